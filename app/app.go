@@ -2,12 +2,18 @@ package app
 
 import (
 	"database/sql"
+	"fmt"
+	"log"
 	"prestasi-mahasiswa/config"
 	"prestasi-mahasiswa/database"
 	"prestasi-mahasiswa/helper"
 	"prestasi-mahasiswa/middleware"
 	"prestasi-mahasiswa/route"
 	"prestasi-mahasiswa/service"
+	"prestasi-mahasiswa/utils"
+	"regexp"
+	"slices"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	swaggerFiles "github.com/swaggo/files"
@@ -29,6 +35,17 @@ type App struct {
 	authUsecase        AuthUsecase
 	achievementUsecase AchievementUsecase
 	fileUsecase        FileUsecase
+
+	// Background jobs
+	jobScheduler *service.JobSchedulerService
+}
+
+// backgroundJob is a job registered with the scheduler, schedules can be overridden with JOB_SCHEDULES
+type backgroundJob struct {
+	name        string
+	description string
+	schedule    string
+	run         service.JobFunc
 }
 
 func NewApp(cfg *config.Config, db *sql.DB, mongodb *database.MongoDB) *App {
@@ -80,28 +97,319 @@ func (a *App) initMiddleware() {
 func (a *App) initRoutes() {
 	// Initialize services with JWT configuration
 	loginService := service.NewLoginService(a.DB, a.Config.JWT.Secret, a.Config.JWT.ExpireHours)
+	loginService.Policy.DelayAfterFailures = a.Config.Login.DelayAfterFailures
+	loginService.Policy.MaxFailedAttempts = a.Config.Login.MaxFailedAttempts
+	loginService.Policy.LockoutDuration = time.Duration(a.Config.Login.LockoutMinutes) * time.Minute
+	loginService.Policy.IPMaxFailedAttempts = a.Config.Login.IPMaxFailedAttempts
+	loginService.Policy.FailureWindow = time.Duration(a.Config.Login.FailureWindowMinutes) * time.Minute
+	loginService.Policy.CaptchaAfterFailures = a.Config.Login.CaptchaAfterFailures
+	loginService.Authenticators = a.buildAuthenticators()
+	loginService.JWTUtil.SetValidation(a.Config.JWT.Issuer, a.Config.JWT.Audience, time.Duration(a.Config.JWT.ClockSkewSeconds)*time.Second)
+	var jwtKeyBox *utils.SecretBox
+	if a.Config.JWT.KeyEncryptionKey != "" {
+		var err error
+		if jwtKeyBox, err = utils.NewSecretBox(a.Config.JWT.KeyEncryptionKey); err != nil {
+			fmt.Printf("Warning: %v, JWT signing keys can't be stored\n", err)
+		}
+	}
+	jwtKeyService := service.NewJWTKeyService(a.DB, jwtKeyBox, a.Config.JWT.SigningAlgorithm, time.Duration(a.Config.JWT.KeyRotationDays)*24*time.Hour)
+	if jwtKeyService.Enabled() {
+		var legacyHS256Switchover time.Time
+		if a.Config.JWT.AcceptLegacyHS256 {
+			switchover, err := jwtKeyService.LegacyHS256Switchover()
+			if err != nil {
+				fmt.Printf("Warning: %v, HS256 tokens are not accepted\n", err)
+			}
+			legacyHS256Switchover = switchover
+		}
+		loginService.JWTUtil.SetKeyProvider(jwtKeyService, legacyHS256Switchover)
+	} else if a.Config.JWT.SigningAlgorithm != utils.JWTAlgorithmHS256 {
+		fmt.Printf("Warning: unsupported JWT_SIGNING_ALG %q, falling back to HS256\n", a.Config.JWT.SigningAlgorithm)
+	}
+	passwordService := service.NewPasswordService(a.DB, service.PasswordPolicy{
+		MinLength:     a.Config.Password.MinLength,
+		RequireUpper:  a.Config.Password.RequireUpper,
+		RequireLower:  a.Config.Password.RequireLower,
+		RequireDigit:  a.Config.Password.RequireDigit,
+		RequireSymbol: a.Config.Password.RequireSymbol,
+		HistorySize:   a.Config.Password.HistorySize,
+	})
+	if a.Config.Password.BreachedListFile != "" {
+		if _, err := passwordService.Policy.LoadBreachedPasswords(a.Config.Password.BreachedListFile); err != nil {
+			fmt.Printf("Warning: %v, breached password check disabled\n", err)
+		}
+	}
 	registerService := service.NewRegisterService(a.DB)
+	registerService.PasswordService = passwordService
+	invitationService := service.NewInvitationService(a.DB)
+	apiKeyService := service.NewAPIKeyService(a.DB)
+	registerService.InvitationService = invitationService
+	registerService.AllowedEmailDomains = a.Config.Registration.AllowedEmailDomains
+	if a.Config.Registration.NIMPattern != "" {
+		// Anchored so the pattern describes the whole NIM
+		nimPattern, err := regexp.Compile("^(?:" + a.Config.Registration.NIMPattern + ")$")
+		if err != nil {
+			fmt.Printf("Warning: invalid REGISTRATION_NIM_PATTERN: %v\n", err)
+		} else {
+			registerService.NIMPattern = nimPattern
+		}
+	}
 	achievementService := service.NewAchievementService(a.DB, a.MongoDB)
 	fileService := service.NewFileService(a.MongoDB)
 	userService := service.NewUserService(a.DB)
+	userService.PasswordService = passwordService
 	refreshTokenService := service.NewRefreshTokenService(a.DB, loginService.JWTUtil)
+	rotationBox, err := utils.NewSecretBox(a.Config.JWT.RefreshRotationEncryptionKey)
+	if err != nil {
+		log.Fatalf("Invalid REFRESH_ROTATION_ENCRYPTION_KEY: %v", err)
+	}
+	refreshTokenService.RotationBox = rotationBox
+	tokenRevocationService := service.NewTokenRevocationService(a.DB)
+	tokenRevocationService.ClockSkew = time.Duration(a.Config.JWT.ClockSkewSeconds) * time.Second
+	loginService.JWTUtil.SetTokenGenerations(tokenRevocationService)
+	impersonationService := service.NewImpersonationService(a.DB, loginService, tokenRevocationService)
+	impersonationService.TokenLifetime = time.Duration(a.Config.JWT.ImpersonationMinutes) * time.Minute
+	permissionService := service.NewPermissionService(a.DB)
+	delegationService := service.NewDelegationService(a.DB, permissionService)
+	notificationService := service.NewNotificationService(a.DB)
+	achievementService.NotificationService = notificationService
+	userService.NotificationService = notificationService
 	reportService := service.NewReportService(a.DB)
+	// LoadConfig already rejects a missing or short key, attestation keys must never be stored in plaintext
+	attestationKeyBox, err := utils.NewSecretBox(a.Config.Certificate.AttestationKeyEncryptionKey)
+	if err != nil {
+		log.Fatalf("Invalid ATTESTATION_KEY_ENCRYPTION_KEY: %v", err)
+	}
+	attestationService := service.NewAttestationService(a.DB, attestationKeyBox, achievementService, fileService, a.Config.Certificate.Institution)
+	achievementService.AttestationService = attestationService
+	badgeService := service.NewBadgeService(a.DB, achievementService, userService, a.Config.Certificate.Institution, a.Config.Certificate.PublicBaseURL)
+	certificateService := service.NewCertificateService(a.DB, achievementService, fileService, a.Config.Certificate.Institution, a.Config.Certificate.PublicBaseURL)
+	mailer, err := utils.NewMailer(a.Config.Mail.Driver, a.Config.Mail.SMTPHost, a.Config.Mail.SMTPPort, a.Config.Mail.SMTPUsername, a.Config.Mail.SMTPPassword, a.Config.Mail.From)
+	if err != nil {
+		fmt.Printf("Warning: %v, emails will only be logged\n", err)
+		mailer = utils.LogMailer{}
+	}
+	verificationSLAService := service.NewVerificationSLAService(a.DB, mailer)
+	verificationSLAService.ReminderAfter = time.Duration(a.Config.Verification.ReminderDays) * 24 * time.Hour
+	verificationSLAService.EscalateAfter = time.Duration(a.Config.Verification.EscalationDays) * 24 * time.Hour
+	verificationSLAService.EscalationRoles = a.Config.Verification.EscalationRoles
+	if verificationSLAService.ReminderAfter > 0 {
+		reportService.DecisionSLA = verificationSLAService.ReminderAfter
+	}
+	sessionService := service.NewSessionService(a.DB, mailer, tokenRevocationService)
+	sessionService.NotifyNewDevices = a.Config.Login.NewDeviceEmail
+	if a.Config.Login.GeoIPDatabaseFile != "" {
+		geoIP, err := utils.LoadGeoIPDatabase(a.Config.Login.GeoIPDatabaseFile)
+		if err != nil {
+			fmt.Printf("Warning: %v, session locations disabled\n", err)
+		} else {
+			sessionService.GeoIP = geoIP
+		}
+	}
+	passwordResetService := service.NewPasswordResetService(a.DB, mailer, refreshTokenService, tokenRevocationService, loginService, a.Config.Mail.PasswordResetURL, time.Duration(a.Config.Mail.PasswordResetTokenMinutes)*time.Minute)
+	passwordResetService.PasswordService = passwordService
+	emailVerificationService := service.NewEmailVerificationService(a.DB, mailer, a.Config.Mail.EmailVerificationURL, time.Duration(a.Config.Mail.EmailVerificationHours)*time.Hour)
+	if a.Config.Mail.EmailVerificationRequired {
+		registerService.EmailVerificationService = emailVerificationService
+	}
+	userService.EmailVerificationService = emailVerificationService
+	// LoadConfig already rejects a missing or short key, two-factor login must never run without one
+	mfaSecretBox, err := utils.NewSecretBox(a.Config.MFA.EncryptionKey)
+	if err != nil {
+		log.Fatalf("Invalid MFA_ENCRYPTION_KEY: %v", err)
+	}
+	mfaService := service.NewMFAService(a.DB, loginService, mfaSecretBox, a.Config.MFA.Issuer, time.Duration(a.Config.MFA.ChallengeMinutes)*time.Minute)
+	mfaService.RequiredRoles = a.Config.MFA.RequiredRoles
+	var oidcProvider *utils.OIDCProvider
+	if a.Config.OIDC.Issuer != "" {
+		oidcProvider = utils.NewOIDCProvider(a.Config.OIDC.Issuer, a.Config.OIDC.ClientID, a.Config.OIDC.ClientSecret, a.Config.OIDC.RedirectURL, a.Config.OIDC.Scopes)
+		oidcProvider.ClockSkew = time.Duration(a.Config.JWT.ClockSkewSeconds) * time.Second
+	}
+	oidcService := service.NewOIDCService(a.DB, oidcProvider, loginService)
+	if a.Config.OIDC.AccountPolicy == service.OIDCAccountPolicyLink || a.Config.OIDC.AccountPolicy == service.OIDCAccountPolicyCreate {
+		oidcService.AccountPolicy = a.Config.OIDC.AccountPolicy
+	} else {
+		fmt.Printf("Warning: unknown OIDC_ACCOUNT_POLICY %q, using %q\n", a.Config.OIDC.AccountPolicy, service.OIDCAccountPolicyLink)
+	}
+	oidcService.MatchBy = nil
+	for _, claim := range a.Config.OIDC.MatchBy {
+		if claim != "email" {
+			fmt.Printf("Warning: OIDC_MATCH_BY %q is ignored, identities are only matched by verified email\n", claim)
+			continue
+		}
+		oidcService.MatchBy = append(oidcService.MatchBy, claim)
+	}
+	oidcService.ClaimMapping = service.OIDCClaimMapping{
+		Email:         a.Config.OIDC.ClaimEmail,
+		EmailVerified: a.Config.OIDC.ClaimEmailVerified,
+		Name:          a.Config.OIDC.ClaimName,
+		NIM:           a.Config.OIDC.ClaimNIM,
+		NIP:           a.Config.OIDC.ClaimNIP,
+	}
+
+	// Background jobs, token cleanup keeps the token tables from growing without bound
+	jobScheduler := service.NewJobSchedulerService(a.DB)
+	if a.Config.Scheduler.PollSeconds > 0 {
+		jobScheduler.PollInterval = time.Duration(a.Config.Scheduler.PollSeconds) * time.Second
+	}
+	jobScheduler.MaxAttempts = a.Config.Scheduler.MaxAttempts
+	jobScheduler.RetryBackoff = time.Duration(a.Config.Scheduler.RetryBackoffSeconds) * time.Second
+	jobs := []backgroundJob{
+		{"refresh-token-cleanup", "Delete expired refresh tokens", "0 * * * *", refreshTokenService.CleanupExpiredTokens},
+		{"revoked-token-cleanup", "Delete revocations of expired access tokens", "10 * * * *", tokenRevocationService.CleanupExpiredRevocations},
+		{"password-reset-token-cleanup", "Delete used and expired password reset tokens", "20 3 * * *", passwordResetService.CleanupExpiredResetTokens},
+		{"email-verification-token-cleanup", "Delete expired email verification tokens", "25 3 * * *", emailVerificationService.CleanupExpiredVerificationTokens},
+		{"mfa-challenge-cleanup", "Delete expired two-factor login challenges", "30 3 * * *", mfaService.CleanupExpiredChallenges},
+		{"oidc-login-state-cleanup", "Delete expired single sign-on login states", "35 3 * * *", oidcService.CleanupExpiredLoginStates},
+		{"job-run-cleanup", "Delete job run history older than 30 days", "40 3 * * *", jobScheduler.CleanupJobRuns},
+		{"notification-cleanup", "Delete read notifications older than 90 days", "45 3 * * *", notificationService.CleanupReadNotifications},
+		{"verification-code-backfill", "Issue verification codes to achievements verified before codes existed", "50 * * * *", achievementService.BackfillVerificationCodes},
+	}
+	if a.Config.Verification.SLAEnabled {
+		jobs = append(jobs, backgroundJob{"verification-sla", "Remind verifiers of overdue approval steps and escalate them", "5 * * * *", func() error {
+			_, _, err := verificationSLAService.CheckOverdue()
+			return err
+		}})
+	}
+	a.registerJobs(jobScheduler, jobs)
+	a.jobScheduler = jobScheduler
 
 	// Initialize helpers
 	healthHelper := helper.NewHealthHelper(a.DB, a.MongoDB)
-	authHelper := helper.NewAuthHelper(loginService, registerService, refreshTokenService)
-	achievementHelper := helper.NewAchievementHelper(achievementService, fileService)
+	authHelper := helper.NewAuthHelper(loginService, registerService, refreshTokenService, tokenRevocationService, passwordResetService, passwordService, emailVerificationService, mfaService, sessionService)
+	achievementHelper := helper.NewAchievementHelper(achievementService, fileService, certificateService)
 	userHelper := helper.NewUserHelper()
-	adminUserHelper := helper.NewAdminUserHelper(userService)
+	adminUserHelper := helper.NewAdminUserHelper(userService, loginService, refreshTokenService, tokenRevocationService, mfaService)
 	studentHelper := helper.NewStudentHelper(userService, achievementService)
 	lecturerHelper := helper.NewLecturerHelper(userService)
 	reportHelper := helper.NewReportHelper(reportService)
+	verificationHelper := helper.NewVerificationHelper(certificateService)
+	verifyRateLimiter := middleware.NewRateLimiter(a.Config.Certificate.VerifyRateLimit, time.Minute)
+	attestationHelper := helper.NewAttestationHelper(attestationService, achievementService)
+	badgeHelper := helper.NewBadgeHelper(badgeService, achievementService)
+	jwtKeyHelper := helper.NewJWTKeyHelper(jwtKeyService)
+	invitationHelper := helper.NewInvitationHelper(invitationService)
+	apiKeyHelper := helper.NewAPIKeyHelper(apiKeyService)
+	impersonationHelper := helper.NewImpersonationHelper(impersonationService)
+	roleHelper := helper.NewRoleHelper(permissionService)
+	approvalHelper := helper.NewApprovalHelper(achievementService.ApprovalService)
+	delegationHelper := helper.NewDelegationHelper(delegationService)
+	jobHelper := helper.NewJobHelper(jobScheduler)
+	notificationHelper := helper.NewNotificationHelper(notificationService)
+	oidcHelper := helper.NewOIDCHelper(oidcService, authHelper)
 
-	// Setup all routes using separate route files with JWT secret
-	route.SetupRoutes(a.Router, a.Config.JWT.Secret, healthHelper, authHelper, achievementHelper, userHelper, adminUserHelper, studentHelper, lecturerHelper, reportHelper)
+	// Setup all routes using separate route files, the middleware verifies tokens with the same JWTUtil that issues them
+	route.SetupRoutes(a.Router, loginService.JWTUtil, tokenRevocationService, permissionService, apiKeyService, impersonationService, healthHelper, authHelper, achievementHelper, userHelper, adminUserHelper, studentHelper, lecturerHelper, reportHelper, verificationHelper, verifyRateLimiter, attestationHelper, badgeHelper, jwtKeyHelper, invitationHelper, oidcHelper, apiKeyHelper, impersonationHelper, roleHelper, approvalHelper, delegationHelper, jobHelper, notificationHelper)
 }
 
 func (a *App) Run() error {
+	if a.Config.Scheduler.Enabled {
+		// Runs for the life of the process, replicas share the jobs through leases in scheduled_jobs
+		if err := a.jobScheduler.Start(nil); err != nil {
+			fmt.Printf("Warning: %v, background jobs disabled\n", err)
+		}
+	}
+
 	address := ":" + a.Config.Server.Port
 	return a.Router.Run(address)
 }
+
+// registerJobs registers jobs with their JOB_SCHEDULES schedule if one is set. A job that
+// fails to register is left out, the others still run.
+func (a *App) registerJobs(scheduler *service.JobSchedulerService, jobs []backgroundJob) {
+	schedules, err := service.ParseJobSchedules(a.Config.Scheduler.JobSchedules)
+	if err != nil {
+		fmt.Printf("Warning: invalid JOB_SCHEDULES: %v, using default schedules\n", err)
+		schedules = nil
+	}
+
+	for _, job := range jobs {
+		schedule := job.schedule
+		if override, ok := schedules[job.name]; ok {
+			schedule = override
+			delete(schedules, job.name)
+		}
+		if err := scheduler.Register(job.name, job.description, schedule, job.run); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+	}
+	for name := range schedules {
+		fmt.Printf("Warning: JOB_SCHEDULES names unknown job %q\n", name)
+	}
+}
+
+// buildAuthenticators returns the password backends in AUTH_BACKENDS order, local only when none is usable
+func (a *App) buildAuthenticators() []service.Authenticator {
+	var authenticators []service.Authenticator
+	for _, name := range a.Config.LDAP.Backends {
+		switch name {
+		case service.AuthenticatorLocal:
+			authenticators = append(authenticators, service.NewLocalAuthenticator(a.DB))
+		case service.AuthenticatorLDAP:
+			if a.Config.LDAP.URL == "" {
+				fmt.Println("Warning: AUTH_BACKENDS includes ldap but LDAP_URL is not set, skipping")
+				continue
+			}
+			authenticators = append(authenticators, a.buildLDAPAuthenticator())
+		default:
+			fmt.Printf("Warning: unknown authentication backend %q, skipping\n", name)
+		}
+	}
+
+	if len(authenticators) == 0 {
+		return []service.Authenticator{service.NewLocalAuthenticator(a.DB)}
+	}
+
+	// Directory accounts must not fall back to a local password, the directory decides
+	var directoryIssuers []string
+	for _, authenticator := range authenticators {
+		if ldapAuthenticator, ok := authenticator.(*service.LDAPAuthenticator); ok {
+			directoryIssuers = append(directoryIssuers, ldapAuthenticator.Issuer)
+		}
+	}
+	for _, authenticator := range authenticators {
+		if localAuthenticator, ok := authenticator.(*service.LocalAuthenticator); ok {
+			localAuthenticator.DirectoryIssuers = directoryIssuers
+		}
+	}
+	return authenticators
+}
+
+func (a *App) buildLDAPAuthenticator() *service.LDAPAuthenticator {
+	cfg := a.Config.LDAP
+
+	client := utils.NewLDAPClient(cfg.URL, cfg.BindDN, cfg.BindPassword, cfg.BaseDN, cfg.UserFilter)
+	client.StartTLS = cfg.StartTLS
+	client.Timeout = time.Duration(cfg.TimeoutSeconds) * time.Second
+
+	authenticator := service.NewLDAPAuthenticator(a.DB, client)
+	authenticator.AttributeMapping = service.LDAPAttributeMapping{
+		Email: cfg.AttrEmail,
+		Name:  cfg.AttrName,
+		NIM:   cfg.AttrNIM,
+		NIP:   cfg.AttrNIP,
+	}
+	// Rules may name roles created at /admin/roles
+	knownRoles, err := service.NewPermissionService(a.DB).RoleNames()
+	if err != nil || len(knownRoles) == 0 {
+		fmt.Printf("Warning: failed to load roles (%v), LDAP role mapping limited to the default roles\n", err)
+		knownRoles = service.DefaultRoleNames
+	}
+
+	if cfg.DefaultRole == "" || slices.Contains(knownRoles, cfg.DefaultRole) {
+		authenticator.DefaultRole = cfg.DefaultRole
+	} else {
+		fmt.Printf("Warning: unknown LDAP_DEFAULT_ROLE %q, users without a mapped role are not provisioned\n", cfg.DefaultRole)
+	}
+	authenticator.Provision = cfg.ProvisionUsers
+	authenticator.SyncRoles = cfg.SyncRoles
+
+	rules, err := service.ParseLDAPRoleRules(cfg.RoleMapping, knownRoles...)
+	if err != nil {
+		fmt.Printf("Warning: %v, LDAP role mapping disabled\n", err)
+	}
+	authenticator.RoleRules = rules
+	client.Attributes = authenticator.RequestedAttributes()
+
+	return authenticator
+}
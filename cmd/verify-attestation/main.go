@@ -0,0 +1,150 @@
+// Command verify-attestation checks a signed achievement attestation offline.
+//
+// Usage:
+//
+//	verify-attestation -keys attestation-keys.json -attestation attestation.jws [-file sertifikat.pdf ...]
+//
+// The key set can be a local file or the URL of /.well-known/attestation-keys.json.
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"prestasi-mahasiswa/utils"
+)
+
+type fileList []string
+
+func (f *fileList) String() string     { return strings.Join(*f, ",") }
+func (f *fileList) Set(v string) error { *f = append(*f, v); return nil }
+
+type attestationPayload struct {
+	Achievement struct {
+		ID               string `json:"id"`
+		Title            string `json:"title"`
+		StudentName      string `json:"student_name"`
+		VerificationCode string `json:"verification_code"`
+		VerifiedAt       string `json:"verified_at"`
+	} `json:"achievement"`
+	Files []struct {
+		FileID   string `json:"file_id"`
+		Filename string `json:"filename"`
+		SHA256   string `json:"sha256"`
+	} `json:"files"`
+	IssuedAt string `json:"issued_at"`
+	Issuer   string `json:"issuer"`
+}
+
+func main() {
+	keysSource := flag.String("keys", "", "path or URL of attestation key set (JWK set)")
+	attestationSource := flag.String("attestation", "", "path of JWS attestation file, - for stdin")
+	var files fileList
+	flag.Var(&files, "file", "local evidence file to check against attested hashes (repeatable)")
+	flag.Parse()
+
+	if *keysSource == "" || *attestationSource == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	keyData, err := readSource(*keysSource)
+	if err != nil {
+		fail("failed to read key set: %v", err)
+	}
+
+	keys, err := utils.ParseAttestationKeySet(keyData)
+	if err != nil {
+		fail("%v", err)
+	}
+
+	jws, err := readSource(*attestationSource)
+	if err != nil {
+		fail("failed to read attestation: %v", err)
+	}
+
+	payloadJSON, kid, err := utils.VerifyAttestation(string(jws), keys)
+	if err != nil {
+		fail("INVALID: %v", err)
+	}
+
+	var payload attestationPayload
+	if err := json.Unmarshal(payloadJSON, &payload); err != nil {
+		fail("INVALID: malformed payload: %v", err)
+	}
+
+	fmt.Println("VALID signature")
+	fmt.Printf("  Key ID:            %s\n", kid)
+	fmt.Printf("  Issuer:            %s\n", payload.Issuer)
+	fmt.Printf("  Issued at:         %s\n", payload.IssuedAt)
+	fmt.Printf("  Student:           %s\n", payload.Achievement.StudentName)
+	fmt.Printf("  Achievement:       %s\n", payload.Achievement.Title)
+	fmt.Printf("  Verified at:       %s\n", payload.Achievement.VerifiedAt)
+	fmt.Printf("  Verification code: %s\n", payload.Achievement.VerificationCode)
+
+	// Compare local evidence files with attested hashes
+	mismatch := false
+	for _, path := range files {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			fail("failed to read %s: %v", path, err)
+		}
+
+		hash := sha256.Sum256(content)
+		digest := hex.EncodeToString(hash[:])
+
+		matched := ""
+		for _, attested := range payload.Files {
+			if attested.SHA256 == digest {
+				matched = attested.Filename
+				break
+			}
+		}
+
+		if matched == "" {
+			mismatch = true
+			fmt.Printf("  File %s: NOT ATTESTED (sha256 %s)\n", path, digest)
+		} else {
+			fmt.Printf("  File %s: matches attested file %s\n", path, matched)
+		}
+	}
+
+	if mismatch {
+		os.Exit(1)
+	}
+}
+
+func readSource(source string) ([]byte, error) {
+	if source == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+
+	if strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://") {
+		client := &http.Client{Timeout: 10 * time.Second}
+		resp, err := client.Get(source)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("unexpected status %s", resp.Status)
+		}
+		return io.ReadAll(resp.Body)
+	}
+
+	return os.ReadFile(source)
+}
+
+func fail(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
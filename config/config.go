@@ -1,6 +1,8 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"os"
 	"strconv"
 	"strings"
@@ -8,13 +10,26 @@ import (
 	"github.com/joho/godotenv"
 )
 
+// MinEncryptionKeyLength is the shortest key accepted for encrypting secrets stored in the database
+const MinEncryptionKeyLength = 32
+
 type Config struct {
-	Server   ServerConfig
-	Database DatabaseConfig
-	MongoDB  MongoDBConfig
-	JWT      JWTConfig
-	Upload   UploadConfig
-	CORS     CORSConfig
+	Server       ServerConfig
+	Database     DatabaseConfig
+	MongoDB      MongoDBConfig
+	JWT          JWTConfig
+	Upload       UploadConfig
+	CORS         CORSConfig
+	Certificate  CertificateConfig
+	Login        LoginConfig
+	Mail         MailConfig
+	Password     PasswordConfig
+	Registration RegistrationConfig
+	MFA          MFAConfig
+	OIDC         OIDCConfig
+	LDAP         LDAPConfig
+	Verification VerificationConfig
+	Scheduler    SchedulerConfig
 }
 
 type ServerConfig struct {
@@ -38,8 +53,19 @@ type MongoDBConfig struct {
 }
 
 type JWTConfig struct {
-	Secret      string
-	ExpireHours int
+	Secret            string
+	ExpireHours       int
+	SigningAlgorithm  string // HS256, RS256 or EdDSA
+	KeyRotationDays   int
+	AcceptLegacyHS256 bool   // accept HS256 tokens issued before the switch, for one access token lifetime
+	KeyEncryptionKey  string // encrypts private signing keys stored in the database
+	Issuer            string
+	Audience          string
+	ClockSkewSeconds  int
+	// Lifetime of admin "login as" tokens, capped at 15 minutes
+	ImpersonationMinutes int
+	// RefreshRotationEncryptionKey encrypts tokens kept for concurrent refreshes, required and separate from JWT_SECRET
+	RefreshRotationEncryptionKey string
 }
 
 type UploadConfig struct {
@@ -52,6 +78,121 @@ type CORSConfig struct {
 	AllowedOrigins []string
 }
 
+type CertificateConfig struct {
+	Institution     string
+	PublicBaseURL   string
+	VerifyRateLimit int // public verification requests per minute per client IP, 0 disables the limit
+
+	// AttestationKeyEncryptionKey encrypts private attestation signing keys, required and separate from JWT_SECRET
+	AttestationKeyEncryptionKey string
+}
+
+// LoginConfig controls login throttling and account lockout
+type LoginConfig struct {
+	DelayAfterFailures   int
+	MaxFailedAttempts    int
+	LockoutMinutes       int
+	IPMaxFailedAttempts  int
+	FailureWindowMinutes int
+	CaptchaAfterFailures int
+	GeoIPDatabaseFile    string // DB-IP Lite CSV used for session locations, empty disables them
+	NewDeviceEmail       bool
+}
+
+// MailConfig selects the mail driver, log prints emails and smtp sends them
+type MailConfig struct {
+	Driver                    string
+	SMTPHost                  string
+	SMTPPort                  string
+	SMTPUsername              string
+	SMTPPassword              string
+	From                      string
+	PasswordResetURL          string
+	PasswordResetTokenMinutes int
+	EmailVerificationRequired bool
+	EmailVerificationURL      string
+	EmailVerificationHours    int
+}
+
+// PasswordConfig is the password policy applied on register, admin create/update, change and reset
+type PasswordConfig struct {
+	MinLength        int
+	RequireUpper     bool
+	RequireLower     bool
+	RequireDigit     bool
+	RequireSymbol    bool
+	HistorySize      int
+	BreachedListFile string
+}
+
+// RegistrationConfig restricts public self-registration, which is only open to mahasiswa
+type RegistrationConfig struct {
+	AllowedEmailDomains []string // empty allows any domain
+	NIMPattern          string   // regular expression, empty accepts any NIM
+}
+
+// MFAConfig controls TOTP two-factor authentication
+type MFAConfig struct {
+	RequiredRoles    []string // roles that must use two-factor authentication
+	Issuer           string   // name shown in authenticator apps
+	ChallengeMinutes int      // lifetime of the mfa_token returned by login
+	EncryptionKey    string   // encrypts TOTP secrets, required and separate from JWT_SECRET
+}
+
+// OIDCConfig configures single sign-on with the university identity provider, disabled when Issuer is empty
+type OIDCConfig struct {
+	Issuer             string
+	ClientID           string
+	ClientSecret       string
+	RedirectURL        string
+	Scopes             []string
+	AccountPolicy      string   // link or create
+	MatchBy            []string // "email" links new identities to the account with their verified email, empty disables it
+	ClaimEmail         string
+	ClaimEmailVerified string
+	ClaimName          string
+	ClaimNIM           string
+	ClaimNIP           string
+}
+
+// LDAPConfig configures password logins against an LDAP or Active Directory server
+type LDAPConfig struct {
+	Backends       []string // authenticators tried in order: local, ldap
+	URL            string
+	BindDN         string
+	BindPassword   string
+	BaseDN         string
+	UserFilter     string
+	StartTLS       bool
+	TimeoutSeconds int
+	AttrEmail      string
+	AttrName       string
+	AttrNIM        string
+	AttrNIP        string
+	RoleMapping    string // attribute=value:role rules separated by semicolons
+	DefaultRole    string
+	ProvisionUsers bool
+	SyncRoles      bool
+}
+
+// VerificationConfig sets the time a verifier has to decide an approval step before being
+// reminded, and before the step is escalated
+type VerificationConfig struct {
+	SLAEnabled      bool
+	ReminderDays    int
+	EscalationDays  int
+	EscalationRoles []string // roles emailed on escalation
+}
+
+// SchedulerConfig controls the background job scheduler, job schedules default to the ones set in code
+type SchedulerConfig struct {
+	Enabled             bool
+	PollSeconds         int
+	MaxAttempts         int
+	RetryBackoffSeconds int
+	JobSchedules        string // name=cron pairs separated by semicolons
+}
+
 func LoadConfig() (*Config, error) {
 	err := godotenv.Load()
 	if err != nil {
@@ -59,6 +200,40 @@ func LoadConfig() (*Config, error) {
 
 	maxFileSize, _ := strconv.ParseInt(getEnv("MAX_FILE_SIZE", "5242880"), 10, 64)
 	expireHours, _ := strconv.Atoi(getEnv("JWT_EXPIRE_HOURS", "24"))
+	keyRotationDays, _ := strconv.Atoi(getEnv("JWT_KEY_ROTATION_DAYS", "30"))
+	acceptLegacyHS256, _ := strconv.ParseBool(getEnv("JWT_ACCEPT_LEGACY_HS256", "false"))
+	clockSkewSeconds, _ := strconv.Atoi(getEnv("JWT_CLOCK_SKEW_SECONDS", "30"))
+	impersonationMinutes, _ := strconv.Atoi(getEnv("IMPERSONATION_TOKEN_MINUTES", "10"))
+	loginDelayAfter, _ := strconv.Atoi(getEnv("LOGIN_DELAY_AFTER_FAILURES", "3"))
+	loginMaxFailed, _ := strconv.Atoi(getEnv("LOGIN_MAX_FAILED_ATTEMPTS", "10"))
+	loginLockoutMinutes, _ := strconv.Atoi(getEnv("LOGIN_LOCKOUT_MINUTES", "15"))
+	loginIPMaxFailed, _ := strconv.Atoi(getEnv("LOGIN_IP_MAX_FAILED_ATTEMPTS", "50"))
+	loginFailureWindow, _ := strconv.Atoi(getEnv("LOGIN_FAILURE_WINDOW_MINUTES", "60"))
+	loginCaptchaAfter, _ := strconv.Atoi(getEnv("LOGIN_CAPTCHA_AFTER_FAILURES", "3"))
+	loginNewDeviceEmail, _ := strconv.ParseBool(getEnv("LOGIN_NEW_DEVICE_EMAIL", "true"))
+	passwordResetTokenMinutes, _ := strconv.Atoi(getEnv("PASSWORD_RESET_TOKEN_MINUTES", "60"))
+	passwordMinLength, _ := strconv.Atoi(getEnv("PASSWORD_MIN_LENGTH", "8"))
+	passwordRequireUpper, _ := strconv.ParseBool(getEnv("PASSWORD_REQUIRE_UPPER", "true"))
+	passwordRequireLower, _ := strconv.ParseBool(getEnv("PASSWORD_REQUIRE_LOWER", "true"))
+	passwordRequireDigit, _ := strconv.ParseBool(getEnv("PASSWORD_REQUIRE_DIGIT", "true"))
+	passwordRequireSymbol, _ := strconv.ParseBool(getEnv("PASSWORD_REQUIRE_SYMBOL", "false"))
+	passwordHistorySize, _ := strconv.Atoi(getEnv("PASSWORD_HISTORY_SIZE", "5"))
+	emailVerificationRequired, _ := strconv.ParseBool(getEnv("EMAIL_VERIFICATION_REQUIRED", "true"))
+	emailVerificationHours, _ := strconv.Atoi(getEnv("EMAIL_VERIFICATION_TOKEN_HOURS", "24"))
+	mfaChallengeMinutes, _ := strconv.Atoi(getEnv("MFA_CHALLENGE_MINUTES", "5"))
+	ldapStartTLS, _ := strconv.ParseBool(getEnv("LDAP_START_TLS", "false"))
+	ldapTimeoutSeconds, _ := strconv.Atoi(getEnv("LDAP_TIMEOUT_SECONDS", "5"))
+	ldapProvisionUsers, _ := strconv.ParseBool(getEnv("LDAP_PROVISION_USERS", "false"))
+	ldapSyncRoles, _ := strconv.ParseBool(getEnv("LDAP_SYNC_ROLES", "false"))
+	verificationSLAEnabled, _ := strconv.ParseBool(getEnv("VERIFICATION_SLA_ENABLED", "true"))
+	verificationReminderDays, _ := strconv.Atoi(getEnv("VERIFICATION_REMINDER_DAYS", "3"))
+	verificationEscalationDays, _ := strconv.Atoi(getEnv("VERIFICATION_ESCALATION_DAYS", "7"))
+	schedulerEnabled, _ := strconv.ParseBool(getEnv("SCHEDULER_ENABLED", "true"))
+	schedulerPollSeconds, _ := strconv.Atoi(getEnv("SCHEDULER_POLL_SECONDS", "30"))
+	schedulerMaxAttempts, _ := strconv.Atoi(getEnv("SCHEDULER_MAX_ATTEMPTS", "3"))
+	schedulerRetryBackoffSeconds, _ := strconv.Atoi(getEnv("SCHEDULER_RETRY_BACKOFF_SECONDS", "60"))
+	publicBaseURL := strings.TrimRight(getEnv("PUBLIC_BASE_URL", "http://localhost:8080"), "/")
+	verifyRateLimit, _ := strconv.Atoi(getEnv("VERIFY_RATE_LIMIT", "60"))
 
 	config := &Config{
 		Server: ServerConfig{
@@ -79,8 +254,17 @@ func LoadConfig() (*Config, error) {
 			Database: getEnv("MONGO_DATABASE", "prestasi_files"),
 		},
 		JWT: JWTConfig{
-			Secret:      getEnv("JWT_SECRET", "your_super_secret_jwt_key_change_this_in_production"),
-			ExpireHours: expireHours,
+			Secret:                       getEnv("JWT_SECRET", "your_super_secret_jwt_key_change_this_in_production"),
+			ExpireHours:                  expireHours,
+			SigningAlgorithm:             getEnv("JWT_SIGNING_ALG", "HS256"),
+			KeyRotationDays:              keyRotationDays,
+			AcceptLegacyHS256:            acceptLegacyHS256,
+			KeyEncryptionKey:             getEnv("JWT_KEY_ENCRYPTION_KEY", ""),
+			RefreshRotationEncryptionKey: getEnv("REFRESH_ROTATION_ENCRYPTION_KEY", ""),
+			Issuer:                       getEnv("JWT_ISSUER", "prestasi-mahasiswa-api"),
+			Audience:                     getEnv("JWT_AUDIENCE", "prestasi-mahasiswa-api"),
+			ClockSkewSeconds:             clockSkewSeconds,
+			ImpersonationMinutes:         impersonationMinutes,
 		},
 		Upload: UploadConfig{
 			MaxFileSize:       maxFileSize,
@@ -90,11 +274,145 @@ func LoadConfig() (*Config, error) {
 		CORS: CORSConfig{
 			AllowedOrigins: strings.Split(getEnv("ALLOWED_ORIGINS", "http://localhost:3000,http://localhost:8080"), ","),
 		},
+		Certificate: CertificateConfig{
+			Institution:     getEnv("INSTITUTION_NAME", "Sistem Pelaporan Prestasi Mahasiswa"),
+			PublicBaseURL:   publicBaseURL,
+			VerifyRateLimit: verifyRateLimit,
+
+			AttestationKeyEncryptionKey: getEnv("ATTESTATION_KEY_ENCRYPTION_KEY", ""),
+		},
+		Login: LoginConfig{
+			DelayAfterFailures:   loginDelayAfter,
+			MaxFailedAttempts:    loginMaxFailed,
+			LockoutMinutes:       loginLockoutMinutes,
+			IPMaxFailedAttempts:  loginIPMaxFailed,
+			FailureWindowMinutes: loginFailureWindow,
+			CaptchaAfterFailures: loginCaptchaAfter,
+			GeoIPDatabaseFile:    getEnv("GEOIP_DATABASE_FILE", ""),
+			NewDeviceEmail:       loginNewDeviceEmail,
+		},
+		Mail: MailConfig{
+			Driver:                    getEnv("MAIL_DRIVER", "log"),
+			SMTPHost:                  getEnv("SMTP_HOST", "localhost"),
+			SMTPPort:                  getEnv("SMTP_PORT", "587"),
+			SMTPUsername:              getEnv("SMTP_USERNAME", ""),
+			SMTPPassword:              getEnv("SMTP_PASSWORD", ""),
+			From:                      getEnv("MAIL_FROM", "noreply@prestasi-mahasiswa.local"),
+			PasswordResetURL:          getEnv("PASSWORD_RESET_URL", publicBaseURL+"/reset-password"),
+			PasswordResetTokenMinutes: passwordResetTokenMinutes,
+			EmailVerificationRequired: emailVerificationRequired,
+			EmailVerificationURL:      getEnv("EMAIL_VERIFICATION_URL", publicBaseURL+"/api/v1/auth/verify-email"),
+			EmailVerificationHours:    emailVerificationHours,
+		},
+		Registration: RegistrationConfig{
+			AllowedEmailDomains: splitList(getEnv("REGISTRATION_ALLOWED_EMAIL_DOMAINS", "")),
+			NIMPattern:          getEnv("REGISTRATION_NIM_PATTERN", ""),
+		},
+		Password: PasswordConfig{
+			MinLength:        passwordMinLength,
+			RequireUpper:     passwordRequireUpper,
+			RequireLower:     passwordRequireLower,
+			RequireDigit:     passwordRequireDigit,
+			RequireSymbol:    passwordRequireSymbol,
+			HistorySize:      passwordHistorySize,
+			BreachedListFile: getEnv("PASSWORD_BREACHED_LIST_FILE", "./config/breached_passwords.txt"),
+		},
+		LDAP: LDAPConfig{
+			Backends:       splitList(getEnv("AUTH_BACKENDS", "local")),
+			URL:            getEnv("LDAP_URL", ""),
+			BindDN:         getEnv("LDAP_BIND_DN", ""),
+			BindPassword:   getEnv("LDAP_BIND_PASSWORD", ""),
+			BaseDN:         getEnv("LDAP_BASE_DN", ""),
+			UserFilter:     getEnv("LDAP_USER_FILTER", "(&(objectClass=person)(mail={login}))"),
+			StartTLS:       ldapStartTLS,
+			TimeoutSeconds: ldapTimeoutSeconds,
+			AttrEmail:      getEnv("LDAP_ATTR_EMAIL", "mail"),
+			AttrName:       getEnv("LDAP_ATTR_NAME", "cn"),
+			AttrNIM:        getEnv("LDAP_ATTR_NIM", ""),
+			AttrNIP:        getEnv("LDAP_ATTR_NIP", ""),
+			RoleMapping:    getEnv("LDAP_ROLE_MAPPING", ""),
+			DefaultRole:    getEnv("LDAP_DEFAULT_ROLE", ""),
+			ProvisionUsers: ldapProvisionUsers,
+			SyncRoles:      ldapSyncRoles,
+		},
+		OIDC: OIDCConfig{
+			Issuer:             getEnv("OIDC_ISSUER", ""),
+			ClientID:           getEnv("OIDC_CLIENT_ID", ""),
+			ClientSecret:       getEnv("OIDC_CLIENT_SECRET", ""),
+			RedirectURL:        getEnv("OIDC_REDIRECT_URL", publicBaseURL+"/api/v1/auth/oidc/callback"),
+			Scopes:             splitList(getEnv("OIDC_SCOPES", "openid,email,profile")),
+			AccountPolicy:      getEnv("OIDC_ACCOUNT_POLICY", "link"),
+			MatchBy:            splitList(getEnv("OIDC_MATCH_BY", "email")),
+			ClaimEmail:         getEnv("OIDC_CLAIM_EMAIL", "email"),
+			ClaimEmailVerified: getEnv("OIDC_CLAIM_EMAIL_VERIFIED", "email_verified"),
+			ClaimName:          getEnv("OIDC_CLAIM_NAME", "name"),
+			ClaimNIM:           getEnv("OIDC_CLAIM_NIM", "nim"),
+			ClaimNIP:           getEnv("OIDC_CLAIM_NIP", "nip"),
+		},
+		Verification: VerificationConfig{
+			SLAEnabled:      verificationSLAEnabled,
+			ReminderDays:    verificationReminderDays,
+			EscalationDays:  verificationEscalationDays,
+			EscalationRoles: splitList(getEnv("VERIFICATION_ESCALATION_ROLES", "kaprodi,admin")),
+		},
+		Scheduler: SchedulerConfig{
+			Enabled:             schedulerEnabled,
+			PollSeconds:         schedulerPollSeconds,
+			MaxAttempts:         schedulerMaxAttempts,
+			RetryBackoffSeconds: schedulerRetryBackoffSeconds,
+			JobSchedules:        getEnv("JOB_SCHEDULES", ""),
+		},
+		MFA: MFAConfig{
+			RequiredRoles:    splitList(getEnv("MFA_REQUIRED_ROLES", "")),
+			Issuer:           getEnv("MFA_ISSUER", "Prestasi Mahasiswa"),
+			ChallengeMinutes: mfaChallengeMinutes,
+			EncryptionKey:    getEnv("MFA_ENCRYPTION_KEY", ""),
+		},
+	}
+
+	// Two-factor authentication is always available, its secrets must never be stored with a guessable key
+	if len(config.MFA.EncryptionKey) < MinEncryptionKeyLength {
+		return nil, fmt.Errorf("MFA_ENCRYPTION_KEY must be at least %d characters", MinEncryptionKeyLength)
+	}
+	if config.MFA.EncryptionKey == config.JWT.Secret {
+		return nil, errors.New("MFA_ENCRYPTION_KEY must be different from JWT_SECRET")
+	}
+
+	// Token pairs kept for concurrent refreshes are live credentials, never sealed with a key derived from JWT_SECRET
+	if len(config.JWT.RefreshRotationEncryptionKey) < MinEncryptionKeyLength {
+		return nil, fmt.Errorf("REFRESH_ROTATION_ENCRYPTION_KEY must be at least %d characters", MinEncryptionKeyLength)
+	}
+	if config.JWT.RefreshRotationEncryptionKey == config.JWT.Secret {
+		return nil, errors.New("REFRESH_ROTATION_ENCRYPTION_KEY must be different from JWT_SECRET")
+	}
+
+	// Attestations can always be issued, their signing keys must never be stored with a guessable key
+	if len(config.Certificate.AttestationKeyEncryptionKey) < MinEncryptionKeyLength {
+		return nil, fmt.Errorf("ATTESTATION_KEY_ENCRYPTION_KEY must be at least %d characters", MinEncryptionKeyLength)
+	}
+	if config.Certificate.AttestationKeyEncryptionKey == config.JWT.Secret {
+		return nil, errors.New("ATTESTATION_KEY_ENCRYPTION_KEY must be different from JWT_SECRET")
+	}
+
+	signingAlgorithm := config.JWT.SigningAlgorithm
+	if (signingAlgorithm == "RS256" || signingAlgorithm == "EdDSA") && len(config.JWT.KeyEncryptionKey) < MinEncryptionKeyLength {
+		return nil, fmt.Errorf("JWT_KEY_ENCRYPTION_KEY must be at least %d characters when JWT_SIGNING_ALG is %s", MinEncryptionKeyLength, signingAlgorithm)
 	}
 
 	return config, nil
 }
 
+// splitList splits a comma separated value, ignoring empty items
+func splitList(value string) []string {
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
 func getEnv(key, defaultValue string) string {
 	if value := os.Getenv(key); value != "" {
 		return value
@@ -0,0 +1,5 @@
+-- Add verification_code column used on stamped certificate copies
+ALTER TABLE achievements ADD COLUMN IF NOT EXISTS verification_code VARCHAR(32) UNIQUE;
+
+-- The UNIQUE constraint already indexes verification_code, drop the duplicate index earlier runs created
+DROP INDEX IF EXISTS idx_achievements_verification_code;
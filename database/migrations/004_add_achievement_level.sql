@@ -0,0 +1,6 @@
+-- Add level column to achievements table (lokal, regional, nasional, internasional)
+ALTER TABLE achievements ADD COLUMN IF NOT EXISTS level VARCHAR(50)
+    CHECK (level IN ('lokal', 'regional', 'nasional', 'internasional'));
+
+-- Add index for level
+CREATE INDEX IF NOT EXISTS idx_achievements_level ON achievements(level);
@@ -0,0 +1,25 @@
+-- Create attestation_keys table (Ed25519 signing keys, private key is wiped on rotation)
+CREATE TABLE IF NOT EXISTS attestation_keys (
+    kid VARCHAR(64) PRIMARY KEY,
+    algorithm VARCHAR(20) NOT NULL DEFAULT 'EdDSA',
+    public_key TEXT NOT NULL,
+    private_key TEXT,
+    status VARCHAR(20) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'retired')),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    retired_at TIMESTAMP
+);
+
+-- Only one active signing key at a time
+CREATE UNIQUE INDEX IF NOT EXISTS idx_attestation_keys_active ON attestation_keys(status) WHERE status = 'active';
+
+-- Create achievement_attestations table
+CREATE TABLE IF NOT EXISTS achievement_attestations (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    achievement_id UUID NOT NULL REFERENCES achievements(id) ON DELETE CASCADE,
+    kid VARCHAR(64) NOT NULL REFERENCES attestation_keys(kid),
+    payload TEXT NOT NULL,
+    jws TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_achievement_attestations_achievement_id ON achievement_attestations(achievement_id);
@@ -0,0 +1,21 @@
+-- Denylist of revoked access tokens, rows are kept until the token would expire anyway
+CREATE TABLE IF NOT EXISTS revoked_access_tokens (
+    jti VARCHAR(64) PRIMARY KEY,
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    reason VARCHAR(50),
+    expires_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_revoked_access_tokens_expires_at ON revoked_access_tokens(expires_at);
+CREATE INDEX IF NOT EXISTS idx_revoked_access_tokens_revoked_at ON revoked_access_tokens(revoked_at);
+
+-- Access tokens issued before invalid_before are rejected (logout all, deactivation, role change)
+CREATE TABLE IF NOT EXISTS user_token_invalidations (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    invalid_before TIMESTAMPTZ NOT NULL,
+    reason VARCHAR(50),
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_token_invalidations_updated_at ON user_token_invalidations(updated_at);
@@ -0,0 +1,13 @@
+-- Create jwt_signing_keys table (RS256/EdDSA token signing keys, private key is wiped on rotation)
+CREATE TABLE IF NOT EXISTS jwt_signing_keys (
+    kid VARCHAR(64) PRIMARY KEY,
+    algorithm VARCHAR(20) NOT NULL CHECK (algorithm IN ('RS256', 'EdDSA')),
+    public_key TEXT NOT NULL,
+    private_key TEXT,
+    status VARCHAR(20) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'retired')),
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    retired_at TIMESTAMPTZ
+);
+
+-- Only one active signing key at a time
+CREATE UNIQUE INDEX IF NOT EXISTS idx_jwt_signing_keys_active ON jwt_signing_keys(status) WHERE status = 'active';
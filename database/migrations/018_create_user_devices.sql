@@ -0,0 +1,17 @@
+-- Access token issued with each refresh token, revoked together when a session is ended
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS access_token_jti VARCHAR(64);
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS access_token_expires_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_user_active ON refresh_tokens(user_id) WHERE is_revoked = false;
+
+-- Devices a user has signed in from, a login from an unknown device is emailed to the user
+CREATE TABLE IF NOT EXISTS user_devices (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    device_hash VARCHAR(64) NOT NULL,
+    label VARCHAR(100) NOT NULL,
+    last_ip VARCHAR(45),
+    first_seen_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    last_seen_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (user_id, device_hash)
+);
@@ -0,0 +1,81 @@
+-- Roles, permissions and their assignment, managed at /admin/roles. The admin role always
+-- has every permission, so it has no rows in role_permissions.
+CREATE TABLE IF NOT EXISTS roles (
+    name VARCHAR(50) PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT '',
+    is_system BOOLEAN NOT NULL DEFAULT false, -- referenced by code, can't be deleted
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS permissions (
+    name VARCHAR(100) PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role_name VARCHAR(50) NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+    permission_name VARCHAR(100) NOT NULL REFERENCES permissions(name) ON DELETE CASCADE,
+    PRIMARY KEY (role_name, permission_name)
+);
+
+-- Permissions are checked by code, descriptions follow the code
+INSERT INTO permissions (name, description) VALUES
+    ('achievement:read', 'View achievements, only their own without achievement:read_all'),
+    ('achievement:read_all', 'View achievements and evidence files of every student'),
+    ('achievement:manage_own', 'Create, edit, submit and delete their own achievements'),
+    ('achievement:verify', 'Verify or reject submitted achievements and re-issue attestations'),
+    ('report:read', 'View statistics and student reports'),
+    ('user:read', 'View the user list'),
+    ('user:manage', 'Create, invite, edit and deactivate users, assign advisors'),
+    ('rbac:manage', 'Manage roles and their permissions'),
+    ('system:manage', 'Manage signing keys, API keys and impersonation')
+ON CONFLICT (name) DO UPDATE SET description = EXCLUDED.description;
+
+-- Default roles get their default permissions only when they are first created,
+-- later changes made by admins are kept across restarts
+WITH default_roles (name, description, is_system) AS (
+    VALUES
+        ('mahasiswa', 'Student, reports their own achievements', true),
+        ('dosen_wali', 'Academic advisor, verifies achievements of advisees', true),
+        ('admin', 'Administrator, has every permission', true),
+        ('kaprodi', 'Head of study program', false),
+        ('wakil_dekan', 'Vice dean', false),
+        ('staff_kemahasiswaan', 'Student affairs staff', false)
+), created_roles AS (
+    INSERT INTO roles (name, description, is_system)
+    SELECT name, description, is_system FROM default_roles
+    ON CONFLICT (name) DO NOTHING
+    RETURNING name
+)
+INSERT INTO role_permissions (role_name, permission_name)
+SELECT grants.role_name, grants.permission_name
+FROM (
+    VALUES
+        ('mahasiswa', 'achievement:read'),
+        ('mahasiswa', 'achievement:manage_own'),
+        ('mahasiswa', 'report:read'),
+        ('dosen_wali', 'achievement:read'),
+        ('dosen_wali', 'achievement:read_all'),
+        ('dosen_wali', 'achievement:verify'),
+        ('dosen_wali', 'report:read'),
+        ('kaprodi', 'achievement:read'),
+        ('kaprodi', 'achievement:read_all'),
+        ('kaprodi', 'achievement:verify'),
+        ('kaprodi', 'report:read'),
+        ('wakil_dekan', 'achievement:read'),
+        ('wakil_dekan', 'achievement:read_all'),
+        ('wakil_dekan', 'achievement:verify'),
+        ('wakil_dekan', 'report:read'),
+        ('staff_kemahasiswaan', 'achievement:read'),
+        ('staff_kemahasiswaan', 'achievement:read_all'),
+        ('staff_kemahasiswaan', 'report:read'),
+        ('staff_kemahasiswaan', 'user:read')
+) AS grants (role_name, permission_name)
+JOIN created_roles ON created_roles.name = grants.role_name
+ON CONFLICT DO NOTHING;
+
+-- users.role now refers to roles instead of a fixed list
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_role_check;
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_role_fkey;
+ALTER TABLE users ADD CONSTRAINT users_role_fkey FOREIGN KEY (role) REFERENCES roles(name) ON UPDATE CASCADE;
@@ -0,0 +1,73 @@
+-- Approval chains decide who approves a submitted achievement and in which order.
+-- A chain applies to a category and/or level, empty means any. The most specific
+-- active chain wins: category and level, category only, level only, then the default.
+CREATE TABLE IF NOT EXISTS approval_chains (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name VARCHAR(100) NOT NULL,
+    category VARCHAR(100),
+    level VARCHAR(20),
+    is_active BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_approval_chains_scope ON approval_chains(LOWER(COALESCE(category, '')), COALESCE(level, ''));
+
+-- Steps of a chain, assignee_rule is advisor (the student's dosen wali), role (any user
+-- with assignee_role) or verifier (any user with achievement:verify)
+CREATE TABLE IF NOT EXISTS approval_chain_steps (
+    chain_id UUID NOT NULL REFERENCES approval_chains(id) ON DELETE CASCADE,
+    step_order INTEGER NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    assignee_rule VARCHAR(20) NOT NULL,
+    assignee_role VARCHAR(50),
+    PRIMARY KEY (chain_id, step_order)
+);
+
+-- Steps of a submitted achievement, copied from its chain on submit so editing a chain
+-- doesn't change achievements already in review. Decided steps are the approval history.
+CREATE TABLE IF NOT EXISTS achievement_approvals (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    achievement_id UUID NOT NULL REFERENCES achievements(id) ON DELETE CASCADE,
+    step_order INTEGER NOT NULL,
+    step_name VARCHAR(100) NOT NULL,
+    assignee_rule VARCHAR(20) NOT NULL,
+    assignee_role VARCHAR(50),
+    status VARCHAR(20) NOT NULL DEFAULT 'pending', -- pending, approved, rejected, skipped
+    decided_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    decided_at TIMESTAMPTZ,
+    note TEXT,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (achievement_id, step_order)
+);
+
+ALTER TABLE achievements ADD COLUMN IF NOT EXISTS current_step INTEGER;
+
+-- Managing chains is a permission of its own
+INSERT INTO permissions (name, description) VALUES
+    ('approval:manage', 'Manage approval chains for achievement verification')
+ON CONFLICT (name) DO UPDATE SET description = EXCLUDED.description;
+
+-- Default chain keeps the single advisor approval, international achievements also
+-- need the head of study program and the vice dean. Seeded only once.
+WITH default_chains (name, level) AS (
+    VALUES
+        ('Default', NULL),
+        ('International', 'internasional')
+), created_chains AS (
+    INSERT INTO approval_chains (name, level)
+    SELECT name, level FROM default_chains
+    ON CONFLICT DO NOTHING
+    RETURNING id, level
+)
+INSERT INTO approval_chain_steps (chain_id, step_order, name, assignee_rule, assignee_role)
+SELECT created_chains.id, steps.step_order, steps.name, steps.assignee_rule, steps.assignee_role
+FROM (
+    VALUES
+        ('', 1, 'Dosen Wali', 'advisor', NULL),
+        ('internasional', 1, 'Dosen Wali', 'advisor', NULL),
+        ('internasional', 2, 'Kaprodi', 'role', 'kaprodi'),
+        ('internasional', 3, 'Wakil Dekan', 'role', 'wakil_dekan')
+) AS steps (level, step_order, name, assignee_rule, assignee_role)
+JOIN created_chains ON COALESCE(created_chains.level, '') = steps.level
+ON CONFLICT DO NOTHING;
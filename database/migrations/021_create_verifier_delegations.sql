@@ -0,0 +1,22 @@
+-- Time-bounded delegation of a dosen wali's approvals to another dosen, e.g. during leave.
+-- While active the delegate decides advisor steps of the delegator's advisees.
+CREATE TABLE IF NOT EXISTS verifier_delegations (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    delegator_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    delegate_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    starts_at TIMESTAMPTZ NOT NULL,
+    ends_at TIMESTAMPTZ NOT NULL,
+    reason TEXT,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    CHECK (ends_at > starts_at),
+    CHECK (delegate_id <> delegator_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_verifier_delegations_delegator_id ON verifier_delegations(delegator_id, ends_at);
+CREATE INDEX IF NOT EXISTS idx_verifier_delegations_delegate_id ON verifier_delegations(delegate_id, ends_at);
+
+-- Decisions made by a delegate record the dosen wali they acted for
+ALTER TABLE achievement_approvals ADD COLUMN IF NOT EXISTS on_behalf_of UUID REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE achievements ADD COLUMN IF NOT EXISTS verified_on_behalf_of UUID REFERENCES users(id) ON DELETE SET NULL;
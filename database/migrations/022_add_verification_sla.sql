@@ -0,0 +1,36 @@
+-- When an achievement was last submitted, the start of its time-to-decision
+ALTER TABLE achievements ADD COLUMN IF NOT EXISTS submitted_at TIMESTAMPTZ;
+
+-- Submissions still in review were submitted at their last update, decided ones have no reliable start
+UPDATE achievements SET submitted_at = updated_at WHERE status = 'submitted' AND submitted_at IS NULL;
+
+-- When a step started waiting for a decision, and when its reminder and escalation were sent
+ALTER TABLE achievement_approvals ADD COLUMN IF NOT EXISTS activated_at TIMESTAMPTZ;
+ALTER TABLE achievement_approvals ADD COLUMN IF NOT EXISTS reminded_at TIMESTAMPTZ;
+ALTER TABLE achievement_approvals ADD COLUMN IF NOT EXISTS escalated_at TIMESTAMPTZ;
+
+UPDATE achievement_approvals ap
+SET activated_at = COALESCE(
+    (SELECT MAX(p.decided_at) FROM achievement_approvals p WHERE p.achievement_id = ap.achievement_id AND p.step_order < ap.step_order),
+    (SELECT a.submitted_at FROM achievements a WHERE a.id = ap.achievement_id),
+    ap.created_at
+)
+WHERE ap.activated_at IS NULL
+  AND (ap.status IN ('approved', 'rejected')
+       OR ap.step_order = (SELECT a.current_step FROM achievements a WHERE a.id = ap.achievement_id));
+
+-- Steps still waiting on achievements submitted before steps were activated have no current_step
+-- set yet, their first pending step has been waiting since the achievement was submitted
+UPDATE achievement_approvals ap
+SET activated_at = COALESCE(
+    (SELECT MAX(p.decided_at) FROM achievement_approvals p WHERE p.achievement_id = ap.achievement_id AND p.step_order < ap.step_order),
+    (SELECT a.submitted_at FROM achievements a WHERE a.id = ap.achievement_id),
+    ap.created_at
+)
+WHERE ap.activated_at IS NULL AND ap.status = 'pending'
+  AND NOT EXISTS (
+      SELECT 1 FROM achievement_approvals p
+      WHERE p.achievement_id = ap.achievement_id AND p.status = 'pending' AND p.step_order < ap.step_order
+  );
+
+CREATE INDEX IF NOT EXISTS idx_achievement_approvals_waiting ON achievement_approvals(activated_at) WHERE status = 'pending';
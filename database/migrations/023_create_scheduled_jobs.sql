@@ -0,0 +1,29 @@
+-- Periodic jobs run by the in-process scheduler. Jobs are registered by code on startup,
+-- the row holds their state shared by all replicas: a replica runs a job only while it holds
+-- the lease (locked_until), so a job never runs twice at the same time.
+CREATE TABLE IF NOT EXISTS scheduled_jobs (
+    name VARCHAR(100) PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT '',
+    schedule VARCHAR(100) NOT NULL, -- cron expression
+    is_paused BOOLEAN NOT NULL DEFAULT false,
+    next_run_at TIMESTAMPTZ,
+    failed_attempts INTEGER NOT NULL DEFAULT 0, -- consecutive failures of the current run, for retries
+    locked_by VARCHAR(255),
+    locked_until TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS job_runs (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    job_name VARCHAR(100) NOT NULL REFERENCES scheduled_jobs(name), -- no cascade, run history is never deleted with the job
+    status VARCHAR(20) NOT NULL DEFAULT 'running' CHECK (status IN ('running', 'succeeded', 'failed')),
+    attempt INTEGER NOT NULL DEFAULT 1,
+    triggered_by UUID REFERENCES users(id) ON DELETE SET NULL, -- admin who ran it manually
+    instance VARCHAR(255) NOT NULL,
+    error TEXT,
+    started_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    finished_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS idx_job_runs_job_started ON job_runs(job_name, started_at DESC);
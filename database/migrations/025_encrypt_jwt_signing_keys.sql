@@ -0,0 +1,3 @@
+-- Private signing keys are stored encrypted with JWT_KEY_ENCRYPTION_KEY, existing plaintext keys
+-- are encrypted when the application first loads them
+ALTER TABLE jwt_signing_keys ADD COLUMN IF NOT EXISTS private_key_encrypted BOOLEAN NOT NULL DEFAULT FALSE;
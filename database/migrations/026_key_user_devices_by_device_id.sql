@@ -0,0 +1,4 @@
+-- Devices used to be keyed by a hash of their browser/OS label, they are now keyed by a random
+-- device id cookie. Label keyed rows can't be matched to a cookie, so they are dropped and the
+-- next login of each user is recorded as their first device instead of alerting everyone.
+DELETE FROM user_devices WHERE device_hash = encode(sha256(convert_to(label, 'UTF8')), 'hex');
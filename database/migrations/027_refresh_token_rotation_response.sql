@@ -0,0 +1,3 @@
+-- Tokens issued by a rotation, encrypted, served again to concurrent refreshes of the same token
+-- during the grace period and cleared afterwards
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS rotation_response TEXT;
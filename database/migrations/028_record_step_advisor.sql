@@ -0,0 +1,25 @@
+-- The dosen wali responsible for an advisor step, recorded when the step starts waiting and
+-- handed over when the student gets another dosen wali, so SLA reports survive reassignments.
+-- Migrations run on every start, the backfill runs only together with adding the column so it
+-- never touches steps recorded at runtime.
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_schema = current_schema() AND table_name = 'achievement_approvals'
+          AND column_name = 'assigned_advisor_id'
+    ) THEN
+        ALTER TABLE achievement_approvals ADD COLUMN assigned_advisor_id UUID REFERENCES users(id) ON DELETE SET NULL;
+
+        -- Decided steps belong to the dosen wali a delegate acted for, otherwise, like waiting
+        -- steps, to the student's current dosen wali; never to whoever decided them
+        UPDATE achievement_approvals ap
+        SET assigned_advisor_id = COALESCE(
+            CASE WHEN ap.status <> 'pending' THEN ap.on_behalf_of END,
+            (SELECT u.advisor_id FROM achievements a JOIN users u ON u.id = a.mahasiswa_id WHERE a.id = ap.achievement_id)
+        )
+        WHERE ap.assignee_rule = 'advisor' AND ap.activated_at IS NOT NULL;
+    END IF;
+END $$;
+
+CREATE INDEX IF NOT EXISTS idx_achievement_approvals_assigned_advisor ON achievement_approvals(assigned_advisor_id) WHERE assigned_advisor_id IS NOT NULL;
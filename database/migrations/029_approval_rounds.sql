@@ -0,0 +1,6 @@
+-- A rejected achievement goes back to the student, who revises and submits it again. Every
+-- submission gets its own round of steps so earlier decisions stay in the approval history.
+ALTER TABLE achievement_approvals ADD COLUMN IF NOT EXISTS round INTEGER NOT NULL DEFAULT 1;
+
+ALTER TABLE achievement_approvals DROP CONSTRAINT IF EXISTS achievement_approvals_achievement_id_step_order_key;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_achievement_approvals_round_step ON achievement_approvals(achievement_id, round, step_order);
@@ -0,0 +1,3 @@
+-- The replica running a job renews its lease and records a heartbeat on the run while the job
+-- runs, runs without a recent heartbeat were interrupted
+ALTER TABLE job_runs ADD COLUMN IF NOT EXISTS heartbeat_at TIMESTAMPTZ;
@@ -0,0 +1,2 @@
+-- Login states started by a signed-in user to link their account to their IdP identity
+ALTER TABLE oidc_login_states ADD COLUMN IF NOT EXISTS link_user_id UUID REFERENCES users(id) ON DELETE CASCADE;
@@ -0,0 +1,20 @@
+-- BadgeClasses referenced by issued assertions, looked up by slug
+CREATE TABLE IF NOT EXISTS badge_classes (
+    slug VARCHAR(200) PRIMARY KEY,
+    category VARCHAR(100) NOT NULL,
+    level VARCHAR(50) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Classes of achievements verified before the table existed, slugs built like service.BadgeClassSlug
+INSERT INTO badge_classes (slug, category, level)
+SELECT DISTINCT ON (slug) slug, category, level
+FROM (
+    SELECT COALESCE(NULLIF(btrim(regexp_replace(lower(category), '[^a-z0-9]+', '-', 'g'), '-'), ''), 'prestasi')
+               || CASE WHEN COALESCE(level, '') <> '' THEN '--' || level ELSE '' END AS slug,
+           category, COALESCE(level, '') AS level
+    FROM achievements
+    WHERE status = 'verified' AND (is_deleted = false OR is_deleted IS NULL)
+) classes
+ORDER BY slug, category
+ON CONFLICT (slug) DO NOTHING;
@@ -0,0 +1,3 @@
+-- Private attestation keys are stored encrypted with ATTESTATION_KEY_ENCRYPTION_KEY, an existing
+-- plaintext key is encrypted when the application first loads it
+ALTER TABLE attestation_keys ADD COLUMN IF NOT EXISTS private_key_encrypted BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,3 @@
+-- Access tokens carry the user's token generation (gen claim), invalidating a user's tokens bumps it.
+-- Rows written before count as one invalidation, so tokens without the claim keep being rejected.
+ALTER TABLE user_token_invalidations ADD COLUMN IF NOT EXISTS generation INTEGER NOT NULL DEFAULT 1;
@@ -1,8 +1,10 @@
 package helper
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"prestasi-mahasiswa/middleware"
 	"prestasi-mahasiswa/service"
 	"time"
 
@@ -12,20 +14,27 @@ import (
 type AchievementHelper struct {
 	AchievementService *service.AchievementService
 	FileService        *service.FileService
+	CertificateService *service.CertificateService
 }
 
-func NewAchievementHelper(achievementSvc *service.AchievementService, fileSvc *service.FileService) *AchievementHelper {
+func NewAchievementHelper(achievementSvc *service.AchievementService, fileSvc *service.FileService, certificateSvc *service.CertificateService) *AchievementHelper {
 	return &AchievementHelper{
 		AchievementService: achievementSvc,
 		FileService:        fileSvc,
+		CertificateService: certificateSvc,
 	}
 }
 
+// canReadAllAchievements reports whether the request may see achievements of every student.
+// API keys only reach achievement handlers with the achievements:read scope.
+func canReadAllAchievements(c *gin.Context) bool {
+	return middleware.HasPermission(c, middleware.PermissionAchievementReadAll) || c.GetString("user_role") == middleware.RoleAPIClient
+}
+
 // GetAchievements godoc
 func (h *AchievementHelper) GetAchievements(c *gin.Context) {
 	// Check user role from middleware
-	userRole, exists := c.Get("user_role")
-	if !exists {
+	if _, exists := c.Get("user_role"); !exists {
 		c.JSON(401, gin.H{"error": "User role not found"})
 		return
 	}
@@ -39,11 +48,10 @@ func (h *AchievementHelper) GetAchievements(c *gin.Context) {
 	var achievements []service.Achievement
 	var err error
 
-	// Mahasiswa only see their own achievements
-	if userRole.(string) == "mahasiswa" {
+	// Without achievement:read_all users only see their own achievements
+	if !canReadAllAchievements(c) {
 		achievements, err = h.AchievementService.GetAchievementsByMahasiswa(userID.(string))
 	} else {
-		// Dosen/Admin see all achievements
 		achievements, err = h.AchievementService.GetAllAchievements()
 	}
 
@@ -70,9 +78,8 @@ func (h *AchievementHelper) CreateAchievement(c *gin.Context) {
 		return
 	}
 
-	userRole, roleExists := c.Get("user_role")
-	if !roleExists || userRole.(string) != "mahasiswa" {
-		c.JSON(403, gin.H{"error": "Only mahasiswa can create achievements"})
+	if !middleware.HasPermission(c, middleware.PermissionAchievementManageOwn) {
+		c.JSON(403, gin.H{"error": "Your role can't create achievements"})
 		return
 	}
 
@@ -80,6 +87,7 @@ func (h *AchievementHelper) CreateAchievement(c *gin.Context) {
 		Title           string    `json:"title" binding:"required"`
 		Description     string    `json:"description" binding:"required"`
 		Category        string    `json:"category" binding:"required"`
+		Level           string    `json:"level"`
 		AchievementDate time.Time `json:"achievement_date" binding:"required"`
 	}
 
@@ -94,6 +102,7 @@ func (h *AchievementHelper) CreateAchievement(c *gin.Context) {
 		Title:           req.Title,
 		Description:     req.Description,
 		Category:        req.Category,
+		Level:           req.Level,
 		AchievementDate: req.AchievementDate,
 	}
 
@@ -125,11 +134,10 @@ func (h *AchievementHelper) GetAchievement(c *gin.Context) {
 	}
 
 	// Check access rights
-	userRole, _ := c.Get("user_role")
 	userID, _ := c.Get("user_id")
 
-	// Mahasiswa can only see their own achievements
-	if userRole.(string) == "mahasiswa" && achievement.MahasiswaID != userID.(string) {
+	// Without achievement:read_all users can only see their own achievements
+	if !canReadAllAchievements(c) && achievement.MahasiswaID != userID.(string) {
 		c.JSON(403, gin.H{"error": "Access denied: You can only view your own achievements"})
 		return
 	}
@@ -196,8 +204,6 @@ func (h *AchievementHelper) UploadFile(c *gin.Context) {
 		return
 	}
 
-	userRole, _ := c.Get("user_role")
-
 	// Verify achievement exists and user can upload to it
 	achievement, err := h.AchievementService.GetAchievementByID(achievementID)
 	if err != nil {
@@ -209,8 +215,8 @@ func (h *AchievementHelper) UploadFile(c *gin.Context) {
 		return
 	}
 
-	// Check access rights - mahasiswa can only upload to their own achievements
-	if userRole.(string) == "mahasiswa" && achievement.MahasiswaID != userID.(string) {
+	// Check access rights - files can only be uploaded to their own achievements
+	if achievement.MahasiswaID != userID.(string) {
 		c.JSON(403, gin.H{
 			"success": false,
 			"message": "Access denied: You can only upload files to your own achievements",
@@ -279,7 +285,6 @@ func (h *AchievementHelper) GetFiles(c *gin.Context) {
 
 	// Check if user has access to this achievement
 	userID, _ := c.Get("user_id")
-	userRole, _ := c.Get("user_role")
 
 	// Verify achievement exists
 	achievement, err := h.AchievementService.GetAchievementByID(achievementID)
@@ -293,7 +298,7 @@ func (h *AchievementHelper) GetFiles(c *gin.Context) {
 	}
 
 	// Check access rights
-	if userRole.(string) == "mahasiswa" && achievement.MahasiswaID != userID.(string) {
+	if !canReadAllAchievements(c) && achievement.MahasiswaID != userID.(string) {
 		c.JSON(403, gin.H{
 			"success": false,
 			"message": "Access denied: You can only view files from your own achievements",
@@ -343,9 +348,8 @@ func (h *AchievementHelper) DeleteFile(c *gin.Context) {
 		return
 	}
 
-	// Validate file access before deletion
-	userRole, _ := c.Get("user_role")
-	err := h.FileService.ValidateFileAccess(fileID, userID.(string), userRole.(string))
+	// Validate file access before deletion, only the owner may delete
+	err := h.FileService.ValidateFileAccess(fileID, userID.(string), false)
 	if err != nil {
 		c.JSON(403, gin.H{
 			"success": false,
@@ -387,8 +391,7 @@ func (h *AchievementHelper) DownloadFile(c *gin.Context) {
 
 	// Validate file access
 	userID, _ := c.Get("user_id")
-	userRole, _ := c.Get("user_role")
-	err := h.FileService.ValidateFileAccess(fileID, userID.(string), userRole.(string))
+	err := h.FileService.ValidateFileAccess(fileID, userID.(string), canReadAllAchievements(c))
 	if err != nil {
 		c.JSON(403, gin.H{
 			"success": false,
@@ -426,6 +429,62 @@ func (h *AchievementHelper) DownloadFile(c *gin.Context) {
 	}
 }
 
+// DownloadVerifiedCopy sends a copy of PDF or image evidence of a verified achievement stamped with its
+// verification code and public verification URL, the stored evidence itself is left untouched
+func (h *AchievementHelper) DownloadVerifiedCopy(c *gin.Context) {
+	achievementID := c.Param("id")
+	fileID := c.Param("fileId")
+
+	if achievementID == "" || fileID == "" {
+		c.JSON(400, gin.H{
+			"success": false,
+			"message": "Achievement ID and File ID are required",
+		})
+		return
+	}
+
+	achievement, err := h.AchievementService.GetAchievementByID(achievementID)
+	if err != nil {
+		c.JSON(404, gin.H{
+			"success": false,
+			"message": "Achievement not found",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	// Without achievement:read_all users can only download verified copies of their own achievements
+	userID, _ := c.Get("user_id")
+	if !canReadAllAchievements(c) && achievement.MahasiswaID != userID.(string) {
+		c.JSON(403, gin.H{
+			"success": false,
+			"message": "Access denied: You can only download files from your own achievements",
+		})
+		return
+	}
+
+	if achievement.Status != "verified" {
+		c.JSON(409, gin.H{
+			"success": false,
+			"message": "Verified copy is only available for verified achievements",
+		})
+		return
+	}
+
+	stampedFile, err := h.CertificateService.GenerateVerifiedCopy(achievementID, fileID)
+	if err != nil {
+		c.JSON(400, gin.H{
+			"success": false,
+			"message": "Failed to generate verified copy",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, stampedFile.Filename))
+	c.Data(200, stampedFile.ContentType, stampedFile.Data)
+}
+
 // SubmitAchievement godoc
 func (h *AchievementHelper) SubmitAchievement(c *gin.Context) {
 	id := c.Param("id")
@@ -434,10 +493,8 @@ func (h *AchievementHelper) SubmitAchievement(c *gin.Context) {
 		return
 	}
 
-	// Check if user is mahasiswa
-	userRole, _ := c.Get("user_role")
-	if userRole.(string) != "mahasiswa" {
-		c.JSON(403, gin.H{"error": "Only mahasiswa can submit achievements"})
+	if !middleware.HasPermission(c, middleware.PermissionAchievementManageOwn) {
+		c.JSON(403, gin.H{"error": "Your role can't submit achievements"})
 		return
 	}
 
@@ -453,6 +510,31 @@ func (h *AchievementHelper) SubmitAchievement(c *gin.Context) {
 	})
 }
 
+// ReturnToDraft moves the student's rejected achievement back to draft for revision and resubmission
+func (h *AchievementHelper) ReturnToDraft(c *gin.Context) {
+	id := c.Param("id")
+	if id == "" {
+		c.JSON(400, gin.H{"error": "Achievement ID is required"})
+		return
+	}
+
+	if !middleware.HasPermission(c, middleware.PermissionAchievementManageOwn) {
+		c.JSON(403, gin.H{"error": "Your role can't revise achievements"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	if err := h.AchievementService.ReturnToDraft(id, userID.(string)); err != nil {
+		c.JSON(409, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message": "Achievement returned to draft, revise and submit it again",
+		"status":  "success",
+	})
+}
+
 // SubmitAchievement godoc
 func (h *AchievementHelper) VerifyAchievement(c *gin.Context) {
 	id := c.Param("id")
@@ -461,22 +543,38 @@ func (h *AchievementHelper) VerifyAchievement(c *gin.Context) {
 		return
 	}
 
-	// Check if user is dosen or admin
-	userRole, _ := c.Get("user_role")
-	if userRole.(string) == "mahasiswa" {
-		c.JSON(403, gin.H{"error": "Only dosen and admin can verify achievements"})
+	if !middleware.HasPermission(c, middleware.PermissionAchievementVerify) {
+		c.JSON(403, gin.H{"error": "Your role can't verify achievements"})
 		return
 	}
 
+	var req struct {
+		Note string `json:"note"`
+	}
+
+	// The note is optional, so is the body
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(400, gin.H{"error": "Invalid request format: " + err.Error()})
+			return
+		}
+	}
+
 	userID, _ := c.Get("user_id")
-	err := h.AchievementService.VerifyAchievement(id, userID.(string))
+	progress, err := h.AchievementService.VerifyAchievement(id, userID.(string), c.GetString("user_role"), req.Note)
 	if err != nil {
-		c.JSON(500, gin.H{"error": err.Error()})
+		c.JSON(approvalErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
+	message := "Achievement verified successfully"
+	if progress.NextStep != nil {
+		message = "Step approved, waiting for " + progress.NextStep.StepName
+	}
+
 	c.JSON(200, gin.H{
-		"message": "Achievement verified successfully",
+		"message": message,
+		"data":    progress,
 		"status":  "success",
 	})
 }
@@ -489,10 +587,8 @@ func (h *AchievementHelper) RejectAchievement(c *gin.Context) {
 		return
 	}
 
-	// Check if user is dosen or admin
-	userRole, _ := c.Get("user_role")
-	if userRole.(string) == "mahasiswa" {
-		c.JSON(403, gin.H{"error": "Only dosen and admin can reject achievements"})
+	if !middleware.HasPermission(c, middleware.PermissionAchievementVerify) {
+		c.JSON(403, gin.H{"error": "Your role can't reject achievements"})
 		return
 	}
 
@@ -506,9 +602,9 @@ func (h *AchievementHelper) RejectAchievement(c *gin.Context) {
 	}
 
 	userID, _ := c.Get("user_id")
-	err := h.AchievementService.RejectAchievement(id, userID.(string), req.Reason)
+	err := h.AchievementService.RejectAchievement(id, userID.(string), c.GetString("user_role"), req.Reason)
 	if err != nil {
-		c.JSON(500, gin.H{"error": err.Error()})
+		c.JSON(approvalErrorStatus(err), gin.H{"error": err.Error()})
 		return
 	}
 
@@ -518,3 +614,40 @@ func (h *AchievementHelper) RejectAchievement(c *gin.Context) {
 		"status":  "success",
 	})
 }
+
+// GetApprovals godoc
+func (h *AchievementHelper) GetApprovals(c *gin.Context) {
+	id := c.Param("id")
+	achievement, err := h.AchievementService.GetAchievementByID(id)
+	if err != nil {
+		c.JSON(404, gin.H{"error": "Achievement not found"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	if !canReadAllAchievements(c) && achievement.MahasiswaID != userID.(string) {
+		c.JSON(403, gin.H{"error": "Access denied: You can only view your own achievements"})
+		return
+	}
+
+	approvals, err := h.AchievementService.ApprovalService.GetAchievementApprovals(id)
+	if err != nil {
+		c.JSON(500, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message": "Get approval steps",
+		"data":    approvals,
+		"count":   len(approvals),
+		"status":  "success",
+	})
+}
+
+// approvalErrorStatus maps verify and reject errors to status codes
+func approvalErrorStatus(err error) int {
+	if errors.Is(err, service.ErrNotApprover) {
+		return 403
+	}
+	return 500
+}
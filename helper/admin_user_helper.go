@@ -1,21 +1,42 @@
 package helper
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
+	"prestasi-mahasiswa/middleware"
 	"prestasi-mahasiswa/service"
 
 	"github.com/gin-gonic/gin"
 )
 
 type AdminUserHelper struct {
-	UserService *service.UserService
+	UserService            *service.UserService
+	LoginService           *service.LoginService
+	RefreshTokenService    *service.RefreshTokenService
+	TokenRevocationService *service.TokenRevocationService
+	MFAService             *service.MFAService
 }
 
-func NewAdminUserHelper(userService *service.UserService) *AdminUserHelper {
+func NewAdminUserHelper(userService *service.UserService, loginService *service.LoginService, refreshTokenService *service.RefreshTokenService, tokenRevocationService *service.TokenRevocationService, mfaService *service.MFAService) *AdminUserHelper {
 	return &AdminUserHelper{
-		UserService: userService,
+		UserService:            userService,
+		LoginService:           loginService,
+		RefreshTokenService:    refreshTokenService,
+		TokenRevocationService: tokenRevocationService,
+		MFAService:             mfaService,
+	}
+}
+
+// revokeUserSessions ends all sessions of a user so role or status changes apply immediately
+func (h *AdminUserHelper) revokeUserSessions(c *gin.Context, userID, reason string) {
+	if err := h.RefreshTokenService.RevokeUserRefreshTokens(userID); err != nil {
+		c.Header("X-Warning", "Failed to revoke refresh tokens")
+	}
+
+	if err := h.TokenRevocationService.InvalidateUserTokens(userID, reason); err != nil {
+		c.Header("X-Warning", "Failed to revoke access tokens")
 	}
 }
 
@@ -85,9 +106,11 @@ func (h *AdminUserHelper) CreateUser(c *gin.Context) {
 		return
 	}
 
+	req.CanManageAdmins = canManageAdmins(c)
+
 	user, err := h.UserService.CreateUser(req)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{
+		c.JSON(roleChangeErrorStatus(err), gin.H{
 			"success": false,
 			"message": "Failed to create user",
 			"error":   err.Error(),
@@ -116,6 +139,9 @@ func (h *AdminUserHelper) UpdateUser(c *gin.Context) {
 		return
 	}
 
+	req.UpdatedBy = c.GetString("user_id")
+	req.CanManageAdmins = canManageAdmins(c)
+
 	user, err := h.UserService.UpdateUser(userID, req)
 	if err != nil {
 		if err.Error() == "user not found" {
@@ -126,7 +152,7 @@ func (h *AdminUserHelper) UpdateUser(c *gin.Context) {
 			return
 		}
 
-		c.JSON(http.StatusBadRequest, gin.H{
+		c.JSON(roleChangeErrorStatus(err), gin.H{
 			"success": false,
 			"message": "Failed to update user",
 			"error":   err.Error(),
@@ -134,6 +160,14 @@ func (h *AdminUserHelper) UpdateUser(c *gin.Context) {
 		return
 	}
 
+	if req.IsActive != nil && !*req.IsActive {
+		h.revokeUserSessions(c, userID, service.RevocationReasonDeactivated)
+	} else if req.Role != nil {
+		h.revokeUserSessions(c, userID, service.RevocationReasonRoleChanged)
+	} else if req.Password != nil {
+		h.revokeUserSessions(c, userID, service.RevocationReasonPasswordChanged)
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "User updated successfully",
@@ -163,6 +197,8 @@ func (h *AdminUserHelper) DeleteUser(c *gin.Context) {
 		return
 	}
 
+	h.revokeUserSessions(c, userID, service.RevocationReasonDeleted)
+
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "User deleted successfully",
@@ -188,7 +224,9 @@ func (h *AdminUserHelper) ChangeUserRole(c *gin.Context) {
 
 	// Update user role using service
 	updateReq := service.UpdateUserRequest{
-		Role: &req.Role,
+		Role:            &req.Role,
+		UpdatedBy:       c.GetString("user_id"),
+		CanManageAdmins: canManageAdmins(c),
 	}
 
 	user, err := h.UserService.UpdateUser(userID, updateReq)
@@ -201,7 +239,7 @@ func (h *AdminUserHelper) ChangeUserRole(c *gin.Context) {
 			return
 		}
 
-		c.JSON(http.StatusBadRequest, gin.H{
+		c.JSON(roleChangeErrorStatus(err), gin.H{
 			"success": false,
 			"message": "Failed to change user role",
 			"error":   err.Error(),
@@ -209,6 +247,9 @@ func (h *AdminUserHelper) ChangeUserRole(c *gin.Context) {
 		return
 	}
 
+	// Tokens carry the role claim, old tokens must not keep the previous role
+	h.revokeUserSessions(c, userID, service.RevocationReasonRoleChanged)
+
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "User role changed successfully",
@@ -228,6 +269,7 @@ func (h *AdminUserHelper) AssignAdvisor(c *gin.Context) {
 		return
 	}
 
+	req.AssignedBy = c.GetString("user_id")
 	err := h.UserService.AssignAdvisor(req)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -365,6 +407,7 @@ func (h *AdminUserHelper) ToggleUserStatus(c *gin.Context) {
 	action := "activated"
 	if !newStatus {
 		action = "deactivated"
+		h.revokeUserSessions(c, userID, service.RevocationReasonDeactivated)
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -373,3 +416,97 @@ func (h *AdminUserHelper) ToggleUserStatus(c *gin.Context) {
 		"data":    user,
 	})
 }
+
+// UnlockUser clears a login lockout before it expires
+func (h *AdminUserHelper) UnlockUser(c *gin.Context) {
+	userID := c.Param("id")
+
+	if err := h.LoginService.UnlockAccount(userID); err != nil {
+		if err.Error() == "user not found" {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"message": "User not found",
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to unlock user",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "User unlocked successfully",
+	})
+}
+
+// GetLoginAttempts returns recent login attempts of a user
+func (h *AdminUserHelper) GetLoginAttempts(c *gin.Context) {
+	userID := c.Param("id")
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+
+	attempts, err := h.LoginService.GetLoginHistory(userID, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to get login attempts",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Login attempts retrieved successfully",
+		"data": gin.H{
+			"attempts": attempts,
+			"total":    len(attempts),
+		},
+	})
+}
+
+// ResetMFA removes the two-factor authentication of a user who lost their device
+func (h *AdminUserHelper) ResetMFA(c *gin.Context) {
+	userID := c.Param("id")
+
+	if err := h.MFAService.ResetMFA(userID, c.GetString("user_id")); err != nil {
+		if err.Error() == "user not found" {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"message": "User not found",
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to reset two-factor authentication",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Two-factor authentication reset successfully",
+	})
+}
+
+// canManageAdmins reports whether the caller may grant or remove the admin role, user:manage alone is not enough
+func canManageAdmins(c *gin.Context) bool {
+	return c.GetString("user_role") == service.RoleAdmin ||
+		middleware.HasPermission(c, middleware.PermissionRBACManage) ||
+		middleware.HasPermission(c, middleware.PermissionSystemManage)
+}
+
+// roleChangeErrorStatus answers refused role changes with 403, other errors are bad requests
+func roleChangeErrorStatus(err error) int {
+	if errors.Is(err, service.ErrOwnRoleChange) || errors.Is(err, service.ErrAdminRoleRequired) {
+		return http.StatusForbidden
+	}
+	return http.StatusBadRequest
+}
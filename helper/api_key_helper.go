@@ -0,0 +1,110 @@
+package helper
+
+import (
+	"net/http"
+	"strings"
+
+	"prestasi-mahasiswa/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type APIKeyHelper struct {
+	APIKeyService *service.APIKeyService
+}
+
+func NewAPIKeyHelper(apiKeyService *service.APIKeyService) *APIKeyHelper {
+	return &APIKeyHelper{
+		APIKeyService: apiKeyService,
+	}
+}
+
+// GetAPIKeys lists API keys with their scopes and last use (admin)
+func (h *APIKeyHelper) GetAPIKeys(c *gin.Context) {
+	apiKeys, err := h.APIKeyService.GetAPIKeys()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to get API keys",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "API keys retrieved successfully",
+		"data": gin.H{
+			"api_keys":         apiKeys,
+			"total":            len(apiKeys),
+			"available_scopes": service.APIKeyScopes,
+		},
+	})
+}
+
+// CreateAPIKey issues a key with scopes, the key is only returned in this response (admin)
+func (h *APIKeyHelper) CreateAPIKey(c *gin.Context) {
+	var req service.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request data",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	adminID, _ := c.Get("user_id")
+	createdBy, _ := adminID.(string)
+
+	apiKey, key, err := h.APIKeyService.CreateAPIKey(req, createdBy)
+	if err != nil {
+		status := http.StatusBadRequest
+		if strings.HasPrefix(err.Error(), "failed to") {
+			status = http.StatusInternalServerError
+		}
+		c.JSON(status, gin.H{
+			"success": false,
+			"message": "Failed to create API key",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"message": "API key created successfully, store the key now as it can't be shown again",
+		"data": gin.H{
+			"key":     key,
+			"api_key": apiKey,
+		},
+	})
+}
+
+// RevokeAPIKey disables an API key (admin)
+func (h *APIKeyHelper) RevokeAPIKey(c *gin.Context) {
+	adminID, _ := c.Get("user_id")
+	revokedBy, _ := adminID.(string)
+
+	if err := h.APIKeyService.RevokeAPIKey(c.Param("id"), revokedBy); err != nil {
+		if err.Error() == "API key not found" {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"message": "API key not found",
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to revoke API key",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "API key revoked successfully",
+	})
+}
@@ -0,0 +1,130 @@
+package helper
+
+import (
+	"net/http"
+	"strings"
+
+	"prestasi-mahasiswa/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ApprovalHelper struct {
+	ApprovalService *service.ApprovalService
+}
+
+func NewApprovalHelper(approvalService *service.ApprovalService) *ApprovalHelper {
+	return &ApprovalHelper{
+		ApprovalService: approvalService,
+	}
+}
+
+// GetChains lists approval chains with their steps (admin)
+func (h *ApprovalHelper) GetChains(c *gin.Context) {
+	chains, err := h.ApprovalService.GetChains()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to get approval chains",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Approval chains retrieved successfully",
+		"data": gin.H{
+			"chains": chains,
+			"total":  len(chains),
+		},
+	})
+}
+
+// CreateChain adds an approval chain for a category and/or level (admin)
+func (h *ApprovalHelper) CreateChain(c *gin.Context) {
+	var req service.ApprovalChainRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request data",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	chain, err := h.ApprovalService.CreateChain(req)
+	if err != nil {
+		c.JSON(approvalChainErrorStatus(err), gin.H{
+			"success": false,
+			"message": "Failed to create approval chain",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"message": "Approval chain created successfully",
+		"data":    chain,
+	})
+}
+
+// UpdateChain replaces an approval chain, achievements in review keep their steps (admin)
+func (h *ApprovalHelper) UpdateChain(c *gin.Context) {
+	var req service.ApprovalChainRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request data",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	chain, err := h.ApprovalService.UpdateChain(c.Param("id"), req)
+	if err != nil {
+		c.JSON(approvalChainErrorStatus(err), gin.H{
+			"success": false,
+			"message": "Failed to update approval chain",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Approval chain updated successfully",
+		"data":    chain,
+	})
+}
+
+// DeleteChain removes an approval chain (admin)
+func (h *ApprovalHelper) DeleteChain(c *gin.Context) {
+	if err := h.ApprovalService.DeleteChain(c.Param("id")); err != nil {
+		c.JSON(approvalChainErrorStatus(err), gin.H{
+			"success": false,
+			"message": "Failed to delete approval chain",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Approval chain deleted successfully",
+	})
+}
+
+func approvalChainErrorStatus(err error) int {
+	switch {
+	case err.Error() == "approval chain not found":
+		return http.StatusNotFound
+	case strings.HasSuffix(err.Error(), "already exists"):
+		return http.StatusConflict
+	case strings.HasPrefix(err.Error(), "failed to"):
+		return http.StatusInternalServerError
+	default:
+		return http.StatusBadRequest
+	}
+}
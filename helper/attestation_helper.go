@@ -0,0 +1,117 @@
+package helper
+
+import (
+	"prestasi-mahasiswa/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type AttestationHelper struct {
+	AttestationService *service.AttestationService
+	AchievementService *service.AchievementService
+}
+
+func NewAttestationHelper(attestationService *service.AttestationService, achievementService *service.AchievementService) *AttestationHelper {
+	return &AttestationHelper{
+		AttestationService: attestationService,
+		AchievementService: achievementService,
+	}
+}
+
+// GetAttestation returns the latest signed attestation of an achievement
+func (h *AttestationHelper) GetAttestation(c *gin.Context) {
+	id := c.Param("id")
+	if id == "" {
+		c.JSON(400, gin.H{"error": "Achievement ID is required"})
+		return
+	}
+
+	achievement, err := h.AchievementService.GetAchievementByID(id)
+	if err != nil {
+		c.JSON(404, gin.H{"error": "Achievement not found"})
+		return
+	}
+
+	// Without achievement:read_all users can only see attestations of their own achievements
+	userID, _ := c.Get("user_id")
+	if !canReadAllAchievements(c) && achievement.MahasiswaID != userID.(string) {
+		c.JSON(403, gin.H{"error": "Access denied: You can only view your own achievements"})
+		return
+	}
+
+	attestation, err := h.AttestationService.GetLatestAttestation(id)
+	if err != nil {
+		if err.Error() == "attestation not found" {
+			c.JSON(404, gin.H{"error": "Attestation not found"})
+			return
+		}
+		c.JSON(500, gin.H{"error": "Failed to retrieve attestation", "details": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message": "Attestation retrieved successfully",
+		"data":    attestation,
+	})
+}
+
+// IssueAttestation signs a new attestation for an already verified achievement
+func (h *AttestationHelper) IssueAttestation(c *gin.Context) {
+	id := c.Param("id")
+	if id == "" {
+		c.JSON(400, gin.H{"error": "Achievement ID is required"})
+		return
+	}
+
+	attestation, err := h.AttestationService.AttestAchievement(id)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Failed to issue attestation", "details": err.Error()})
+		return
+	}
+
+	c.JSON(201, gin.H{
+		"message": "Attestation issued successfully",
+		"data":    attestation,
+	})
+}
+
+// GetPublicKeys publishes attestation verification keys (JWK set)
+func (h *AttestationHelper) GetPublicKeys(c *gin.Context) {
+	keySet, err := h.AttestationService.GetPublicKeySet()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to retrieve attestation keys"})
+		return
+	}
+
+	c.Header("Cache-Control", "public, max-age=3600")
+	c.JSON(200, keySet)
+}
+
+// GetKeys lists attestation keys with their status (admin)
+func (h *AttestationHelper) GetKeys(c *gin.Context) {
+	keys, err := h.AttestationService.GetKeys()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to retrieve attestation keys", "details": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message": "Attestation keys retrieved successfully",
+		"data":    keys,
+		"total":   len(keys),
+	})
+}
+
+// RotateKey retires the active signing key and creates a new one (admin)
+func (h *AttestationHelper) RotateKey(c *gin.Context) {
+	key, err := h.AttestationService.RotateKey()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to rotate attestation key", "details": err.Error()})
+		return
+	}
+
+	c.JSON(201, gin.H{
+		"message": "Attestation key rotated successfully",
+		"data":    key,
+	})
+}
@@ -1,63 +1,123 @@
 package helper
 
 import (
+	"encoding/hex"
+	"errors"
+	"html/template"
+	"math"
+	"net/http"
 	"prestasi-mahasiswa/service"
 	"prestasi-mahasiswa/utils"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 type AuthHelper struct {
-	LoginService        *service.LoginService
-	RegisterService     *service.RegisterService
-	RefreshTokenService *service.RefreshTokenService
+	LoginService             *service.LoginService
+	RegisterService          *service.RegisterService
+	RefreshTokenService      *service.RefreshTokenService
+	TokenRevocationService   *service.TokenRevocationService
+	PasswordResetService     *service.PasswordResetService
+	PasswordService          *service.PasswordService
+	EmailVerificationService *service.EmailVerificationService
+	MFAService               *service.MFAService
+	SessionService           *service.SessionService
 }
 
-func NewAuthHelper(loginSvc *service.LoginService, registerSvc *service.RegisterService, refreshTokenSvc *service.RefreshTokenService) *AuthHelper {
+func NewAuthHelper(loginSvc *service.LoginService, registerSvc *service.RegisterService, refreshTokenSvc *service.RefreshTokenService, tokenRevocationSvc *service.TokenRevocationService, passwordResetSvc *service.PasswordResetService, passwordSvc *service.PasswordService, emailVerificationSvc *service.EmailVerificationService, mfaSvc *service.MFAService, sessionSvc *service.SessionService) *AuthHelper {
 	return &AuthHelper{
-		LoginService:        loginSvc,
-		RegisterService:     registerSvc,
-		RefreshTokenService: refreshTokenSvc,
+		LoginService:             loginSvc,
+		RegisterService:          registerSvc,
+		RefreshTokenService:      refreshTokenSvc,
+		TokenRevocationService:   tokenRevocationSvc,
+		PasswordResetService:     passwordResetSvc,
+		PasswordService:          passwordSvc,
+		EmailVerificationService: emailVerificationSvc,
+		MFAService:               mfaSvc,
+		SessionService:           sessionSvc,
 	}
 }
 
-// Login
-func (h *AuthHelper) Login(c *gin.Context) {
-	var req struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
+// issueTokenPair starts a session for user and stores its refresh token
+func (h *AuthHelper) issueTokenPair(c *gin.Context, user *service.UserData) (*utils.TokenPair, error) {
+	// Get client IP and User-Agent for security tracking
+	clientIP := c.ClientIP()
+	userAgent := c.GetHeader("User-Agent")
+
+	tokenPair, _, err := h.RefreshTokenService.StartSession(user.ID, user.Email, user.Role, &clientIP, &userAgent)
+	if err != nil {
+		return nil, err
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(400, gin.H{"error": "Invalid request format"})
-		return
+	// Remembers the device and emails the user about logins from new devices
+	h.SessionService.RecordLogin(user.ID, deviceID(c), clientIP, userAgent)
+
+	return tokenPair, nil
+}
+
+// deviceCookieName holds a random id that identifies a browser across logins
+const deviceCookieName = "device_id"
+
+// deviceCookieMaxAge is the longest cookie lifetime browsers keep, 400 days
+const deviceCookieMaxAge = 400 * 24 * 60 * 60
+
+// deviceID returns the id of the device signing in from its cookie, setting a new one for
+// devices without it
+func deviceID(c *gin.Context) string {
+	if id, err := c.Cookie(deviceCookieName); err == nil {
+		if raw, err := hex.DecodeString(id); err == nil && len(raw) == 32 {
+			return id
+		}
 	}
 
-	user, err := h.LoginService.AuthenticateUser(req.Email, req.Password)
+	id, err := utils.GenerateRandomToken()
 	if err != nil {
-		c.JSON(401, gin.H{"error": err.Error()})
-		return
+		return ""
 	}
 
-	// Generate token pair (access + refresh)
-	tokenPair, err := h.LoginService.JWTUtil.GenerateTokenPair(user.ID, user.Email, user.Role)
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(deviceCookieName, id, deviceCookieMaxAge, "/", "", c.Request.TLS != nil, true)
+	return id
+}
+
+// completeLogin answers a login whose first factor succeeded, either with a token pair
+// or with the challenge token of the second factor
+func (h *AuthHelper) completeLogin(c *gin.Context, user *service.UserData) {
+	// With two-factor authentication enabled, or required for the role, the first factor
+	// only yields a short-lived challenge token that is exchanged for tokens at /auth/mfa/*
+	purpose, err := h.MFAService.LoginChallenge(user)
 	if err != nil {
-		c.JSON(500, gin.H{"error": "Failed to generate tokens"})
+		c.JSON(500, gin.H{"error": "Failed to check two-factor authentication"})
 		return
 	}
+	if purpose != "" {
+		mfaToken, err := h.MFAService.CreateChallenge(user.ID, purpose)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to start two-factor authentication"})
+			return
+		}
 
-	// Store refresh token in database
-	refreshTokenHash := utils.HashToken(tokenPair.RefreshToken)
-	expiresAt := time.Now().Add(7 * 24 * time.Hour) // 7 days
+		message := "Two-factor authentication code required"
+		if purpose == service.MFAChallengeEnroll {
+			message = "Two-factor authentication is required for your role, set it up to continue"
+		}
 
-	// Get client IP and User-Agent for security tracking
-	clientIP := c.ClientIP()
-	userAgent := c.GetHeader("User-Agent")
+		c.JSON(200, gin.H{
+			"message":                 message,
+			"mfa_required":            true,
+			"mfa_enrollment_required": purpose == service.MFAChallengeEnroll,
+			"mfa_token":               mfaToken,
+			"expires_in":              int(h.MFAService.ChallengeLifetime.Seconds()),
+		})
+		return
+	}
 
-	err = h.RefreshTokenService.StoreRefreshToken(user.ID, refreshTokenHash, expiresAt, &clientIP, &userAgent)
+	tokenPair, err := h.issueTokenPair(c, user)
 	if err != nil {
-		c.JSON(500, gin.H{"error": "Failed to store refresh token"})
+		c.JSON(500, gin.H{"error": "Failed to generate tokens"})
 		return
 	}
 
@@ -71,14 +131,11 @@ func (h *AuthHelper) Login(c *gin.Context) {
 	})
 }
 
-// Register
-func (h *AuthHelper) Register(c *gin.Context) {
+// Login
+func (h *AuthHelper) Login(c *gin.Context) {
 	var req struct {
-		NIM      string `json:"nim"`
-		Name     string `json:"name"`
 		Email    string `json:"email"`
 		Password string `json:"password"`
-		Role     string `json:"role"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -86,13 +143,86 @@ func (h *AuthHelper) Register(c *gin.Context) {
 		return
 	}
 
-	if err := h.RegisterService.ValidateUserData(req.NIM, req.Name, req.Email, req.Password, req.Role); err != nil {
-		c.JSON(400, gin.H{"error": err.Error()})
+	user, err := h.LoginService.AuthenticateUser(req.Email, req.Password, c.ClientIP(), c.GetHeader("User-Agent"))
+	if err != nil {
+		if errors.Is(err, service.ErrAuthUnavailable) {
+			c.JSON(503, gin.H{"error": "Authentication service unavailable, try again later"})
+			return
+		}
+
+		var loginErr *service.LoginError
+		if !errors.As(err, &loginErr) {
+			c.JSON(401, gin.H{"error": err.Error()})
+			return
+		}
+
+		if loginErr.RetryAfter > 0 {
+			retryAfter := int(math.Ceil(loginErr.RetryAfter.Seconds()))
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.JSON(429, gin.H{
+				"error":               loginErr.Message,
+				"code":                loginErr.Code,
+				"retry_after_seconds": retryAfter,
+				"captcha_required":    loginErr.CaptchaRequired,
+			})
+			return
+		}
+
+		if loginErr.Code == service.LoginErrorEmailNotVerified {
+			c.JSON(403, gin.H{
+				"error": loginErr.Message,
+				"code":  loginErr.Code,
+			})
+			return
+		}
+
+		c.JSON(401, gin.H{
+			"error":            loginErr.Message,
+			"code":             loginErr.Code,
+			"captcha_required": loginErr.CaptchaRequired,
+		})
 		return
 	}
 
-	if err := h.RegisterService.CreateUser(req.NIM, req.Name, req.Email, req.Password, req.Role); err != nil {
-		c.JSON(500, gin.H{"error": err.Error()})
+	h.completeLogin(c, user)
+}
+
+// Register
+func (h *AuthHelper) Register(c *gin.Context) {
+	var req struct {
+		NIM            string `json:"nim"`
+		Name           string `json:"name"`
+		Email          string `json:"email"`
+		Password       string `json:"password"`
+		Role           string `json:"role"` // optional, mahasiswa or the role of the invitation
+		InvitationCode string `json:"invitation_code"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	if err := h.RegisterService.CreateUser(req.NIM, req.Name, req.Email, req.Password, req.Role, req.InvitationCode); err != nil {
+		var accessErr *service.RegistrationAccessError
+		switch {
+		case errors.As(err, &accessErr):
+			c.JSON(403, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrEmailRegistered), errors.Is(err, service.ErrInvitationTaken):
+			c.JSON(409, gin.H{"error": err.Error()})
+		case strings.HasPrefix(err.Error(), "failed to"), strings.HasPrefix(err.Error(), "database error"):
+			c.JSON(500, gin.H{"error": "Failed to register user"})
+		default:
+			c.JSON(400, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	if h.RegisterService.EmailVerificationService != nil {
+		c.JSON(201, gin.H{
+			"message": "User registered successfully, check your email to verify your account before logging in",
+			"status":  "pending_verification",
+		})
 		return
 	}
 
@@ -117,6 +247,14 @@ func (h *AuthHelper) Logout(c *gin.Context) {
 					// Log but don't fail logout
 					c.Header("X-Warning", "Failed to revoke refresh tokens")
 				}
+
+				// Deny the current access token for its remaining lifetime
+				if claims.ExpiresAt != nil {
+					err = h.TokenRevocationService.RevokeAccessToken(claims.ID, claims.UserID, claims.ExpiresAt.Time, service.RevocationReasonLogout)
+					if err != nil {
+						c.Header("X-Warning", "Failed to revoke access token")
+					}
+				}
 			}
 		}
 	}
@@ -142,10 +280,20 @@ func (h *AuthHelper) GetProfile(c *gin.Context) {
 		return
 	}
 
-	c.JSON(200, gin.H{
+	response := gin.H{
 		"message": "Profile retrieved successfully",
 		"data":    user,
-	})
+	}
+	// Tells the frontend to show an impersonation banner
+	if impersonatorID := c.GetString("impersonator_id"); impersonatorID != "" {
+		response["impersonation"] = gin.H{
+			"impersonated":       true,
+			"impersonator_id":    impersonatorID,
+			"impersonator_email": c.GetString("impersonator_email"),
+		}
+	}
+
+	c.JSON(200, response)
 }
 
 // RefreshToken handles token refreshing
@@ -164,6 +312,11 @@ func (h *AuthHelper) RefreshToken(c *gin.Context) {
 	// Refresh tokens
 	tokenResponse, err := h.RefreshTokenService.RefreshTokens(req.RefreshToken, &clientIP, &userAgent)
 	if err != nil {
+		if errors.Is(err, service.ErrRefreshInProgress) {
+			c.Header("Retry-After", "1")
+			c.JSON(409, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(401, gin.H{"error": err.Error()})
 		return
 	}
@@ -228,6 +381,13 @@ func (h *AuthHelper) LogoutAllDevices(c *gin.Context) {
 		return
 	}
 
+	// Invalidate access tokens already issued to every device
+	err = h.TokenRevocationService.InvalidateUserTokens(claims.UserID, service.RevocationReasonLogoutAll)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to logout from all devices"})
+		return
+	}
+
 	c.JSON(200, gin.H{
 		"message": "Logged out from all devices successfully",
 		"status":  "success",
@@ -289,3 +449,562 @@ func (h *AuthHelper) GetActiveTokens(c *gin.Context) {
 		"total":         len(tokenInfos),
 	})
 }
+
+// GetSessions lists the active login sessions of the current user with device and location
+func (h *AuthHelper) GetSessions(c *gin.Context) {
+	sessions, err := h.SessionService.GetSessions(c.GetString("user_id"), c.GetString("session_id"))
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to retrieve sessions"})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message":  "Sessions retrieved successfully",
+		"sessions": sessions,
+		"total":    len(sessions),
+	})
+}
+
+// RevokeSession ends one session of the current user, including the current one
+func (h *AuthHelper) RevokeSession(c *gin.Context) {
+	err := h.SessionService.RevokeSession(c.GetString("user_id"), c.Param("id"))
+	if err != nil {
+		if err.Error() == "session not found" {
+			c.JSON(404, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(500, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message": "Session revoked successfully",
+		"status":  "success",
+		"current": c.Param("id") == c.GetString("session_id"),
+	})
+}
+
+// GetLoginHistory returns recent login attempts of the current user
+func (h *AuthHelper) GetLoginHistory(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(401, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	attempts, err := h.LoginService.GetLoginHistory(userID.(string), limit)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to retrieve login history"})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message":  "Login history retrieved successfully",
+		"attempts": attempts,
+		"count":    len(attempts),
+	})
+}
+
+// ForgotPassword emails a password reset link, the response is the same whether or not the email is registered
+func (h *AuthHelper) ForgotPassword(c *gin.Context) {
+	var req struct {
+		Email string `json:"email"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	if err := h.PasswordResetService.RequestPasswordReset(req.Email, c.ClientIP()); err != nil {
+		if err.Error() == "email is required" {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(500, gin.H{"error": "Failed to process password reset request"})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message": "If the email is registered, a password reset link has been sent",
+		"status":  "success",
+	})
+}
+
+// ResetPassword sets a new password with a reset token and logs out all sessions
+func (h *AuthHelper) ResetPassword(c *gin.Context) {
+	var req struct {
+		Token       string `json:"token"`
+		NewPassword string `json:"new_password"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	if err := h.PasswordResetService.ResetPassword(req.Token, req.NewPassword); err != nil {
+		switch {
+		case err.Error() == "invalid or expired reset token", err.Error() == "reset token is required",
+			service.IsPasswordPolicyError(err):
+			c.JSON(400, gin.H{"error": err.Error()})
+		default:
+			c.JSON(500, gin.H{"error": "Failed to reset password"})
+		}
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message": "Password reset successfully, please login with your new password",
+		"status":  "success",
+	})
+}
+
+// ChangePassword sets a new password for the current user. All other sessions are logged out,
+// the current one continues with the token pair returned in the response.
+func (h *AuthHelper) ChangePassword(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(401, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	if err := h.PasswordService.ChangePassword(userID.(string), req.CurrentPassword, req.NewPassword); err != nil {
+		switch {
+		case err.Error() == "current password is incorrect":
+			c.JSON(401, gin.H{"error": err.Error()})
+		case err.Error() == "user not found":
+			c.JSON(404, gin.H{"error": err.Error()})
+		case err.Error() == "current password is required", service.IsPasswordPolicyError(err):
+			c.JSON(400, gin.H{"error": err.Error()})
+		default:
+			c.JSON(500, gin.H{"error": "Failed to change password"})
+		}
+		return
+	}
+
+	// End every session, including this one, then start a fresh session for the caller
+	if err := h.RefreshTokenService.RevokeUserRefreshTokens(userID.(string)); err != nil {
+		c.Header("X-Warning", "Failed to revoke refresh tokens")
+	}
+	if err := h.TokenRevocationService.InvalidateUserTokens(userID.(string), service.RevocationReasonPasswordChanged); err != nil {
+		c.Header("X-Warning", "Failed to revoke access tokens")
+	}
+
+	user, err := h.LoginService.GetUserInfo(userID.(string))
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Password changed, please login again"})
+		return
+	}
+
+	tokenPair, err := h.issueTokenPair(c, user)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Password changed, please login again"})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message":       "Password changed successfully, other sessions have been logged out",
+		"access_token":  tokenPair.AccessToken,
+		"refresh_token": tokenPair.RefreshToken,
+		"token_type":    tokenPair.TokenType,
+		"expires_in":    tokenPair.ExpiresIn,
+	})
+}
+
+// verifyEmailPage is opened by the emailed link. Only its button uses the token up, so mail
+// scanners and link previews that fetch the link don't verify the address.
+var verifyEmailPage = template.Must(template.New("verify-email").Parse(`<!DOCTYPE html>
+<html lang="id">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Verifikasi Email</title>
+<style>body{font-family:sans-serif;max-width:32rem;margin:4rem auto;padding:0 1rem}button{padding:.6rem 1.2rem}</style>
+</head>
+<body>
+<h1>Verifikasi Email</h1>
+<p>{{.Message}}</p>
+{{if .Confirm}}<form method="post" action="{{.Action}}">
+<input type="hidden" name="token" value="{{.Token}}">
+<button type="submit">Verifikasi email saya</button>
+</form>{{end}}
+</body>
+</html>
+`))
+
+type verifyEmailPageData struct {
+	Message string
+	Confirm bool
+	Action  string
+	Token   string
+}
+
+func renderVerifyEmailPage(c *gin.Context, status int, data verifyEmailPageData) {
+	// The token is in the URL, it must not be cached, leak through Referer or be clicked in a frame
+	c.Header("Cache-Control", "no-store")
+	c.Header("Referrer-Policy", "no-referrer")
+	c.Header("X-Frame-Options", "DENY")
+	c.Header("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; form-action 'self'; frame-ancestors 'none'")
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(status)
+	if err := verifyEmailPage.Execute(c.Writer, data); err != nil {
+		c.Error(err)
+	}
+}
+
+// ShowVerifyEmail renders the confirmation page of the emailed link, it checks the token without using it
+func (h *AuthHelper) ShowVerifyEmail(c *gin.Context) {
+	data := verifyEmailPageData{Action: c.Request.URL.Path, Token: c.Query("token")}
+
+	if err := h.EmailVerificationService.CheckVerificationToken(data.Token); err != nil {
+		if err.Error() == "invalid or expired verification token" || err.Error() == "verification token is required" {
+			data.Message = "Tautan verifikasi tidak valid atau sudah kedaluwarsa. Minta tautan baru dari halaman login."
+			renderVerifyEmailPage(c, 400, data)
+			return
+		}
+		data.Message = "Verifikasi email sedang tidak dapat diproses. Silakan coba lagi nanti."
+		renderVerifyEmailPage(c, 500, data)
+		return
+	}
+
+	data.Message = "Klik tombol di bawah untuk memverifikasi alamat email akun Anda."
+	data.Confirm = true
+	renderVerifyEmailPage(c, 200, data)
+}
+
+// VerifyEmail confirms an email address with the token from the verification link
+func (h *AuthHelper) VerifyEmail(c *gin.Context) {
+	// The confirmation page posts a form and gets a page back, API clients post JSON
+	if c.ContentType() == "application/x-www-form-urlencoded" {
+		data := verifyEmailPageData{Message: "Email berhasil diverifikasi. Silakan login."}
+		status := 200
+		if err := h.EmailVerificationService.VerifyEmail(c.PostForm("token")); err != nil {
+			status, data.Message = 400, "Tautan verifikasi tidak valid atau sudah kedaluwarsa. Minta tautan baru dari halaman login."
+			if strings.HasPrefix(err.Error(), "failed to") {
+				status, data.Message = 500, "Verifikasi email sedang tidak dapat diproses. Silakan coba lagi nanti."
+			}
+		}
+		renderVerifyEmailPage(c, status, data)
+		return
+	}
+
+	var req struct {
+		Token string `json:"token"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	if err := h.EmailVerificationService.VerifyEmail(req.Token); err != nil {
+		if err.Error() == "invalid or expired verification token" || err.Error() == "verification token is required" {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(500, gin.H{"error": "Failed to verify email"})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message": "Email verified successfully, you can now login",
+		"status":  "success",
+	})
+}
+
+// ResendVerification emails a new verification link, the response is the same for every email
+func (h *AuthHelper) ResendVerification(c *gin.Context) {
+	var req struct {
+		Email string `json:"email"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	if err := h.EmailVerificationService.ResendVerification(req.Email); err != nil {
+		if err.Error() == "email is required" {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(500, gin.H{"error": "Failed to process verification request"})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message": "If the account is awaiting verification, a new link has been sent",
+		"status":  "success",
+	})
+}
+
+// respondMFAError maps two-factor authentication errors to status codes
+func respondMFAError(c *gin.Context, err error, failureMessage string) {
+	var loginErr *service.LoginError
+	if errors.As(err, &loginErr) {
+		if loginErr.RetryAfter > 0 {
+			retryAfter := int(math.Ceil(loginErr.RetryAfter.Seconds()))
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.JSON(429, gin.H{
+				"error":               loginErr.Message,
+				"code":                loginErr.Code,
+				"retry_after_seconds": retryAfter,
+			})
+			return
+		}
+		c.JSON(401, gin.H{"error": loginErr.Message, "code": loginErr.Code})
+		return
+	}
+
+	switch {
+	case err.Error() == "invalid or expired MFA token", err.Error() == "MFA token is required",
+		err.Error() == "current password is incorrect":
+		c.JSON(401, gin.H{"error": err.Error()})
+	case err.Error() == "two-factor authentication is mandatory for your role":
+		c.JSON(403, gin.H{"error": err.Error()})
+	case err.Error() == "user not found":
+		c.JSON(404, gin.H{"error": err.Error()})
+	case strings.HasPrefix(err.Error(), "failed to"):
+		c.JSON(500, gin.H{"error": failureMessage})
+	default:
+		c.JSON(400, gin.H{"error": err.Error()})
+	}
+}
+
+// VerifyMFA completes a login with a TOTP code or a recovery code and the mfa_token from Login
+func (h *AuthHelper) VerifyMFA(c *gin.Context) {
+	var req struct {
+		MFAToken     string `json:"mfa_token"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	if req.Code == "" && req.RecoveryCode == "" {
+		c.JSON(400, gin.H{"error": "code or recovery_code is required"})
+		return
+	}
+
+	user, err := h.MFAService.VerifyChallenge(req.MFAToken, req.Code, req.RecoveryCode, c.ClientIP(), c.GetHeader("User-Agent"))
+	if err != nil {
+		respondMFAError(c, err, "Failed to verify two-factor authentication")
+		return
+	}
+
+	tokenPair, err := h.issueTokenPair(c, user)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to generate tokens"})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message":       "Login successful",
+		"access_token":  tokenPair.AccessToken,
+		"refresh_token": tokenPair.RefreshToken,
+		"token_type":    tokenPair.TokenType,
+		"expires_in":    tokenPair.ExpiresIn,
+		"user":          user,
+	})
+}
+
+// StartMFAEnrollment returns a new TOTP secret for a login whose role requires two-factor authentication
+func (h *AuthHelper) StartMFAEnrollment(c *gin.Context) {
+	var req struct {
+		MFAToken string `json:"mfa_token"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	enrollment, err := h.MFAService.StartEnrollmentWithChallenge(req.MFAToken)
+	if err != nil {
+		respondMFAError(c, err, "Failed to start two-factor enrollment")
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message": "Scan the QR code with an authenticator app, then confirm with a code",
+		"data":    enrollment,
+	})
+}
+
+// ConfirmMFAEnrollment enables two-factor authentication during login and completes the login
+func (h *AuthHelper) ConfirmMFAEnrollment(c *gin.Context) {
+	var req struct {
+		MFAToken string `json:"mfa_token"`
+		Code     string `json:"code"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	user, recoveryCodes, err := h.MFAService.EnrollWithChallenge(req.MFAToken, req.Code, c.ClientIP(), c.GetHeader("User-Agent"))
+	if err != nil {
+		respondMFAError(c, err, "Failed to enable two-factor authentication")
+		return
+	}
+
+	tokenPair, err := h.issueTokenPair(c, user)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Two-factor authentication enabled, please login again"})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message":        "Two-factor authentication enabled, store the recovery codes in a safe place",
+		"recovery_codes": recoveryCodes,
+		"access_token":   tokenPair.AccessToken,
+		"refresh_token":  tokenPair.RefreshToken,
+		"token_type":     tokenPair.TokenType,
+		"expires_in":     tokenPair.ExpiresIn,
+		"user":           user,
+	})
+}
+
+// GetMFAStatus returns the two-factor authentication state of the current user
+func (h *AuthHelper) GetMFAStatus(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(401, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	status, err := h.MFAService.GetStatus(userID.(string), c.GetString("user_role"))
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to retrieve two-factor status"})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message": "Two-factor status retrieved successfully",
+		"data":    status,
+	})
+}
+
+// SetupMFA starts two-factor enrollment for the current user
+func (h *AuthHelper) SetupMFA(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(401, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	enrollment, err := h.MFAService.StartEnrollment(userID.(string))
+	if err != nil {
+		respondMFAError(c, err, "Failed to start two-factor enrollment")
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message": "Scan the QR code with an authenticator app, then confirm with a code",
+		"data":    enrollment,
+	})
+}
+
+// EnableMFA confirms enrollment with the first code and returns the recovery codes
+func (h *AuthHelper) EnableMFA(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(401, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req struct {
+		Code string `json:"code"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	recoveryCodes, err := h.MFAService.ConfirmEnrollment(userID.(string), req.Code)
+	if err != nil {
+		respondMFAError(c, err, "Failed to enable two-factor authentication")
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message":        "Two-factor authentication enabled, store the recovery codes in a safe place",
+		"recovery_codes": recoveryCodes,
+	})
+}
+
+// DisableMFA turns off two-factor authentication, requires the password and a current code
+func (h *AuthHelper) DisableMFA(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(401, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req struct {
+		Password     string `json:"password"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	if err := h.MFAService.Disable(userID.(string), c.GetString("user_role"), req.Password, req.Code, req.RecoveryCode); err != nil {
+		respondMFAError(c, err, "Failed to disable two-factor authentication")
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message": "Two-factor authentication disabled",
+		"status":  "success",
+	})
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of the current user
+func (h *AuthHelper) RegenerateRecoveryCodes(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(401, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var req struct {
+		Code string `json:"code"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(400, gin.H{"error": "Invalid request format"})
+		return
+	}
+
+	recoveryCodes, err := h.MFAService.RegenerateRecoveryCodes(userID.(string), req.Code)
+	if err != nil {
+		respondMFAError(c, err, "Failed to regenerate recovery codes")
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message":        "New recovery codes generated, previous codes no longer work",
+		"recovery_codes": recoveryCodes,
+	})
+}
@@ -0,0 +1,125 @@
+package helper
+
+import (
+	"prestasi-mahasiswa/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type BadgeHelper struct {
+	BadgeService       *service.BadgeService
+	AchievementService *service.AchievementService
+}
+
+func NewBadgeHelper(badgeService *service.BadgeService, achievementService *service.AchievementService) *BadgeHelper {
+	return &BadgeHelper{
+		BadgeService:       badgeService,
+		AchievementService: achievementService,
+	}
+}
+
+// GetIssuer returns hosted Open Badges issuer profile
+func (h *BadgeHelper) GetIssuer(c *gin.Context) {
+	c.JSON(200, h.BadgeService.GetIssuer())
+}
+
+// GetBadgeClass returns hosted BadgeClass for category/level
+func (h *BadgeHelper) GetBadgeClass(c *gin.Context) {
+	badgeClass, err := h.BadgeService.GetBadgeClass(c.Param("slug"))
+	if err != nil {
+		if err.Error() == "badge class not found" {
+			c.JSON(404, gin.H{"error": "Badge class not found"})
+			return
+		}
+		c.JSON(500, gin.H{"error": "Failed to retrieve badge class"})
+		return
+	}
+
+	c.JSON(200, badgeClass)
+}
+
+// GetBadgeImage returns PNG image of a BadgeClass
+func (h *BadgeHelper) GetBadgeImage(c *gin.Context) {
+	image, err := h.BadgeService.RenderBadgeImage(c.Param("slug"))
+	if err != nil {
+		if err.Error() == "badge class not found" {
+			c.JSON(404, gin.H{"error": "Badge class not found"})
+			return
+		}
+		c.JSON(500, gin.H{"error": "Failed to render badge image"})
+		return
+	}
+
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.Data(200, "image/png", image)
+}
+
+// GetAssertion returns hosted assertion (HostedBadge verification)
+func (h *BadgeHelper) GetAssertion(c *gin.Context) {
+	assertion, err := h.BadgeService.GetAssertion(c.Param("code"))
+	if err != nil {
+		if err.Error() == "assertion not found" {
+			c.JSON(404, gin.H{"error": "Assertion not found"})
+			return
+		}
+		c.JSON(500, gin.H{"error": "Failed to retrieve assertion"})
+		return
+	}
+
+	c.JSON(200, assertion)
+}
+
+// GetAchievementBadge returns assertion JSON of one verified achievement
+func (h *BadgeHelper) GetAchievementBadge(c *gin.Context) {
+	id := c.Param("id")
+	if id == "" {
+		c.JSON(400, gin.H{"error": "Achievement ID is required"})
+		return
+	}
+
+	achievement, err := h.AchievementService.GetAchievementByID(id)
+	if err != nil {
+		c.JSON(404, gin.H{"error": "Achievement not found"})
+		return
+	}
+
+	// Without achievement:read_all users can only export their own achievements
+	userID, _ := c.Get("user_id")
+	if !canReadAllAchievements(c) && achievement.MahasiswaID != userID.(string) {
+		c.JSON(403, gin.H{"error": "Access denied: You can only export your own achievements"})
+		return
+	}
+
+	assertion, err := h.BadgeService.BuildAssertion(id)
+	if err != nil {
+		c.JSON(400, gin.H{"error": "Failed to export badge", "details": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message": "Badge exported successfully",
+		"data":    assertion,
+	})
+}
+
+// ExportMyBadges returns assertions of all verified achievements of current mahasiswa
+func (h *BadgeHelper) ExportMyBadges(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(401, gin.H{"error": "User ID not found"})
+		return
+	}
+
+	assertions, err := h.BadgeService.ExportStudentAssertions(userID.(string))
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to export badges", "details": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message": "Badges exported successfully",
+		"issuer":  h.BadgeService.GetIssuer().ID,
+		"data":    assertions,
+		"total":   len(assertions),
+	})
+}
@@ -0,0 +1,121 @@
+package helper
+
+import (
+	"net/http"
+	"strings"
+
+	"prestasi-mahasiswa/middleware"
+	"prestasi-mahasiswa/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type DelegationHelper struct {
+	DelegationService *service.DelegationService
+}
+
+func NewDelegationHelper(delegationService *service.DelegationService) *DelegationHelper {
+	return &DelegationHelper{
+		DelegationService: delegationService,
+	}
+}
+
+// GetDelegations lists delegations given or received by the signed-in dosen.
+// Users with user:manage see every delegation, optionally of one user_id.
+func (h *DelegationHelper) GetDelegations(c *gin.Context) {
+	userID := c.GetString("user_id")
+	if middleware.HasPermission(c, middleware.PermissionUserManage) {
+		userID = c.Query("user_id")
+	}
+
+	delegations, err := h.DelegationService.GetDelegations(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to get delegations",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Delegations retrieved successfully",
+		"data": gin.H{
+			"delegations": delegations,
+			"total":       len(delegations),
+		},
+	})
+}
+
+// CreateDelegation delegates the approvals of the signed-in dosen, or with user:manage of delegator_id
+func (h *DelegationHelper) CreateDelegation(c *gin.Context) {
+	var req service.CreateDelegationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request data",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	userID := c.GetString("user_id")
+	if req.DelegatorID == "" {
+		req.DelegatorID = userID
+	} else if req.DelegatorID != userID && !middleware.HasPermission(c, middleware.PermissionUserManage) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"success": false,
+			"message": "Failed to create delegation",
+			"error":   "only admins can delegate on behalf of another dosen",
+		})
+		return
+	}
+
+	delegation, err := h.DelegationService.CreateDelegation(req, userID)
+	if err != nil {
+		status := http.StatusBadRequest
+		switch {
+		case err.Error() == "user not found":
+			status = http.StatusNotFound
+		case strings.HasPrefix(err.Error(), "delegation overlaps"):
+			status = http.StatusConflict
+		case strings.HasPrefix(err.Error(), "failed to"):
+			status = http.StatusInternalServerError
+		}
+		c.JSON(status, gin.H{
+			"success": false,
+			"message": "Failed to create delegation",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"message": "Delegation created successfully",
+		"data":    delegation,
+	})
+}
+
+// RevokeDelegation ends a delegation early, by its delegator or a user with user:manage
+func (h *DelegationHelper) RevokeDelegation(c *gin.Context) {
+	canRevokeAny := middleware.HasPermission(c, middleware.PermissionUserManage)
+	if err := h.DelegationService.RevokeDelegation(c.Param("id"), c.GetString("user_id"), canRevokeAny); err != nil {
+		status := http.StatusInternalServerError
+		if err.Error() == "delegation not found" {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{
+			"success": false,
+			"message": "Failed to revoke delegation",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Delegation revoked successfully",
+	})
+}
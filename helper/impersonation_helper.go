@@ -0,0 +1,130 @@
+package helper
+
+import (
+	"net/http"
+	"strings"
+
+	"prestasi-mahasiswa/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type ImpersonationHelper struct {
+	ImpersonationService *service.ImpersonationService
+}
+
+func NewImpersonationHelper(impersonationService *service.ImpersonationService) *ImpersonationHelper {
+	return &ImpersonationHelper{
+		ImpersonationService: impersonationService,
+	}
+}
+
+// StartImpersonation issues a short-lived access token to act as the user (admin)
+func (h *ImpersonationHelper) StartImpersonation(c *gin.Context) {
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request data",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	token, err := h.ImpersonationService.StartImpersonation(c.GetString("user_id"), c.Param("id"), req.Reason,
+		c.ClientIP(), c.GetHeader("User-Agent"))
+	if err != nil {
+		status := http.StatusBadRequest
+		switch {
+		case err.Error() == "user not found":
+			status = http.StatusNotFound
+		case err.Error() == "admin accounts can't be impersonated", err.Error() == "only admins can impersonate users":
+			status = http.StatusForbidden
+		case strings.HasPrefix(err.Error(), "failed to"), strings.HasPrefix(err.Error(), "database error"):
+			status = http.StatusInternalServerError
+		}
+		c.JSON(status, gin.H{
+			"success": false,
+			"message": "Failed to start impersonation",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"message": "Impersonation started, every request with this token is recorded",
+		"data":    token,
+	})
+}
+
+// GetSessions lists impersonation sessions, filtered by ?actor_id= and ?user_id= (admin)
+func (h *ImpersonationHelper) GetSessions(c *gin.Context) {
+	sessions, err := h.ImpersonationService.GetSessions(c.Query("actor_id"), c.Query("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to get impersonation sessions",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Impersonation sessions retrieved successfully",
+		"data": gin.H{
+			"sessions": sessions,
+			"total":    len(sessions),
+		},
+	})
+}
+
+// GetSessionRequests returns the audit trail of one impersonation session (admin)
+func (h *ImpersonationHelper) GetSessionRequests(c *gin.Context) {
+	requests, err := h.ImpersonationService.GetSessionRequests(c.Param("id"))
+	if err != nil {
+		status := http.StatusInternalServerError
+		if err.Error() == "impersonation session not found" {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{
+			"success": false,
+			"message": "Failed to get impersonated requests",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Impersonated requests retrieved successfully",
+		"data": gin.H{
+			"requests": requests,
+			"total":    len(requests),
+		},
+	})
+}
+
+// EndImpersonation revokes the token of an active session (admin)
+func (h *ImpersonationHelper) EndImpersonation(c *gin.Context) {
+	if err := h.ImpersonationService.EndImpersonation(c.Param("id")); err != nil {
+		status := http.StatusInternalServerError
+		if err.Error() == "active impersonation session not found" {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{
+			"success": false,
+			"message": "Failed to end impersonation",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Impersonation ended successfully",
+	})
+}
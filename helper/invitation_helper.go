@@ -0,0 +1,106 @@
+package helper
+
+import (
+	"net/http"
+	"strings"
+
+	"prestasi-mahasiswa/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type InvitationHelper struct {
+	InvitationService *service.InvitationService
+}
+
+func NewInvitationHelper(invitationService *service.InvitationService) *InvitationHelper {
+	return &InvitationHelper{
+		InvitationService: invitationService,
+	}
+}
+
+// GetInvitations lists registration invitation codes (admin)
+func (h *InvitationHelper) GetInvitations(c *gin.Context) {
+	invitations, err := h.InvitationService.GetInvitations()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to get invitations",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Invitations retrieved successfully",
+		"data": gin.H{
+			"invitations": invitations,
+			"total":       len(invitations),
+		},
+	})
+}
+
+// CreateInvitation creates a code bound to a role, the code is only returned in this response (admin)
+func (h *InvitationHelper) CreateInvitation(c *gin.Context) {
+	var req service.CreateInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request data",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	adminID, _ := c.Get("user_id")
+	createdBy, _ := adminID.(string)
+
+	invitation, code, err := h.InvitationService.CreateInvitation(req, createdBy)
+	if err != nil {
+		status := http.StatusBadRequest
+		if strings.HasPrefix(err.Error(), "failed to") {
+			status = http.StatusInternalServerError
+		}
+		c.JSON(status, gin.H{
+			"success": false,
+			"message": "Failed to create invitation",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"message": "Invitation created successfully, share the code now as it can't be shown again",
+		"data": gin.H{
+			"code":       code,
+			"invitation": invitation,
+		},
+	})
+}
+
+// RevokeInvitation disables an invitation code (admin)
+func (h *InvitationHelper) RevokeInvitation(c *gin.Context) {
+	if err := h.InvitationService.RevokeInvitation(c.Param("id")); err != nil {
+		if err.Error() == "invitation not found" {
+			c.JSON(http.StatusNotFound, gin.H{
+				"success": false,
+				"message": "Invitation not found",
+			})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to revoke invitation",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Invitation revoked successfully",
+	})
+}
@@ -0,0 +1,124 @@
+package helper
+
+import (
+	"net/http"
+	"strconv"
+
+	"prestasi-mahasiswa/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type JobHelper struct {
+	JobSchedulerService *service.JobSchedulerService
+}
+
+func NewJobHelper(jobSchedulerService *service.JobSchedulerService) *JobHelper {
+	return &JobHelper{
+		JobSchedulerService: jobSchedulerService,
+	}
+}
+
+// GetJobs lists scheduled jobs with their state and last run (admin)
+func (h *JobHelper) GetJobs(c *gin.Context) {
+	jobs, err := h.JobSchedulerService.GetJobs()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to get jobs",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Jobs retrieved successfully",
+		"data": gin.H{
+			"jobs":  jobs,
+			"total": len(jobs),
+		},
+	})
+}
+
+// GetJobRuns lists the latest runs of a job, ?limit up to 200 (admin)
+func (h *JobHelper) GetJobRuns(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+
+	runs, err := h.JobSchedulerService.GetJobRuns(c.Param("name"), limit)
+	if err != nil {
+		c.JSON(jobErrorStatus(err), gin.H{
+			"success": false,
+			"message": "Failed to get job runs",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Job runs retrieved successfully",
+		"data": gin.H{
+			"runs":  runs,
+			"total": len(runs),
+		},
+	})
+}
+
+// TriggerJob starts a job now, the run continues in the background (admin)
+func (h *JobHelper) TriggerJob(c *gin.Context) {
+	run, err := h.JobSchedulerService.TriggerJob(c.Param("name"), c.GetString("user_id"))
+	if err != nil {
+		c.JSON(jobErrorStatus(err), gin.H{
+			"success": false,
+			"message": "Failed to trigger job",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{
+		"success": true,
+		"message": "Job started",
+		"data":    run,
+	})
+}
+
+// PauseJob stops a job from running on its schedule (admin)
+func (h *JobHelper) PauseJob(c *gin.Context) {
+	h.setPaused(c, true, "Job paused")
+}
+
+// ResumeJob puts a paused job back on its schedule (admin)
+func (h *JobHelper) ResumeJob(c *gin.Context) {
+	h.setPaused(c, false, "Job resumed")
+}
+
+func (h *JobHelper) setPaused(c *gin.Context, paused bool, message string) {
+	job, err := h.JobSchedulerService.SetPaused(c.Param("name"), paused)
+	if err != nil {
+		c.JSON(jobErrorStatus(err), gin.H{
+			"success": false,
+			"message": "Failed to update job",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": message,
+		"data":    job,
+	})
+}
+
+func jobErrorStatus(err error) int {
+	switch err.Error() {
+	case "job not found":
+		return http.StatusNotFound
+	case "job is already running":
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
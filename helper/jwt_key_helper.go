@@ -0,0 +1,60 @@
+package helper
+
+import (
+	"prestasi-mahasiswa/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type JWTKeyHelper struct {
+	JWTKeyService *service.JWTKeyService
+}
+
+func NewJWTKeyHelper(jwtKeyService *service.JWTKeyService) *JWTKeyHelper {
+	return &JWTKeyHelper{
+		JWTKeyService: jwtKeyService,
+	}
+}
+
+// GetJWKS publishes token verification keys so other services can verify access tokens
+func (h *JWTKeyHelper) GetJWKS(c *gin.Context) {
+	keySet, err := h.JWTKeyService.GetJWKS()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to retrieve signing keys"})
+		return
+	}
+
+	// Short cache so consumers pick up rotated keys quickly
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(200, keySet)
+}
+
+// GetKeys lists token signing keys with their status (admin)
+func (h *JWTKeyHelper) GetKeys(c *gin.Context) {
+	keys, err := h.JWTKeyService.GetKeys()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to retrieve signing keys", "details": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message":   "Signing keys retrieved successfully",
+		"algorithm": h.JWTKeyService.Algorithm,
+		"data":      keys,
+		"total":     len(keys),
+	})
+}
+
+// RotateKey retires the active token signing key and creates a new one (admin)
+func (h *JWTKeyHelper) RotateKey(c *gin.Context) {
+	key, err := h.JWTKeyService.RotateKey()
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to rotate signing key", "details": err.Error()})
+		return
+	}
+
+	c.JSON(201, gin.H{
+		"message": "Signing key rotated successfully",
+		"data":    key,
+	})
+}
@@ -0,0 +1,180 @@
+package helper
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"prestasi-mahasiswa/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type NotificationHelper struct {
+	NotificationService *service.NotificationService
+}
+
+func NewNotificationHelper(notificationService *service.NotificationService) *NotificationHelper {
+	return &NotificationHelper{
+		NotificationService: notificationService,
+	}
+}
+
+// UpdateNotificationPreferencesRequest turns event types on or off, e.g. {"achievement_verified": false}
+type UpdateNotificationPreferencesRequest struct {
+	Preferences map[string]bool `json:"preferences" binding:"required"`
+}
+
+// GetNotifications lists the signed-in user's notifications with their unread count,
+// ?unread=true for unread ones only, ?limit (max 100) and ?offset to page
+func (h *NotificationHelper) GetNotifications(c *gin.Context) {
+	userID := c.GetString("user_id")
+	unreadOnly, _ := strconv.ParseBool(c.DefaultQuery("unread", "false"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+
+	notifications, err := h.NotificationService.GetNotifications(userID, unreadOnly, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to get notifications",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	unreadCount, err := h.NotificationService.UnreadCount(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to get notifications",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Notifications retrieved successfully",
+		"data": gin.H{
+			"notifications": notifications,
+			"unread_count":  unreadCount,
+		},
+	})
+}
+
+// GetUnreadCount returns the signed-in user's unread notification count, for badges
+func (h *NotificationHelper) GetUnreadCount(c *gin.Context) {
+	unreadCount, err := h.NotificationService.UnreadCount(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to count notifications",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Unread count retrieved successfully",
+		"data": gin.H{
+			"unread_count": unreadCount,
+		},
+	})
+}
+
+// MarkRead marks one of the signed-in user's notifications as read
+func (h *NotificationHelper) MarkRead(c *gin.Context) {
+	err := h.NotificationService.MarkRead(c.GetString("user_id"), c.Param("id"))
+	if err != nil {
+		status := http.StatusInternalServerError
+		if err.Error() == "notification not found" {
+			status = http.StatusNotFound
+		}
+		c.JSON(status, gin.H{
+			"success": false,
+			"message": "Failed to mark notification as read",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Notification marked as read",
+	})
+}
+
+// MarkAllRead marks all of the signed-in user's notifications as read
+func (h *NotificationHelper) MarkAllRead(c *gin.Context) {
+	marked, err := h.NotificationService.MarkAllRead(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to mark notifications as read",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Notifications marked as read",
+		"data": gin.H{
+			"marked": marked,
+		},
+	})
+}
+
+// GetPreferences lists the event types and whether the signed-in user receives them
+func (h *NotificationHelper) GetPreferences(c *gin.Context) {
+	preferences, err := h.NotificationService.GetPreferences(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to get notification preferences",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Notification preferences retrieved successfully",
+		"data":    preferences,
+	})
+}
+
+// UpdatePreferences turns event types on or off for the signed-in user
+func (h *NotificationHelper) UpdatePreferences(c *gin.Context) {
+	var req UpdateNotificationPreferencesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request data",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	preferences, err := h.NotificationService.UpdatePreferences(c.GetString("user_id"), req.Preferences)
+	if err != nil {
+		status := http.StatusInternalServerError
+		if strings.HasPrefix(err.Error(), "unknown event type") {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{
+			"success": false,
+			"message": "Failed to update notification preferences",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Notification preferences updated successfully",
+		"data":    preferences,
+	})
+}
@@ -0,0 +1,125 @@
+package helper
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"prestasi-mahasiswa/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OIDCHelper handles single sign-on through the university identity provider.
+// Successful logins continue like password logins, including two-factor authentication.
+type OIDCHelper struct {
+	OIDCService *service.OIDCService
+	AuthHelper  *AuthHelper
+}
+
+// oidcStateCookieName binds a login to the browser that started it, a callback carrying a state
+// the browser didn't start (login CSRF) is refused
+const oidcStateCookieName = "oidc_state"
+
+func NewOIDCHelper(oidcService *service.OIDCService, authHelper *AuthHelper) *OIDCHelper {
+	return &OIDCHelper{
+		OIDCService: oidcService,
+		AuthHelper:  authHelper,
+	}
+}
+
+// Login redirects the browser to the identity provider, with ?redirect=false the URL is returned as JSON
+func (h *OIDCHelper) Login(c *gin.Context) {
+	if !h.OIDCService.Enabled() {
+		c.JSON(404, gin.H{"error": "Single sign-on is not configured"})
+		return
+	}
+
+	authURL, state, err := h.OIDCService.StartLogin()
+	if err != nil {
+		c.JSON(502, gin.H{"error": "Identity provider is unavailable"})
+		return
+	}
+	h.setStateCookie(c, state)
+
+	if c.Query("redirect") == "false" {
+		c.JSON(200, gin.H{"authorization_url": authURL})
+		return
+	}
+
+	c.Redirect(302, authURL)
+}
+
+// Callback completes single sign-on with the authorization code sent back by the identity provider
+func (h *OIDCHelper) Callback(c *gin.Context) {
+	if !h.OIDCService.Enabled() {
+		c.JSON(404, gin.H{"error": "Single sign-on is not configured"})
+		return
+	}
+
+	// The user cancelled or the IdP refused the request
+	if idpError := c.Query("error"); idpError != "" {
+		c.JSON(401, gin.H{"error": "Single sign-on was not completed", "code": idpError})
+		return
+	}
+
+	state := c.Query("state")
+	cookieState, _ := c.Cookie(oidcStateCookieName)
+	c.SetCookie(oidcStateCookieName, "", -1, "/", "", c.Request.TLS != nil, true)
+	if state == "" || subtle.ConstantTimeCompare([]byte(cookieState), []byte(state)) != 1 {
+		c.JSON(400, gin.H{"error": "invalid or expired login state"})
+		return
+	}
+
+	user, linked, err := h.OIDCService.CompleteLogin(state, c.Query("code"), c.ClientIP(), c.GetHeader("User-Agent"))
+	if err != nil {
+		switch {
+		case err.Error() == "state and code are required", err.Error() == "invalid or expired login state":
+			c.JSON(400, gin.H{"error": err.Error()})
+		case strings.HasPrefix(err.Error(), "single sign-on failed"):
+			c.JSON(401, gin.H{"error": "Single sign-on failed"})
+		case strings.HasPrefix(err.Error(), "failed to"):
+			c.JSON(500, gin.H{"error": "Failed to complete single sign-on"})
+		default:
+			// No linked account, inactive account or claims not sufficient to create one
+			c.JSON(403, gin.H{"error": err.Error()})
+		}
+		return
+	}
+
+	if linked {
+		c.JSON(200, gin.H{"message": "Single sign-on identity linked to your account"})
+		return
+	}
+
+	h.AuthHelper.completeLogin(c, user)
+}
+
+// StartLink returns the IdP authorization URL for linking the signed-in user's account to their
+// IdP identity, the callback links the identity instead of signing in
+func (h *OIDCHelper) StartLink(c *gin.Context) {
+	if !h.OIDCService.Enabled() {
+		c.JSON(404, gin.H{"error": "Single sign-on is not configured"})
+		return
+	}
+
+	// Linking lets the IdP identity sign in to the account, an impersonator must not link their own
+	if c.GetString("user_id") == "" || c.GetString("impersonator_id") != "" {
+		c.JSON(403, gin.H{"error": "Only the account owner can link a single sign-on identity"})
+		return
+	}
+
+	authURL, state, err := h.OIDCService.StartLink(c.GetString("user_id"))
+	if err != nil {
+		c.JSON(502, gin.H{"error": "Identity provider is unavailable"})
+		return
+	}
+	h.setStateCookie(c, state)
+
+	c.JSON(200, gin.H{"authorization_url": authURL})
+}
+
+func (h *OIDCHelper) setStateCookie(c *gin.Context, state string) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookieName, state, int(h.OIDCService.StateLifetime.Seconds()), "/", "", c.Request.TLS != nil, true)
+}
@@ -2,6 +2,7 @@ package helper
 
 import (
 	"prestasi-mahasiswa/service"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 )
@@ -54,6 +55,28 @@ func (h *ReportHelper) GetStudentReport(c *gin.Context) {
 	})
 }
 
+// GetVerifierSLA reports how quickly each dosen wali decides approval steps, ?days sets the period (default 90)
+func (h *ReportHelper) GetVerifierSLA(c *gin.Context) {
+	days, err := strconv.Atoi(c.DefaultQuery("days", "90"))
+	if err != nil || days < 1 || days > 3650 {
+		c.JSON(400, gin.H{"error": "days must be a number between 1 and 3650"})
+		return
+	}
+
+	report, err := h.ReportService.GetVerifierSLA(days)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to retrieve verifier SLA", "details": err.Error()})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message":   "Verifier SLA retrieved successfully",
+		"data":      report,
+		"days":      days,
+		"sla_hours": h.ReportService.DecisionSLA.Hours(),
+	})
+}
+
 // GetAchievementHistory retrieves status change history for an achievement
 func (h *ReportHelper) GetAchievementHistory(c *gin.Context) {
 	achievementID := c.Param("id")
@@ -0,0 +1,147 @@
+package helper
+
+import (
+	"net/http"
+	"strings"
+
+	"prestasi-mahasiswa/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RoleHelper struct {
+	PermissionService *service.PermissionService
+}
+
+func NewRoleHelper(permissionService *service.PermissionService) *RoleHelper {
+	return &RoleHelper{
+		PermissionService: permissionService,
+	}
+}
+
+// GetRoles lists roles with their permissions (admin)
+func (h *RoleHelper) GetRoles(c *gin.Context) {
+	roles, err := h.PermissionService.GetRoles()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"success": false,
+			"message": "Failed to get roles",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Roles retrieved successfully",
+		"data": gin.H{
+			"roles": roles,
+			"total": len(roles),
+		},
+	})
+}
+
+// GetPermissions lists every permission a role can be granted (admin)
+func (h *RoleHelper) GetPermissions(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Permissions retrieved successfully",
+		"data":    h.PermissionService.GetPermissions(),
+	})
+}
+
+// CreateRole adds a role (admin)
+func (h *RoleHelper) CreateRole(c *gin.Context) {
+	var req service.RoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request data",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	role, err := h.PermissionService.CreateRole(req)
+	if err != nil {
+		status := http.StatusBadRequest
+		switch {
+		case err.Error() == "role already exists":
+			status = http.StatusConflict
+		case strings.HasPrefix(err.Error(), "failed to"):
+			status = http.StatusInternalServerError
+		}
+		c.JSON(status, gin.H{
+			"success": false,
+			"message": "Failed to create role",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"success": true,
+		"message": "Role created successfully",
+		"data":    role,
+	})
+}
+
+// UpdateRole replaces the description and permissions of a role (admin)
+func (h *RoleHelper) UpdateRole(c *gin.Context) {
+	var req service.RoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"success": false,
+			"message": "Invalid request data",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	role, err := h.PermissionService.UpdateRole(c.Param("name"), req)
+	if err != nil {
+		status := http.StatusBadRequest
+		switch {
+		case err.Error() == "role not found":
+			status = http.StatusNotFound
+		case strings.HasPrefix(err.Error(), "failed to"):
+			status = http.StatusInternalServerError
+		}
+		c.JSON(status, gin.H{
+			"success": false,
+			"message": "Failed to update role",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Role updated successfully",
+		"data":    role,
+	})
+}
+
+// DeleteRole removes a role no user has (admin)
+func (h *RoleHelper) DeleteRole(c *gin.Context) {
+	if err := h.PermissionService.DeleteRole(c.Param("name")); err != nil {
+		status := http.StatusBadRequest
+		switch {
+		case err.Error() == "role not found":
+			status = http.StatusNotFound
+		case strings.HasPrefix(err.Error(), "failed to"):
+			status = http.StatusInternalServerError
+		}
+		c.JSON(status, gin.H{
+			"success": false,
+			"message": "Failed to delete role",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "Role deleted successfully",
+	})
+}
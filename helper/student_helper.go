@@ -134,6 +134,7 @@ func (h *StudentHelper) AssignAdvisor(c *gin.Context) {
 	err := h.UserService.AssignAdvisor(service.AssignAdvisorRequest{
 		MahasiswaID: studentID,
 		AdvisorID:   req.AdvisorID,
+		AssignedBy:  studentID,
 	})
 
 	if err != nil {
@@ -0,0 +1,70 @@
+package helper
+
+import (
+	"prestasi-mahasiswa/service"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type VerificationHelper struct {
+	CertificateService *service.CertificateService
+}
+
+func NewVerificationHelper(certificateService *service.CertificateService) *VerificationHelper {
+	return &VerificationHelper{
+		CertificateService: certificateService,
+	}
+}
+
+// GetVerification returns public details of a verified achievement
+func (h *VerificationHelper) GetVerification(c *gin.Context) {
+	code := c.Param("code")
+	if code == "" {
+		c.JSON(400, gin.H{"error": "Verification code is required"})
+		return
+	}
+
+	verification, err := h.CertificateService.GetPublicVerification(code)
+	if err != nil {
+		if err.Error() == "verification code not found" {
+			c.JSON(404, gin.H{
+				"valid": false,
+				"error": "Verification code not found",
+			})
+			return
+		}
+		c.JSON(500, gin.H{"error": "Failed to verify achievement"})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"message": "Achievement verified",
+		"valid":   true,
+		"data":    verification,
+	})
+}
+
+// GetVerificationQR returns QR code PNG encoding the public verification URL
+func (h *VerificationHelper) GetVerificationQR(c *gin.Context) {
+	code := c.Param("code")
+	if code == "" {
+		c.JSON(400, gin.H{"error": "Verification code is required"})
+		return
+	}
+
+	size, _ := strconv.Atoi(c.DefaultQuery("size", "256"))
+
+	png, err := h.CertificateService.GenerateVerificationQR(code, size)
+	if err != nil {
+		if err.Error() == "verification code not found" {
+			c.JSON(404, gin.H{"error": "Verification code not found"})
+			return
+		}
+		c.JSON(500, gin.H{"error": "Failed to generate QR code"})
+		return
+	}
+
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.Data(200, "image/png", png)
+}
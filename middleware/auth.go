@@ -4,23 +4,42 @@ import (
 	"net/http"
 	"strings"
 
+	"prestasi-mahasiswa/utils"
+
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 )
 
-// JWTClaims represents the JWT token claims
-type JWTClaims struct {
-	UserID string `json:"user_id"`
-	Email  string `json:"email"`
-	Role   string `json:"role"`
-	jwt.RegisteredClaims
+// AccessTokenVerifier validates access tokens, implemented by utils.JWTUtil
+type AccessTokenVerifier interface {
+	ValidateAccessToken(tokenString string) (*utils.Claims, error)
+}
+
+// TokenRevocationChecker reports access tokens revoked before their expiry
+type TokenRevocationChecker interface {
+	IsAccessTokenRevoked(jti, userID string, generation int) bool
 }
 
-// AuthMiddleware validates JWT token and extracts user info
-func AuthMiddleware(secretKey string) gin.HandlerFunc {
+// APIKeyVerifier resolves keys sent in the X-API-Key header, implemented by service.APIKeyService
+type APIKeyVerifier interface {
+	VerifyAPIKey(key, ipAddress string) (apiKeyID string, scopes []string, err error)
+}
+
+// APIKeyHeader carries API keys of machine-to-machine integrations
+const APIKeyHeader = "X-API-Key"
+
+// AuthMiddleware validates JWT token and extracts user info.
+// All checks (signature, algorithm, token type, issuer, audience, expiry) are done by verifier,
+// so refresh tokens are never accepted here. When revocations is not nil, denylisted tokens are rejected as well.
+// When apiKeys is not nil, requests without Authorization header may authenticate with an API key instead;
+// they get the api_client role, which only passes RequirePermissionOrScope for a granted scope.
+func AuthMiddleware(verifier AccessTokenVerifier, revocations TokenRevocationChecker, apiKeys APIKeyVerifier) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Get Authorization header
 		authHeader := c.GetHeader("Authorization")
+		if authHeader == "" && apiKeys != nil && c.GetHeader(APIKeyHeader) != "" {
+			authenticateAPIKey(c, apiKeys)
+			return
+		}
 		if authHeader == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"error":   "Authorization header required",
@@ -43,11 +62,8 @@ func AuthMiddleware(secretKey string) gin.HandlerFunc {
 
 		tokenString := tokenParts[1]
 
-		// Parse and validate token
-		token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-			return []byte(secretKey), nil
-		})
-
+		// Validate token with the shared verifier
+		claims, err := verifier.ValidateAccessToken(tokenString)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{
 				"error":   "Invalid token",
@@ -57,31 +73,55 @@ func AuthMiddleware(secretKey string) gin.HandlerFunc {
 			return
 		}
 
-		if !token.Valid {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error":   "Token expired or invalid",
-				"message": "Please login again",
-			})
-			c.Abort()
-			return
-		}
-
-		// Extract claims
-		claims, ok := token.Claims.(*JWTClaims)
-		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error":   "Invalid token claims",
-				"message": "Token format error",
-			})
-			c.Abort()
-			return
+		// Reject tokens revoked by logout, deactivation or role change
+		if revocations != nil {
+			// Impersonation tokens also end when the acting admin's sessions are invalidated
+			revoked := revocations.IsAccessTokenRevoked(claims.ID, claims.UserID, claims.Generation)
+			if !revoked && claims.IsImpersonated() {
+				revoked = revocations.IsAccessTokenRevoked(claims.ID, claims.Actor.Subject, claims.Actor.Generation)
+			}
+			if revoked {
+				c.JSON(http.StatusUnauthorized, gin.H{
+					"error":   "Token has been revoked",
+					"message": "Please login again",
+				})
+				c.Abort()
+				return
+			}
 		}
 
 		// Store user info in context
 		c.Set("user_id", claims.UserID)
 		c.Set("user_email", claims.Email)
 		c.Set("user_role", claims.Role)
+		c.Set("token_jti", claims.ID)
+		c.Set("session_id", claims.SessionID)
+		if claims.IsImpersonated() {
+			c.Set("impersonator_id", claims.Actor.Subject)
+			c.Set("impersonator_email", claims.Actor.Email)
+		}
 
 		c.Next()
 	}
 }
+
+// authenticateAPIKey stores the key as principal, the key id takes the place of the user id
+func authenticateAPIKey(c *gin.Context, apiKeys APIKeyVerifier) {
+	apiKeyID, scopes, err := apiKeys.VerifyAPIKey(c.GetHeader(APIKeyHeader), c.ClientIP())
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{
+			"error":   "Invalid API key",
+			"message": err.Error(),
+		})
+		c.Abort()
+		return
+	}
+
+	c.Set("user_id", "")
+	c.Set("user_email", "")
+	c.Set("user_role", RoleAPIClient)
+	c.Set("api_key_id", apiKeyID)
+	c.Set("api_key_scopes", scopes)
+
+	c.Next()
+}
@@ -0,0 +1,133 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"prestasi-mahasiswa/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type stubRevocations struct {
+	revokedJTI string
+}
+
+func (s stubRevocations) IsAccessTokenRevoked(jti, userID string, generation int) bool {
+	return jti == s.revokedJTI
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	jwtUtil := utils.NewJWTUtil("test-secret-key-that-is-long-enough-for-testing", 24)
+	accessToken, _ := jwtUtil.GenerateAccessToken("test-user-123", "test@example.com", "mahasiswa")
+	refreshToken, _ := jwtUtil.GenerateRefreshToken("test-user-123", "test@example.com", "mahasiswa")
+	revokedToken, _ := jwtUtil.GenerateAccessToken("test-user-123", "test@example.com", "mahasiswa")
+	revokedClaims, _ := jwtUtil.ValidateAccessToken(revokedToken)
+
+	tests := []struct {
+		name       string
+		header     string
+		wantStatus int
+	}{
+		{name: "valid access token", header: "Bearer " + accessToken, wantStatus: http.StatusOK},
+		{name: "missing header", header: "", wantStatus: http.StatusUnauthorized},
+		{name: "not bearer", header: "Basic " + accessToken, wantStatus: http.StatusUnauthorized},
+		{name: "refresh token", header: "Bearer " + refreshToken, wantStatus: http.StatusUnauthorized},
+		{name: "revoked access token", header: "Bearer " + revokedToken, wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/protected", AuthMiddleware(jwtUtil, stubRevocations{revokedJTI: revokedClaims.ID}, nil), func(c *gin.Context) {
+				c.JSON(http.StatusOK, gin.H{"user_id": c.GetString("user_id")})
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.wantStatus, recorder.Code, recorder.Body.String())
+			}
+		})
+	}
+}
+
+type stubAPIKeys struct{}
+
+func (stubAPIKeys) VerifyAPIKey(key, ipAddress string) (string, []string, error) {
+	if key != "pmk_valid" {
+		return "", nil, errors.New("invalid or expired API key")
+	}
+	return "key-1", []string{ScopeReportsRead}, nil
+}
+
+func TestAuthMiddlewareAPIKeys(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	jwtUtil := utils.NewJWTUtil("test-secret-key-that-is-long-enough-for-testing", 24)
+	accessToken, _ := jwtUtil.GenerateAccessToken("test-user-123", "test@example.com", "mahasiswa")
+
+	router := gin.New()
+	protected := router.Group("")
+	protected.Use(AuthMiddleware(jwtUtil, nil, stubAPIKeys{}), LoadPermissions(stubPermissions{"mahasiswa": {PermissionAchievementRead}}))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	protected.GET("/reports", RequirePermissionOrScope(PermissionReportRead, ScopeReportsRead), ok)
+	protected.GET("/achievements", RequirePermissionOrScope(PermissionAchievementRead, ScopeAchievementsRead), ok)
+	protected.GET("/admin", RequireAdmin(), ok)
+	protected.GET("/profile", RequireUser(), ok)
+
+	tests := []struct {
+		name       string
+		path       string
+		apiKey     string
+		bearer     string
+		wantStatus int
+	}{
+		{name: "key with scope", path: "/reports", apiKey: "pmk_valid", wantStatus: http.StatusOK},
+		{name: "key without scope", path: "/achievements", apiKey: "pmk_valid", wantStatus: http.StatusForbidden},
+		{name: "key on role route", path: "/admin", apiKey: "pmk_valid", wantStatus: http.StatusForbidden},
+		{name: "key on account route", path: "/profile", apiKey: "pmk_valid", wantStatus: http.StatusForbidden},
+		{name: "invalid key", path: "/reports", apiKey: "pmk_invalid", wantStatus: http.StatusUnauthorized},
+		{name: "user on scoped route", path: "/achievements", bearer: accessToken, wantStatus: http.StatusOK},
+		{name: "user on account route", path: "/profile", bearer: accessToken, wantStatus: http.StatusOK},
+		{name: "bearer takes precedence", path: "/admin", apiKey: "pmk_valid", bearer: accessToken, wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.apiKey != "" {
+				req.Header.Set(APIKeyHeader, tt.apiKey)
+			}
+			if tt.bearer != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.bearer)
+			}
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.wantStatus, recorder.Code, recorder.Body.String())
+			}
+		})
+	}
+
+	// Without a verifier the header is ignored and a bearer token is required
+	router = gin.New()
+	router.GET("/reports", AuthMiddleware(jwtUtil, nil, nil), ok)
+	req := httptest.NewRequest(http.MethodGet, "/reports", nil)
+	req.Header.Set(APIKeyHeader, "pmk_valid")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status %d without API key verifier, got %d", http.StatusUnauthorized, recorder.Code)
+	}
+}
@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ImpersonationAuditor records requests made with impersonation tokens, implemented by service.ImpersonationService
+type ImpersonationAuditor interface {
+	LogImpersonatedRequest(jti, actorID, userID, method, path string, status int, ipAddress string)
+}
+
+// ImpersonationGuard audits every request made under impersonation and refuses DELETE requests,
+// which can't be undone on behalf of the user. Place it after AuthMiddleware.
+func ImpersonationGuard(auditor ImpersonationAuditor) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		actorID := c.GetString("impersonator_id")
+		if actorID == "" {
+			c.Next()
+			return
+		}
+
+		if c.Request.Method == http.MethodDelete {
+			abortImpersonated(c)
+		} else {
+			c.Next()
+		}
+
+		auditor.LogImpersonatedRequest(c.GetString("token_jti"), actorID, c.GetString("user_id"),
+			c.Request.Method, c.Request.URL.Path, c.Writer.Status(), c.ClientIP())
+	}
+}
+
+// DenyImpersonation refuses routes that change credentials or sessions of the user,
+// such as password change, two-factor settings and logout
+func DenyImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("impersonator_id") != "" {
+			abortImpersonated(c)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func abortImpersonated(c *gin.Context) {
+	c.JSON(http.StatusForbidden, gin.H{
+		"error":   "Not allowed while impersonating",
+		"message": "This action can only be performed by the user",
+	})
+	c.Abort()
+}
@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"prestasi-mahasiswa/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type impersonatedRequest struct {
+	actorID, userID, method string
+	status                  int
+}
+
+type stubAuditor struct {
+	requests []impersonatedRequest
+}
+
+func (s *stubAuditor) LogImpersonatedRequest(jti, actorID, userID, method, path string, status int, ipAddress string) {
+	s.requests = append(s.requests, impersonatedRequest{actorID: actorID, userID: userID, method: method, status: status})
+}
+
+func TestImpersonationGuard(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	jwtUtil := utils.NewJWTUtil("test-secret-key-that-is-long-enough-for-testing", 24)
+	accessToken, _ := jwtUtil.GenerateAccessToken("test-user-123", "test@example.com", "mahasiswa")
+	impersonationToken, _ := jwtUtil.GenerateImpersonationToken("test-user-123", "test@example.com", "mahasiswa",
+		utils.ActorClaims{Subject: "admin-1", Email: "admin@example.com"}, time.Minute)
+
+	auditor := &stubAuditor{}
+	router := gin.New()
+	protected := router.Group("")
+	protected.Use(AuthMiddleware(jwtUtil, nil, nil), ImpersonationGuard(auditor))
+	ok := func(c *gin.Context) { c.JSON(http.StatusOK, gin.H{"impersonator_id": c.GetString("impersonator_id")}) }
+	protected.GET("/achievements", ok)
+	protected.DELETE("/achievements/1", ok)
+	protected.PUT("/password", DenyImpersonation(), ok)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		token      string
+		wantStatus int
+	}{
+		{name: "impersonated read", method: http.MethodGet, path: "/achievements", token: impersonationToken, wantStatus: http.StatusOK},
+		{name: "impersonated delete", method: http.MethodDelete, path: "/achievements/1", token: impersonationToken, wantStatus: http.StatusForbidden},
+		{name: "impersonated password change", method: http.MethodPut, path: "/password", token: impersonationToken, wantStatus: http.StatusForbidden},
+		{name: "user delete", method: http.MethodDelete, path: "/achievements/1", token: accessToken, wantStatus: http.StatusOK},
+		{name: "user password change", method: http.MethodPut, path: "/password", token: accessToken, wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.wantStatus, recorder.Code, recorder.Body.String())
+			}
+		})
+	}
+
+	// Only the three impersonated requests are audited, refused ones included
+	if len(auditor.requests) != 3 {
+		t.Fatalf("Expected 3 audited requests, got %d", len(auditor.requests))
+	}
+	wantStatuses := []int{http.StatusOK, http.StatusForbidden, http.StatusForbidden}
+	for i, request := range auditor.requests {
+		if request.actorID != "admin-1" || request.userID != "test-user-123" {
+			t.Errorf("Expected request by admin-1 as test-user-123, got %+v", request)
+		}
+		if request.status != wantStatuses[i] {
+			t.Errorf("Expected audited status %d, got %d", wantStatuses[i], request.status)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Permissions checked by RequirePermission, managed per role at /admin/roles
+const (
+	PermissionAchievementRead      = "achievement:read"
+	PermissionAchievementReadAll   = "achievement:read_all"
+	PermissionAchievementManageOwn = "achievement:manage_own"
+	PermissionAchievementVerify    = "achievement:verify"
+	PermissionReportRead           = "report:read"
+	PermissionUserRead             = "user:read"
+	PermissionUserManage           = "user:manage"
+	PermissionRBACManage           = "rbac:manage"
+	PermissionApprovalManage       = "approval:manage"
+	PermissionSystemManage         = "system:manage"
+)
+
+// PermissionResolver returns the permissions of a role, implemented by service.PermissionService
+type PermissionResolver interface {
+	PermissionsForRole(role string) []string
+}
+
+// LoadPermissions looks up the permissions of the user's role and stores them as user_permissions.
+// Place it after AuthMiddleware. Permissions are not token claims, so role changes made at
+// /admin/roles apply to existing sessions.
+func LoadPermissions(resolver PermissionResolver) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role := c.GetString("user_role")
+		if role != "" && role != RoleAPIClient {
+			c.Set("user_permissions", resolver.PermissionsForRole(role))
+		}
+		c.Next()
+	}
+}
+
+// HasPermission reports whether the signed-in user has permission
+func HasPermission(c *gin.Context, permission string) bool {
+	permissions, _ := c.Get("user_permissions")
+	granted, _ := permissions.([]string)
+	for _, grantedPermission := range granted {
+		if grantedPermission == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// RequirePermission admits users whose role has permission
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, exists := c.Get("user_role"); !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error":   "Authentication required",
+				"message": "Please login first",
+			})
+			c.Abort()
+			return
+		}
+
+		if !HasPermission(c, permission) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":               "Insufficient permissions",
+				"message":             "Your role (" + c.GetString("user_role") + ") is not authorized for this action",
+				"required_permission": permission,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequirePermissionOrScope admits users whose role has permission and API keys granted scope
+func RequirePermissionOrScope(permission, scope string) gin.HandlerFunc {
+	requirePermission := RequirePermission(permission)
+	return func(c *gin.Context) {
+		if c.GetString("user_role") != RoleAPIClient {
+			requirePermission(c)
+			return
+		}
+		requireScope(c, scope)
+	}
+}
@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"prestasi-mahasiswa/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type stubPermissions map[string][]string
+
+func (s stubPermissions) PermissionsForRole(role string) []string {
+	return s[role]
+}
+
+func TestRequirePermission(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	jwtUtil := utils.NewJWTUtil("test-secret-key-that-is-long-enough-for-testing", 24)
+	studentToken, _ := jwtUtil.GenerateAccessToken("student-1", "student@example.com", "mahasiswa")
+	kaprodiToken, _ := jwtUtil.GenerateAccessToken("kaprodi-1", "kaprodi@example.com", "kaprodi")
+	resolver := stubPermissions{
+		"mahasiswa": {PermissionAchievementRead, PermissionAchievementManageOwn},
+		"kaprodi":   {PermissionAchievementRead, PermissionAchievementReadAll, PermissionReportRead},
+	}
+
+	router := gin.New()
+	protected := router.Group("")
+	protected.Use(AuthMiddleware(jwtUtil, nil, stubAPIKeys{}), LoadPermissions(resolver))
+	ok := func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"read_all": HasPermission(c, PermissionAchievementReadAll)})
+	}
+	protected.POST("/achievements", RequirePermission(PermissionAchievementManageOwn), ok)
+	protected.GET("/achievements", RequirePermissionOrScope(PermissionAchievementRead, ScopeAchievementsRead), ok)
+	protected.GET("/reports", RequirePermissionOrScope(PermissionReportRead, ScopeReportsRead), ok)
+	protected.GET("/roles", RequirePermission(PermissionRBACManage), ok)
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		bearer     string
+		apiKey     string
+		wantStatus int
+	}{
+		{name: "student creates achievement", method: http.MethodPost, path: "/achievements", bearer: studentToken, wantStatus: http.StatusOK},
+		{name: "kaprodi can't create achievement", method: http.MethodPost, path: "/achievements", bearer: kaprodiToken, wantStatus: http.StatusForbidden},
+		{name: "student reads achievements", method: http.MethodGet, path: "/achievements", bearer: studentToken, wantStatus: http.StatusOK},
+		{name: "student can't read reports", method: http.MethodGet, path: "/reports", bearer: studentToken, wantStatus: http.StatusForbidden},
+		{name: "kaprodi reads reports", method: http.MethodGet, path: "/reports", bearer: kaprodiToken, wantStatus: http.StatusOK},
+		{name: "kaprodi can't manage roles", method: http.MethodGet, path: "/roles", bearer: kaprodiToken, wantStatus: http.StatusForbidden},
+		{name: "key with scope", method: http.MethodGet, path: "/reports", apiKey: "pmk_valid", wantStatus: http.StatusOK},
+		{name: "key without scope", method: http.MethodGet, path: "/achievements", apiKey: "pmk_valid", wantStatus: http.StatusForbidden},
+		{name: "key on permission route", method: http.MethodGet, path: "/roles", apiKey: "pmk_valid", wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.bearer != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.bearer)
+			}
+			if tt.apiKey != "" {
+				req.Header.Set(APIKeyHeader, tt.apiKey)
+			}
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, req)
+
+			if recorder.Code != tt.wantStatus {
+				t.Errorf("Expected status %d, got %d: %s", tt.wantStatus, recorder.Code, recorder.Body.String())
+			}
+		})
+	}
+
+	// Without LoadPermissions nothing is granted
+	router = gin.New()
+	router.GET("/reports", AuthMiddleware(jwtUtil, nil, nil), RequirePermission(PermissionReportRead), ok)
+	req := httptest.NewRequest(http.MethodGet, "/reports", nil)
+	req.Header.Set("Authorization", "Bearer "+kaprodiToken)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, req)
+	if recorder.Code != http.StatusForbidden {
+		t.Errorf("Expected status %d without permissions loaded, got %d", http.StatusForbidden, recorder.Code)
+	}
+}
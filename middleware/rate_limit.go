@@ -0,0 +1,88 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimiter counts requests per client in fixed windows. Counts are kept in memory,
+// so every replica allows Limit requests per window on its own.
+type RateLimiter struct {
+	Limit  int // requests per window, 0 disables the limit
+	Window time.Duration
+
+	mu        sync.Mutex
+	clients   map[string]*rateWindow
+	nextPrune time.Time
+	now       func() time.Time
+}
+
+type rateWindow struct {
+	count   int
+	resetAt time.Time
+}
+
+func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
+	return &RateLimiter{
+		Limit:   limit,
+		Window:  window,
+		clients: make(map[string]*rateWindow),
+		now:     time.Now,
+	}
+}
+
+// Allow counts a request of key and reports whether it is within the limit,
+// otherwise how long until the window resets
+func (l *RateLimiter) Allow(key string) (bool, time.Duration) {
+	if l.Limit <= 0 {
+		return true, 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.After(l.nextPrune) {
+		// Forget clients whose window ended, the map doesn't grow with every address seen
+		for client, window := range l.clients {
+			if !now.Before(window.resetAt) {
+				delete(l.clients, client)
+			}
+		}
+		l.nextPrune = now.Add(l.Window)
+	}
+
+	window, ok := l.clients[key]
+	if !ok || !now.Before(window.resetAt) {
+		window = &rateWindow{resetAt: now.Add(l.Window)}
+		l.clients[key] = window
+	}
+
+	if window.count >= l.Limit {
+		return false, window.resetAt.Sub(now)
+	}
+	window.count++
+	return true, 0
+}
+
+// RateLimit answers 429 with Retry-After once a client IP exceeds the limiter's limit
+func RateLimit(limiter *RateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		allowed, retryAfter := limiter.Allow(c.ClientIP())
+		if !allowed {
+			seconds := int(math.Ceil(retryAfter.Seconds()))
+			c.Header("Retry-After", strconv.Itoa(seconds))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"error":               "Too many requests, please try again later",
+				"retry_after_seconds": seconds,
+			})
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRateLimiterWindow(t *testing.T) {
+	now := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	limiter := NewRateLimiter(2, time.Minute)
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if allowed, _ := limiter.Allow("203.0.113.7"); !allowed {
+			t.Fatalf("Expected request %d to be allowed", i+1)
+		}
+	}
+
+	now = now.Add(20 * time.Second)
+	allowed, retryAfter := limiter.Allow("203.0.113.7")
+	if allowed || retryAfter != 40*time.Second {
+		t.Errorf("Expected third request to be refused for 40s, got %v, %v", allowed, retryAfter)
+	}
+	if allowed, _ := limiter.Allow("198.51.100.2"); !allowed {
+		t.Error("Expected other clients to be counted separately")
+	}
+
+	now = now.Add(40 * time.Second)
+	if allowed, _ := limiter.Allow("203.0.113.7"); !allowed {
+		t.Error("Expected a new window after the reset")
+	}
+
+	now = now.Add(30 * time.Second)
+	limiter.Allow("203.0.113.7")
+	if _, ok := limiter.clients["198.51.100.2"]; ok {
+		t.Error("Expected clients with ended windows to be forgotten")
+	}
+}
+
+func TestRateLimiterDisabled(t *testing.T) {
+	limiter := NewRateLimiter(0, time.Minute)
+	for i := 0; i < 100; i++ {
+		if allowed, _ := limiter.Allow("203.0.113.7"); !allowed {
+			t.Fatal("Expected a zero limit to allow every request")
+		}
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.GET("/verify/:code", RateLimit(NewRateLimiter(1, time.Minute)), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	request := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/verify/K7QX-2MHP-4AB9", nil)
+		req.RemoteAddr = "203.0.113.7:52000"
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := request(); w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", w.Code)
+	}
+	w := request()
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "60" {
+		t.Errorf("Expected 429 with Retry-After 60, got %d %q", w.Code, w.Header().Get("Retry-After"))
+	}
+}
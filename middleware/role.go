@@ -45,11 +45,53 @@ func RequireRole(allowedRoles ...string) gin.HandlerFunc {
 	}
 }
 
+// requireScope admits API keys granted scope
+func requireScope(c *gin.Context, scope string) {
+	scopes, _ := c.Get("api_key_scopes")
+	granted, _ := scopes.([]string)
+	for _, grantedScope := range granted {
+		if grantedScope == scope {
+			c.Next()
+			return
+		}
+	}
+
+	c.JSON(http.StatusForbidden, gin.H{
+		"error":          "Insufficient scope",
+		"message":        "This API key is not authorized for this action",
+		"required_scope": scope,
+	})
+	c.Abort()
+}
+
+// RequireUser rejects API keys on routes that act on the signed-in user's own account
+func RequireUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetString("user_role") == RoleAPIClient {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":   "User login required",
+				"message": "API keys can't be used for this action",
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
 // Role constants for easier use
 const (
 	RoleMahasiswa = "mahasiswa"
 	RoleDosenWali = "dosen_wali"
 	RoleAdmin     = "admin"
+	RoleAPIClient = "api_client" // requests authenticated with an API key
+)
+
+// API key scopes checked by RequirePermissionOrScope
+const (
+	ScopeReportsRead      = "reports:read"
+	ScopeAchievementsRead = "achievements:read"
 )
 
 // Helper functions for common role combinations
@@ -65,6 +107,19 @@ func RequireAdmin() gin.HandlerFunc {
 func RequireDosenOrAdmin() gin.HandlerFunc {
 	return RequireRole(RoleDosenWali, RoleAdmin)
 }
+
+// RequireAnyAuthenticated admits every signed-in user whatever their role, but not API keys
 func RequireAnyAuthenticated() gin.HandlerFunc {
-	return RequireRole(RoleMahasiswa, RoleDosenWali, RoleAdmin)
+	requireUser := RequireUser()
+	return func(c *gin.Context) {
+		if c.GetString("user_role") == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{
+				"error":   "Authentication required",
+				"message": "Please login first",
+			})
+			c.Abort()
+			return
+		}
+		requireUser(c)
+	}
 }
@@ -9,7 +9,11 @@ import (
 
 // SetupRoutes configures all application routes
 func SetupRoutes(router *gin.Engine,
-	jwtSecret string,
+	tokenVerifier middleware.AccessTokenVerifier,
+	tokenRevocations middleware.TokenRevocationChecker,
+	permissions middleware.PermissionResolver,
+	apiKeys middleware.APIKeyVerifier,
+	impersonationAuditor middleware.ImpersonationAuditor,
 	healthHelper *helper.HealthHelper,
 	authHelper *helper.AuthHelper,
 	achievementHelper *helper.AchievementHelper,
@@ -17,7 +21,21 @@ func SetupRoutes(router *gin.Engine,
 	adminUserHelper *helper.AdminUserHelper,
 	studentHelper *helper.StudentHelper,
 	lecturerHelper *helper.LecturerHelper,
-	reportHelper *helper.ReportHelper) {
+	reportHelper *helper.ReportHelper,
+	verificationHelper *helper.VerificationHelper,
+	verifyRateLimiter *middleware.RateLimiter,
+	attestationHelper *helper.AttestationHelper,
+	badgeHelper *helper.BadgeHelper,
+	jwtKeyHelper *helper.JWTKeyHelper,
+	invitationHelper *helper.InvitationHelper,
+	oidcHelper *helper.OIDCHelper,
+	apiKeyHelper *helper.APIKeyHelper,
+	impersonationHelper *helper.ImpersonationHelper,
+	roleHelper *helper.RoleHelper,
+	approvalHelper *helper.ApprovalHelper,
+	delegationHelper *helper.DelegationHelper,
+	jobHelper *helper.JobHelper,
+	notificationHelper *helper.NotificationHelper) {
 
 	// Root route
 	router.GET("/", func(c *gin.Context) {
@@ -31,27 +49,58 @@ func SetupRoutes(router *gin.Engine,
 	// Health check route
 	router.GET("/health", healthHelper.CheckHealth)
 
+	// Attestation verification keys (JWK set) for offline signature checks
+	router.GET("/.well-known/attestation-keys.json", attestationHelper.GetPublicKeys)
+
+	// Access token verification keys (JWK set) for other campus services
+	router.GET("/.well-known/jwks.json", jwtKeyHelper.GetJWKS)
+
+	// Public certificate verification at /verify/{code}, the URL printed on stamped copies and QR codes
+	setupVerificationRoutes(&router.RouterGroup, verificationHelper, verifyRateLimiter)
+
 	// API v1 routes group
 	v1 := router.Group("/api/v1")
 	{
 		// Public auth routes (no authentication required)
 		setupPublicAuthRoutes(v1, authHelper)
+		setupOIDCRoutes(v1, oidcHelper)
+
+		// Public certificate verification routes (no authentication required), copies stamped
+		// before the routes moved to /verify still carry /api/v1/verify URLs
+		setupVerificationRoutes(v1, verificationHelper, verifyRateLimiter)
+
+		// Public hosted Open Badges documents (no authentication required)
+		setupPublicBadgeRoutes(v1, badgeHelper)
 
-		// Protected routes (authentication required)
+		// Protected routes (authentication required, API keys only where a scope allows them)
+		// Permissions of the user's role are loaded for every request
+		// Requests made with impersonation tokens are audited and can't delete anything
 		protected := v1.Group("")
-		protected.Use(middleware.AuthMiddleware(jwtSecret))
+		protected.Use(middleware.AuthMiddleware(tokenVerifier, tokenRevocations, apiKeys), middleware.LoadPermissions(permissions), middleware.ImpersonationGuard(impersonationAuditor))
 		{
 			// Protected auth routes
 			setupProtectedAuthRoutes(protected, authHelper)
+			protected.POST("/auth/oidc/link", oidcHelper.StartLink) // Link the signed-in account to its IdP identity
 
-			// Setup achievement routes (role-based access)
+			// Setup achievement routes (permission-based access)
 			setupAchievementRoutes(protected, achievementHelper)
+			setupAttestationRoutes(protected, attestationHelper)
+			setupBadgeExportRoutes(protected, badgeHelper)
 
 			// Setup user routes (role-based access)
 			setupUserRoutes(protected, userHelper)
 
 			// Setup admin user management routes
 			setupAdminUserRoutes(protected, adminUserHelper)
+			setupJWTKeyRoutes(protected, jwtKeyHelper)
+			setupInvitationRoutes(protected, invitationHelper)
+			setupAPIKeyRoutes(protected, apiKeyHelper)
+			setupImpersonationRoutes(protected, impersonationHelper)
+			setupRoleRoutes(protected, roleHelper)
+			setupApprovalChainRoutes(protected, approvalHelper)
+			setupDelegationRoutes(protected, delegationHelper)
+			setupJobRoutes(protected, jobHelper)
+			setupNotificationRoutes(protected, notificationHelper)
 
 			// Setup new public/protected routes
 			setupStudentRoutes(v1, studentHelper)      // Public student routes
@@ -67,46 +116,232 @@ func setupPublicAuthRoutes(rg *gin.RouterGroup, authHelper *helper.AuthHelper) {
 	{
 		auth.POST("/login", authHelper.Login)
 		auth.POST("/register", authHelper.Register)
-		auth.POST("/refresh", authHelper.RefreshToken)      // Refresh access token using refresh token
-		auth.POST("/revoke", authHelper.RevokeRefreshToken) // Revoke specific refresh token
+		auth.POST("/refresh", authHelper.RefreshToken)                   // Refresh access token using refresh token
+		auth.POST("/revoke", authHelper.RevokeRefreshToken)              // Revoke specific refresh token
+		auth.POST("/forgot-password", authHelper.ForgotPassword)         // Email a password reset link
+		auth.POST("/reset-password", authHelper.ResetPassword)           // Set new password with reset token
+		auth.GET("/verify-email", authHelper.ShowVerifyEmail)            // Confirmation page of the emailed link, doesn't use the token
+		auth.POST("/verify-email", authHelper.VerifyEmail)               // Verify email with token in body (form or JSON)
+		auth.POST("/resend-verification", authHelper.ResendVerification) // Email a new verification link
+
+		// Second step of logins with two-factor authentication, authorized by the mfa_token
+		auth.POST("/mfa/verify", authHelper.VerifyMFA)                    // Complete login with a TOTP or recovery code
+		auth.POST("/mfa/enroll", authHelper.StartMFAEnrollment)           // Start mandatory enrollment, returns secret and QR code
+		auth.POST("/mfa/enroll/confirm", authHelper.ConfirmMFAEnrollment) // Confirm enrollment and complete login
+	}
+}
+
+// setupOIDCRoutes configures single sign-on routes (no auth required)
+func setupOIDCRoutes(rg *gin.RouterGroup, oidcHelper *helper.OIDCHelper) {
+	oidc := rg.Group("/auth/oidc")
+	{
+		oidc.GET("/login", oidcHelper.Login)       // GET /api/v1/auth/oidc/login, redirects to the identity provider
+		oidc.GET("/callback", oidcHelper.Callback) // GET /api/v1/auth/oidc/callback?code=...&state=...
+	}
+}
+
+// setupVerificationRoutes configures public achievement verification routes, rate limited per client IP
+func setupVerificationRoutes(rg *gin.RouterGroup, verificationHelper *helper.VerificationHelper, rateLimiter *middleware.RateLimiter) {
+	verify := rg.Group("/verify")
+	verify.Use(middleware.RateLimit(rateLimiter))
+	{
+		verify.GET("/:code", verificationHelper.GetVerification)      // GET /verify/{code}
+		verify.GET("/:code/qr", verificationHelper.GetVerificationQR) // GET /verify/{code}/qr?size=256
+	}
+}
+
+// setupPublicBadgeRoutes configures hosted Open Badges 2.0 routes
+func setupPublicBadgeRoutes(rg *gin.RouterGroup, badgeHelper *helper.BadgeHelper) {
+	badges := rg.Group("/badges")
+	{
+		badges.GET("/issuer", badgeHelper.GetIssuer)                  // GET /api/v1/badges/issuer
+		badges.GET("/classes/:slug", badgeHelper.GetBadgeClass)       // GET /api/v1/badges/classes/{slug}
+		badges.GET("/classes/:slug/image", badgeHelper.GetBadgeImage) // GET /api/v1/badges/classes/{slug}/image
+		badges.GET("/assertions/:code", badgeHelper.GetAssertion)     // GET /api/v1/badges/assertions/{verification_code}
 	}
 }
 
+// setupBadgeExportRoutes configures Open Badges export routes
+func setupBadgeExportRoutes(rg *gin.RouterGroup, badgeHelper *helper.BadgeHelper) {
+	rg.GET("/badges/export", middleware.RequirePermission(middleware.PermissionAchievementManageOwn), badgeHelper.ExportMyBadges)          // GET /api/v1/badges/export
+	rg.GET("/achievements/:id/badge", middleware.RequirePermission(middleware.PermissionAchievementRead), badgeHelper.GetAchievementBadge) // GET /api/v1/achievements/{id}/badge
+}
+
 // setupProtectedAuthRoutes configures protected authentication routes (auth required)
 func setupProtectedAuthRoutes(rg *gin.RouterGroup, authHelper *helper.AuthHelper) {
 	auth := rg.Group("/auth")
+	auth.Use(middleware.RequireUser()) // Account routes, not for API keys
 	{
 		// Protected authentication routes (require valid access token)
-		auth.POST("/logout", authHelper.Logout)               // Logout current session and revoke all tokens
-		auth.POST("/logout-all", authHelper.LogoutAllDevices) // Logout from all devices
-		auth.GET("/tokens", authHelper.GetActiveTokens)       // Get list of active refresh tokens
-		auth.GET("/profile", authHelper.GetProfile)           // Get current user profile
+		// Credential and session changes are refused under impersonation
+		auth.POST("/logout", middleware.DenyImpersonation(), authHelper.Logout)               // Logout current session and revoke all tokens
+		auth.POST("/logout-all", middleware.DenyImpersonation(), authHelper.LogoutAllDevices) // Logout from all devices
+		auth.GET("/tokens", authHelper.GetActiveTokens)                                       // Get list of active refresh tokens
+		auth.GET("/sessions", authHelper.GetSessions)                                         // Active sessions with device, location and current flag
+		auth.DELETE("/sessions/:id", authHelper.RevokeSession)                                // End one session
+		auth.GET("/profile", authHelper.GetProfile)                                           // Get current user profile
+		auth.GET("/login-history", authHelper.GetLoginHistory)                                // Get own login attempts
+		auth.PUT("/password", middleware.DenyImpersonation(), authHelper.ChangePassword)      // Change password, requires current password
+
+		// Two-factor authentication (TOTP)
+		auth.GET("/mfa", authHelper.GetMFAStatus)                                                            // Get two-factor status
+		auth.POST("/mfa/setup", middleware.DenyImpersonation(), authHelper.SetupMFA)                         // Get a new secret and QR code
+		auth.POST("/mfa/enable", middleware.DenyImpersonation(), authHelper.EnableMFA)                       // Confirm with a code, returns recovery codes
+		auth.POST("/mfa/disable", middleware.DenyImpersonation(), authHelper.DisableMFA)                     // Disable, requires password and code
+		auth.POST("/mfa/recovery-codes", middleware.DenyImpersonation(), authHelper.RegenerateRecoveryCodes) // Replace recovery codes
 	}
 }
 
-// setupAchievementRoutes configures achievement routes with role-based access
+// setupAchievementRoutes configures achievement routes with permission-based access
 func setupAchievementRoutes(rg *gin.RouterGroup, achievementHelper *helper.AchievementHelper) {
 	achievements := rg.Group("/achievements")
 	{
-		// All authenticated users can view achievements (with role-based filtering in helper)
-		achievements.GET("/", middleware.RequireAnyAuthenticated(), achievementHelper.GetAchievements)
-		achievements.GET("/:id", middleware.RequireAnyAuthenticated(), achievementHelper.GetAchievement)
-		achievements.GET("/:id/files", middleware.RequireAnyAuthenticated(), achievementHelper.GetFiles)
+		// Users with achievement:read can view achievements, only their own without achievement:read_all
+		// API keys with the achievements:read scope may read them too
+		achievements.GET("/", middleware.RequirePermissionOrScope(middleware.PermissionAchievementRead, middleware.ScopeAchievementsRead), achievementHelper.GetAchievements)
+		achievements.GET("/:id", middleware.RequirePermissionOrScope(middleware.PermissionAchievementRead, middleware.ScopeAchievementsRead), achievementHelper.GetAchievement)
+		achievements.GET("/:id/files", middleware.RequirePermissionOrScope(middleware.PermissionAchievementRead, middleware.ScopeAchievementsRead), achievementHelper.GetFiles)
+
+		// Users with achievement:manage_own (mahasiswa) create and manage their own achievements
+		achievements.POST("/", middleware.RequirePermission(middleware.PermissionAchievementManageOwn), achievementHelper.CreateAchievement)
+		achievements.PUT("/:id", middleware.RequirePermission(middleware.PermissionAchievementManageOwn), achievementHelper.UpdateAchievement)
+		achievements.DELETE("/:id", middleware.RequirePermission(middleware.PermissionAchievementManageOwn), achievementHelper.DeleteAchievement)
+
+		// Achievement workflow - mahasiswa submits, roles with achievement:verify verify/reject
+		achievements.POST("/:id/submit", middleware.RequirePermission(middleware.PermissionAchievementManageOwn), achievementHelper.SubmitAchievement)
+		achievements.POST("/:id/verify", middleware.RequirePermission(middleware.PermissionAchievementVerify), achievementHelper.VerifyAchievement)
+		achievements.POST("/:id/reject", middleware.RequirePermission(middleware.PermissionAchievementVerify), achievementHelper.RejectAchievement)
+		achievements.POST("/:id/draft", middleware.RequirePermission(middleware.PermissionAchievementManageOwn), achievementHelper.ReturnToDraft) // Revise a rejected achievement
+		achievements.GET("/:id/approvals", middleware.RequirePermission(middleware.PermissionAchievementRead), achievementHelper.GetApprovals)    // Approval steps and their decisions
+
+		// File management - mahasiswa can upload, users with achievement:read can view/download
+		achievements.POST("/:id/files", middleware.RequirePermission(middleware.PermissionAchievementManageOwn), achievementHelper.UploadFile)
+		achievements.GET("/:id/files/:fileId/download", middleware.RequirePermission(middleware.PermissionAchievementRead), achievementHelper.DownloadFile)
+		achievements.GET("/:id/files/:fileId/verified-copy", middleware.RequirePermission(middleware.PermissionAchievementRead), achievementHelper.DownloadVerifiedCopy) // Stamped copy of verified evidence
+		achievements.DELETE("/:id/files/:fileId", middleware.RequirePermission(middleware.PermissionAchievementManageOwn), achievementHelper.DeleteFile)
+	}
+}
+
+// setupAttestationRoutes configures signed achievement attestation routes
+func setupAttestationRoutes(rg *gin.RouterGroup, attestationHelper *helper.AttestationHelper) {
+	achievements := rg.Group("/achievements")
+	{
+		achievements.GET("/:id/attestation", middleware.RequirePermission(middleware.PermissionAchievementRead), attestationHelper.GetAttestation)
+		achievements.POST("/:id/attestation", middleware.RequirePermission(middleware.PermissionAchievementVerify), attestationHelper.IssueAttestation) // Re-issue signature
+	}
+
+	keys := rg.Group("/admin/attestation-keys")
+	keys.Use(middleware.RequirePermission(middleware.PermissionSystemManage))
+	{
+		keys.GET("/", attestationHelper.GetKeys)          // GET /api/v1/admin/attestation-keys
+		keys.POST("/rotate", attestationHelper.RotateKey) // POST /api/v1/admin/attestation-keys/rotate
+	}
+}
+
+// setupJWTKeyRoutes configures token signing key management routes
+func setupJWTKeyRoutes(rg *gin.RouterGroup, jwtKeyHelper *helper.JWTKeyHelper) {
+	keys := rg.Group("/admin/jwt-keys")
+	keys.Use(middleware.RequirePermission(middleware.PermissionSystemManage))
+	{
+		keys.GET("/", jwtKeyHelper.GetKeys)          // GET /api/v1/admin/jwt-keys
+		keys.POST("/rotate", jwtKeyHelper.RotateKey) // POST /api/v1/admin/jwt-keys/rotate
+	}
+}
+
+// setupInvitationRoutes configures registration invitation management routes
+func setupInvitationRoutes(rg *gin.RouterGroup, invitationHelper *helper.InvitationHelper) {
+	invitations := rg.Group("/admin/invitations")
+	invitations.Use(middleware.RequirePermission(middleware.PermissionUserManage))
+	{
+		invitations.GET("/", invitationHelper.GetInvitations)         // GET /api/v1/admin/invitations
+		invitations.POST("/", invitationHelper.CreateInvitation)      // POST /api/v1/admin/invitations
+		invitations.DELETE("/:id", invitationHelper.RevokeInvitation) // DELETE /api/v1/admin/invitations/{id}
+	}
+}
+
+// setupAPIKeyRoutes configures API key management routes for integrations
+func setupAPIKeyRoutes(rg *gin.RouterGroup, apiKeyHelper *helper.APIKeyHelper) {
+	apiKeys := rg.Group("/admin/api-keys")
+	apiKeys.Use(middleware.RequirePermission(middleware.PermissionSystemManage))
+	{
+		apiKeys.GET("/", apiKeyHelper.GetAPIKeys)         // GET /api/v1/admin/api-keys
+		apiKeys.POST("/", apiKeyHelper.CreateAPIKey)      // POST /api/v1/admin/api-keys
+		apiKeys.DELETE("/:id", apiKeyHelper.RevokeAPIKey) // DELETE /api/v1/admin/api-keys/{id}
+	}
+}
+
+// setupImpersonationRoutes configures admin "login as" routes and their audit trail
+func setupImpersonationRoutes(rg *gin.RouterGroup, impersonationHelper *helper.ImpersonationHelper) {
+	admin := rg.Group("/admin")
+	admin.Use(middleware.RequirePermission(middleware.PermissionSystemManage)) // Starting a session also requires the admin role
+	{
+		admin.POST("/users/:id/impersonate", impersonationHelper.StartImpersonation)      // POST /api/v1/admin/users/{id}/impersonate
+		admin.GET("/impersonations", impersonationHelper.GetSessions)                     // GET /api/v1/admin/impersonations?actor_id=&user_id=
+		admin.GET("/impersonations/:id/requests", impersonationHelper.GetSessionRequests) // GET /api/v1/admin/impersonations/{id}/requests
+		admin.POST("/impersonations/:id/end", impersonationHelper.EndImpersonation)       // POST /api/v1/admin/impersonations/{id}/end
+	}
+}
+
+// setupRoleRoutes configures role and permission management routes
+func setupRoleRoutes(rg *gin.RouterGroup, roleHelper *helper.RoleHelper) {
+	admin := rg.Group("/admin")
+	admin.Use(middleware.RequirePermission(middleware.PermissionRBACManage))
+	{
+		admin.GET("/roles", roleHelper.GetRoles)             // GET /api/v1/admin/roles
+		admin.POST("/roles", roleHelper.CreateRole)          // POST /api/v1/admin/roles
+		admin.PUT("/roles/:name", roleHelper.UpdateRole)     // PUT /api/v1/admin/roles/{name}
+		admin.DELETE("/roles/:name", roleHelper.DeleteRole)  // DELETE /api/v1/admin/roles/{name}
+		admin.GET("/permissions", roleHelper.GetPermissions) // GET /api/v1/admin/permissions
+	}
+}
 
-		// Only mahasiswa can create and manage their own achievements
-		achievements.POST("/", middleware.RequireMahasiswa(), achievementHelper.CreateAchievement)
-		achievements.PUT("/:id", middleware.RequireMahasiswa(), achievementHelper.UpdateAchievement)
-		achievements.DELETE("/:id", middleware.RequireMahasiswa(), achievementHelper.DeleteAchievement)
+// setupApprovalChainRoutes configures approval chain management routes
+func setupApprovalChainRoutes(rg *gin.RouterGroup, approvalHelper *helper.ApprovalHelper) {
+	chains := rg.Group("/admin/approval-chains")
+	chains.Use(middleware.RequirePermission(middleware.PermissionApprovalManage))
+	{
+		chains.GET("/", approvalHelper.GetChains)         // GET /api/v1/admin/approval-chains
+		chains.POST("/", approvalHelper.CreateChain)      // POST /api/v1/admin/approval-chains
+		chains.PUT("/:id", approvalHelper.UpdateChain)    // PUT /api/v1/admin/approval-chains/{id}
+		chains.DELETE("/:id", approvalHelper.DeleteChain) // DELETE /api/v1/admin/approval-chains/{id}
+	}
+}
 
-		// Achievement workflow - mahasiswa submits, dosen/admin verify/reject
-		achievements.POST("/:id/submit", middleware.RequireMahasiswa(), achievementHelper.SubmitAchievement)
-		achievements.POST("/:id/verify", middleware.RequireDosenOrAdmin(), achievementHelper.VerifyAchievement)
-		achievements.POST("/:id/reject", middleware.RequireDosenOrAdmin(), achievementHelper.RejectAchievement)
+// setupDelegationRoutes configures verifier delegation routes, e.g. while a dosen wali is on leave
+func setupDelegationRoutes(rg *gin.RouterGroup, delegationHelper *helper.DelegationHelper) {
+	delegations := rg.Group("/delegations")
+	delegations.Use(middleware.RequirePermission(middleware.PermissionAchievementVerify))
+	{
+		delegations.GET("/", delegationHelper.GetDelegations)         // GET /api/v1/delegations?user_id= (user_id for admins)
+		delegations.POST("/", delegationHelper.CreateDelegation)      // POST /api/v1/delegations
+		delegations.DELETE("/:id", delegationHelper.RevokeDelegation) // DELETE /api/v1/delegations/{id}
+	}
+}
+
+// setupJobRoutes configures background job management routes
+func setupJobRoutes(rg *gin.RouterGroup, jobHelper *helper.JobHelper) {
+	jobs := rg.Group("/admin/jobs")
+	jobs.Use(middleware.RequirePermission(middleware.PermissionSystemManage))
+	{
+		jobs.GET("/", jobHelper.GetJobs)                // GET /api/v1/admin/jobs
+		jobs.GET("/:name/runs", jobHelper.GetJobRuns)   // GET /api/v1/admin/jobs/{name}/runs
+		jobs.POST("/:name/run", jobHelper.TriggerJob)   // POST /api/v1/admin/jobs/{name}/run
+		jobs.POST("/:name/pause", jobHelper.PauseJob)   // POST /api/v1/admin/jobs/{name}/pause
+		jobs.POST("/:name/resume", jobHelper.ResumeJob) // POST /api/v1/admin/jobs/{name}/resume
+	}
+}
 
-		// File management - mahasiswa can upload, all can view/download
-		achievements.POST("/:id/files", middleware.RequireMahasiswa(), achievementHelper.UploadFile)
-		achievements.GET("/:id/files/:fileId/download", middleware.RequireAnyAuthenticated(), achievementHelper.DownloadFile)
-		achievements.DELETE("/:id/files/:fileId", middleware.RequireMahasiswa(), achievementHelper.DeleteFile)
+// setupNotificationRoutes configures the signed-in user's in-app notification routes
+func setupNotificationRoutes(rg *gin.RouterGroup, notificationHelper *helper.NotificationHelper) {
+	notifications := rg.Group("/notifications")
+	notifications.Use(middleware.RequireAnyAuthenticated())
+	{
+		notifications.GET("/", notificationHelper.GetNotifications)             // GET /api/v1/notifications?unread=true&limit=20&offset=0
+		notifications.GET("/unread-count", notificationHelper.GetUnreadCount)   // GET /api/v1/notifications/unread-count
+		notifications.POST("/read-all", notificationHelper.MarkAllRead)         // POST /api/v1/notifications/read-all
+		notifications.POST("/:id/read", notificationHelper.MarkRead)            // POST /api/v1/notifications/{id}/read
+		notifications.GET("/preferences", notificationHelper.GetPreferences)    // GET /api/v1/notifications/preferences
+		notifications.PUT("/preferences", notificationHelper.UpdatePreferences) // PUT /api/v1/notifications/preferences
 	}
 }
 
@@ -116,17 +351,17 @@ func setupUserRoutes(rg *gin.RouterGroup, userHelper *helper.UserHelper) {
 	{
 		// All authenticated users can view and update their own profile
 		users.GET("/profile", middleware.RequireAnyAuthenticated(), userHelper.GetProfile)
-		users.PUT("/profile", middleware.RequireAnyAuthenticated(), userHelper.UpdateProfile)
+		users.PUT("/profile", middleware.RequireAnyAuthenticated(), middleware.DenyImpersonation(), userHelper.UpdateProfile)
 
-		// Only admin can view all users
-		users.GET("/", middleware.RequireAdmin(), userHelper.GetUsers)
+		// Users with user:read can view all users
+		users.GET("/", middleware.RequirePermission(middleware.PermissionUserRead), userHelper.GetUsers)
 	}
 }
 
 // setupAdminUserRoutes configures admin user management routes
 func setupAdminUserRoutes(rg *gin.RouterGroup, adminUserHelper *helper.AdminUserHelper) {
 	admin := rg.Group("/admin")
-	admin.Use(middleware.RequireAdmin()) // All admin routes require admin role
+	admin.Use(middleware.RequirePermission(middleware.PermissionUserManage)) // All user management routes require user:manage
 	{
 		// User management routes
 		userMgmt := admin.Group("/users")
@@ -139,8 +374,11 @@ func setupAdminUserRoutes(rg *gin.RouterGroup, adminUserHelper *helper.AdminUser
 			userMgmt.DELETE("/:id", adminUserHelper.DeleteUser) // DELETE /api/v1/admin/users/{id}
 
 			// Role management
-			userMgmt.PUT("/:id/role", adminUserHelper.ChangeUserRole)     // PUT /api/v1/admin/users/{id}/role
-			userMgmt.PUT("/:id/status", adminUserHelper.ToggleUserStatus) // PUT /api/v1/admin/users/{id}/status
+			userMgmt.PUT("/:id/role", adminUserHelper.ChangeUserRole)             // PUT /api/v1/admin/users/{id}/role
+			userMgmt.PUT("/:id/status", adminUserHelper.ToggleUserStatus)         // PUT /api/v1/admin/users/{id}/status
+			userMgmt.POST("/:id/unlock", adminUserHelper.UnlockUser)              // POST /api/v1/admin/users/{id}/unlock
+			userMgmt.GET("/:id/login-attempts", adminUserHelper.GetLoginAttempts) // GET /api/v1/admin/users/{id}/login-attempts
+			userMgmt.DELETE("/:id/mfa", adminUserHelper.ResetMFA)                 // DELETE /api/v1/admin/users/{id}/mfa
 
 			// Advisor management
 			userMgmt.POST("/assign-advisor", adminUserHelper.AssignAdvisor)                      // POST /api/v1/admin/users/assign-advisor
@@ -179,12 +417,15 @@ func setupLecturerRoutes(rg *gin.RouterGroup, lecturerHelper *helper.LecturerHel
 // setupReportRoutes configures report and statistics routes
 func setupReportRoutes(rg *gin.RouterGroup, reportHelper *helper.ReportHelper) {
 	reports := rg.Group("/reports")
-	reports.Use(middleware.RequireAnyAuthenticated()) // All report routes require authentication
+	reports.Use(middleware.RequirePermissionOrScope(middleware.PermissionReportRead, middleware.ScopeReportsRead)) // Users with report:read, or API keys with reports:read
 	{
 		// System statistics - for admin/dosen to see overall stats
 		reports.GET("/statistics", reportHelper.GetSystemStatistics) // GET /api/v1/reports/statistics
 
 		// Student-specific reports
 		reports.GET("/student/:id", reportHelper.GetStudentReport) // GET /api/v1/reports/student/:id
+
+		// Approval turnaround per dosen wali, names every advisor so it needs achievement:read_all too
+		reports.GET("/sla", middleware.RequirePermissionOrScope(middleware.PermissionAchievementReadAll, middleware.ScopeReportsRead), reportHelper.GetVerifierSLA) // GET /api/v1/reports/sla?days=90
 	}
 }
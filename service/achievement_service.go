@@ -3,7 +3,9 @@ package service
 import (
 	"database/sql"
 	"errors"
+	"fmt"
 	"prestasi-mahasiswa/database"
+	"prestasi-mahasiswa/utils"
 	"time"
 
 	"github.com/google/uuid"
@@ -13,12 +15,25 @@ import (
 type AchievementService struct {
 	DB      *sql.DB
 	MongoDB *database.MongoDB
+
+	// ApprovalService decides who approves a submission and in which order
+	ApprovalService *ApprovalService
+
+	// AttestationService signs achievements once verified (optional)
+	AttestationService *AttestationService
+
+	// NotificationService tells students and verifiers about submissions and decisions (optional)
+	NotificationService *NotificationService
 }
 
+// ErrNotApprover is returned when the user may not decide the achievement's current approval step
+var ErrNotApprover = errors.New("you are not an approver of the current step")
+
 func NewAchievementService(db *sql.DB, mongodb *database.MongoDB) *AchievementService {
 	return &AchievementService{
-		DB:      db,
-		MongoDB: mongodb,
+		DB:              db,
+		MongoDB:         mongodb,
+		ApprovalService: NewApprovalService(db),
 	}
 }
 
@@ -26,8 +41,8 @@ func NewAchievementService(db *sql.DB, mongodb *database.MongoDB) *AchievementSe
 func (s *AchievementService) GetAllAchievements() ([]Achievement, error) {
 	query := `
 		SELECT a.id, a.mahasiswa_id, u.name as mahasiswa_name, a.title, a.description, 
-		       a.category, a.achievement_date, a.status, a.verified_by, a.verified_at,
-		       a.rejection_reason, a.created_at, a.updated_at
+		       a.category, COALESCE(a.level, '') as level, a.achievement_date, a.status, a.submitted_at, a.verified_by, a.verified_at,
+		       a.rejection_reason, a.verification_code, a.verified_on_behalf_of, a.created_at, a.updated_at
 		FROM achievements a
 		JOIN users u ON a.mahasiswa_id = u.id
 		WHERE a.is_deleted = false OR a.is_deleted IS NULL
@@ -44,12 +59,12 @@ func (s *AchievementService) GetAllAchievements() ([]Achievement, error) {
 	for rows.Next() {
 		var a Achievement
 		var verifiedAt, rejectionReason sql.NullString
-		var verifiedBy sql.NullString
+		var verifiedBy, verificationCode sql.NullString
 
 		err := rows.Scan(
 			&a.ID, &a.MahasiswaID, &a.MahasiswaName, &a.Title, &a.Description,
-			&a.Category, &a.AchievementDate, &a.Status, &verifiedBy, &verifiedAt,
-			&rejectionReason, &a.CreatedAt, &a.UpdatedAt,
+			&a.Category, &a.Level, &a.AchievementDate, &a.Status, &a.SubmittedAt, &verifiedBy, &verifiedAt,
+			&rejectionReason, &verificationCode, &a.VerifiedOnBehalf, &a.CreatedAt, &a.UpdatedAt,
 		)
 		if err != nil {
 			return nil, errors.New("failed to scan achievement: " + err.Error())
@@ -64,6 +79,9 @@ func (s *AchievementService) GetAllAchievements() ([]Achievement, error) {
 		if rejectionReason.Valid {
 			a.RejectionReason = &rejectionReason.String
 		}
+		if verificationCode.Valid {
+			a.VerificationCode = &verificationCode.String
+		}
 
 		achievements = append(achievements, a)
 	}
@@ -75,8 +93,8 @@ func (s *AchievementService) GetAllAchievements() ([]Achievement, error) {
 func (s *AchievementService) GetAchievementsByMahasiswa(mahasiswaID string) ([]Achievement, error) {
 	query := `
 		SELECT a.id, a.mahasiswa_id, u.name as mahasiswa_name, a.title, a.description,
-		       a.category, a.achievement_date, a.status, a.verified_by, a.verified_at,
-		       a.rejection_reason, a.created_at, a.updated_at
+		       a.category, COALESCE(a.level, '') as level, a.achievement_date, a.status, a.submitted_at, a.verified_by, a.verified_at,
+		       a.rejection_reason, a.verification_code, a.verified_on_behalf_of, a.created_at, a.updated_at
 		FROM achievements a
 		JOIN users u ON a.mahasiswa_id = u.id
 		WHERE a.mahasiswa_id = $1 AND (a.is_deleted = false OR a.is_deleted IS NULL)
@@ -93,12 +111,12 @@ func (s *AchievementService) GetAchievementsByMahasiswa(mahasiswaID string) ([]A
 	for rows.Next() {
 		var a Achievement
 		var verifiedAt, rejectionReason sql.NullString
-		var verifiedBy sql.NullString
+		var verifiedBy, verificationCode sql.NullString
 
 		err := rows.Scan(
 			&a.ID, &a.MahasiswaID, &a.MahasiswaName, &a.Title, &a.Description,
-			&a.Category, &a.AchievementDate, &a.Status, &verifiedBy, &verifiedAt,
-			&rejectionReason, &a.CreatedAt, &a.UpdatedAt,
+			&a.Category, &a.Level, &a.AchievementDate, &a.Status, &a.SubmittedAt, &verifiedBy, &verifiedAt,
+			&rejectionReason, &verificationCode, &a.VerifiedOnBehalf, &a.CreatedAt, &a.UpdatedAt,
 		)
 		if err != nil {
 			return nil, errors.New("failed to scan achievement: " + err.Error())
@@ -113,6 +131,9 @@ func (s *AchievementService) GetAchievementsByMahasiswa(mahasiswaID string) ([]A
 		if rejectionReason.Valid {
 			a.RejectionReason = &rejectionReason.String
 		}
+		if verificationCode.Valid {
+			a.VerificationCode = &verificationCode.String
+		}
 
 		achievements = append(achievements, a)
 	}
@@ -131,14 +152,18 @@ func (s *AchievementService) CreateAchievement(achievement Achievement) (*Achiev
 		return nil, errors.New("mahasiswa_id is required")
 	}
 
+	if err := ValidateAchievementLevel(achievement.Level); err != nil {
+		return nil, err
+	}
+
 	// Generate UUID for new achievement
 	achievementID := uuid.New().String()
 	now := time.Now()
 
 	query := `
-		INSERT INTO achievements (id, mahasiswa_id, title, description, category, 
+		INSERT INTO achievements (id, mahasiswa_id, title, description, category, level,
 		                         achievement_date, status, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
 		RETURNING id
 	`
 
@@ -149,6 +174,7 @@ func (s *AchievementService) CreateAchievement(achievement Achievement) (*Achiev
 		achievement.Title,
 		achievement.Description,
 		achievement.Category,
+		nullIfEmpty(achievement.Level),
 		achievement.AchievementDate,
 		"draft", // Default status
 		now,
@@ -172,8 +198,8 @@ func (s *AchievementService) CreateAchievement(achievement Achievement) (*Achiev
 func (s *AchievementService) GetAchievementByID(id string) (*Achievement, error) {
 	query := `
 		SELECT a.id, a.mahasiswa_id, u.name as mahasiswa_name, a.title, a.description,
-		       a.category, a.achievement_date, a.status, a.verified_by, a.verified_at,
-		       a.rejection_reason, a.created_at, a.updated_at
+		       a.category, COALESCE(a.level, '') as level, a.achievement_date, a.status, a.submitted_at, a.verified_by, a.verified_at,
+		       a.rejection_reason, a.verification_code, a.verified_on_behalf_of, a.created_at, a.updated_at
 		FROM achievements a
 		JOIN users u ON a.mahasiswa_id = u.id
 		WHERE a.id = $1 AND (a.is_deleted = false OR a.is_deleted IS NULL)
@@ -181,12 +207,12 @@ func (s *AchievementService) GetAchievementByID(id string) (*Achievement, error)
 
 	var a Achievement
 	var verifiedAt, rejectionReason sql.NullString
-	var verifiedBy sql.NullString
+	var verifiedBy, verificationCode sql.NullString
 
 	err := s.DB.QueryRow(query, id).Scan(
 		&a.ID, &a.MahasiswaID, &a.MahasiswaName, &a.Title, &a.Description,
-		&a.Category, &a.AchievementDate, &a.Status, &verifiedBy, &verifiedAt,
-		&rejectionReason, &a.CreatedAt, &a.UpdatedAt,
+		&a.Category, &a.Level, &a.AchievementDate, &a.Status, &a.SubmittedAt, &verifiedBy, &verifiedAt,
+		&rejectionReason, &verificationCode, &a.VerifiedOnBehalf, &a.CreatedAt, &a.UpdatedAt,
 	)
 
 	if err != nil {
@@ -205,22 +231,30 @@ func (s *AchievementService) GetAchievementByID(id string) (*Achievement, error)
 	if rejectionReason.Valid {
 		a.RejectionReason = &rejectionReason.String
 	}
+	if verificationCode.Valid {
+		a.VerificationCode = &verificationCode.String
+	}
 
 	return &a, nil
 }
 
 // UpdateAchievement updates existing achievement
 func (s *AchievementService) UpdateAchievement(id string, achievement Achievement) error {
+	if err := ValidateAchievementLevel(achievement.Level); err != nil {
+		return err
+	}
+
 	query := `
 		UPDATE achievements 
-		SET title = $1, description = $2, category = $3, achievement_date = $4, updated_at = $5
-		WHERE id = $6 AND status = 'draft' AND (is_deleted = false OR is_deleted IS NULL)
+		SET title = $1, description = $2, category = $3, level = $4, achievement_date = $5, updated_at = $6
+		WHERE id = $7 AND status = 'draft' AND (is_deleted = false OR is_deleted IS NULL)
 	`
 
 	result, err := s.DB.Exec(query,
 		achievement.Title,
 		achievement.Description,
 		achievement.Category,
+		nullIfEmpty(achievement.Level),
 		achievement.AchievementDate,
 		time.Now(),
 		id,
@@ -267,95 +301,365 @@ func (s *AchievementService) DeleteAchievement(id string) error {
 	return nil
 }
 
-// SubmitAchievement submits achievement for verification
+// SubmitAchievement submits achievement for verification and starts its approval chain
 func (s *AchievementService) SubmitAchievement(id string) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return errors.New("failed to start transaction: " + err.Error())
+	}
+	defer tx.Rollback()
+
+	// A resubmission starts over, the decisions of earlier rounds stay in the approval history
 	query := `
 		UPDATE achievements 
-		SET status = 'submitted', updated_at = $1
+		SET status = 'submitted', submitted_at = $1, updated_at = $1,
+		    verified_by = NULL, verified_at = NULL, rejection_reason = NULL, verified_on_behalf_of = NULL
 		WHERE id = $2 AND status = 'draft' AND (is_deleted = false OR is_deleted IS NULL)
+		RETURNING category, COALESCE(level, '')
 	`
 
-	result, err := s.DB.Exec(query, time.Now(), id)
+	var category, level string
+	err = tx.QueryRow(query, time.Now(), id).Scan(&category, &level)
 	if err != nil {
+		if err == sql.ErrNoRows {
+			return errors.New("achievement not found or cannot be submitted")
+		}
 		return errors.New("failed to submit achievement: " + err.Error())
 	}
 
-	rowsAffected, err := result.RowsAffected()
-	if err != nil {
-		return errors.New("failed to check submit result: " + err.Error())
+	if err := s.ApprovalService.startApproval(tx, id, category, level); err != nil {
+		return err
 	}
 
-	if rowsAffected == 0 {
-		return errors.New("achievement not found or cannot be submitted")
+	if err := tx.Commit(); err != nil {
+		return errors.New("failed to submit achievement: " + err.Error())
 	}
 
+	s.notify(id, func(n *NotificationService) error { return n.achievementSubmitted(id) })
+
 	return nil
 }
 
-// VerifyAchievement verifies achievement (for dosen/admin)
-func (s *AchievementService) VerifyAchievement(id string, verifierID string) error {
+// VerifyAchievement approves the current approval step of a submitted achievement.
+// The achievement becomes verified when the last step is approved.
+func (s *AchievementService) VerifyAchievement(id string, verifierID string, verifierRole string, note string) (*ApprovalProgress, error) {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, errors.New("failed to start transaction: " + err.Error())
+	}
+	defer tx.Rollback()
+
+	step, onBehalfOf, err := s.lockCurrentStep(tx, id, verifierID, verifierRole, "verified")
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.ApprovalService.decideStep(tx, step.ID, "approved", verifierID, onBehalfOf, note); err != nil {
+		return nil, err
+	}
+
+	nextStep, err := s.ApprovalService.firstPendingStep(tx, id)
+	if err != nil {
+		return nil, err
+	}
+	if nextStep != nil {
+		_, err := tx.Exec(`UPDATE achievements SET current_step = $1, updated_at = $2 WHERE id = $3`, nextStep.StepOrder, time.Now(), id)
+		if err != nil {
+			return nil, errors.New("failed to advance approval: " + err.Error())
+		}
+		if err := s.ApprovalService.activateStep(tx, nextStep.ID); err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, errors.New("failed to verify achievement: " + err.Error())
+		}
+		s.notify(id, func(n *NotificationService) error {
+			return n.approvalStepApproved(id, step.StepName, nextStep, verifierID)
+		})
+		return &ApprovalProgress{Status: "submitted", NextStep: nextStep}, nil
+	}
+
+	// Issue verification code printed on stamped certificate copies
+	verificationCode, err := utils.GenerateVerificationCode()
+	if err != nil {
+		return nil, errors.New("failed to generate verification code: " + err.Error())
+	}
+
 	query := `
 		UPDATE achievements 
-		SET status = 'verified', verified_by = $1, verified_at = $2, updated_at = $3
-		WHERE id = $4 AND status = 'submitted' AND (is_deleted = false OR is_deleted IS NULL)
+		SET status = 'verified', verified_by = $1, verified_at = $2, verification_code = $3, updated_at = $4, current_step = NULL,
+		    verified_on_behalf_of = $6
+		WHERE id = $5 AND status = 'submitted' AND (is_deleted = false OR is_deleted IS NULL)
 	`
 
 	now := time.Now()
-	result, err := s.DB.Exec(query, verifierID, now, now, id)
+	if _, err := tx.Exec(query, verifierID, now, verificationCode, now, id, nullIfEmpty(onBehalfOf)); err != nil {
+		return nil, errors.New("failed to verify achievement: " + err.Error())
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, errors.New("failed to verify achievement: " + err.Error())
+	}
+
+	// Produce signed attestation, failure doesn't undo the verification
+	if s.AttestationService != nil {
+		if _, err := s.AttestationService.AttestAchievement(id); err != nil {
+			fmt.Printf("Warning: failed to sign attestation for achievement %s: %v\n", id, err)
+		}
+	}
+
+	s.notify(id, func(n *NotificationService) error { return n.achievementDecided(id, true, "", verifierID) })
+
+	return &ApprovalProgress{Status: "verified"}, nil
+}
+
+// lockCurrentStep locks a submitted achievement and returns its current approval step when the
+// user is an assignee of it, along with the dosen wali the user acts for as delegate.
+// action completes the "cannot be ..." error.
+func (s *AchievementService) lockCurrentStep(tx *sql.Tx, id, userID, userRole, action string) (*AchievementApproval, string, error) {
+	query := `
+		SELECT a.category, COALESCE(a.level, ''), COALESCE(u.advisor_id::text, '')
+		FROM achievements a
+		JOIN users u ON u.id = a.mahasiswa_id
+		WHERE a.id = $1 AND a.status = 'submitted' AND (a.is_deleted = false OR a.is_deleted IS NULL)
+		FOR UPDATE OF a
+	`
+
+	var category, level, advisorID string
+	if err := tx.QueryRow(query, id).Scan(&category, &level, &advisorID); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, "", errors.New("achievement not found or cannot be " + action)
+		}
+		return nil, "", errors.New("failed to get achievement: " + err.Error())
+	}
+
+	step, err := s.ApprovalService.currentStep(tx, id, category, level)
 	if err != nil {
-		return errors.New("failed to verify achievement: " + err.Error())
+		return nil, "", err
 	}
 
-	rowsAffected, err := result.RowsAffected()
+	advisorDelegate := false
+	if step.AssigneeRule == AssigneeRuleAdvisor && advisorID != "" && advisorID != userID {
+		advisorDelegate, err = isActiveDelegate(tx, userID, advisorID)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	allowed, onBehalfOf := canDecideStep(*step, userID, userRole, advisorID, advisorDelegate)
+	if !allowed {
+		return nil, "", fmt.Errorf("%w (%s)", ErrNotApprover, step.StepName)
+	}
+
+	return step, onBehalfOf, nil
+}
+
+// EnsureVerificationCode returns the verification code of a verified achievement,
+// issuing one for achievements verified before codes were introduced
+func (s *AchievementService) EnsureVerificationCode(id string) (string, error) {
+	achievement, err := s.GetAchievementByID(id)
 	if err != nil {
-		return errors.New("failed to check verify result: " + err.Error())
+		return "", err
 	}
 
-	if rowsAffected == 0 {
-		return errors.New("achievement not found or cannot be verified")
+	if achievement.Status != "verified" {
+		return "", errors.New("achievement is not verified")
+	}
+
+	if achievement.VerificationCode != nil {
+		return *achievement.VerificationCode, nil
+	}
+
+	if err := s.issueVerificationCode(id); err != nil {
+		return "", err
+	}
+
+	// Re-read in case a concurrent request issued the code first
+	achievement, err = s.GetAchievementByID(id)
+	if err != nil {
+		return "", err
+	}
+	if achievement.VerificationCode == nil {
+		return "", errors.New("failed to issue verification code")
+	}
+
+	return *achievement.VerificationCode, nil
+}
+
+// BackfillVerificationCodes issues verification codes to verified achievements that have none,
+// those verified before codes were introduced, so their public verification URL exists
+func (s *AchievementService) BackfillVerificationCodes() error {
+	rows, err := s.DB.Query(`
+		SELECT id FROM achievements
+		WHERE status = 'verified' AND verification_code IS NULL
+		  AND (is_deleted = false OR is_deleted IS NULL)
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to get achievements without verification code: %w", err)
+	}
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan achievement: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to get achievements without verification code: %w", err)
+	}
+
+	for _, id := range ids {
+		if err := s.issueVerificationCode(id); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-// RejectAchievement rejects achievement with reason (for dosen/admin)
-func (s *AchievementService) RejectAchievement(id string, verifierID string, reason string) error {
+// issueVerificationCode stores a new code unless the achievement got one concurrently
+func (s *AchievementService) issueVerificationCode(id string) error {
+	verificationCode, err := utils.GenerateVerificationCode()
+	if err != nil {
+		return errors.New("failed to generate verification code: " + err.Error())
+	}
+
 	query := `
 		UPDATE achievements 
-		SET status = 'rejected', verified_by = $1, verified_at = $2, rejection_reason = $3, updated_at = $4
+		SET verification_code = $1
+		WHERE id = $2 AND status = 'verified' AND verification_code IS NULL
+	`
+
+	if _, err := s.DB.Exec(query, verificationCode, id); err != nil {
+		return errors.New("failed to store verification code: " + err.Error())
+	}
+
+	return nil
+}
+
+// RejectAchievement rejects achievement with reason at its current approval step,
+// the remaining steps are skipped
+func (s *AchievementService) RejectAchievement(id string, verifierID string, verifierRole string, reason string) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return errors.New("failed to start transaction: " + err.Error())
+	}
+	defer tx.Rollback()
+
+	step, onBehalfOf, err := s.lockCurrentStep(tx, id, verifierID, verifierRole, "rejected")
+	if err != nil {
+		return err
+	}
+
+	if err := s.ApprovalService.decideStep(tx, step.ID, "rejected", verifierID, onBehalfOf, reason); err != nil {
+		return err
+	}
+	if err := s.ApprovalService.skipRemainingSteps(tx, id); err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE achievements 
+		SET status = 'rejected', verified_by = $1, verified_at = $2, rejection_reason = $3, updated_at = $4, current_step = NULL,
+		    verified_on_behalf_of = $6
 		WHERE id = $5 AND status = 'submitted' AND (is_deleted = false OR is_deleted IS NULL)
 	`
 
 	now := time.Now()
-	result, err := s.DB.Exec(query, verifierID, now, reason, now, id)
-	if err != nil {
+	if _, err := tx.Exec(query, verifierID, now, reason, now, id, nullIfEmpty(onBehalfOf)); err != nil {
 		return errors.New("failed to reject achievement: " + err.Error())
 	}
 
+	if err := tx.Commit(); err != nil {
+		return errors.New("failed to reject achievement: " + err.Error())
+	}
+
+	s.notify(id, func(n *NotificationService) error { return n.achievementDecided(id, false, reason, verifierID) })
+
+	return nil
+}
+
+// ReturnToDraft moves a rejected achievement of the student back to draft so it can be revised and
+// submitted again. The rejection reason stays until the next submission.
+func (s *AchievementService) ReturnToDraft(id string, mahasiswaID string) error {
+	query := `
+		UPDATE achievements 
+		SET status = 'draft', updated_at = $1
+		WHERE id = $2 AND mahasiswa_id = $3 AND status = 'rejected' AND (is_deleted = false OR is_deleted IS NULL)
+	`
+
+	result, err := s.DB.Exec(query, time.Now(), id, mahasiswaID)
+	if err != nil {
+		return errors.New("failed to return achievement to draft: " + err.Error())
+	}
+
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
-		return errors.New("failed to check reject result: " + err.Error())
+		return errors.New("failed to check update result: " + err.Error())
 	}
 
 	if rowsAffected == 0 {
-		return errors.New("achievement not found or cannot be rejected")
+		return errors.New("achievement not found or cannot be returned to draft (only your rejected achievements can)")
 	}
 
 	return nil
 }
 
+// notify sends the notifications of a status change, failure doesn't undo the change
+func (s *AchievementService) notify(id string, send func(n *NotificationService) error) {
+	if s.NotificationService == nil {
+		return
+	}
+	if err := send(s.NotificationService); err != nil {
+		fmt.Printf("Warning: failed to send notifications for achievement %s: %v\n", id, err)
+	}
+}
+
 type Achievement struct {
-	ID              string    `json:"id"`
-	MahasiswaID     string    `json:"mahasiswa_id"`
-	MahasiswaName   string    `json:"mahasiswa_name,omitempty"`
-	Title           string    `json:"title"`
-	Description     string    `json:"description"`
-	Category        string    `json:"category"`
-	AchievementDate time.Time `json:"achievement_date"`
-	Status          string    `json:"status"` // draft, submitted, verified, rejected
-	VerifiedBy      *string   `json:"verified_by,omitempty"`
-	VerifiedAt      *string   `json:"verified_at,omitempty"`
-	RejectionReason *string   `json:"rejection_reason,omitempty"`
-	CreatedAt       string    `json:"created_at"`
-	UpdatedAt       string    `json:"updated_at"`
+	ID               string    `json:"id"`
+	MahasiswaID      string    `json:"mahasiswa_id"`
+	MahasiswaName    string    `json:"mahasiswa_name,omitempty"`
+	Title            string    `json:"title"`
+	Description      string    `json:"description"`
+	Category         string    `json:"category"`
+	Level            string    `json:"level,omitempty"` // lokal, regional, nasional, internasional
+	AchievementDate  time.Time `json:"achievement_date"`
+	Status           string    `json:"status"` // draft, submitted, verified, rejected
+	SubmittedAt      *string   `json:"submitted_at,omitempty"`
+	VerifiedBy       *string   `json:"verified_by,omitempty"`
+	VerifiedAt       *string   `json:"verified_at,omitempty"`
+	VerifiedOnBehalf *string   `json:"verified_on_behalf_of,omitempty"` // dosen wali a delegate decided for
+	RejectionReason  *string   `json:"rejection_reason,omitempty"`
+	VerificationCode *string   `json:"verification_code,omitempty"`
+	CreatedAt        string    `json:"created_at"`
+	UpdatedAt        string    `json:"updated_at"`
+}
+
+// AchievementLevels lists supported achievement levels
+var AchievementLevels = []string{"lokal", "regional", "nasional", "internasional"}
+
+// ValidateAchievementLevel checks level value, empty level is allowed
+func ValidateAchievementLevel(level string) error {
+	if level == "" {
+		return nil
+	}
+
+	for _, validLevel := range AchievementLevels {
+		if level == validLevel {
+			return nil
+		}
+	}
+
+	return errors.New("invalid level. Must be lokal, regional, nasional, or internasional")
+}
+
+func nullIfEmpty(value string) *string {
+	if value == "" {
+		return nil
+	}
+	return &value
 }
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"database/sql/driver"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+)
+
+func TestBackfillVerificationCodes(t *testing.T) {
+	db, fake := newFakeDB(t)
+	s := &AchievementService{DB: db}
+
+	fake.expectQuery("verification_code IS NULL", []string{"id"}, []driver.Value{"achievement-1"}, []driver.Value{"achievement-2"})
+	fake.allowExec("SET verification_code = $1", 1)
+
+	if err := s.BackfillVerificationCodes(); err != nil {
+		t.Fatalf("BackfillVerificationCodes failed: %v", err)
+	}
+
+	updates := fake.callsContaining("SET verification_code = $1")
+	if len(updates) != 2 {
+		t.Fatalf("Expected 2 codes to be issued, got %d", len(updates))
+	}
+	format := regexp.MustCompile(`^[A-Z2-7]{4}(-[A-Z2-7]{4}){3}$`)
+	for i, update := range updates {
+		code, _ := update.Args[0].(string)
+		if !format.MatchString(code) {
+			t.Errorf("Expected a verification code, got %q", code)
+		}
+		if want := []string{"achievement-1", "achievement-2"}[i]; update.Args[1] != want {
+			t.Errorf("Expected code for %s, got %v", want, update.Args[1])
+		}
+	}
+	if updates[0].Args[0] == updates[1].Args[0] {
+		t.Error("Expected every achievement to get its own code")
+	}
+}
+
+func TestLockCurrentStepNotApprover(t *testing.T) {
+	db, fake := newFakeDB(t)
+	s := NewAchievementService(db, nil)
+
+	fake.expectQuery("FROM achievements a", []string{"category", "level", "advisor_id"}, []driver.Value{"Lomba", "nasional", "dosen-1"})
+	fake.expectQuery("status = 'pending'", []string{"id", "step_order", "step_name", "assignee_rule", "assignee_role", "status", "created_at"},
+		[]driver.Value{"step-2", int64(2), "Kaprodi", AssigneeRuleRole, "kaprodi", "pending", time.Now()})
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	_, _, err = s.lockCurrentStep(tx, "ach-1", "dosen-1", "dosen_wali", "verified")
+	if !errors.Is(err, ErrNotApprover) {
+		t.Fatalf("Expected ErrNotApprover, got %v", err)
+	}
+	if err.Error() != "you are not an approver of the current step (Kaprodi)" {
+		t.Errorf("Expected the step name in the message, got %q", err.Error())
+	}
+}
@@ -0,0 +1,239 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"prestasi-mahasiswa/utils"
+
+	"github.com/lib/pq"
+)
+
+// apiKeyPrefix marks API keys so they are recognizable in configs and secret scanners
+const apiKeyPrefix = "pmk_"
+
+// API key scopes, each grants read access to one area
+const (
+	APIKeyScopeReportsRead      = "reports:read"
+	APIKeyScopeAchievementsRead = "achievements:read"
+)
+
+// APIKeyScopes lists the scopes an admin can grant
+var APIKeyScopes = []string{APIKeyScopeReportsRead, APIKeyScopeAchievementsRead}
+
+// APIKeyService manages admin issued keys for integrations that read data without a user login.
+// Keys are shown once when created, only their hash is stored.
+type APIKeyService struct {
+	DB *sql.DB
+}
+
+type APIKey struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	KeyPrefix  string     `json:"key_prefix"` // first characters of the key, to tell keys apart
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	LastUsedIP *string    `json:"last_used_ip,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	CreatedBy  *string    `json:"created_by,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Status     string     `json:"status"` // active, expired, revoked
+}
+
+type CreateAPIKeyRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days"` // default 90
+}
+
+func NewAPIKeyService(db *sql.DB) *APIKeyService {
+	return &APIKeyService{DB: db}
+}
+
+// CreateAPIKey stores a new key and returns it in plain text, it can't be retrieved later
+func (s *APIKeyService) CreateAPIKey(req CreateAPIKeyRequest, createdBy string) (*APIKey, string, error) {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 100 {
+		return nil, "", errors.New("name is required and must be at most 100 characters")
+	}
+
+	scopes, err := normalizeAPIKeyScopes(req.Scopes)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if req.ExpiresInDays == 0 {
+		req.ExpiresInDays = 90
+	}
+	if req.ExpiresInDays < 0 || req.ExpiresInDays > 730 {
+		return nil, "", errors.New("expires_in_days must be between 1 and 730")
+	}
+
+	secret, err := utils.GenerateRandomToken()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+	key := apiKeyPrefix + secret
+
+	var creator interface{}
+	if createdBy != "" {
+		creator = createdBy
+	}
+
+	apiKey := &APIKey{
+		Name:      req.Name,
+		KeyPrefix: key[:len(apiKeyPrefix)+8],
+		Scopes:    scopes,
+		ExpiresAt: time.Now().Add(time.Duration(req.ExpiresInDays) * 24 * time.Hour),
+		Status:    "active",
+	}
+	if createdBy != "" {
+		apiKey.CreatedBy = &createdBy
+	}
+
+	query := `
+		INSERT INTO api_keys (name, key_prefix, key_hash, scopes, expires_at, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`
+	err = s.DB.QueryRow(query, apiKey.Name, apiKey.KeyPrefix, utils.HashToken(key), pq.Array(apiKey.Scopes),
+		apiKey.ExpiresAt, creator).Scan(&apiKey.ID, &apiKey.CreatedAt)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create API key: %w", err)
+	}
+
+	LogSecurityEvent(s.DB, SecurityEvent{
+		UserID:    createdBy,
+		EventType: SecurityEventAPIKeyCreated,
+		Details:   map[string]interface{}{"api_key_id": apiKey.ID, "name": apiKey.Name, "scopes": apiKey.Scopes},
+	})
+
+	return apiKey, key, nil
+}
+
+// GetAPIKeys lists API keys, newest first
+func (s *APIKeyService) GetAPIKeys() ([]APIKey, error) {
+	query := `
+		SELECT id, name, key_prefix, scopes, expires_at, last_used_at, last_used_ip, revoked_at, created_by, created_at
+		FROM api_keys
+		ORDER BY created_at DESC
+	`
+	rows, err := s.DB.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API keys: %w", err)
+	}
+	defer rows.Close()
+
+	apiKeys := []APIKey{}
+	for rows.Next() {
+		var apiKey APIKey
+		err := rows.Scan(&apiKey.ID, &apiKey.Name, &apiKey.KeyPrefix, pq.Array(&apiKey.Scopes), &apiKey.ExpiresAt,
+			&apiKey.LastUsedAt, &apiKey.LastUsedIP, &apiKey.RevokedAt, &apiKey.CreatedBy, &apiKey.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan API key: %w", err)
+		}
+		apiKey.Status = apiKeyStatus(&apiKey, time.Now())
+		apiKeys = append(apiKeys, apiKey)
+	}
+
+	return apiKeys, nil
+}
+
+// RevokeAPIKey stops a key from being accepted, effective with the next request
+func (s *APIKeyService) RevokeAPIKey(apiKeyID, revokedBy string) error {
+	result, err := s.DB.Exec(`
+		UPDATE api_keys SET revoked_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND revoked_at IS NULL
+	`, apiKeyID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke API key: %w", err)
+	}
+
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return errors.New("API key not found")
+	}
+
+	LogSecurityEvent(s.DB, SecurityEvent{
+		UserID:    revokedBy,
+		EventType: SecurityEventAPIKeyRevoked,
+		Details:   map[string]interface{}{"api_key_id": apiKeyID},
+	})
+
+	return nil
+}
+
+// VerifyAPIKey returns the id and scopes of an active key and records its use
+func (s *APIKeyService) VerifyAPIKey(key, ipAddress string) (string, []string, error) {
+	if !strings.HasPrefix(key, apiKeyPrefix) {
+		return "", nil, errors.New("invalid or expired API key")
+	}
+
+	var apiKeyID string
+	var scopes []string
+	err := s.DB.QueryRow(`
+		SELECT id, scopes FROM api_keys
+		WHERE key_hash = $1 AND revoked_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+	`, utils.HashToken(key)).Scan(&apiKeyID, pq.Array(&scopes))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", nil, errors.New("invalid or expired API key")
+		}
+		return "", nil, fmt.Errorf("failed to verify API key: %w", err)
+	}
+
+	// Written at most once a minute per key, dashboards poll often
+	_, err = s.DB.Exec(`
+		UPDATE api_keys SET last_used_at = CURRENT_TIMESTAMP, last_used_ip = $2
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < CURRENT_TIMESTAMP - INTERVAL '1 minute' OR last_used_ip IS DISTINCT FROM $2)
+	`, apiKeyID, nullIfEmpty(ipAddress))
+	if err != nil {
+		fmt.Printf("Warning: failed to record API key use: %v\n", err)
+	}
+
+	return apiKeyID, scopes, nil
+}
+
+// normalizeAPIKeyScopes checks scopes against APIKeyScopes and removes duplicates
+func normalizeAPIKeyScopes(scopes []string) ([]string, error) {
+	normalized := []string{}
+	seen := make(map[string]bool)
+	for _, scope := range scopes {
+		scope = strings.ToLower(strings.TrimSpace(scope))
+
+		valid := false
+		for _, known := range APIKeyScopes {
+			if scope == known {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return nil, fmt.Errorf("invalid scope %q. Must be one of: %s", scope, strings.Join(APIKeyScopes, ", "))
+		}
+
+		if !seen[scope] {
+			seen[scope] = true
+			normalized = append(normalized, scope)
+		}
+	}
+
+	if len(normalized) == 0 {
+		return nil, errors.New("at least one scope is required")
+	}
+	return normalized, nil
+}
+
+func apiKeyStatus(apiKey *APIKey, now time.Time) string {
+	switch {
+	case apiKey.RevokedAt != nil:
+		return "revoked"
+	case !apiKey.ExpiresAt.After(now):
+		return "expired"
+	default:
+		return "active"
+	}
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNormalizeAPIKeyScopes(t *testing.T) {
+	scopes, err := normalizeAPIKeyScopes([]string{" Reports:Read ", "achievements:read", "reports:read"})
+	if err != nil {
+		t.Fatalf("Failed to normalize scopes: %v", err)
+	}
+	if len(scopes) != 2 || scopes[0] != APIKeyScopeReportsRead || scopes[1] != APIKeyScopeAchievementsRead {
+		t.Errorf("Unexpected scopes: %v", scopes)
+	}
+
+	for _, invalid := range [][]string{nil, {}, {"reports:write"}, {"reports:read", "*"}} {
+		if _, err := normalizeAPIKeyScopes(invalid); err == nil {
+			t.Errorf("Expected scopes %v to be rejected", invalid)
+		}
+	}
+}
+
+func TestAPIKeyStatus(t *testing.T) {
+	now := time.Now()
+	revokedAt := now.Add(-time.Hour)
+
+	tests := []struct {
+		apiKey APIKey
+		want   string
+	}{
+		{APIKey{ExpiresAt: now.Add(time.Hour)}, "active"},
+		{APIKey{ExpiresAt: now.Add(-time.Minute)}, "expired"},
+		{APIKey{ExpiresAt: now.Add(time.Hour), RevokedAt: &revokedAt}, "revoked"},
+	}
+
+	for _, tt := range tests {
+		if got := apiKeyStatus(&tt.apiKey, now); got != tt.want {
+			t.Errorf("apiKeyStatus(%+v) = %q, want %q", tt.apiKey, got, tt.want)
+		}
+	}
+}
+
+func TestVerifyAPIKeyRejectsForeignFormat(t *testing.T) {
+	// Keys without the prefix are refused before touching the database
+	s := &APIKeyService{}
+	if _, _, err := s.VerifyAPIKey("eyJhbGciOiJIUzI1NiJ9", "127.0.0.1"); err == nil {
+		t.Error("Expected key without prefix to be rejected")
+	}
+}
@@ -0,0 +1,645 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Assignee rules of approval steps
+const (
+	AssigneeRuleAdvisor  = "advisor"  // the student's dosen wali
+	AssigneeRuleRole     = "role"     // any user with the step's role
+	AssigneeRuleVerifier = "verifier" // any user with achievement:verify
+)
+
+// maxApprovalSteps keeps chains short enough that a submission can get through them
+const maxApprovalSteps = 10
+
+// defaultApprovalSteps applies when no active chain matches an achievement
+var defaultApprovalSteps = []ApprovalChainStep{
+	{StepOrder: 1, Name: "Dosen Wali", AssigneeRule: AssigneeRuleAdvisor},
+}
+
+// ApprovalService manages the approval chains submitted achievements go through
+// and the per-achievement steps copied from them
+type ApprovalService struct {
+	DB *sql.DB
+}
+
+type ApprovalChain struct {
+	ID        string              `json:"id"`
+	Name      string              `json:"name"`
+	Category  *string             `json:"category"` // null matches every category
+	Level     *string             `json:"level"`    // null matches every level
+	IsActive  bool                `json:"is_active"`
+	Steps     []ApprovalChainStep `json:"steps"`
+	CreatedAt time.Time           `json:"created_at"`
+	UpdatedAt time.Time           `json:"updated_at"`
+}
+
+type ApprovalChainStep struct {
+	StepOrder    int     `json:"step_order"`
+	Name         string  `json:"name"`
+	AssigneeRule string  `json:"assignee_rule"`           // advisor, role, verifier
+	AssigneeRole *string `json:"assignee_role,omitempty"` // for the role rule
+}
+
+type ApprovalChainRequest struct {
+	Name     string                `json:"name"`
+	Category string                `json:"category"`
+	Level    string                `json:"level"`
+	IsActive *bool                 `json:"is_active"` // default true
+	Steps    []ApprovalStepRequest `json:"steps"`
+}
+
+type ApprovalStepRequest struct {
+	Name         string `json:"name"`
+	AssigneeRule string `json:"assignee_rule"`
+	AssigneeRole string `json:"assignee_role"`
+}
+
+// AchievementApproval is one step of a submitted achievement, decided steps form its history
+type AchievementApproval struct {
+	ID            string     `json:"id"`
+	Round         int        `json:"round"` // submission the step belongs to, resubmissions start a new round
+	StepOrder     int        `json:"step_order"`
+	StepName      string     `json:"step_name"`
+	AssigneeRule  string     `json:"assignee_rule"`
+	AssigneeRole  *string    `json:"assignee_role,omitempty"`
+	Status        string     `json:"status"` // pending, approved, rejected, skipped
+	DecidedBy     *string    `json:"decided_by,omitempty"`
+	DecidedByName *string    `json:"decided_by_name,omitempty"`
+	OnBehalfOf    *string    `json:"on_behalf_of,omitempty"` // dosen wali a delegate decided for
+	OnBehalfName  *string    `json:"on_behalf_of_name,omitempty"`
+	DecidedAt     *time.Time `json:"decided_at,omitempty"`
+	Note          *string    `json:"note,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// ApprovalProgress is the outcome of approving a step
+type ApprovalProgress struct {
+	Status   string               `json:"status"`              // submitted while steps remain, verified after the last one
+	NextStep *AchievementApproval `json:"next_step,omitempty"` // step now waiting for a decision
+}
+
+func NewApprovalService(db *sql.DB) *ApprovalService {
+	return &ApprovalService{DB: db}
+}
+
+// GetChains lists approval chains with their steps
+func (s *ApprovalService) GetChains() ([]ApprovalChain, error) {
+	rows, err := s.DB.Query(`
+		SELECT id, name, category, level, is_active, created_at, updated_at
+		FROM approval_chains
+		ORDER BY category NULLS FIRST, level NULLS FIRST, name
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get approval chains: %w", err)
+	}
+	defer rows.Close()
+
+	chains := []ApprovalChain{}
+	for rows.Next() {
+		var chain ApprovalChain
+		err := rows.Scan(&chain.ID, &chain.Name, &chain.Category, &chain.Level, &chain.IsActive, &chain.CreatedAt, &chain.UpdatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan approval chain: %w", err)
+		}
+		chains = append(chains, chain)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get approval chains: %w", err)
+	}
+
+	for i := range chains {
+		steps, err := s.getChainSteps(s.DB, chains[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		chains[i].Steps = steps
+	}
+
+	return chains, nil
+}
+
+// GetChain returns one approval chain with its steps
+func (s *ApprovalService) GetChain(id string) (*ApprovalChain, error) {
+	var chain ApprovalChain
+	err := s.DB.QueryRow(`
+		SELECT id, name, category, level, is_active, created_at, updated_at
+		FROM approval_chains WHERE id = $1
+	`, id).Scan(&chain.ID, &chain.Name, &chain.Category, &chain.Level, &chain.IsActive, &chain.CreatedAt, &chain.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("approval chain not found")
+		}
+		return nil, fmt.Errorf("failed to get approval chain: %w", err)
+	}
+
+	chain.Steps, err = s.getChainSteps(s.DB, chain.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &chain, nil
+}
+
+// CreateChain adds an approval chain for a category and/or level
+func (s *ApprovalService) CreateChain(req ApprovalChainRequest) (*ApprovalChain, error) {
+	steps, err := normalizeApprovalChain(&req)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkStepRoles(steps); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var id string
+	err = tx.QueryRow(`
+		INSERT INTO approval_chains (name, category, level, is_active)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`, req.Name, nullIfEmpty(req.Category), nullIfEmpty(req.Level), *req.IsActive).Scan(&id)
+	if err != nil {
+		return nil, approvalChainWriteError("create", err)
+	}
+
+	if err := setChainSteps(tx, id, steps); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit approval chain: %w", err)
+	}
+
+	return s.GetChain(id)
+}
+
+// UpdateChain replaces an approval chain. Achievements already in review keep the steps they were submitted with.
+func (s *ApprovalService) UpdateChain(id string, req ApprovalChainRequest) (*ApprovalChain, error) {
+	steps, err := normalizeApprovalChain(&req)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkStepRoles(steps); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE approval_chains
+		SET name = $2, category = $3, level = $4, is_active = $5, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`, id, req.Name, nullIfEmpty(req.Category), nullIfEmpty(req.Level), *req.IsActive)
+	if err != nil {
+		return nil, approvalChainWriteError("update", err)
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return nil, errors.New("approval chain not found")
+	}
+
+	if _, err := tx.Exec(`DELETE FROM approval_chain_steps WHERE chain_id = $1`, id); err != nil {
+		return nil, fmt.Errorf("failed to update approval steps: %w", err)
+	}
+	if err := setChainSteps(tx, id, steps); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit approval chain: %w", err)
+	}
+
+	return s.GetChain(id)
+}
+
+// DeleteChain removes an approval chain, matching achievements fall back to a less specific chain
+func (s *ApprovalService) DeleteChain(id string) error {
+	result, err := s.DB.Exec(`DELETE FROM approval_chains WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete approval chain: %w", err)
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return errors.New("approval chain not found")
+	}
+	return nil
+}
+
+// GetAchievementApprovals returns the approval steps of an achievement in order
+func (s *ApprovalService) GetAchievementApprovals(achievementID string) ([]AchievementApproval, error) {
+	return s.getAchievementApprovals(s.DB, achievementID)
+}
+
+// startApproval copies the steps of the chain matching category and level to a submitted achievement.
+// Every submission is a new round, the steps of earlier rounds are kept as history.
+func (s *ApprovalService) startApproval(tx *sql.Tx, achievementID, category, level string) error {
+	steps, err := s.resolveChainSteps(tx, category, level)
+	if err != nil {
+		return err
+	}
+
+	var round int
+	err = tx.QueryRow(`SELECT COALESCE(MAX(round), 0) + 1 FROM achievement_approvals WHERE achievement_id = $1`, achievementID).Scan(&round)
+	if err != nil {
+		return fmt.Errorf("failed to start approval: %w", err)
+	}
+
+	for _, step := range steps {
+		_, err := tx.Exec(`
+			INSERT INTO achievement_approvals (achievement_id, round, step_order, step_name, assignee_rule, assignee_role)
+			VALUES ($1, $2, $3, $4, $5, $6)
+		`, achievementID, round, step.StepOrder, step.Name, step.AssigneeRule, step.AssigneeRole)
+		if err != nil {
+			return fmt.Errorf("failed to create approval step: %w", err)
+		}
+	}
+
+	if _, err := tx.Exec(`UPDATE achievements SET current_step = 1 WHERE id = $1`, achievementID); err != nil {
+		return fmt.Errorf("failed to start approval: %w", err)
+	}
+	// Achievements submitted before approval chains get their steps on the first decision, they have been waiting since submission
+	_, err = tx.Exec(`
+		UPDATE achievement_approvals ap
+		SET activated_at = COALESCE((SELECT submitted_at FROM achievements WHERE id = ap.achievement_id), CURRENT_TIMESTAMP),
+		    assigned_advisor_id = `+stepAdvisorSQL+`
+		WHERE ap.achievement_id = $1 AND ap.round = $2 AND ap.step_order = 1
+	`, achievementID, round)
+	if err != nil {
+		return fmt.Errorf("failed to start approval: %w", err)
+	}
+	return nil
+}
+
+// activateStep starts the SLA clock of the next step once the previous one is approved
+func (s *ApprovalService) activateStep(tx *sql.Tx, stepID string) error {
+	_, err := tx.Exec(`
+		UPDATE achievement_approvals ap
+		SET activated_at = CURRENT_TIMESTAMP, assigned_advisor_id = `+stepAdvisorSQL+`
+		WHERE ap.id = $1
+	`, stepID)
+	if err != nil {
+		return fmt.Errorf("failed to advance approval: %w", err)
+	}
+	return nil
+}
+
+// stepAdvisorSQL is the dosen wali responsible for the achievement_approvals row ap when it starts
+// waiting, the student's dosen wali for advisor steps
+const stepAdvisorSQL = `CASE WHEN ap.assignee_rule = 'advisor' THEN (
+			SELECT u.advisor_id FROM achievements a JOIN users u ON u.id = a.mahasiswa_id WHERE a.id = ap.achievement_id
+		) END`
+
+// handOverAdvisorSteps makes a student's new dosen wali responsible for the advisor steps still waiting
+func handOverAdvisorSteps(tx *sql.Tx, studentID, advisorID string) error {
+	_, err := tx.Exec(`
+		UPDATE achievement_approvals ap SET assigned_advisor_id = $2
+		FROM achievements a
+		WHERE a.id = ap.achievement_id AND a.mahasiswa_id = $1
+		  AND ap.assignee_rule = 'advisor' AND ap.status = 'pending' AND ap.activated_at IS NOT NULL
+	`, studentID, advisorID)
+	if err != nil {
+		return fmt.Errorf("failed to hand over approval steps: %w", err)
+	}
+	return nil
+}
+
+// currentStep returns the first pending step of a submitted achievement. Achievements
+// submitted before approval chains existed get their steps on the first decision.
+func (s *ApprovalService) currentStep(tx *sql.Tx, achievementID, category, level string) (*AchievementApproval, error) {
+	step, err := s.firstPendingStep(tx, achievementID)
+	if err != nil || step != nil {
+		return step, err
+	}
+
+	if err := s.startApproval(tx, achievementID, category, level); err != nil {
+		return nil, err
+	}
+	step, err = s.firstPendingStep(tx, achievementID)
+	if err != nil {
+		return nil, err
+	}
+	if step == nil {
+		return nil, errors.New("achievement has no approval steps")
+	}
+	return step, nil
+}
+
+func (s *ApprovalService) firstPendingStep(tx *sql.Tx, achievementID string) (*AchievementApproval, error) {
+	var step AchievementApproval
+	err := tx.QueryRow(`
+		SELECT id, step_order, step_name, assignee_rule, assignee_role, status, created_at
+		FROM achievement_approvals
+		WHERE achievement_id = $1 AND status = 'pending'
+		ORDER BY step_order
+		LIMIT 1
+	`, achievementID).Scan(&step.ID, &step.StepOrder, &step.StepName, &step.AssigneeRule, &step.AssigneeRole, &step.Status, &step.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get approval step: %w", err)
+	}
+	return &step, nil
+}
+
+// decideStep records the decision on a step, onBehalfOf is the dosen wali a delegate decided for
+func (s *ApprovalService) decideStep(tx *sql.Tx, stepID, status, decidedBy, onBehalfOf, note string) error {
+	result, err := tx.Exec(`
+		UPDATE achievement_approvals
+		SET status = $2, decided_by = $3, on_behalf_of = $4, decided_at = CURRENT_TIMESTAMP, note = $5
+		WHERE id = $1 AND status = 'pending'
+	`, stepID, status, decidedBy, nullIfEmpty(onBehalfOf), nullIfEmpty(note))
+	if err != nil {
+		return fmt.Errorf("failed to record approval decision: %w", err)
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected != 1 {
+		return errors.New("approval step was already decided")
+	}
+	return nil
+}
+
+// skipRemainingSteps closes the steps after a rejection
+func (s *ApprovalService) skipRemainingSteps(tx *sql.Tx, achievementID string) error {
+	_, err := tx.Exec(`
+		UPDATE achievement_approvals SET status = 'skipped'
+		WHERE achievement_id = $1 AND status = 'pending'
+	`, achievementID)
+	if err != nil {
+		return fmt.Errorf("failed to close approval steps: %w", err)
+	}
+	return nil
+}
+
+// resolveChainSteps returns the steps of the most specific active chain for category and level
+func (s *ApprovalService) resolveChainSteps(q queryer, category, level string) ([]ApprovalChainStep, error) {
+	var chainID string
+	err := q.QueryRow(`
+		SELECT id FROM approval_chains
+		WHERE is_active
+		  AND (category IS NULL OR LOWER(category) = LOWER($1))
+		  AND (level IS NULL OR level = $2)
+		ORDER BY (category IS NOT NULL) DESC, (level IS NOT NULL) DESC
+		LIMIT 1
+	`, category, level).Scan(&chainID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return defaultApprovalSteps, nil
+		}
+		return nil, fmt.Errorf("failed to resolve approval chain: %w", err)
+	}
+
+	steps, err := s.getChainSteps(q, chainID)
+	if err != nil {
+		return nil, err
+	}
+	if len(steps) == 0 {
+		return defaultApprovalSteps, nil
+	}
+	return steps, nil
+}
+
+func (s *ApprovalService) getChainSteps(q queryer, chainID string) ([]ApprovalChainStep, error) {
+	rows, err := q.Query(`
+		SELECT step_order, name, assignee_rule, assignee_role
+		FROM approval_chain_steps
+		WHERE chain_id = $1
+		ORDER BY step_order
+	`, chainID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get approval steps: %w", err)
+	}
+	defer rows.Close()
+
+	steps := []ApprovalChainStep{}
+	for rows.Next() {
+		var step ApprovalChainStep
+		if err := rows.Scan(&step.StepOrder, &step.Name, &step.AssigneeRule, &step.AssigneeRole); err != nil {
+			return nil, fmt.Errorf("failed to scan approval step: %w", err)
+		}
+		steps = append(steps, step)
+	}
+	return steps, rows.Err()
+}
+
+func (s *ApprovalService) getAchievementApprovals(q queryer, achievementID string) ([]AchievementApproval, error) {
+	rows, err := q.Query(`
+		SELECT a.id, a.round, a.step_order, a.step_name, a.assignee_rule, a.assignee_role, a.status,
+		       a.decided_by, u.name, a.on_behalf_of, o.name, a.decided_at, a.note, a.created_at
+		FROM achievement_approvals a
+		LEFT JOIN users u ON u.id = a.decided_by
+		LEFT JOIN users o ON o.id = a.on_behalf_of
+		WHERE a.achievement_id = $1
+		ORDER BY a.round, a.step_order
+	`, achievementID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get approval steps: %w", err)
+	}
+	defer rows.Close()
+
+	approvals := []AchievementApproval{}
+	for rows.Next() {
+		var approval AchievementApproval
+		err := rows.Scan(&approval.ID, &approval.Round, &approval.StepOrder, &approval.StepName, &approval.AssigneeRule, &approval.AssigneeRole,
+			&approval.Status, &approval.DecidedBy, &approval.DecidedByName, &approval.OnBehalfOf, &approval.OnBehalfName,
+			&approval.DecidedAt, &approval.Note, &approval.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan approval step: %w", err)
+		}
+		approvals = append(approvals, approval)
+	}
+	return approvals, rows.Err()
+}
+
+// checkStepRoles makes sure roles named by role steps exist
+func (s *ApprovalService) checkStepRoles(steps []ApprovalChainStep) error {
+	for _, step := range steps {
+		if step.AssigneeRole == nil {
+			continue
+		}
+		exists, err := roleExists(s.DB, *step.AssigneeRole)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return fmt.Errorf("step %d: role %q not found", step.StepOrder, *step.AssigneeRole)
+		}
+	}
+	return nil
+}
+
+func setChainSteps(tx *sql.Tx, chainID string, steps []ApprovalChainStep) error {
+	for _, step := range steps {
+		_, err := tx.Exec(`
+			INSERT INTO approval_chain_steps (chain_id, step_order, name, assignee_rule, assignee_role)
+			VALUES ($1, $2, $3, $4, $5)
+		`, chainID, step.StepOrder, step.Name, step.AssigneeRule, step.AssigneeRole)
+		if err != nil {
+			return fmt.Errorf("failed to create approval step: %w", err)
+		}
+	}
+	return nil
+}
+
+func approvalChainWriteError(action string, err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return errors.New("an approval chain for this category and level already exists")
+	}
+	return fmt.Errorf("failed to %s approval chain: %w", action, err)
+}
+
+// normalizeApprovalChain validates a chain request and numbers its steps from 1
+func normalizeApprovalChain(req *ApprovalChainRequest) ([]ApprovalChainStep, error) {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 100 {
+		return nil, errors.New("name is required and must be at most 100 characters")
+	}
+	req.Category = strings.TrimSpace(req.Category)
+	if len(req.Category) > 100 {
+		return nil, errors.New("category must be at most 100 characters")
+	}
+	req.Level = strings.TrimSpace(req.Level)
+	if err := ValidateAchievementLevel(req.Level); err != nil {
+		return nil, err
+	}
+	if req.IsActive == nil {
+		active := true
+		req.IsActive = &active
+	}
+
+	if len(req.Steps) == 0 || len(req.Steps) > maxApprovalSteps {
+		return nil, fmt.Errorf("a chain needs between 1 and %d steps", maxApprovalSteps)
+	}
+
+	steps := make([]ApprovalChainStep, len(req.Steps))
+	for i, stepReq := range req.Steps {
+		step := ApprovalChainStep{
+			StepOrder:    i + 1,
+			Name:         strings.TrimSpace(stepReq.Name),
+			AssigneeRule: strings.ToLower(strings.TrimSpace(stepReq.AssigneeRule)),
+		}
+		if step.Name == "" || len(step.Name) > 100 {
+			return nil, fmt.Errorf("step %d: name is required and must be at most 100 characters", step.StepOrder)
+		}
+
+		role := strings.TrimSpace(stepReq.AssigneeRole)
+		switch step.AssigneeRule {
+		case AssigneeRuleAdvisor, AssigneeRuleVerifier:
+			if role != "" {
+				return nil, fmt.Errorf("step %d: assignee_role is only used with the role rule", step.StepOrder)
+			}
+		case AssigneeRuleRole:
+			if !roleNamePattern.MatchString(role) {
+				return nil, fmt.Errorf("step %d: assignee_role is required for the role rule", step.StepOrder)
+			}
+			step.AssigneeRole = &role
+		default:
+			return nil, fmt.Errorf("step %d: assignee_rule must be advisor, role or verifier", step.StepOrder)
+		}
+
+		steps[i] = step
+	}
+
+	return steps, nil
+}
+
+// canDecideStep reports whether a user may approve or reject step, and for which dosen wali
+// when the user decides as their delegate. Admins can decide every step, and advisor steps of
+// students without a dosen wali are open to any verifier.
+func canDecideStep(step AchievementApproval, userID, userRole, advisorID string, advisorDelegate bool) (bool, string) {
+	if userRole == RoleAdmin {
+		return true, ""
+	}
+
+	switch step.AssigneeRule {
+	case AssigneeRuleAdvisor:
+		if advisorID == "" || userID == advisorID {
+			return true, ""
+		}
+		if advisorDelegate {
+			return true, advisorID
+		}
+		return false, ""
+	case AssigneeRuleRole:
+		return step.AssigneeRole != nil && userRole == *step.AssigneeRole, ""
+	case AssigneeRuleVerifier:
+		return true, ""
+	default:
+		return false, ""
+	}
+}
+
+// userContact is a user to email or notify
+type userContact struct {
+	ID    string
+	Name  string
+	Email string
+}
+
+// stepAssignees returns the users expected to decide a step: users with the step's role for role
+// steps, otherwise the dosen wali and their active delegates. Verifier steps are open to any
+// verifier, the dosen wali is the one expected to pick them up.
+func stepAssignees(q queryer, assigneeRule string, assigneeRole, advisorID *string) ([]userContact, error) {
+	if assigneeRule == AssigneeRuleRole {
+		if assigneeRole == nil {
+			return nil, nil
+		}
+		return activeUsersWithRoles(q, []string{*assigneeRole})
+	}
+	if advisorID == nil || *advisorID == "" {
+		return nil, nil
+	}
+
+	return queryUserContacts(q, `
+		SELECT id, name, email FROM users
+		WHERE is_active = true AND deleted_at IS NULL
+		  AND (id = $1 OR id IN (
+			SELECT delegate_id FROM verifier_delegations
+			WHERE delegator_id = $1 AND revoked_at IS NULL
+			  AND starts_at <= CURRENT_TIMESTAMP AND ends_at > CURRENT_TIMESTAMP
+		  ))
+	`, *advisorID)
+}
+
+func activeUsersWithRoles(q queryer, roles []string) ([]userContact, error) {
+	return queryUserContacts(q, `
+		SELECT id, name, email FROM users
+		WHERE is_active = true AND deleted_at IS NULL AND role = ANY($1)
+	`, pq.Array(roles))
+}
+
+func queryUserContacts(q queryer, query string, args ...interface{}) ([]userContact, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get users: %w", err)
+	}
+	defer rows.Close()
+
+	var contacts []userContact
+	for rows.Next() {
+		var contact userContact
+		if err := rows.Scan(&contact.ID, &contact.Name, &contact.Email); err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		contacts = append(contacts, contact)
+	}
+	return contacts, rows.Err()
+}
+
+// queryer is implemented by *sql.DB and *sql.Tx
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
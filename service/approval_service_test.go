@@ -0,0 +1,135 @@
+package service
+
+import (
+	"database/sql/driver"
+	"testing"
+)
+
+func TestNormalizeApprovalChain(t *testing.T) {
+	req := ApprovalChainRequest{
+		Name:  " International ",
+		Level: "internasional",
+		Steps: []ApprovalStepRequest{
+			{Name: "Dosen Wali", AssigneeRule: "Advisor"},
+			{Name: "Kaprodi", AssigneeRule: "role", AssigneeRole: "kaprodi"},
+			{Name: "Verifier", AssigneeRule: "verifier"},
+		},
+	}
+
+	steps, err := normalizeApprovalChain(&req)
+	if err != nil {
+		t.Fatalf("Failed to normalize chain: %v", err)
+	}
+	if req.Name != "International" || req.IsActive == nil || !*req.IsActive {
+		t.Errorf("Unexpected normalized request: %+v", req)
+	}
+	if len(steps) != 3 || steps[0].StepOrder != 1 || steps[2].StepOrder != 3 {
+		t.Fatalf("Unexpected steps: %+v", steps)
+	}
+	if steps[0].AssigneeRule != AssigneeRuleAdvisor || steps[0].AssigneeRole != nil {
+		t.Errorf("Unexpected advisor step: %+v", steps[0])
+	}
+	if steps[1].AssigneeRole == nil || *steps[1].AssigneeRole != "kaprodi" {
+		t.Errorf("Unexpected role step: %+v", steps[1])
+	}
+
+	invalid := []ApprovalChainRequest{
+		{Name: "", Steps: []ApprovalStepRequest{{Name: "Dosen Wali", AssigneeRule: "advisor"}}},
+		{Name: "No steps"},
+		{Name: "Bad level", Level: "global", Steps: []ApprovalStepRequest{{Name: "Dosen Wali", AssigneeRule: "advisor"}}},
+		{Name: "Bad rule", Steps: []ApprovalStepRequest{{Name: "Dekan", AssigneeRule: "dean"}}},
+		{Name: "Role missing", Steps: []ApprovalStepRequest{{Name: "Kaprodi", AssigneeRule: "role"}}},
+		{Name: "Role on advisor", Steps: []ApprovalStepRequest{{Name: "Dosen Wali", AssigneeRule: "advisor", AssigneeRole: "kaprodi"}}},
+		{Name: "Unnamed step", Steps: []ApprovalStepRequest{{AssigneeRule: "verifier"}}},
+	}
+	for _, req := range invalid {
+		if _, err := normalizeApprovalChain(&req); err == nil {
+			t.Errorf("Expected chain %q to be rejected", req.Name)
+		}
+	}
+}
+
+func TestCanDecideStep(t *testing.T) {
+	kaprodi := "kaprodi"
+	advisorStep := AchievementApproval{AssigneeRule: AssigneeRuleAdvisor}
+	roleStep := AchievementApproval{AssigneeRule: AssigneeRuleRole, AssigneeRole: &kaprodi}
+	verifierStep := AchievementApproval{AssigneeRule: AssigneeRuleVerifier}
+
+	tests := []struct {
+		name           string
+		step           AchievementApproval
+		userID         string
+		userRole       string
+		advisorID      string
+		delegate       bool
+		want           bool
+		wantOnBehalfOf string
+	}{
+		{"advisor decides advisor step", advisorStep, "dosen-1", "dosen_wali", "dosen-1", false, true, ""},
+		{"other dosen can't decide advisor step", advisorStep, "dosen-2", "dosen_wali", "dosen-1", false, false, ""},
+		{"delegate decides for advisor", advisorStep, "dosen-2", "dosen_wali", "dosen-1", true, true, "dosen-1"},
+		{"student without advisor is open to verifiers", advisorStep, "dosen-2", "dosen_wali", "", false, true, ""},
+		{"kaprodi decides kaprodi step", roleStep, "kaprodi-1", "kaprodi", "dosen-1", false, true, ""},
+		{"advisor can't decide kaprodi step", roleStep, "dosen-1", "dosen_wali", "dosen-1", false, false, ""},
+		{"delegation doesn't cover role steps", roleStep, "dosen-2", "dosen_wali", "dosen-1", true, false, ""},
+		{"admin decides every step", roleStep, "admin-1", RoleAdmin, "dosen-1", false, true, ""},
+		{"any verifier decides verifier step", verifierStep, "staff-1", "wakil_dekan", "dosen-1", false, true, ""},
+		{"unknown rule", AchievementApproval{AssigneeRule: "dean"}, "dosen-1", "dosen_wali", "dosen-1", false, false, ""},
+	}
+
+	for _, tt := range tests {
+		got, onBehalfOf := canDecideStep(tt.step, tt.userID, tt.userRole, tt.advisorID, tt.delegate)
+		if got != tt.want || onBehalfOf != tt.wantOnBehalfOf {
+			t.Errorf("%s: canDecideStep() = %v, %q, want %v, %q", tt.name, got, onBehalfOf, tt.want, tt.wantOnBehalfOf)
+		}
+	}
+}
+
+func TestStartApprovalOpensNewRound(t *testing.T) {
+	db, fake := newFakeDB(t)
+	fake.expectQuery("FROM approval_chains", []string{"id"})
+	fake.expectQuery("MAX(round)", []string{"round"}, []driver.Value{int64(2)})
+	fake.expectExec("INSERT INTO achievement_approvals", 1)
+	fake.expectExec("SET current_step = 1", 1)
+	fake.expectExec("SET activated_at", 1)
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	// A resubmission after a rejection in round 1 gets its own steps instead of colliding with the old ones
+	if err := NewApprovalService(db).startApproval(tx, "ach-1", "Lomba", "nasional"); err != nil {
+		t.Fatalf("startApproval() error = %v", err)
+	}
+
+	insert := fake.callsContaining("INSERT INTO achievement_approvals")[0]
+	if insert.Args[1] != int64(2) || insert.Args[2] != int64(1) || insert.Args[3] != "Dosen Wali" {
+		t.Errorf("Expected step 1 of round 2, got %v", insert.Args)
+	}
+	activate := fake.callsContaining("SET activated_at")[0]
+	if activate.Args[0] != "ach-1" || activate.Args[1] != int64(2) {
+		t.Errorf("Expected step 1 of round 2 to be activated, got %v", activate.Args)
+	}
+}
+
+func TestDecideStepAlreadyDecided(t *testing.T) {
+	db, fake := newFakeDB(t)
+	fake.expectExec("UPDATE achievement_approvals", 1)
+	fake.expectExec("UPDATE achievement_approvals", 0)
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	service := NewApprovalService(db)
+	if err := service.decideStep(tx, "step-1", "approved", "dosen-1", "", ""); err != nil {
+		t.Fatalf("decideStep() error = %v", err)
+	}
+	if err := service.decideStep(tx, "step-1", "rejected", "dosen-2", "", "late"); err == nil {
+		t.Error("Expected deciding a step that is no longer pending to fail")
+	}
+}
@@ -0,0 +1,402 @@
+package service
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"prestasi-mahasiswa/utils"
+)
+
+// AttestationService signs verified achievements with Ed25519. Private keys are stored encrypted with KeyBox.
+type AttestationService struct {
+	DB                 *sql.DB
+	KeyBox             *utils.SecretBox
+	AchievementService *AchievementService
+	FileService        *FileService
+	Issuer             string
+}
+
+// AttestationPayload is the signed document, utils.CanonicalJSON encodes it with sorted keys
+type AttestationPayload struct {
+	Achievement AttestedAchievement `json:"achievement"`
+	Files       []AttestedFile      `json:"files"`
+	IssuedAt    string              `json:"issued_at"`
+	Issuer      string              `json:"issuer"`
+	Version     int                 `json:"version"`
+}
+
+type AttestedAchievement struct {
+	AchievementDate  string `json:"achievement_date"`
+	Category         string `json:"category"`
+	Description      string `json:"description"`
+	ID               string `json:"id"`
+	Level            string `json:"level"`
+	MahasiswaID      string `json:"mahasiswa_id"`
+	StudentName      string `json:"student_name"`
+	Title            string `json:"title"`
+	VerificationCode string `json:"verification_code"`
+	VerifiedAt       string `json:"verified_at"`
+	VerifiedBy       string `json:"verified_by"`
+}
+
+type AttestedFile struct {
+	ContentType string `json:"content_type"`
+	FileID      string `json:"file_id"`
+	Filename    string `json:"filename"`
+	SHA256      string `json:"sha256"`
+	Size        int64  `json:"size"`
+}
+
+type Attestation struct {
+	ID            string          `json:"id"`
+	AchievementID string          `json:"achievement_id"`
+	KeyID         string          `json:"kid"`
+	Payload       json.RawMessage `json:"payload"`
+	JWS           string          `json:"jws"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+type AttestationKey struct {
+	KeyID     string     `json:"kid"`
+	Algorithm string     `json:"algorithm"`
+	PublicKey string     `json:"public_key"`
+	Status    string     `json:"status"` // active, retired
+	CreatedAt time.Time  `json:"created_at"`
+	RetiredAt *time.Time `json:"retired_at,omitempty"`
+}
+
+func NewAttestationService(db *sql.DB, keyBox *utils.SecretBox, achievementSvc *AchievementService, fileSvc *FileService, issuer string) *AttestationService {
+	return &AttestationService{
+		DB:                 db,
+		KeyBox:             keyBox,
+		AchievementService: achievementSvc,
+		FileService:        fileSvc,
+		Issuer:             issuer,
+	}
+}
+
+// AttestAchievement signs canonical JSON of a verified achievement and its file hashes
+func (s *AttestationService) AttestAchievement(achievementID string) (*Attestation, error) {
+	achievement, err := s.AchievementService.GetAchievementByID(achievementID)
+	if err != nil {
+		return nil, err
+	}
+
+	if achievement.Status != "verified" || achievement.VerifiedAt == nil || achievement.VerifiedBy == nil {
+		return nil, errors.New("achievement is not verified")
+	}
+
+	verificationCode, err := s.AchievementService.EnsureVerificationCode(achievementID)
+	if err != nil {
+		return nil, err
+	}
+
+	files, err := s.hashAchievementFiles(achievementID)
+	if err != nil {
+		return nil, err
+	}
+
+	payload := AttestationPayload{
+		Achievement: AttestedAchievement{
+			AchievementDate:  achievement.AchievementDate.Format("2006-01-02"),
+			Category:         achievement.Category,
+			Description:      achievement.Description,
+			ID:               achievement.ID,
+			Level:            achievement.Level,
+			MahasiswaID:      achievement.MahasiswaID,
+			StudentName:      achievement.MahasiswaName,
+			Title:            achievement.Title,
+			VerificationCode: verificationCode,
+			VerifiedAt:       *achievement.VerifiedAt,
+			VerifiedBy:       *achievement.VerifiedBy,
+		},
+		Files:    files,
+		IssuedAt: time.Now().UTC().Format(time.RFC3339),
+		Issuer:   s.Issuer,
+		Version:  1,
+	}
+
+	canonicalPayload, err := utils.CanonicalJSON(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode attestation payload: %w", err)
+	}
+
+	kid, privateKey, err := s.activeSigningKey()
+	if err != nil {
+		return nil, err
+	}
+
+	jws, err := utils.SignAttestation(canonicalPayload, kid, privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign attestation: %w", err)
+	}
+
+	attestation := &Attestation{
+		AchievementID: achievementID,
+		KeyID:         kid,
+		Payload:       canonicalPayload,
+		JWS:           jws,
+	}
+
+	query := `
+		INSERT INTO achievement_attestations (achievement_id, kid, payload, jws)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`
+	err = s.DB.QueryRow(query, achievementID, kid, string(canonicalPayload), jws).Scan(&attestation.ID, &attestation.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store attestation: %w", err)
+	}
+
+	return attestation, nil
+}
+
+// GetLatestAttestation returns the most recent attestation of an achievement
+func (s *AttestationService) GetLatestAttestation(achievementID string) (*Attestation, error) {
+	query := `
+		SELECT id, achievement_id, kid, payload, jws, created_at
+		FROM achievement_attestations
+		WHERE achievement_id = $1
+		ORDER BY created_at DESC
+		LIMIT 1
+	`
+
+	var attestation Attestation
+	var payload string
+	err := s.DB.QueryRow(query, achievementID).Scan(
+		&attestation.ID,
+		&attestation.AchievementID,
+		&attestation.KeyID,
+		&payload,
+		&attestation.JWS,
+		&attestation.CreatedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("attestation not found")
+		}
+		return nil, fmt.Errorf("failed to get attestation: %w", err)
+	}
+
+	attestation.Payload = json.RawMessage(payload)
+	return &attestation, nil
+}
+
+// GetPublicKeySet returns all active and retired verification keys in JWK set format
+func (s *AttestationService) GetPublicKeySet() (*utils.AttestationKeySet, error) {
+	keys, err := s.GetKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	keySet := &utils.AttestationKeySet{Keys: []utils.AttestationJWK{}}
+	for _, key := range keys {
+		publicKey, err := base64.StdEncoding.DecodeString(key.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("invalid public key %s: %w", key.KeyID, err)
+		}
+		keySet.Keys = append(keySet.Keys, utils.NewAttestationJWK(key.KeyID, ed25519.PublicKey(publicKey)))
+	}
+
+	return keySet, nil
+}
+
+// GetKeys lists attestation keys, newest first
+func (s *AttestationService) GetKeys() ([]AttestationKey, error) {
+	query := `
+		SELECT kid, algorithm, public_key, status, created_at, retired_at
+		FROM attestation_keys
+		ORDER BY created_at DESC
+	`
+
+	rows, err := s.DB.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get attestation keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []AttestationKey
+	for rows.Next() {
+		var key AttestationKey
+		if err := rows.Scan(&key.KeyID, &key.Algorithm, &key.PublicKey, &key.Status, &key.CreatedAt, &key.RetiredAt); err != nil {
+			return nil, fmt.Errorf("failed to scan attestation key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// RotateKey retires the active signing key and creates a new one,
+// retired public keys stay published so old attestations remain verifiable
+func (s *AttestationService) RotateKey() (*AttestationKey, error) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate attestation key: %w", err)
+	}
+
+	sealedSeed, err := s.sealSeed(privateKey.Seed())
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Retired private keys are wiped, they are never needed again
+	_, err = tx.Exec(`
+		UPDATE attestation_keys
+		SET status = 'retired', retired_at = CURRENT_TIMESTAMP, private_key = NULL
+		WHERE status = 'active'
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retire attestation key: %w", err)
+	}
+
+	key := &AttestationKey{
+		KeyID:     utils.AttestationKeyID(publicKey),
+		Algorithm: "EdDSA",
+		PublicKey: base64.StdEncoding.EncodeToString(publicKey),
+		Status:    "active",
+	}
+
+	err = tx.QueryRow(`
+		INSERT INTO attestation_keys (kid, algorithm, public_key, private_key, private_key_encrypted, status)
+		VALUES ($1, $2, $3, $4, TRUE, 'active')
+		RETURNING created_at
+	`, key.KeyID, key.Algorithm, key.PublicKey, sealedSeed).Scan(&key.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store attestation key: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit key rotation: %w", err)
+	}
+
+	return key, nil
+}
+
+// activeSigningKey loads the active key, creating the first key on demand
+func (s *AttestationService) activeSigningKey() (string, ed25519.PrivateKey, error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		var kid, seed string
+		var encrypted bool
+		err := s.DB.QueryRow(`
+			SELECT kid, private_key, private_key_encrypted FROM attestation_keys WHERE status = 'active'
+		`).Scan(&kid, &seed, &encrypted)
+		if err == nil {
+			if encrypted {
+				if s.KeyBox == nil {
+					return "", nil, errors.New("attestation key encryption key is not configured")
+				}
+				if seed, err = s.KeyBox.Open(seed); err != nil {
+					return "", nil, errors.New("active attestation key can't be decrypted")
+				}
+			}
+			seedBytes, err := base64.StdEncoding.DecodeString(seed)
+			if err != nil || len(seedBytes) != ed25519.SeedSize {
+				return "", nil, errors.New("active attestation key is corrupted")
+			}
+
+			// A key stored before private keys were encrypted is encrypted on first load
+			if !encrypted {
+				if err := s.encryptStoredKey(kid, seedBytes); err != nil {
+					fmt.Printf("Warning: %v\n", err)
+				}
+			}
+			return kid, ed25519.NewKeyFromSeed(seedBytes), nil
+		}
+		if err != sql.ErrNoRows {
+			return "", nil, fmt.Errorf("failed to load attestation key: %w", err)
+		}
+
+		// No key yet, a concurrent creation is resolved by the unique active index
+		if _, err := s.RotateKey(); err != nil {
+			fmt.Printf("Warning: failed to create attestation key: %v\n", err)
+		}
+	}
+
+	return "", nil, errors.New("no active attestation key")
+}
+
+// sealSeed encrypts an Ed25519 seed for storage
+func (s *AttestationService) sealSeed(seed []byte) (string, error) {
+	if s.KeyBox == nil {
+		return "", errors.New("attestation key encryption key is not configured")
+	}
+
+	sealed, err := s.KeyBox.Seal(base64.StdEncoding.EncodeToString(seed))
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt attestation key: %w", err)
+	}
+	return sealed, nil
+}
+
+// encryptStoredKey replaces a plaintext seed in the database with its encrypted form
+func (s *AttestationService) encryptStoredKey(kid string, seed []byte) error {
+	sealed, err := s.sealSeed(seed)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.DB.Exec(`
+		UPDATE attestation_keys SET private_key = $2, private_key_encrypted = TRUE
+		WHERE kid = $1 AND private_key_encrypted = FALSE
+	`, kid, sealed)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt attestation key %s: %w", kid, err)
+	}
+	return nil
+}
+
+// hashAchievementFiles computes SHA-256 of every evidence file, sorted by file ID
+func (s *AttestationService) hashAchievementFiles(achievementID string) ([]AttestedFile, error) {
+	files, err := s.FileService.GetFiles(achievementID)
+	if err != nil {
+		return nil, err
+	}
+
+	attested := []AttestedFile{}
+	for _, file := range files {
+		stream, _, err := s.FileService.DownloadFile(file.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file %s: %w", file.ID, err)
+		}
+
+		hash := sha256.New()
+		_, err = io.Copy(hash, stream)
+		if closer, ok := stream.(io.Closer); ok {
+			closer.Close()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash file %s: %w", file.ID, err)
+		}
+
+		attested = append(attested, AttestedFile{
+			ContentType: file.ContentType,
+			FileID:      file.ID,
+			Filename:    file.Filename,
+			SHA256:      hex.EncodeToString(hash.Sum(nil)),
+			Size:        file.Size,
+		})
+	}
+
+	sort.Slice(attested, func(i, j int) bool {
+		return attested[i].FileID < attested[j].FileID
+	})
+
+	return attested, nil
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"crypto/ed25519"
+	"database/sql/driver"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"prestasi-mahasiswa/utils"
+)
+
+func newAttestationKeyBox(t *testing.T) *utils.SecretBox {
+	t.Helper()
+	box, err := utils.NewSecretBox("attestation-key-encryption-key-for-tests")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return box
+}
+
+func TestRotateKeyStoresEncryptedSeed(t *testing.T) {
+	db, fake := newFakeDB(t)
+	box := newAttestationKeyBox(t)
+	s := NewAttestationService(db, box, nil, nil, "Universitas Airlangga")
+
+	fake.expectExec("SET status = 'retired'", 1)
+	fake.expectQuery("INSERT INTO attestation_keys", []string{"created_at"}, []driver.Value{time.Now()})
+
+	key, err := s.RotateKey()
+	if err != nil {
+		t.Fatalf("RotateKey failed: %v", err)
+	}
+
+	insert := fake.callsContaining("INSERT INTO attestation_keys")[0]
+	if !strings.Contains(insert.Query, "TRUE, 'active'") {
+		t.Error("Expected the key to be marked as encrypted")
+	}
+	stored, _ := insert.Args[3].(string)
+	seed, err := box.Open(stored)
+	if err != nil {
+		t.Fatalf("Expected the stored seed to be encrypted with the key box: %v", err)
+	}
+	seedBytes, _ := base64.StdEncoding.DecodeString(seed)
+	publicKey, _ := base64.StdEncoding.DecodeString(key.PublicKey)
+	if len(seedBytes) != ed25519.SeedSize || !ed25519.NewKeyFromSeed(seedBytes).Public().(ed25519.PublicKey).Equal(ed25519.PublicKey(publicKey)) {
+		t.Error("Expected the stored seed to belong to the new public key")
+	}
+}
+
+func TestRotateKeyRequiresKeyBox(t *testing.T) {
+	db, _ := newFakeDB(t)
+	s := NewAttestationService(db, nil, nil, nil, "Universitas Airlangga")
+
+	if _, err := s.RotateKey(); err == nil {
+		t.Error("Expected no key to be stored without an encryption key")
+	}
+}
+
+func TestActiveSigningKeyDecryptsSeed(t *testing.T) {
+	db, fake := newFakeDB(t)
+	box := newAttestationKeyBox(t)
+	s := NewAttestationService(db, box, nil, nil, "Universitas Airlangga")
+
+	seed := make([]byte, ed25519.SeedSize)
+	seed[0] = 7
+	sealed, _ := box.Seal(base64.StdEncoding.EncodeToString(seed))
+	fake.expectQuery("FROM attestation_keys WHERE status = 'active'", []string{"kid", "private_key", "private_key_encrypted"},
+		[]driver.Value{"kid-1", sealed, true})
+
+	kid, privateKey, err := s.activeSigningKey()
+	if err != nil {
+		t.Fatalf("activeSigningKey failed: %v", err)
+	}
+	if kid != "kid-1" || !privateKey.Equal(ed25519.NewKeyFromSeed(seed)) {
+		t.Error("Expected the decrypted key")
+	}
+}
+
+func TestActiveSigningKeyEncryptsPlaintextSeed(t *testing.T) {
+	db, fake := newFakeDB(t)
+	box := newAttestationKeyBox(t)
+	s := NewAttestationService(db, box, nil, nil, "Universitas Airlangga")
+
+	seed := make([]byte, ed25519.SeedSize)
+	seed[0] = 9
+	fake.expectQuery("FROM attestation_keys WHERE status = 'active'", []string{"kid", "private_key", "private_key_encrypted"},
+		[]driver.Value{"kid-1", base64.StdEncoding.EncodeToString(seed), false})
+	fake.expectExec("SET private_key = $2, private_key_encrypted = TRUE", 1)
+
+	_, privateKey, err := s.activeSigningKey()
+	if err != nil {
+		t.Fatalf("activeSigningKey failed: %v", err)
+	}
+	if !privateKey.Equal(ed25519.NewKeyFromSeed(seed)) {
+		t.Error("Expected the stored key")
+	}
+
+	update := fake.callsContaining("private_key_encrypted = TRUE")[0]
+	stored, _ := update.Args[1].(string)
+	if opened, err := box.Open(stored); err != nil || opened != base64.StdEncoding.EncodeToString(seed) {
+		t.Errorf("Expected the plaintext seed to be replaced by its encrypted form, got %v", err)
+	}
+}
+
+func TestAttestationPayloadEncoding(t *testing.T) {
+	// Attestations already issued are verified against this exact encoding
+	payload := AttestationPayload{
+		Achievement: AttestedAchievement{
+			AchievementDate:  "2026-02-14",
+			Category:         "R&D",
+			Description:      "Lomba <Web>",
+			ID:               "achievement-1",
+			Level:            "nasional",
+			MahasiswaID:      "student-1",
+			StudentName:      "Aryo",
+			Title:            "Juara 1",
+			VerificationCode: "K7QX-2MHP-4AB9-ZZ2A",
+			VerifiedAt:       "2026-03-02T10:15:00Z",
+			VerifiedBy:       "advisor-1",
+		},
+		Files:    []AttestedFile{{ContentType: "application/pdf", FileID: "file-1", Filename: "sertifikat.pdf", SHA256: "ab12", Size: 2048}},
+		IssuedAt: "2026-03-02T10:20:00Z",
+		Issuer:   "Universitas Airlangga",
+		Version:  1,
+	}
+
+	encoded, err := utils.CanonicalJSON(payload)
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+
+	expected := `{"achievement":{"achievement_date":"2026-02-14","category":"R&D","description":"Lomba <Web>","id":"achievement-1",` +
+		`"level":"nasional","mahasiswa_id":"student-1","student_name":"Aryo","title":"Juara 1","verification_code":"K7QX-2MHP-4AB9-ZZ2A",` +
+		`"verified_at":"2026-03-02T10:15:00Z","verified_by":"advisor-1"},"files":[{"content_type":"application/pdf","file_id":"file-1",` +
+		`"filename":"sertifikat.pdf","sha256":"ab12","size":2048}],"issued_at":"2026-03-02T10:20:00Z","issuer":"Universitas Airlangga","version":1}`
+	if string(encoded) != expected {
+		t.Errorf("Attestation payload encoding changed:\n%s", encoded)
+	}
+}
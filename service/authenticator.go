@@ -0,0 +1,74 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+
+	"prestasi-mahasiswa/utils"
+
+	"github.com/lib/pq"
+)
+
+// Authenticator names accepted in the AUTH_BACKENDS order
+const (
+	AuthenticatorLocal = "local"
+	AuthenticatorLDAP  = "ldap"
+)
+
+var (
+	// ErrAuthUserNotFound lets LoginService try the next authenticator
+	ErrAuthUserNotFound = errors.New("user not found")
+	// ErrAuthInvalidPassword ends the login, the account exists in this backend but the password is wrong
+	ErrAuthInvalidPassword = errors.New("invalid password")
+	// ErrAuthUnavailable is returned by LoginService when a backend that may know the user couldn't be reached
+	ErrAuthUnavailable = errors.New("authentication service unavailable")
+)
+
+// Authenticator checks a login and password against one credential store and returns the id of
+// the matching row in users. Any error other than the two above means the backend is unavailable.
+type Authenticator interface {
+	Name() string
+	Authenticate(login, password string) (userID string, err error)
+}
+
+// LocalAuthenticator checks bcrypt password hashes stored in users. Accounts linked to one of
+// DirectoryIssuers sign in with their directory password only, their local hash is never checked.
+type LocalAuthenticator struct {
+	DB               *sql.DB
+	DirectoryIssuers []string
+}
+
+func NewLocalAuthenticator(db *sql.DB) *LocalAuthenticator {
+	return &LocalAuthenticator{DB: db}
+}
+
+func (a *LocalAuthenticator) Name() string {
+	return AuthenticatorLocal
+}
+
+func (a *LocalAuthenticator) Authenticate(email, password string) (string, error) {
+	var userID, hashedPassword string
+	var directoryLinked bool
+	err := a.DB.QueryRow(`
+		SELECT id, password,
+		       EXISTS (SELECT 1 FROM user_identities ui WHERE ui.user_id = users.id AND ui.issuer = ANY($2))
+		FROM users WHERE email = $1
+	`, email, pq.Array(a.DirectoryIssuers)).Scan(&userID, &hashedPassword, &directoryLinked)
+	if err == nil && directoryLinked {
+		err = sql.ErrNoRows
+	}
+	if err != nil {
+		if err != sql.ErrNoRows {
+			return "", errors.New("database error: " + err.Error())
+		}
+		// Compare against a dummy hash so unknown emails take as long as wrong passwords
+		utils.ComparePassword(dummyPasswordHash, password)
+		return "", ErrAuthUserNotFound
+	}
+
+	if utils.ComparePassword(hashedPassword, password) != nil {
+		return userID, ErrAuthInvalidPassword
+	}
+
+	return userID, nil
+}
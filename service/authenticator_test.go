@@ -0,0 +1,136 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"prestasi-mahasiswa/utils"
+)
+
+// stubAuthenticator answers every login the same way
+type stubAuthenticator struct {
+	name   string
+	userID string
+	err    error
+	calls  int
+}
+
+func (a *stubAuthenticator) Name() string {
+	return a.name
+}
+
+func (a *stubAuthenticator) Authenticate(login, password string) (string, error) {
+	a.calls++
+	return a.userID, a.err
+}
+
+func TestCheckCredentialsFallbackOrder(t *testing.T) {
+	unavailable := errors.New("connection refused")
+
+	tests := []struct {
+		name       string
+		first      *stubAuthenticator
+		second     *stubAuthenticator
+		wantUserID string
+		wantReason string
+		wantErr    bool
+		wantCalls  int // calls to the second authenticator
+	}{
+		{"first accepts", &stubAuthenticator{userID: "u1"}, &stubAuthenticator{userID: "u2"}, "u1", "", false, 0},
+		{"unknown falls through", &stubAuthenticator{err: ErrAuthUserNotFound}, &stubAuthenticator{userID: "u2"}, "u2", "", false, 1},
+		{"unavailable falls through", &stubAuthenticator{err: unavailable}, &stubAuthenticator{userID: "u2"}, "u2", "", false, 1},
+		{"wrong password stops", &stubAuthenticator{userID: "u1", err: ErrAuthInvalidPassword}, &stubAuthenticator{userID: "u2"}, "u1", LoginReasonInvalidPassword, false, 0},
+		{"unknown everywhere", &stubAuthenticator{err: ErrAuthUserNotFound}, &stubAuthenticator{err: ErrAuthUserNotFound}, "", LoginReasonUnknownEmail, false, 1},
+		{"unavailable and unknown", &stubAuthenticator{err: unavailable}, &stubAuthenticator{err: ErrAuthUserNotFound}, "", "", true, 1},
+	}
+
+	for _, tt := range tests {
+		s := &LoginService{Authenticators: []Authenticator{tt.first, tt.second}}
+		userID, reason, err := s.checkCredentials("budi@unair.ac.id", "secret")
+
+		if (err != nil) != tt.wantErr || userID != tt.wantUserID || reason != tt.wantReason {
+			t.Errorf("%s: got (%q, %q, %v), want (%q, %q, error %v)", tt.name, userID, reason, err, tt.wantUserID, tt.wantReason, tt.wantErr)
+		}
+		if err != nil && !errors.Is(err, ErrAuthUnavailable) {
+			t.Errorf("%s: got error %v, want ErrAuthUnavailable", tt.name, err)
+		}
+		if err != nil && errors.Is(err, unavailable) {
+			t.Errorf("%s: backend error %v must not reach the caller", tt.name, err)
+		}
+		if tt.second.calls != tt.wantCalls {
+			t.Errorf("%s: second authenticator called %d times, want %d", tt.name, tt.second.calls, tt.wantCalls)
+		}
+	}
+}
+
+func TestParseLDAPRoleRules(t *testing.T) {
+	rules, err := ParseLDAPRoleRules("memberOf=cn=dosen,ou=groups,dc=unair,dc=ac,dc=id:dosen_wali; employeeType=student:mahasiswa;")
+	if err != nil {
+		t.Fatalf("Failed to parse rules: %v", err)
+	}
+	if len(rules) != 2 {
+		t.Fatalf("Expected 2 rules, got %d", len(rules))
+	}
+	if rules[0].Attribute != "memberOf" || rules[0].Value != "cn=dosen,ou=groups,dc=unair,dc=ac,dc=id" || rules[0].Role != "dosen_wali" {
+		t.Errorf("Unexpected first rule: %+v", rules[0])
+	}
+
+	for _, spec := range []string{"memberOf:admin", "memberOf=cn=admins", "memberOf=cn=admins:superuser"} {
+		if _, err := ParseLDAPRoleRules(spec); err == nil {
+			t.Errorf("Expected %q to be rejected", spec)
+		}
+	}
+}
+
+func TestMapLDAPRole(t *testing.T) {
+	rules := []LDAPRoleRule{
+		{Attribute: "memberOf", Value: "cn=admins,ou=groups,dc=unair,dc=ac,dc=id", Role: "admin"},
+		{Attribute: "employeeType", Value: "student", Role: "mahasiswa"},
+	}
+
+	entry := &utils.LDAPEntry{Attributes: map[string][]string{
+		"memberof":     {"cn=bem,ou=groups,dc=unair,dc=ac,dc=id", "CN=Admins,OU=Groups,DC=unair,DC=ac,DC=id"},
+		"employeetype": {"student"},
+	}}
+	if role := mapLDAPRole(entry, rules); role != "admin" {
+		t.Errorf("Expected first matching rule to win, got %q", role)
+	}
+
+	entry = &utils.LDAPEntry{Attributes: map[string][]string{"employeetype": {"staff"}}}
+	if role := mapLDAPRole(entry, rules); role != "" {
+		t.Errorf("Expected no role, got %q", role)
+	}
+}
+
+// stubDirectory refuses every login with a fixed error
+type stubDirectory struct {
+	err error
+}
+
+func (d stubDirectory) Authenticate(login, password string) (*utils.LDAPEntry, error) {
+	return nil, d.err
+}
+
+func TestLDAPAuthenticatorErrors(t *testing.T) {
+	tests := []struct {
+		directoryErr error
+		want         error
+	}{
+		{utils.ErrLDAPUserNotFound, ErrAuthUserNotFound},
+		{utils.ErrLDAPInvalidCredentials, ErrAuthInvalidPassword},
+	}
+
+	for _, tt := range tests {
+		authenticator := &LDAPAuthenticator{Directory: stubDirectory{err: tt.directoryErr}}
+		if _, err := authenticator.Authenticate("budi", "secret"); !errors.Is(err, tt.want) {
+			t.Errorf("Directory error %v: expected %v, got %v", tt.directoryErr, tt.want, err)
+		}
+	}
+
+	// Anything else means the directory is unavailable and must not look like a refused login
+	authenticator := &LDAPAuthenticator{Directory: stubDirectory{err: errors.New("connection refused")}}
+	_, err := authenticator.Authenticate("budi", "secret")
+	if err == nil || errors.Is(err, ErrAuthUserNotFound) || errors.Is(err, ErrAuthInvalidPassword) {
+		t.Errorf("Expected unavailable error, got %v", err)
+	}
+}
@@ -0,0 +1,325 @@
+package service
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const openBadgesContext = "https://w3id.org/openbadges/v2"
+
+// BadgeService renders verified achievements as hosted Open Badges 2.0 documents
+type BadgeService struct {
+	DB                 *sql.DB
+	AchievementService *AchievementService
+	UserService        *UserService
+	Institution        string
+	PublicBaseURL      string
+}
+
+type BadgeIssuer struct {
+	Context     string `json:"@context"`
+	Type        string `json:"type"`
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	URL         string `json:"url"`
+	Description string `json:"description,omitempty"`
+}
+
+type BadgeCriteria struct {
+	Narrative string `json:"narrative"`
+}
+
+type BadgeClass struct {
+	Context     string        `json:"@context"`
+	Type        string        `json:"type"`
+	ID          string        `json:"id"`
+	Name        string        `json:"name"`
+	Description string        `json:"description"`
+	Image       string        `json:"image"`
+	Criteria    BadgeCriteria `json:"criteria"`
+	Issuer      string        `json:"issuer"`
+	Tags        []string      `json:"tags,omitempty"`
+}
+
+type BadgeRecipient struct {
+	Type     string `json:"type"`
+	Hashed   bool   `json:"hashed"`
+	Salt     string `json:"salt"`
+	Identity string `json:"identity"`
+}
+
+type BadgeVerification struct {
+	Type string `json:"type"`
+}
+
+type BadgeEvidence struct {
+	ID        string `json:"id"`
+	Narrative string `json:"narrative,omitempty"`
+}
+
+type BadgeAssertion struct {
+	Context      string            `json:"@context"`
+	Type         string            `json:"type"`
+	ID           string            `json:"id"`
+	Recipient    BadgeRecipient    `json:"recipient"`
+	Badge        string            `json:"badge"`
+	Verification BadgeVerification `json:"verification"`
+	IssuedOn     string            `json:"issuedOn"`
+	Evidence     []BadgeEvidence   `json:"evidence,omitempty"`
+}
+
+func NewBadgeService(db *sql.DB, achievementSvc *AchievementService, userSvc *UserService, institution, publicBaseURL string) *BadgeService {
+	return &BadgeService{
+		DB:                 db,
+		AchievementService: achievementSvc,
+		UserService:        userSvc,
+		Institution:        institution,
+		PublicBaseURL:      publicBaseURL,
+	}
+}
+
+// GetIssuer returns the hosted issuer profile
+func (s *BadgeService) GetIssuer() *BadgeIssuer {
+	return &BadgeIssuer{
+		Context:     openBadgesContext,
+		Type:        "Issuer",
+		ID:          s.badgesURL("/issuer"),
+		Name:        s.Institution,
+		URL:         s.PublicBaseURL,
+		Description: "Penerbit badge prestasi mahasiswa yang telah diverifikasi",
+	}
+}
+
+// GetBadgeClass returns the hosted BadgeClass for a category/level slug
+func (s *BadgeService) GetBadgeClass(slug string) (*BadgeClass, error) {
+	var category, level string
+	err := s.DB.QueryRow(`SELECT category, level FROM badge_classes WHERE slug = $1`, slug).Scan(&category, &level)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("badge class not found")
+		}
+		return nil, fmt.Errorf("failed to get badge class: %w", err)
+	}
+
+	return s.buildBadgeClass(category, level), nil
+}
+
+// registerBadgeClass stores the BadgeClass an assertion refers to so its slug can be looked up,
+// categories that share a slug share the class registered first
+func (s *BadgeService) registerBadgeClass(category, level string) (string, error) {
+	slug := BadgeClassSlug(category, level)
+	query := `
+		INSERT INTO badge_classes (slug, category, level)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (slug) DO NOTHING
+	`
+	if _, err := s.DB.Exec(query, slug, category, level); err != nil {
+		return "", fmt.Errorf("failed to register badge class: %w", err)
+	}
+	return slug, nil
+}
+
+// GetAssertion returns the hosted assertion identified by verification code
+func (s *BadgeService) GetAssertion(verificationCode string) (*BadgeAssertion, error) {
+	var achievementID string
+	query := `
+		SELECT id FROM achievements
+		WHERE verification_code = $1 AND status = 'verified' AND (is_deleted = false OR is_deleted IS NULL)
+	`
+	err := s.DB.QueryRow(query, normalizeVerificationCode(verificationCode)).Scan(&achievementID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("assertion not found")
+		}
+		return nil, fmt.Errorf("failed to get assertion: %w", err)
+	}
+
+	return s.BuildAssertion(achievementID)
+}
+
+// BuildAssertion renders a verified achievement as an Open Badges assertion
+func (s *BadgeService) BuildAssertion(achievementID string) (*BadgeAssertion, error) {
+	achievement, err := s.AchievementService.GetAchievementByID(achievementID)
+	if err != nil {
+		return nil, err
+	}
+
+	if achievement.Status != "verified" || achievement.VerifiedAt == nil {
+		return nil, errors.New("achievement is not verified")
+	}
+
+	verificationCode, err := s.AchievementService.EnsureVerificationCode(achievementID)
+	if err != nil {
+		return nil, err
+	}
+
+	student, err := s.UserService.GetUserByID(achievement.MahasiswaID)
+	if err != nil {
+		return nil, err
+	}
+
+	slug, err := s.registerBadgeClass(achievement.Category, achievement.Level)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.assertionFor(achievement, student.Email, verificationCode, slug)
+}
+
+// assertionFor renders the public assertion, it holds no more than the public verification
+// shows: the title as evidence narrative but not the description
+func (s *BadgeService) assertionFor(achievement *Achievement, email, verificationCode, slug string) (*BadgeAssertion, error) {
+	issuedOn, err := time.Parse(time.RFC3339Nano, *achievement.VerifiedAt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid verification date: %v", err)
+	}
+
+	// Recipient email is hashed so the public assertion doesn't expose it
+	saltHash := sha256.Sum256([]byte("badge:" + achievement.ID))
+	salt := hex.EncodeToString(saltHash[:8])
+	identityHash := sha256.Sum256([]byte(strings.ToLower(email) + salt))
+
+	return &BadgeAssertion{
+		Context: openBadgesContext,
+		Type:    "Assertion",
+		ID:      s.badgesURL("/assertions/" + verificationCode),
+		Recipient: BadgeRecipient{
+			Type:     "email",
+			Hashed:   true,
+			Salt:     salt,
+			Identity: "sha256$" + hex.EncodeToString(identityHash[:]),
+		},
+		Badge:        s.badgesURL("/classes/" + slug),
+		Verification: BadgeVerification{Type: "HostedBadge"},
+		IssuedOn:     issuedOn.UTC().Format(time.RFC3339),
+		Evidence: []BadgeEvidence{{
+			ID:        s.PublicBaseURL + "/verify/" + url.PathEscape(verificationCode),
+			Narrative: achievement.Title,
+		}},
+	}, nil
+}
+
+// ExportStudentAssertions renders all verified achievements of a student
+func (s *BadgeService) ExportStudentAssertions(mahasiswaID string) ([]BadgeAssertion, error) {
+	achievements, err := s.AchievementService.GetAchievementsByMahasiswa(mahasiswaID)
+	if err != nil {
+		return nil, err
+	}
+
+	assertions := []BadgeAssertion{}
+	for _, achievement := range achievements {
+		if achievement.Status != "verified" {
+			continue
+		}
+
+		assertion, err := s.BuildAssertion(achievement.ID)
+		if err != nil {
+			return nil, err
+		}
+		assertions = append(assertions, *assertion)
+	}
+
+	return assertions, nil
+}
+
+// RenderBadgeImage draws a simple PNG badge, colored by achievement level
+func (s *BadgeService) RenderBadgeImage(slug string) ([]byte, error) {
+	badgeClass, err := s.GetBadgeClass(slug)
+	if err != nil {
+		return nil, err
+	}
+
+	level := ""
+	if len(badgeClass.Tags) > 1 {
+		level = badgeClass.Tags[1]
+	}
+
+	levelColors := map[string]color.RGBA{
+		"lokal":         {R: 121, G: 85, B: 72, A: 255},
+		"regional":      {R: 96, G: 125, B: 139, A: 255},
+		"nasional":      {R: 13, G: 71, B: 161, A: 255},
+		"internasional": {R: 191, G: 144, B: 0, A: 255},
+	}
+	fill, ok := levelColors[level]
+	if !ok {
+		fill = color.RGBA{R: 11, G: 110, B: 46, A: 255}
+	}
+
+	const size = 256
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	center := float64(size) / 2
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			dx, dy := float64(x)-center+0.5, float64(y)-center+0.5
+			distance := dx*dx + dy*dy
+			switch {
+			case distance <= 80*80:
+				img.Set(x, y, color.RGBA{R: 255, G: 255, B: 255, A: 255})
+			case distance <= 120*120:
+				img.Set(x, y, fill)
+			}
+		}
+	}
+
+	var output bytes.Buffer
+	if err := png.Encode(&output, img); err != nil {
+		return nil, fmt.Errorf("failed to encode badge image: %v", err)
+	}
+
+	return output.Bytes(), nil
+}
+
+func (s *BadgeService) buildBadgeClass(category, level string) *BadgeClass {
+	slug := BadgeClassSlug(category, level)
+
+	name := category
+	criteria := fmt.Sprintf("Prestasi kategori %s yang telah diverifikasi oleh %s.", category, s.Institution)
+	tags := []string{category}
+	if level != "" {
+		name = fmt.Sprintf("%s - %s", category, strings.ToUpper(level[:1])+level[1:])
+		criteria = fmt.Sprintf("Prestasi kategori %s tingkat %s yang telah diverifikasi oleh %s.", category, level, s.Institution)
+		tags = append(tags, level)
+	}
+
+	return &BadgeClass{
+		Context:     openBadgesContext,
+		Type:        "BadgeClass",
+		ID:          s.badgesURL("/classes/" + slug),
+		Name:        name,
+		Description: fmt.Sprintf("Badge prestasi mahasiswa %s", name),
+		Image:       s.badgesURL("/classes/" + slug + "/image"),
+		Criteria:    BadgeCriteria{Narrative: criteria},
+		Issuer:      s.badgesURL("/issuer"),
+		Tags:        tags,
+	}
+}
+
+func (s *BadgeService) badgesURL(path string) string {
+	return s.PublicBaseURL + "/api/v1/badges" + path
+}
+
+var slugInvalidChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// BadgeClassSlug builds URL-safe BadgeClass identifier from category and level
+func BadgeClassSlug(category, level string) string {
+	slug := slugInvalidChars.ReplaceAllString(strings.ToLower(category), "-")
+	slug = strings.Trim(slug, "-")
+	if slug == "" {
+		slug = "prestasi"
+	}
+	if level != "" {
+		slug += "--" + level
+	}
+	return slug
+}
@@ -0,0 +1,163 @@
+package service
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestBadgeClassSlug(t *testing.T) {
+	tests := []struct {
+		category string
+		level    string
+		expected string
+	}{
+		{"Lomba Web Design", "nasional", "lomba-web-design--nasional"},
+		{"Olahraga", "", "olahraga"},
+		{"  R&D / Riset  ", "internasional", "r-d-riset--internasional"},
+		{"***", "lokal", "prestasi--lokal"},
+	}
+
+	for _, tt := range tests {
+		if slug := BadgeClassSlug(tt.category, tt.level); slug != tt.expected {
+			t.Errorf("BadgeClassSlug(%q, %q) = %q, expected %q", tt.category, tt.level, slug, tt.expected)
+		}
+	}
+}
+
+func TestGetBadgeClassBySlug(t *testing.T) {
+	db, fake := newFakeDB(t)
+	s := NewBadgeService(db, nil, nil, "Universitas Airlangga", "https://prestasi.example.ac.id")
+
+	fake.expectQuery("FROM badge_classes WHERE slug = $1", []string{"category", "level"}, []driver.Value{"Lomba Web Design", "nasional"})
+
+	badgeClass, err := s.GetBadgeClass("lomba-web-design--nasional")
+	if err != nil {
+		t.Fatalf("GetBadgeClass failed: %v", err)
+	}
+	if badgeClass.ID != "https://prestasi.example.ac.id/api/v1/badges/classes/lomba-web-design--nasional" {
+		t.Errorf("Unexpected BadgeClass id %s", badgeClass.ID)
+	}
+	if badgeClass.Name != "Lomba Web Design - Nasional" {
+		t.Errorf("Unexpected BadgeClass name %s", badgeClass.Name)
+	}
+	if len(badgeClass.Tags) != 2 || badgeClass.Tags[1] != "nasional" {
+		t.Errorf("Expected category and level tags, got %v", badgeClass.Tags)
+	}
+	if !strings.Contains(badgeClass.Criteria.Narrative, "Universitas Airlangga") {
+		t.Errorf("Expected criteria to name the institution, got %s", badgeClass.Criteria.Narrative)
+	}
+
+	calls := fake.callsContaining("FROM badge_classes")
+	if len(calls) != 1 || calls[0].Args[0] != "lomba-web-design--nasional" {
+		t.Errorf("Expected a single lookup by slug, got %v", calls)
+	}
+}
+
+func TestGetBadgeClassNotFound(t *testing.T) {
+	db, fake := newFakeDB(t)
+	s := NewBadgeService(db, nil, nil, "Universitas Airlangga", "https://prestasi.example.ac.id")
+
+	fake.expectQuery("FROM badge_classes", []string{"category", "level"})
+	if _, err := s.GetBadgeClass("unknown"); err == nil || err.Error() != "badge class not found" {
+		t.Errorf("Expected badge class not found, got %v", err)
+	}
+
+	fake.expectQuery("FROM badge_classes", []string{"category", "level"})
+	if _, err := s.RenderBadgeImage("unknown"); err == nil || err.Error() != "badge class not found" {
+		t.Errorf("Expected no image for an unknown class, got %v", err)
+	}
+}
+
+func TestRenderBadgeImage(t *testing.T) {
+	db, fake := newFakeDB(t)
+	s := NewBadgeService(db, nil, nil, "Universitas Airlangga", "https://prestasi.example.ac.id")
+
+	fake.expectQuery("FROM badge_classes", []string{"category", "level"}, []driver.Value{"Olahraga", "internasional"})
+
+	data, err := s.RenderBadgeImage("olahraga--internasional")
+	if err != nil {
+		t.Fatalf("RenderBadgeImage failed: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Expected a PNG, got %v", err)
+	}
+	if size := img.Bounds().Size(); size.X != 256 || size.Y != 256 {
+		t.Errorf("Expected a 256x256 image, got %v", size)
+	}
+}
+
+func TestRegisterBadgeClass(t *testing.T) {
+	db, fake := newFakeDB(t)
+	s := NewBadgeService(db, nil, nil, "Universitas Airlangga", "https://prestasi.example.ac.id")
+
+	fake.expectExec("INSERT INTO badge_classes", 0)
+
+	slug, err := s.registerBadgeClass("R&D / Riset", "")
+	if err != nil {
+		t.Fatalf("registerBadgeClass failed: %v", err)
+	}
+	if slug != "r-d-riset" {
+		t.Errorf("Expected slug r-d-riset, got %s", slug)
+	}
+
+	insert := fake.callsContaining("INSERT INTO badge_classes")[0]
+	if !strings.Contains(insert.Query, "ON CONFLICT (slug) DO NOTHING") {
+		t.Error("Expected an existing class to be kept")
+	}
+	if insert.Args[0] != "r-d-riset" || insert.Args[1] != "R&D / Riset" || insert.Args[2] != "" {
+		t.Errorf("Unexpected badge class row %v", insert.Args)
+	}
+}
+
+func TestAssertionLeavesOutPrivateDetails(t *testing.T) {
+	s := NewBadgeService(nil, nil, nil, "Universitas Airlangga", "https://prestasi.example.ac.id")
+	verifiedAt := "2026-03-02T10:15:00.123456+07:00"
+	achievement := &Achievement{
+		ID:          "achievement-1",
+		Title:       "Juara 1 Lomba Web Design",
+		Description: "Nomor peserta 0812-3456-7890, tim bersama Budi",
+		Category:    "Lomba Web Design",
+		Level:       "nasional",
+		Status:      "verified",
+		VerifiedAt:  &verifiedAt,
+	}
+
+	assertion, err := s.assertionFor(achievement, "Aryo@Student.unair.ac.id", "K7QX-2MHP-4AB9-ZZ2A", "lomba-web-design--nasional")
+	if err != nil {
+		t.Fatalf("assertionFor failed: %v", err)
+	}
+
+	document, _ := json.Marshal(assertion)
+	for _, private := range []string{achievement.Description, "0812-3456-7890", "Aryo@Student.unair.ac.id", "aryo@student.unair.ac.id"} {
+		if strings.Contains(string(document), private) {
+			t.Errorf("Expected the public assertion not to contain %q", private)
+		}
+	}
+
+	// Backpacks check the recipient by hashing the lowercased email with the salt
+	identity := sha256.Sum256([]byte("aryo@student.unair.ac.id" + assertion.Recipient.Salt))
+	if !assertion.Recipient.Hashed || assertion.Recipient.Identity != "sha256$"+hex.EncodeToString(identity[:]) {
+		t.Errorf("Unexpected recipient %+v", assertion.Recipient)
+	}
+
+	if assertion.Badge != "https://prestasi.example.ac.id/api/v1/badges/classes/lomba-web-design--nasional" {
+		t.Errorf("Unexpected badge %s", assertion.Badge)
+	}
+	if assertion.ID != "https://prestasi.example.ac.id/api/v1/badges/assertions/K7QX-2MHP-4AB9-ZZ2A" {
+		t.Errorf("Unexpected assertion id %s", assertion.ID)
+	}
+	if assertion.IssuedOn != "2026-03-02T03:15:00Z" {
+		t.Errorf("Expected issuedOn in UTC, got %s", assertion.IssuedOn)
+	}
+	if len(assertion.Evidence) != 1 || assertion.Evidence[0].ID != "https://prestasi.example.ac.id/verify/K7QX-2MHP-4AB9-ZZ2A" ||
+		assertion.Evidence[0].Narrative != achievement.Title {
+		t.Errorf("Expected the verification page and title as evidence, got %+v", assertion.Evidence)
+	}
+}
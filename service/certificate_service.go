@@ -0,0 +1,308 @@
+package service
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+	"github.com/skip2/go-qrcode"
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+func init() {
+	// Stamping runs in-memory, pdfcpu must not create a config directory on the server
+	model.ConfigPath = "disable"
+}
+
+type CertificateService struct {
+	DB                 *sql.DB
+	AchievementService *AchievementService
+	FileService        *FileService
+	Institution        string
+	PublicBaseURL      string
+}
+
+type StampedFile struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// PublicVerification contains only non-sensitive details shown to third parties
+type PublicVerification struct {
+	VerificationCode    string    `json:"verification_code"`
+	StudentName         string    `json:"student_name"`
+	Title               string    `json:"title"`
+	Category            string    `json:"category"`
+	Level               string    `json:"level,omitempty"`
+	VerifiedAt          time.Time `json:"verified_at"`
+	VerifierInstitution string    `json:"verifier_institution"`
+	VerificationURL     string    `json:"verification_url"`
+}
+
+func NewCertificateService(db *sql.DB, achievementSvc *AchievementService, fileSvc *FileService, institution, publicBaseURL string) *CertificateService {
+	return &CertificateService{
+		DB:                 db,
+		AchievementService: achievementSvc,
+		FileService:        fileSvc,
+		Institution:        institution,
+		PublicBaseURL:      publicBaseURL,
+	}
+}
+
+// VerificationURL builds the public verification URL for a code
+func (s *CertificateService) VerificationURL(code string) string {
+	return s.PublicBaseURL + "/verify/" + url.PathEscape(code)
+}
+
+// GetPublicVerification looks up a verified achievement by its verification code
+func (s *CertificateService) GetPublicVerification(code string) (*PublicVerification, error) {
+	code = normalizeVerificationCode(code)
+	if code == "" {
+		return nil, errors.New("verification code is required")
+	}
+
+	query := `
+		SELECT a.verification_code, u.name, a.title, a.category, COALESCE(a.level, ''), a.verified_at
+		FROM achievements a
+		JOIN users u ON a.mahasiswa_id = u.id
+		WHERE a.verification_code = $1 AND a.status = 'verified'
+		  AND (a.is_deleted = false OR a.is_deleted IS NULL)
+	`
+
+	var verification PublicVerification
+	err := s.DB.QueryRow(query, code).Scan(
+		&verification.VerificationCode,
+		&verification.StudentName,
+		&verification.Title,
+		&verification.Category,
+		&verification.Level,
+		&verification.VerifiedAt,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("verification code not found")
+		}
+		return nil, fmt.Errorf("failed to get verification: %v", err)
+	}
+
+	verification.VerifierInstitution = s.Institution
+	verification.VerificationURL = s.VerificationURL(verification.VerificationCode)
+
+	return &verification, nil
+}
+
+// GenerateVerificationQR renders a PNG QR code encoding the public verification URL
+func (s *CertificateService) GenerateVerificationQR(code string, size int) ([]byte, error) {
+	verification, err := s.GetPublicVerification(code)
+	if err != nil {
+		return nil, err
+	}
+
+	if size < 128 || size > 1024 {
+		size = 256
+	}
+
+	png, err := qrcode.Encode(verification.VerificationURL, qrcode.Medium, size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate QR code: %v", err)
+	}
+
+	return png, nil
+}
+
+// normalizeVerificationCode accepts codes typed in lowercase or without dashes
+func normalizeVerificationCode(code string) string {
+	code = strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+
+	var groups []string
+	for i := 0; i < len(code); i += 4 {
+		end := i + 4
+		if end > len(code) {
+			end = len(code)
+		}
+		groups = append(groups, code[i:end])
+	}
+
+	return strings.Join(groups, "-")
+}
+
+// GenerateVerifiedCopy returns a stamped copy of achievement evidence, the stored file is never modified
+func (s *CertificateService) GenerateVerifiedCopy(achievementID, fileID string) (*StampedFile, error) {
+	achievement, err := s.AchievementService.GetAchievementByID(achievementID)
+	if err != nil {
+		return nil, err
+	}
+
+	if achievement.Status != "verified" || achievement.VerifiedAt == nil {
+		return nil, errors.New("achievement is not verified")
+	}
+
+	verificationCode, err := s.AchievementService.EnsureVerificationCode(achievementID)
+	if err != nil {
+		return nil, err
+	}
+
+	verifiedAt, err := time.Parse(time.RFC3339Nano, *achievement.VerifiedAt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid verification date: %v", err)
+	}
+
+	// Download original evidence from GridFS
+	fileStream, fileData, err := s.FileService.DownloadFile(fileID)
+	if err != nil {
+		return nil, err
+	}
+	if closer, ok := fileStream.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	if fileData.AchievementID != achievementID {
+		return nil, errors.New("file not found")
+	}
+
+	original, err := io.ReadAll(fileStream)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %v", err)
+	}
+
+	lines := []string{
+		fmt.Sprintf("Verified by %s on %s", s.Institution, verifiedAt.Format("02 January 2006")),
+		"Verification code: " + verificationCode,
+		"Check at: " + s.VerificationURL(verificationCode),
+	}
+	if verifierName := s.getVerifierName(achievement.VerifiedBy); verifierName != "" {
+		lines = append(lines, "Verifier: "+verifierName)
+	}
+
+	var stamped []byte
+	switch fileData.ContentType {
+	case "application/pdf":
+		stamped, err = stampPDF(original, lines)
+	case "image/jpeg", "image/png":
+		stamped, err = stampImage(original, fileData.ContentType, lines)
+	default:
+		return nil, errors.New("verified copy is only available for PDF and image files")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &StampedFile{
+		Filename:    "verified_" + fileData.Filename,
+		ContentType: fileData.ContentType,
+		Data:        stamped,
+	}, nil
+}
+
+func (s *CertificateService) getVerifierName(verifierID *string) string {
+	if verifierID == nil {
+		return ""
+	}
+
+	var name string
+	if err := s.DB.QueryRow(`SELECT name FROM users WHERE id = $1`, *verifierID).Scan(&name); err != nil {
+		return ""
+	}
+	return name
+}
+
+// stampPDF adds the verification stamp on top of every page
+func stampPDF(original []byte, lines []string) (stamped []byte, err error) {
+	// pdfcpu may panic on malformed documents, report it as a regular error
+	defer func() {
+		if r := recover(); r != nil {
+			stamped, err = nil, fmt.Errorf("failed to stamp PDF: malformed document")
+		}
+	}()
+
+	text := strings.Join(lines, "\n")
+	description := "font:Helvetica, points:9, pos:bl, off:20 20, scale:1 abs, rot:0, fillcolor:#0B6E2E, opacity:0.9"
+
+	watermark, err := api.TextWatermark(text, description, true, false, types.POINTS)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare PDF stamp: %v", err)
+	}
+
+	var output bytes.Buffer
+	if err := api.AddWatermarks(bytes.NewReader(original), &output, nil, watermark, nil); err != nil {
+		return nil, fmt.Errorf("failed to stamp PDF: %v", err)
+	}
+
+	return output.Bytes(), nil
+}
+
+// stampImage draws the verification stamp as a banner at the bottom of the image
+func stampImage(original []byte, contentType string, lines []string) ([]byte, error) {
+	source, _, err := image.Decode(bytes.NewReader(original))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %v", err)
+	}
+
+	bounds := source.Bounds()
+	canvas := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(canvas, canvas.Bounds(), source, bounds.Min, draw.Src)
+
+	// Render text at the native font size, then scale it to the image width
+	face := basicfont.Face7x13
+	lineHeight := face.Metrics().Height.Ceil()
+	textWidth := 0
+	for _, line := range lines {
+		if width := font.MeasureString(face, line).Ceil(); width > textWidth {
+			textWidth = width
+		}
+	}
+
+	padding := 4
+	banner := image.NewRGBA(image.Rect(0, 0, textWidth+2*padding, lineHeight*len(lines)+2*padding))
+	draw.Draw(banner, banner.Bounds(), &image.Uniform{C: color.RGBA{R: 255, G: 255, B: 255, A: 255}}, image.Point{}, draw.Src)
+
+	drawer := &font.Drawer{Dst: banner, Src: image.NewUniform(color.RGBA{R: 11, G: 110, B: 46, A: 255}), Face: face}
+	for i, line := range lines {
+		drawer.Dot = fixed.P(padding, padding+face.Metrics().Ascent.Ceil()+i*lineHeight)
+		drawer.DrawString(line)
+	}
+
+	// Banner covers at most 60% of the image width, keeping the aspect ratio
+	scale := float64(bounds.Dx()) * 0.6 / float64(banner.Bounds().Dx())
+	targetWidth := int(float64(banner.Bounds().Dx()) * scale)
+	targetHeight := int(float64(banner.Bounds().Dy()) * scale)
+	if targetHeight > bounds.Dy() {
+		targetHeight = bounds.Dy()
+	}
+
+	margin := bounds.Dx() / 50
+	target := image.Rect(margin, bounds.Dy()-targetHeight-margin, margin+targetWidth, bounds.Dy()-margin)
+	xdraw.ApproxBiLinear.Scale(canvas, target, banner, banner.Bounds(), xdraw.Over, &xdraw.Options{
+		SrcMask: image.NewUniform(color.Alpha{A: 220}),
+	})
+
+	var output bytes.Buffer
+	switch contentType {
+	case "image/png":
+		err = png.Encode(&output, canvas)
+	default:
+		err = jpeg.Encode(&output, canvas, &jpeg.Options{Quality: 92})
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode image: %v", err)
+	}
+
+	return output.Bytes(), nil
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+func stampLines(code string) []string {
+	return []string{
+		"Verified by Universitas Airlangga on 02 March 2026",
+		"Verification code: " + code,
+		"Check at: https://prestasi.example.ac.id/verify/" + code,
+	}
+}
+
+// pdfStreams returns the decoded content of every stream in a PDF
+func pdfStreams(t *testing.T, data []byte) []string {
+	t.Helper()
+	ctx, err := api.ReadContext(bytes.NewReader(data), nil)
+	if err != nil {
+		t.Fatalf("Failed to read stamped PDF: %v", err)
+	}
+
+	var streams []string
+	for _, entry := range ctx.XRefTable.Table {
+		if entry == nil {
+			continue
+		}
+		if stream, ok := entry.Object.(types.StreamDict); ok {
+			if err := stream.Decode(); err != nil {
+				t.Fatalf("Failed to decode stream: %v", err)
+			}
+			streams = append(streams, string(stream.Content))
+		}
+	}
+	return streams
+}
+
+func TestStampPDFEmbedsVerificationCode(t *testing.T) {
+	original, err := os.ReadFile("testdata/evidence.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stamped, err := stampPDF(original, stampLines("K7QX-2MHP-4AB9"))
+	if err != nil {
+		t.Fatalf("stampPDF failed: %v", err)
+	}
+	if err := api.Validate(bytes.NewReader(stamped), nil); err != nil {
+		t.Fatalf("Stamped PDF is not valid: %v", err)
+	}
+
+	content := strings.Join(pdfStreams(t, stamped), "\n")
+	for _, want := range []string{"(Verification code: K7QX-2MHP-4AB9)", "/verify/K7QX-2MHP-4AB9)", "(Certificate of Achievement)"} {
+		if !strings.Contains(content, want) {
+			t.Errorf("Expected stamped PDF to contain %s", want)
+		}
+	}
+}
+
+func TestStampPDFMalformedDocument(t *testing.T) {
+	if _, err := stampPDF([]byte("%PDF-1.4\nnot a document"), stampLines("K7QX-2MHP-4AB9")); err == nil {
+		t.Error("Expected an error for a malformed PDF")
+	}
+}
+
+func TestStampImageEmbedsVerificationCode(t *testing.T) {
+	original, err := os.ReadFile("testdata/evidence.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	source, err := png.Decode(bytes.NewReader(original))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decodeStamped := func(code string) image.Image {
+		t.Helper()
+		stamped, err := stampImage(original, "image/png", stampLines(code))
+		if err != nil {
+			t.Fatalf("stampImage failed: %v", err)
+		}
+		decoded, err := png.Decode(bytes.NewReader(stamped))
+		if err != nil {
+			t.Fatalf("Stamped copy is not a PNG: %v", err)
+		}
+		if decoded.Bounds().Size() != source.Bounds().Size() {
+			t.Fatalf("Expected size %v, got %v", source.Bounds().Size(), decoded.Bounds().Size())
+		}
+		return decoded
+	}
+
+	stamped := decodeStamped("K7QX-2MHP-4AB9")
+	other := decodeStamped("ZZZZ-ZZZZ-ZZZZ")
+
+	// The banner stays in the bottom half, the rest of the evidence is untouched
+	bounds := source.Bounds()
+	var bannerChanged, codeRendered bool
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			changed := !sameColor(stamped, source, x, y)
+			if y < bounds.Dy()/2 && changed {
+				t.Fatalf("Expected pixel %d,%d above the banner to be unchanged", x, y)
+			}
+			bannerChanged = bannerChanged || changed
+			codeRendered = codeRendered || !sameColor(stamped, other, x, y)
+		}
+	}
+
+	if !bannerChanged {
+		t.Error("Expected a verification banner on the image")
+	}
+	if !codeRendered {
+		t.Error("Expected the verification code to be rendered in the banner")
+	}
+}
+
+func sameColor(a, b image.Image, x, y int) bool {
+	ar, ag, ab, aa := a.At(x, y).RGBA()
+	br, bg, bb, ba := b.At(x, y).RGBA()
+	return ar == br && ag == bg && ab == bb && aa == ba
+}
+
+func TestStampImageInvalidData(t *testing.T) {
+	if _, err := stampImage([]byte("not an image"), "image/png", stampLines("K7QX-2MHP-4AB9")); err == nil {
+		t.Error("Expected an error for data that isn't an image")
+	}
+}
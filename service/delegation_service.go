@@ -0,0 +1,247 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// maxDelegationLength bounds a delegation, a longer absence calls for a new dosen wali
+const maxDelegationLength = 366 * 24 * time.Hour
+
+// DelegationService manages time-bounded delegations of a dosen wali's approvals to another
+// dosen. While a delegation is active the delegate decides advisor steps of the delegator's
+// advisees, and each decision records the delegator it was made for.
+type DelegationService struct {
+	DB                *sql.DB
+	PermissionService *PermissionService
+}
+
+type Delegation struct {
+	ID            string     `json:"id"`
+	DelegatorID   string     `json:"delegator_id"`
+	DelegatorName string     `json:"delegator_name"`
+	DelegateID    string     `json:"delegate_id"`
+	DelegateName  string     `json:"delegate_name"`
+	StartsAt      time.Time  `json:"starts_at"`
+	EndsAt        time.Time  `json:"ends_at"`
+	Reason        *string    `json:"reason,omitempty"`
+	CreatedBy     *string    `json:"created_by,omitempty"`
+	RevokedAt     *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	Status        string     `json:"status"` // scheduled, active, ended, revoked
+}
+
+type CreateDelegationRequest struct {
+	DelegatorID string     `json:"delegator_id"` // admins only, defaults to the signed-in dosen
+	DelegateID  string     `json:"delegate_id"`
+	StartsAt    *time.Time `json:"starts_at"` // default now
+	EndsAt      time.Time  `json:"ends_at"`
+	Reason      string     `json:"reason"`
+}
+
+func NewDelegationService(db *sql.DB, permissionService *PermissionService) *DelegationService {
+	return &DelegationService{DB: db, PermissionService: permissionService}
+}
+
+// CreateDelegation delegates the approvals of req.DelegatorID to req.DelegateID. Both must be
+// allowed to verify achievements. A dosen can have one delegation at a time, overlapping ones
+// are refused.
+func (s *DelegationService) CreateDelegation(req CreateDelegationRequest, createdBy string) (*Delegation, error) {
+	if err := validateDelegation(&req, time.Now()); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// The delegator row is locked first, so concurrent requests for the same delegator run the
+	// overlap check one after another
+	for _, userID := range []string{req.DelegatorID, req.DelegateID} {
+		var role string
+		var isActive bool
+		err := tx.QueryRow(`SELECT role, is_active FROM users WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`, userID).Scan(&role, &isActive)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return nil, errors.New("user not found")
+			}
+			return nil, fmt.Errorf("failed to get user: %w", err)
+		}
+		if !s.PermissionService.HasPermission(role, PermissionAchievementVerify) {
+			return nil, errors.New("delegator and delegate must both be allowed to verify achievements")
+		}
+		if userID == req.DelegateID && !isActive {
+			return nil, errors.New("delegate account is inactive")
+		}
+	}
+
+	var overlapping bool
+	err = tx.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM verifier_delegations
+			WHERE delegator_id = $1 AND revoked_at IS NULL AND starts_at < $3 AND ends_at > $2
+		)
+	`, req.DelegatorID, *req.StartsAt, req.EndsAt).Scan(&overlapping)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check delegations: %w", err)
+	}
+	if overlapping {
+		return nil, errors.New("delegation overlaps an existing delegation, revoke it first")
+	}
+
+	var id string
+	err = tx.QueryRow(`
+		INSERT INTO verifier_delegations (delegator_id, delegate_id, starts_at, ends_at, reason, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id
+	`, req.DelegatorID, req.DelegateID, *req.StartsAt, req.EndsAt, nullIfEmpty(req.Reason), nullIfEmpty(createdBy)).Scan(&id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create delegation: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit delegation: %w", err)
+	}
+
+	return s.getDelegation(id)
+}
+
+// GetDelegations lists delegations given or received by userID, or every delegation when userID is empty
+func (s *DelegationService) GetDelegations(userID string) ([]Delegation, error) {
+	rows, err := s.DB.Query(delegationSelect+`
+		WHERE ($1 = '' OR d.delegator_id::text = $1 OR d.delegate_id::text = $1)
+		ORDER BY d.starts_at DESC
+		LIMIT 200
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get delegations: %w", err)
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	delegations := []Delegation{}
+	for rows.Next() {
+		delegation, err := scanDelegation(rows, now)
+		if err != nil {
+			return nil, err
+		}
+		delegations = append(delegations, *delegation)
+	}
+	return delegations, rows.Err()
+}
+
+// RevokeDelegation ends a delegation early. Only the delegator or, with canRevokeAny, an admin may revoke it.
+func (s *DelegationService) RevokeDelegation(id, userID string, canRevokeAny bool) error {
+	result, err := s.DB.Exec(`
+		UPDATE verifier_delegations SET revoked_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND revoked_at IS NULL AND ends_at > CURRENT_TIMESTAMP AND ($3 OR delegator_id::text = $2)
+	`, id, userID, canRevokeAny)
+	if err != nil {
+		return fmt.Errorf("failed to revoke delegation: %w", err)
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return errors.New("delegation not found")
+	}
+	return nil
+}
+
+// isActiveDelegate reports whether delegateID currently acts for delegatorID
+func isActiveDelegate(q queryer, delegateID, delegatorID string) (bool, error) {
+	var active bool
+	err := q.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM verifier_delegations
+			WHERE delegate_id = $1 AND delegator_id = $2 AND revoked_at IS NULL
+			  AND starts_at <= CURRENT_TIMESTAMP AND ends_at > CURRENT_TIMESTAMP
+		)
+	`, delegateID, delegatorID).Scan(&active)
+	if err != nil {
+		return false, fmt.Errorf("failed to check delegation: %w", err)
+	}
+	return active, nil
+}
+
+const delegationSelect = `
+	SELECT d.id, d.delegator_id, a.name, d.delegate_id, b.name, d.starts_at, d.ends_at, d.reason,
+	       d.created_by, d.revoked_at, d.created_at
+	FROM verifier_delegations d
+	JOIN users a ON a.id = d.delegator_id
+	JOIN users b ON b.id = d.delegate_id
+`
+
+func (s *DelegationService) getDelegation(id string) (*Delegation, error) {
+	rows, err := s.DB.Query(delegationSelect+` WHERE d.id = $1`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get delegation: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, errors.New("delegation not found")
+	}
+	return scanDelegation(rows, time.Now())
+}
+
+func scanDelegation(rows *sql.Rows, now time.Time) (*Delegation, error) {
+	var delegation Delegation
+	err := rows.Scan(&delegation.ID, &delegation.DelegatorID, &delegation.DelegatorName, &delegation.DelegateID,
+		&delegation.DelegateName, &delegation.StartsAt, &delegation.EndsAt, &delegation.Reason,
+		&delegation.CreatedBy, &delegation.RevokedAt, &delegation.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan delegation: %w", err)
+	}
+	delegation.Status = delegationStatus(&delegation, now)
+	return &delegation, nil
+}
+
+func delegationStatus(delegation *Delegation, now time.Time) string {
+	switch {
+	case delegation.RevokedAt != nil:
+		return "revoked"
+	case !delegation.EndsAt.After(now):
+		return "ended"
+	case delegation.StartsAt.After(now):
+		return "scheduled"
+	default:
+		return "active"
+	}
+}
+
+// validateDelegation checks the period and parties of a delegation request
+func validateDelegation(req *CreateDelegationRequest, now time.Time) error {
+	req.DelegatorID = strings.TrimSpace(req.DelegatorID)
+	req.DelegateID = strings.TrimSpace(req.DelegateID)
+	req.Reason = strings.TrimSpace(req.Reason)
+
+	if req.DelegatorID == "" || req.DelegateID == "" {
+		return errors.New("delegate_id is required")
+	}
+	if req.DelegatorID == req.DelegateID {
+		return errors.New("you can't delegate to yourself")
+	}
+	if len(req.Reason) > 500 {
+		return errors.New("reason must be at most 500 characters")
+	}
+
+	if req.StartsAt == nil {
+		req.StartsAt = &now
+	}
+	if req.EndsAt.IsZero() {
+		return errors.New("ends_at is required")
+	}
+	if !req.EndsAt.After(*req.StartsAt) {
+		return errors.New("ends_at must be after starts_at")
+	}
+	if !req.EndsAt.After(now) {
+		return errors.New("ends_at must be in the future")
+	}
+	if req.EndsAt.Sub(*req.StartsAt) > maxDelegationLength {
+		return errors.New("a delegation can last at most one year")
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidateDelegation(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-48 * time.Hour)
+
+	req := CreateDelegationRequest{DelegatorID: "dosen-1", DelegateID: " dosen-2 ", EndsAt: now.Add(14 * 24 * time.Hour)}
+	if err := validateDelegation(&req, now); err != nil {
+		t.Fatalf("Expected delegation to be valid: %v", err)
+	}
+	if req.StartsAt == nil || !req.StartsAt.Equal(now) || req.DelegateID != "dosen-2" {
+		t.Errorf("Unexpected normalized request: %+v", req)
+	}
+
+	invalid := []CreateDelegationRequest{
+		{DelegatorID: "dosen-1", EndsAt: now.Add(time.Hour)},
+		{DelegatorID: "dosen-1", DelegateID: "dosen-1", EndsAt: now.Add(time.Hour)},
+		{DelegatorID: "dosen-1", DelegateID: "dosen-2"},
+		{DelegatorID: "dosen-1", DelegateID: "dosen-2", EndsAt: now.Add(-time.Hour), StartsAt: &past},
+		{DelegatorID: "dosen-1", DelegateID: "dosen-2", EndsAt: now.Add(-72 * time.Hour)},
+		{DelegatorID: "dosen-1", DelegateID: "dosen-2", EndsAt: now.Add(400 * 24 * time.Hour)},
+	}
+	for _, req := range invalid {
+		if err := validateDelegation(&req, now); err == nil {
+			t.Errorf("Expected delegation %+v to be rejected", req)
+		}
+	}
+}
+
+func TestDelegationStatus(t *testing.T) {
+	now := time.Now()
+	revokedAt := now.Add(-time.Hour)
+
+	tests := []struct {
+		delegation Delegation
+		want       string
+	}{
+		{Delegation{StartsAt: now.Add(-time.Hour), EndsAt: now.Add(time.Hour)}, "active"},
+		{Delegation{StartsAt: now.Add(time.Hour), EndsAt: now.Add(2 * time.Hour)}, "scheduled"},
+		{Delegation{StartsAt: now.Add(-2 * time.Hour), EndsAt: now.Add(-time.Hour)}, "ended"},
+		{Delegation{StartsAt: now.Add(-time.Hour), EndsAt: now.Add(time.Hour), RevokedAt: &revokedAt}, "revoked"},
+	}
+
+	for _, tt := range tests {
+		if got := delegationStatus(&tt.delegation, now); got != tt.want {
+			t.Errorf("delegationStatus(%+v) = %q, want %q", tt.delegation, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"prestasi-mahasiswa/utils"
+)
+
+// EmailVerificationService confirms that self-registered users own their email address.
+// Accounts stay pending, and can't login, until the emailed link is opened.
+type EmailVerificationService struct {
+	DB             *sql.DB
+	Mailer         utils.Mailer
+	VerifyURL      string // link sent by email, the token is appended as ?token=
+	TokenLifetime  time.Duration
+	ResendInterval time.Duration // at most one email per user within this interval
+	MaxSendsPerDay int
+}
+
+func NewEmailVerificationService(db *sql.DB, mailer utils.Mailer, verifyURL string, tokenLifetime time.Duration) *EmailVerificationService {
+	return &EmailVerificationService{
+		DB:             db,
+		Mailer:         mailer,
+		VerifyURL:      verifyURL,
+		TokenLifetime:  tokenLifetime,
+		ResendInterval: time.Minute,
+		MaxSendsPerDay: 5,
+	}
+}
+
+// SendVerification creates a new verification token for a pending user and emails the link,
+// earlier links stop working
+func (s *EmailVerificationService) SendVerification(userID, email, name string) error {
+	token, err := utils.GenerateRandomToken()
+	if err != nil {
+		return fmt.Errorf("failed to generate verification token: %w", err)
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`UPDATE email_verification_tokens SET used_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND used_at IS NULL`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to invalidate previous verification tokens: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO email_verification_tokens (user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3)
+	`, userID, utils.HashToken(token), time.Now().Add(s.TokenLifetime))
+	if err != nil {
+		return fmt.Errorf("failed to store verification token: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit verification token: %w", err)
+	}
+
+	message := utils.EmailMessage{
+		To:      email,
+		Subject: "Verifikasi email Sistem Pelaporan Prestasi Mahasiswa",
+		Body: fmt.Sprintf("Halo %s,\n\nTerima kasih telah mendaftar. Buka tautan berikut untuk memverifikasi alamat email Anda:\n\n%s\n\nTautan berlaku selama %d jam. Abaikan email ini jika Anda tidak mendaftar.\n",
+			name, s.verifyLink(token), int(s.TokenLifetime.Hours())),
+	}
+	if err := s.Mailer.Send(message); err != nil {
+		return fmt.Errorf("failed to send verification email: %w", err)
+	}
+
+	return nil
+}
+
+// ResendVerification emails a new link to a pending account. Unknown, verified and rate limited
+// emails return nil as well, so the endpoint can't be used to discover accounts.
+func (s *EmailVerificationService) ResendVerification(email string) error {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return errors.New("email is required")
+	}
+
+	var userID, name string
+	err := s.DB.QueryRow(`
+		SELECT id, name FROM users
+		WHERE email = $1 AND is_active = true AND email_verification_pending = true
+	`, email).Scan(&userID, &name)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	var recentSends, dailySends int
+	err = s.DB.QueryRow(`
+		SELECT
+			COUNT(*) FILTER (WHERE created_at > CURRENT_TIMESTAMP - ($2 * INTERVAL '1 second')),
+			COUNT(*) FILTER (WHERE created_at > CURRENT_TIMESTAMP - INTERVAL '1 day')
+		FROM email_verification_tokens
+		WHERE user_id = $1
+	`, userID, s.ResendInterval.Seconds()).Scan(&recentSends, &dailySends)
+	if err != nil {
+		return fmt.Errorf("failed to check verification requests: %w", err)
+	}
+	if recentSends > 0 || (s.MaxSendsPerDay > 0 && dailySends >= s.MaxSendsPerDay) {
+		return nil
+	}
+
+	if err := s.SendVerification(userID, email, name); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+
+	return nil
+}
+
+// CheckVerificationToken reports whether a token can still verify an email without using it up
+func (s *EmailVerificationService) CheckVerificationToken(token string) error {
+	if token == "" {
+		return errors.New("verification token is required")
+	}
+
+	var exists bool
+	err := s.DB.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM email_verification_tokens
+			WHERE token_hash = $1 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		)
+	`, utils.HashToken(token)).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to check verification token: %w", err)
+	}
+	if !exists {
+		return errors.New("invalid or expired verification token")
+	}
+
+	return nil
+}
+
+// VerifyEmail consumes a verification token and activates login for the account
+func (s *EmailVerificationService) VerifyEmail(token string) error {
+	if token == "" {
+		return errors.New("verification token is required")
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var userID string
+	err = tx.QueryRow(`
+		UPDATE email_verification_tokens
+		SET used_at = CURRENT_TIMESTAMP
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		RETURNING user_id
+	`, utils.HashToken(token)).Scan(&userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return errors.New("invalid or expired verification token")
+		}
+		return fmt.Errorf("failed to consume verification token: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE users
+		SET email_verification_pending = false, email_verified_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to verify email: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit email verification: %w", err)
+	}
+
+	return nil
+}
+
+func (s *EmailVerificationService) verifyLink(token string) string {
+	separator := "?"
+	if strings.Contains(s.VerifyURL, "?") {
+		separator = "&"
+	}
+	return s.VerifyURL + separator + "token=" + url.QueryEscape(token)
+}
+
+// CleanupExpiredVerificationTokens removes used and expired verification tokens
+func (s *EmailVerificationService) CleanupExpiredVerificationTokens() error {
+	query := `
+		DELETE FROM email_verification_tokens
+		WHERE expires_at < CURRENT_TIMESTAMP - INTERVAL '1 day'
+	`
+	result, err := s.DB.Exec(query)
+	if err != nil {
+		return fmt.Errorf("failed to cleanup verification tokens: %w", err)
+	}
+
+	rowsDeleted, _ := result.RowsAffected()
+	fmt.Printf("Cleaned up %d expired email verification tokens\n", rowsDeleted)
+
+	return nil
+}
@@ -0,0 +1,180 @@
+package service
+
+import (
+	"database/sql/driver"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"prestasi-mahasiswa/utils"
+)
+
+// recordingMailer keeps sent messages instead of delivering them
+type recordingMailer struct {
+	messages []utils.EmailMessage
+}
+
+func (m *recordingMailer) Send(message utils.EmailMessage) error {
+	m.messages = append(m.messages, message)
+	return nil
+}
+
+func TestEmailVerificationLink(t *testing.T) {
+	s := NewEmailVerificationService(nil, nil, "http://localhost:8080/api/v1/auth/verify-email", 24*time.Hour)
+
+	link, err := url.Parse(s.verifyLink("abc/123+"))
+	if err != nil {
+		t.Fatalf("Failed to parse verification link: %v", err)
+	}
+	if link.Path != "/api/v1/auth/verify-email" {
+		t.Errorf("Expected verify-email path, got %s", link.Path)
+	}
+	if link.Query().Get("token") != "abc/123+" {
+		t.Errorf("Expected token to survive URL encoding, got %q", link.Query().Get("token"))
+	}
+}
+
+func TestEmailVerificationDefaults(t *testing.T) {
+	s := NewEmailVerificationService(nil, nil, "", 24*time.Hour)
+
+	if s.ResendInterval != time.Minute {
+		t.Errorf("Expected resend interval of 1 minute, got %v", s.ResendInterval)
+	}
+	if s.MaxSendsPerDay != 5 {
+		t.Errorf("Expected 5 sends per day, got %d", s.MaxSendsPerDay)
+	}
+}
+
+func TestVerifyEmailConsumesTokenAndActivatesUser(t *testing.T) {
+	db, fake := newFakeDB(t)
+	s := NewEmailVerificationService(db, nil, "", 24*time.Hour)
+
+	fake.expectQuery("UPDATE email_verification_tokens", []string{"user_id"}, []driver.Value{"user-1"})
+	fake.expectExec("SET email_verification_pending = false", 1)
+
+	if err := s.VerifyEmail("token-123"); err != nil {
+		t.Fatalf("VerifyEmail failed: %v", err)
+	}
+
+	consume := fake.callsContaining("UPDATE email_verification_tokens")[0]
+	if consume.Args[0] != utils.HashToken("token-123") {
+		t.Error("Expected the token to be looked up by its hash")
+	}
+	if activate := fake.callsContaining("SET email_verification_pending = false")[0]; activate.Args[0] != "user-1" {
+		t.Errorf("Expected user-1 to be verified, got %v", activate.Args[0])
+	}
+	if len(fake.callsContaining("COMMIT")) != 1 {
+		t.Error("Expected the verification to be committed")
+	}
+}
+
+func TestVerifyEmailInvalidToken(t *testing.T) {
+	db, fake := newFakeDB(t)
+	s := NewEmailVerificationService(db, nil, "", 24*time.Hour)
+
+	if err := s.VerifyEmail(""); err == nil || err.Error() != "verification token is required" {
+		t.Errorf("Expected verification token is required, got %v", err)
+	}
+
+	// Used, expired and unknown tokens match no row
+	fake.expectQuery("UPDATE email_verification_tokens", []string{"user_id"})
+	if err := s.VerifyEmail("used-token"); err == nil || err.Error() != "invalid or expired verification token" {
+		t.Errorf("Expected invalid or expired verification token, got %v", err)
+	}
+	if len(fake.callsContaining("UPDATE users")) != 0 || len(fake.callsContaining("COMMIT")) != 0 {
+		t.Error("Expected no user to be verified")
+	}
+}
+
+func TestCheckVerificationTokenDoesNotUseToken(t *testing.T) {
+	db, fake := newFakeDB(t)
+	s := NewEmailVerificationService(db, nil, "", 24*time.Hour)
+
+	fake.expectQuery("SELECT EXISTS", []string{"exists"}, []driver.Value{true})
+	if err := s.CheckVerificationToken("token-123"); err != nil {
+		t.Errorf("Expected a valid token, got %v", err)
+	}
+
+	fake.expectQuery("SELECT EXISTS", []string{"exists"}, []driver.Value{false})
+	if err := s.CheckVerificationToken("token-456"); err == nil || err.Error() != "invalid or expired verification token" {
+		t.Errorf("Expected invalid or expired verification token, got %v", err)
+	}
+
+	if len(fake.callsContaining("UPDATE")) != 0 {
+		t.Error("Expected checking a token not to change it")
+	}
+}
+
+func TestResendVerificationSendsNewLink(t *testing.T) {
+	db, fake := newFakeDB(t)
+	mailer := &recordingMailer{}
+	s := NewEmailVerificationService(db, mailer, "https://prestasi.example.ac.id/api/v1/auth/verify-email", 24*time.Hour)
+
+	fake.expectQuery("FROM users", []string{"id", "name"}, []driver.Value{"user-1", "Aryo"})
+	fake.expectQuery("FROM email_verification_tokens", []string{"recent", "daily"}, []driver.Value{int64(0), int64(2)})
+	fake.expectExec("SET used_at = CURRENT_TIMESTAMP WHERE user_id = $1", 1)
+	fake.expectExec("INSERT INTO email_verification_tokens", 1)
+
+	if err := s.ResendVerification(" aryo@unair.ac.id "); err != nil {
+		t.Fatalf("ResendVerification failed: %v", err)
+	}
+
+	if len(mailer.messages) != 1 || mailer.messages[0].To != "aryo@unair.ac.id" {
+		t.Fatalf("Expected one email to aryo@unair.ac.id, got %+v", mailer.messages)
+	}
+
+	// The emailed link carries the token whose hash was stored
+	insert := fake.callsContaining("INSERT INTO email_verification_tokens")[0]
+	var token string
+	for _, word := range strings.Fields(mailer.messages[0].Body) {
+		if link, err := url.Parse(word); err == nil && link.Query().Get("token") != "" {
+			token = link.Query().Get("token")
+		}
+	}
+	if token == "" || insert.Args[1] != utils.HashToken(token) {
+		t.Error("Expected the emailed link to carry the stored token")
+	}
+	if len(fake.callsContaining("COMMIT")) != 1 {
+		t.Error("Expected the new token to be committed before sending")
+	}
+}
+
+func TestResendVerificationSendsNothing(t *testing.T) {
+	tests := []struct {
+		name   string
+		expect func(fake *fakeDB)
+	}{
+		{"unknown or verified email", func(fake *fakeDB) {
+			fake.expectQuery("FROM users", []string{"id", "name"})
+		}},
+		{"sent within the last minute", func(fake *fakeDB) {
+			fake.expectQuery("FROM users", []string{"id", "name"}, []driver.Value{"user-1", "Aryo"})
+			fake.expectQuery("FROM email_verification_tokens", []string{"recent", "daily"}, []driver.Value{int64(1), int64(1)})
+		}},
+		{"daily limit reached", func(fake *fakeDB) {
+			fake.expectQuery("FROM users", []string{"id", "name"}, []driver.Value{"user-1", "Aryo"})
+			fake.expectQuery("FROM email_verification_tokens", []string{"recent", "daily"}, []driver.Value{int64(0), int64(5)})
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, fake := newFakeDB(t)
+			mailer := &recordingMailer{}
+			s := NewEmailVerificationService(db, mailer, "https://prestasi.example.ac.id/api/v1/auth/verify-email", 24*time.Hour)
+			tt.expect(fake)
+
+			// The response doesn't tell whether an email was sent
+			if err := s.ResendVerification("aryo@unair.ac.id"); err != nil {
+				t.Errorf("Expected nil, got %v", err)
+			}
+			if len(mailer.messages) != 0 {
+				t.Errorf("Expected no email, got %d", len(mailer.messages))
+			}
+			if len(fake.callsContaining("INSERT INTO email_verification_tokens")) != 0 {
+				t.Error("Expected no new token")
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeDB is a database/sql driver for unit tests. Every statement must match an expected one,
+// expectations are matched in order by a substring of the query and used once unless allowed repeatedly.
+type fakeDB struct {
+	t            *testing.T
+	mu           sync.Mutex
+	expectations []*fakeExpectation
+	calls        []fakeCall
+}
+
+type fakeExpectation struct {
+	contains     string
+	columns      []string
+	rows         [][]driver.Value
+	rowsAffected int64
+	err          error
+	repeat       bool // matches any number of statements
+	used         bool
+}
+
+// fakeCall is a statement the code under test ran, committed and rolled back transactions
+// show up as COMMIT and ROLLBACK
+type fakeCall struct {
+	Query string
+	Args  []driver.Value
+}
+
+// newFakeDB returns a *sql.DB backed by a fakeDB, the test fails if an expectation is left unused
+func newFakeDB(t *testing.T) (*sql.DB, *fakeDB) {
+	t.Helper()
+	fake := &fakeDB{t: t}
+	db := sql.OpenDB(fakeConnector{fake})
+	t.Cleanup(func() {
+		db.Close()
+		for _, expectation := range fake.expectations {
+			if !expectation.used {
+				t.Errorf("expected statement containing %q was not run", expectation.contains)
+			}
+		}
+	})
+	return db, fake
+}
+
+// expectQuery answers the next query containing the given text with rows, no rows gives sql.ErrNoRows on QueryRow
+func (f *fakeDB) expectQuery(contains string, columns []string, rows ...[]driver.Value) {
+	f.expectations = append(f.expectations, &fakeExpectation{contains: contains, columns: columns, rows: rows})
+}
+
+// expectExec answers the next statement containing the given text with the number of rows affected
+func (f *fakeDB) expectExec(contains string, rowsAffected int64) {
+	f.expectations = append(f.expectations, &fakeExpectation{contains: contains, rowsAffected: rowsAffected})
+}
+
+// allowExec answers any number of statements containing the given text, at least one must run
+func (f *fakeDB) allowExec(contains string, rowsAffected int64) {
+	f.expectations = append(f.expectations, &fakeExpectation{contains: contains, rowsAffected: rowsAffected, repeat: true})
+}
+
+// expectError fails the next statement containing the given text
+func (f *fakeDB) expectError(contains string, err error) {
+	f.expectations = append(f.expectations, &fakeExpectation{contains: contains, err: err})
+}
+
+// callsContaining returns the statements run that contain the given text, in order
+func (f *fakeDB) callsContaining(contains string) []fakeCall {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var calls []fakeCall
+	for _, call := range f.calls {
+		if strings.Contains(call.Query, contains) {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+func (f *fakeDB) run(query string, args []driver.NamedValue) (*fakeExpectation, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		values[i] = arg.Value
+	}
+	f.calls = append(f.calls, fakeCall{Query: query, Args: values})
+
+	for _, expectation := range f.expectations {
+		if (!expectation.used || expectation.repeat) && strings.Contains(query, expectation.contains) {
+			expectation.used = true
+			return expectation, expectation.err
+		}
+	}
+	f.t.Errorf("unexpected statement: %s", strings.Join(strings.Fields(query), " "))
+	return nil, fmt.Errorf("unexpected statement")
+}
+
+type fakeConnector struct{ db *fakeDB }
+
+func (c fakeConnector) Connect(context.Context) (driver.Conn, error) { return fakeConn{c.db}, nil }
+func (c fakeConnector) Driver() driver.Driver                        { return fakeDriver{} }
+
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("fake driver is opened through its connector")
+}
+
+type fakeConn struct{ db *fakeDB }
+
+func (c fakeConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("fake driver doesn't prepare statements")
+}
+func (c fakeConn) Close() error              { return nil }
+func (c fakeConn) Begin() (driver.Tx, error) { return fakeTx{c.db}, nil }
+
+func (c fakeConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	expectation, err := c.db.run(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRows{columns: expectation.columns, rows: expectation.rows}, nil
+}
+
+func (c fakeConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	expectation, err := c.db.run(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(expectation.rowsAffected), nil
+}
+
+type fakeTx struct{ db *fakeDB }
+
+func (tx fakeTx) Commit() error   { return tx.db.end("COMMIT") }
+func (tx fakeTx) Rollback() error { return tx.db.end("ROLLBACK") }
+
+func (f *fakeDB) end(statement string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, fakeCall{Query: statement})
+	return nil
+}
+
+type fakeRows struct {
+	columns []string
+	rows    [][]driver.Value
+	next    int
+}
+
+func (r *fakeRows) Columns() []string { return r.columns }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.next >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.next])
+	r.next++
+	return nil
+}
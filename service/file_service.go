@@ -260,7 +260,7 @@ func (s *FileService) DeleteFile(fileID, userID string) error {
 }
 
 // ValidateFileAccess checks if user can access file
-func (s *FileService) ValidateFileAccess(fileID, userID, userRole string) error {
+func (s *FileService) ValidateFileAccess(fileID, userID string, canReadAll bool) error {
 	fileData, err := s.GetFileByID(fileID)
 	if err != nil {
 		return err
@@ -271,8 +271,8 @@ func (s *FileService) ValidateFileAccess(fileID, userID, userRole string) error
 		return nil
 	}
 
-	// Admin and dosen can access all files
-	if userRole == "admin" || userRole == "dosen_wali" {
+	// Roles with achievement:read_all can access all files
+	if canReadAll {
 		return nil
 	}
 
@@ -0,0 +1,242 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"prestasi-mahasiswa/utils"
+)
+
+// maxImpersonationLifetime keeps impersonation tokens within the access token lifetime the
+// revocation service tracks, so invalidating the user's or admin's tokens always covers them
+const maxImpersonationLifetime = 15 * time.Minute
+
+// ImpersonationService lets admins act as a user to see what the user sees. Tokens carry the
+// admin in the act claim, have no refresh token, and every request made with them is recorded.
+type ImpersonationService struct {
+	DB                     *sql.DB
+	LoginService           *LoginService
+	TokenRevocationService *TokenRevocationService
+	TokenLifetime          time.Duration
+}
+
+type ImpersonationToken struct {
+	AccessToken string    `json:"access_token"`
+	TokenType   string    `json:"token_type"`
+	ExpiresIn   int       `json:"expires_in"` // seconds
+	SessionID   string    `json:"session_id"`
+	User        *UserData `json:"user"`
+}
+
+type ImpersonationSession struct {
+	ID           string     `json:"id"`
+	ActorID      *string    `json:"actor_id"`
+	ActorName    *string    `json:"actor_name"`
+	UserID       string     `json:"user_id"`
+	UserName     string     `json:"user_name"`
+	Reason       string     `json:"reason"`
+	IPAddress    *string    `json:"ip_address"`
+	ExpiresAt    time.Time  `json:"expires_at"`
+	EndedAt      *time.Time `json:"ended_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	RequestCount int        `json:"request_count"`
+	Status       string     `json:"status"` // active, ended, expired
+}
+
+type ImpersonationRequest struct {
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	StatusCode int       `json:"status_code"`
+	IPAddress  *string   `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func NewImpersonationService(db *sql.DB, loginService *LoginService, tokenRevocationService *TokenRevocationService) *ImpersonationService {
+	return &ImpersonationService{
+		DB:                     db,
+		LoginService:           loginService,
+		TokenRevocationService: tokenRevocationService,
+		TokenLifetime:          10 * time.Minute,
+	}
+}
+
+// StartImpersonation issues an access token for userID on behalf of the admin actorID
+func (s *ImpersonationService) StartImpersonation(actorID, userID, reason, ipAddress, userAgent string) (*ImpersonationToken, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return nil, errors.New("reason is required")
+	}
+	if len(reason) > 500 {
+		return nil, errors.New("reason must be at most 500 characters")
+	}
+	if actorID == userID {
+		return nil, errors.New("you can't impersonate yourself")
+	}
+
+	actor, err := s.LoginService.GetUserInfo(actorID)
+	if err != nil {
+		return nil, err
+	}
+	if actor.Role != "admin" {
+		return nil, errors.New("only admins can impersonate users")
+	}
+
+	user, err := s.LoginService.GetUserInfo(userID)
+	if err != nil {
+		return nil, err
+	}
+	// Admin sessions could mint further tokens and reach every admin endpoint
+	if user.Role == "admin" {
+		return nil, errors.New("admin accounts can't be impersonated")
+	}
+
+	lifetime := s.TokenLifetime
+	if lifetime <= 0 || lifetime > maxImpersonationLifetime {
+		lifetime = maxImpersonationLifetime
+	}
+
+	accessToken, err := s.LoginService.JWTUtil.GenerateImpersonationToken(user.ID, user.Email, user.Role,
+		utils.ActorClaims{Subject: actor.ID, Email: actor.Email}, lifetime)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate impersonation token: %w", err)
+	}
+	claims, err := s.LoginService.JWTUtil.ValidateAccessToken(accessToken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read impersonation token: %w", err)
+	}
+
+	var sessionID string
+	err = s.DB.QueryRow(`
+		INSERT INTO impersonation_sessions (token_jti, actor_id, user_id, reason, ip_address, user_agent, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id
+	`, claims.ID, actor.ID, user.ID, reason, nullIfEmpty(ipAddress), nullIfEmpty(userAgent), claims.ExpiresAt.Time).Scan(&sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store impersonation session: %w", err)
+	}
+
+	LogSecurityEvent(s.DB, SecurityEvent{
+		UserID:    actor.ID,
+		EventType: SecurityEventImpersonation,
+		IPAddress: nullIfEmpty(ipAddress),
+		UserAgent: nullIfEmpty(userAgent),
+		Details:   map[string]interface{}{"session_id": sessionID, "user_id": user.ID, "reason": reason},
+	})
+
+	return &ImpersonationToken{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(lifetime.Seconds()),
+		SessionID:   sessionID,
+		User:        user,
+	}, nil
+}
+
+// EndImpersonation revokes the token of a session before it expires
+func (s *ImpersonationService) EndImpersonation(sessionID string) error {
+	var jti, userID string
+	var expiresAt time.Time
+	err := s.DB.QueryRow(`
+		UPDATE impersonation_sessions SET ended_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND ended_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		RETURNING token_jti, user_id, expires_at
+	`, sessionID).Scan(&jti, &userID, &expiresAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return errors.New("active impersonation session not found")
+		}
+		return fmt.Errorf("failed to end impersonation session: %w", err)
+	}
+
+	return s.TokenRevocationService.RevokeAccessToken(jti, userID, expiresAt, "impersonation_ended")
+}
+
+// LogImpersonatedRequest records one request made with an impersonation token
+func (s *ImpersonationService) LogImpersonatedRequest(jti, actorID, userID, method, path string, status int, ipAddress string) {
+	_, err := s.DB.Exec(`
+		INSERT INTO impersonation_requests (session_id, method, path, status_code, ip_address)
+		SELECT id, $2, $3, $4, $5 FROM impersonation_sessions WHERE token_jti = $1
+	`, jti, method, path, status, nullIfEmpty(ipAddress))
+	if err != nil {
+		// The request is printed so the audit trail survives in the logs
+		fmt.Printf("Warning: failed to store impersonated request actor=%s user=%s %s %s %d: %v\n", actorID, userID, method, path, status, err)
+	}
+}
+
+// GetSessions lists impersonation sessions, optionally of one admin or of one impersonated user
+func (s *ImpersonationService) GetSessions(actorID, userID string) ([]ImpersonationSession, error) {
+	query := `
+		SELECT s.id, s.actor_id, a.name, s.user_id, u.name, s.reason, s.ip_address, s.expires_at, s.ended_at, s.created_at,
+		       (SELECT COUNT(*) FROM impersonation_requests r WHERE r.session_id = s.id)
+		FROM impersonation_sessions s
+		JOIN users u ON u.id = s.user_id
+		LEFT JOIN users a ON a.id = s.actor_id
+		WHERE ($1 = '' OR s.actor_id::text = $1) AND ($2 = '' OR s.user_id::text = $2)
+		ORDER BY s.created_at DESC
+		LIMIT 200
+	`
+	rows, err := s.DB.Query(query, actorID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get impersonation sessions: %w", err)
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	sessions := []ImpersonationSession{}
+	for rows.Next() {
+		var session ImpersonationSession
+		err := rows.Scan(&session.ID, &session.ActorID, &session.ActorName, &session.UserID, &session.UserName, &session.Reason,
+			&session.IPAddress, &session.ExpiresAt, &session.EndedAt, &session.CreatedAt, &session.RequestCount)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan impersonation session: %w", err)
+		}
+
+		switch {
+		case session.EndedAt != nil:
+			session.Status = "ended"
+		case !session.ExpiresAt.After(now):
+			session.Status = "expired"
+		default:
+			session.Status = "active"
+		}
+		sessions = append(sessions, session)
+	}
+
+	return sessions, nil
+}
+
+// GetSessionRequests returns the requests made in one impersonation session, oldest first
+func (s *ImpersonationService) GetSessionRequests(sessionID string) ([]ImpersonationRequest, error) {
+	var exists bool
+	if err := s.DB.QueryRow(`SELECT EXISTS (SELECT 1 FROM impersonation_sessions WHERE id = $1)`, sessionID).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("failed to get impersonation session: %w", err)
+	}
+	if !exists {
+		return nil, errors.New("impersonation session not found")
+	}
+
+	rows, err := s.DB.Query(`
+		SELECT method, path, status_code, ip_address, created_at
+		FROM impersonation_requests
+		WHERE session_id = $1
+		ORDER BY created_at
+	`, sessionID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get impersonated requests: %w", err)
+	}
+	defer rows.Close()
+
+	requests := []ImpersonationRequest{}
+	for rows.Next() {
+		var request ImpersonationRequest
+		if err := rows.Scan(&request.Method, &request.Path, &request.StatusCode, &request.IPAddress, &request.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan impersonated request: %w", err)
+		}
+		requests = append(requests, request)
+	}
+
+	return requests, nil
+}
@@ -0,0 +1,31 @@
+package service
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStartImpersonationValidation(t *testing.T) {
+	s := &ImpersonationService{}
+
+	tests := []struct {
+		name    string
+		actorID string
+		userID  string
+		reason  string
+		wantErr string
+	}{
+		{name: "missing reason", actorID: "admin-1", userID: "user-1", reason: "  ", wantErr: "reason is required"},
+		{name: "reason too long", actorID: "admin-1", userID: "user-1", reason: strings.Repeat("a", 501), wantErr: "reason must be at most 500 characters"},
+		{name: "self", actorID: "admin-1", userID: "admin-1", reason: "support ticket #12", wantErr: "you can't impersonate yourself"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.StartImpersonation(tt.actorID, tt.userID, tt.reason, "", "")
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("Expected error %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,282 @@
+package service
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"prestasi-mahasiswa/utils"
+)
+
+var (
+	// ErrInvalidInvitation refuses unknown, expired, used up and revoked codes, and codes issued
+	// for another email, alike so the error doesn't tell which codes exist
+	ErrInvalidInvitation error = &RegistrationAccessError{Message: "invalid or expired invitation code"}
+
+	// ErrInvitationTaken is returned when a concurrent registration took the last use of a code
+	ErrInvitationTaken = errors.New("invitation code was used up by another registration at the same time")
+)
+
+// invitationCodeAlphabet leaves out characters that are easily confused (0/O, 1/I/L)
+const invitationCodeAlphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+
+// InvitationService manages admin issued registration codes bound to a role.
+// Codes are shown once when created, only their hash is stored.
+type InvitationService struct {
+	DB *sql.DB
+}
+
+type Invitation struct {
+	ID        string     `json:"id"`
+	CodeHint  string     `json:"code_hint"` // last characters of the code, to tell codes apart
+	Role      string     `json:"role"`
+	Email     *string    `json:"email,omitempty"` // when set only this email can use the code
+	MaxUses   int        `json:"max_uses"`
+	UsedCount int        `json:"used_count"`
+	Note      *string    `json:"note,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	CreatedBy *string    `json:"created_by,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	Status    string     `json:"status"` // active, expired, revoked, used_up
+}
+
+type CreateInvitationRequest struct {
+	Role          string  `json:"role"`
+	Email         *string `json:"email,omitempty"`
+	MaxUses       int     `json:"max_uses"`        // default 1
+	ExpiresInDays int     `json:"expires_in_days"` // default 14
+	Note          *string `json:"note,omitempty"`
+}
+
+func NewInvitationService(db *sql.DB) *InvitationService {
+	return &InvitationService{DB: db}
+}
+
+// CreateInvitation stores a new code and returns it in plain text, it can't be retrieved later
+func (s *InvitationService) CreateInvitation(req CreateInvitationRequest, createdBy string) (*Invitation, string, error) {
+	exists, err := roleExists(s.DB, req.Role)
+	if err != nil {
+		return nil, "", err
+	}
+	if !exists {
+		return nil, "", errors.New("invalid role. Must be one of the roles at /admin/roles")
+	}
+
+	if req.MaxUses == 0 {
+		req.MaxUses = 1
+	}
+	if req.MaxUses < 0 || req.MaxUses > 1000 {
+		return nil, "", errors.New("max_uses must be between 1 and 1000")
+	}
+
+	if req.ExpiresInDays == 0 {
+		req.ExpiresInDays = 14
+	}
+	if req.ExpiresInDays < 0 || req.ExpiresInDays > 365 {
+		return nil, "", errors.New("expires_in_days must be between 1 and 365")
+	}
+
+	if req.Email != nil {
+		email := strings.ToLower(strings.TrimSpace(*req.Email))
+		if email == "" {
+			req.Email = nil
+		} else {
+			req.Email = &email
+		}
+	}
+
+	code, err := generateInvitationCode()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate invitation code: %w", err)
+	}
+	normalized := normalizeInvitationCode(code)
+
+	var creator interface{}
+	if createdBy != "" {
+		creator = createdBy
+	}
+
+	invitation := &Invitation{
+		CodeHint: normalized[len(normalized)-4:],
+		Role:     req.Role,
+		Email:    req.Email,
+		MaxUses:  req.MaxUses,
+		Note:     req.Note,
+		Status:   "active",
+	}
+	expiresAt := time.Now().Add(time.Duration(req.ExpiresInDays) * 24 * time.Hour)
+	invitation.ExpiresAt = &expiresAt
+	if createdBy != "" {
+		invitation.CreatedBy = &createdBy
+	}
+
+	query := `
+		INSERT INTO invitation_codes (code_hash, code_hint, role, email, max_uses, note, expires_at, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at
+	`
+	err = s.DB.QueryRow(query, utils.HashToken(normalized), invitation.CodeHint, invitation.Role, invitation.Email,
+		invitation.MaxUses, invitation.Note, expiresAt, creator).Scan(&invitation.ID, &invitation.CreatedAt)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create invitation: %w", err)
+	}
+
+	return invitation, code, nil
+}
+
+// GetInvitations lists invitation codes, newest first
+func (s *InvitationService) GetInvitations() ([]Invitation, error) {
+	query := `
+		SELECT id, code_hint, role, email, max_uses, used_count, note, expires_at, revoked_at, created_by, created_at
+		FROM invitation_codes
+		ORDER BY created_at DESC
+	`
+	rows, err := s.DB.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get invitations: %w", err)
+	}
+	defer rows.Close()
+
+	invitations := []Invitation{}
+	for rows.Next() {
+		invitation, err := scanInvitation(rows)
+		if err != nil {
+			return nil, err
+		}
+		invitations = append(invitations, *invitation)
+	}
+
+	return invitations, nil
+}
+
+// RevokeInvitation stops a code from being used, registrations already made are kept
+func (s *InvitationService) RevokeInvitation(invitationID string) error {
+	result, err := s.DB.Exec(`
+		UPDATE invitation_codes SET revoked_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND revoked_at IS NULL
+	`, invitationID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke invitation: %w", err)
+	}
+
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return errors.New("invitation not found")
+	}
+
+	return nil
+}
+
+// findValidInvitation returns the invitation for a code that can still be used by email, read in
+// the registration transaction that redeems it
+func (s *InvitationService) findValidInvitation(tx queryer, code, email string) (*Invitation, error) {
+	query := `
+		SELECT id, code_hint, role, email, max_uses, used_count, note, expires_at, revoked_at, created_by, created_at
+		FROM invitation_codes
+		WHERE code_hash = $1
+	`
+	invitation, err := scanInvitation(tx.QueryRow(query, utils.HashToken(normalizeInvitationCode(code))))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrInvalidInvitation
+		}
+		return nil, err
+	}
+
+	if !invitationUsableBy(invitation, email) {
+		return nil, ErrInvalidInvitation
+	}
+
+	return invitation, nil
+}
+
+// invitationUsableBy reports whether an invitation is active and, when issued for an email, for this one
+func invitationUsableBy(invitation *Invitation, email string) bool {
+	if invitation.Status != "active" {
+		return false
+	}
+	return invitation.Email == nil || strings.EqualFold(*invitation.Email, strings.TrimSpace(email))
+}
+
+// redeemInvitation counts a use inside the registration transaction, it fails with
+// ErrInvitationTaken when a concurrent registration took the last use
+func (s *InvitationService) redeemInvitation(tx *sql.Tx, invitationID, userID string) error {
+	result, err := tx.Exec(`
+		UPDATE invitation_codes SET used_count = used_count + 1
+		WHERE id = $1 AND used_count < max_uses AND revoked_at IS NULL
+		  AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)
+	`, invitationID)
+	if err != nil {
+		return fmt.Errorf("failed to redeem invitation: %w", err)
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return ErrInvitationTaken
+	}
+
+	_, err = tx.Exec(`INSERT INTO invitation_redemptions (invitation_id, user_id) VALUES ($1, $2)`, invitationID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to record invitation redemption: %w", err)
+	}
+
+	return nil
+}
+
+type invitationScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanInvitation(row invitationScanner) (*Invitation, error) {
+	var invitation Invitation
+	err := row.Scan(&invitation.ID, &invitation.CodeHint, &invitation.Role, &invitation.Email, &invitation.MaxUses,
+		&invitation.UsedCount, &invitation.Note, &invitation.ExpiresAt, &invitation.RevokedAt, &invitation.CreatedBy, &invitation.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to scan invitation: %w", err)
+	}
+
+	invitation.Status = invitationStatus(&invitation, time.Now())
+	return &invitation, nil
+}
+
+func invitationStatus(invitation *Invitation, now time.Time) string {
+	switch {
+	case invitation.RevokedAt != nil:
+		return "revoked"
+	case invitation.ExpiresAt != nil && !invitation.ExpiresAt.After(now):
+		return "expired"
+	case invitation.UsedCount >= invitation.MaxUses:
+		return "used_up"
+	default:
+		return "active"
+	}
+}
+
+// generateInvitationCode returns a code like K7QX2-MHP4A
+func generateInvitationCode() (string, error) {
+	max := big.NewInt(int64(len(invitationCodeAlphabet)))
+	code := make([]byte, 0, 11)
+	for i := 0; i < 10; i++ {
+		if i == 5 {
+			code = append(code, '-')
+		}
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code = append(code, invitationCodeAlphabet[n.Int64()])
+	}
+	return string(code), nil
+}
+
+// normalizeInvitationCode makes codes typed with lowercase, spaces or without dash match
+func normalizeInvitationCode(code string) string {
+	code = strings.ToUpper(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.Join(strings.Fields(code), "")
+}
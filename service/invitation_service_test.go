@@ -0,0 +1,153 @@
+package service
+
+import (
+	"database/sql/driver"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGenerateInvitationCode(t *testing.T) {
+	format := regexp.MustCompile(`^[` + invitationCodeAlphabet + `]{5}-[` + invitationCodeAlphabet + `]{5}$`)
+
+	seen := make(map[string]bool)
+	for i := 0; i < 50; i++ {
+		code, err := generateInvitationCode()
+		if err != nil {
+			t.Fatalf("Failed to generate code: %v", err)
+		}
+		if !format.MatchString(code) {
+			t.Errorf("Unexpected code format: %s", code)
+		}
+		if seen[code] {
+			t.Errorf("Duplicate code generated: %s", code)
+		}
+		seen[code] = true
+	}
+}
+
+func TestNormalizeInvitationCode(t *testing.T) {
+	want := normalizeInvitationCode("K7QX2-MHP4A")
+	for _, typed := range []string{"k7qx2-mhp4a", "K7QX2MHP4A", " k7qx2 mhp4a "} {
+		if got := normalizeInvitationCode(typed); got != want {
+			t.Errorf("normalizeInvitationCode(%q) = %q, want %q", typed, got, want)
+		}
+	}
+}
+
+func TestInvitationStatus(t *testing.T) {
+	now := time.Now()
+	past := now.Add(-time.Hour)
+	future := now.Add(time.Hour)
+
+	tests := []struct {
+		name       string
+		invitation Invitation
+		want       string
+	}{
+		{"active", Invitation{MaxUses: 3, UsedCount: 2, ExpiresAt: &future}, "active"},
+		{"used up", Invitation{MaxUses: 1, UsedCount: 1, ExpiresAt: &future}, "used_up"},
+		{"expired", Invitation{MaxUses: 1, ExpiresAt: &past}, "expired"},
+		{"revoked wins", Invitation{MaxUses: 1, ExpiresAt: &past, RevokedAt: &past}, "revoked"},
+	}
+
+	for _, tt := range tests {
+		if got := invitationStatus(&tt.invitation, now); got != tt.want {
+			t.Errorf("%s: invitationStatus = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPublicRegistrationIsMahasiswaOnly(t *testing.T) {
+	s := &RegisterService{AllowedEmailDomains: []string{"unair.ac.id"}}
+
+	_, role, err := s.resolveRegistration(nil, "aryo@student.unair.ac.id", "", "")
+	if err != nil || role != "mahasiswa" {
+		t.Errorf("Expected mahasiswa for subdomain email, got %q, %v", role, err)
+	}
+
+	for _, requested := range []string{"admin", "dosen_wali"} {
+		if _, _, err := s.resolveRegistration(nil, "aryo@unair.ac.id", requested, ""); err == nil {
+			t.Errorf("Expected public registration as %s to be refused", requested)
+		}
+	}
+
+	if _, _, err := s.resolveRegistration(nil, "aryo@gmail.com", "mahasiswa", ""); err == nil || !strings.Contains(err.Error(), "domain") {
+		t.Errorf("Expected domain error, got %v", err)
+	}
+	if _, _, err := s.resolveRegistration(nil, "aryo@evilunair.ac.id", "mahasiswa", ""); err == nil {
+		t.Error("Expected domain suffix without dot to be refused")
+	}
+}
+
+func TestRegistrationInvitationRequiresService(t *testing.T) {
+	s := &RegisterService{}
+
+	if _, _, err := s.resolveRegistration(nil, "dosen@unair.ac.id", "dosen_wali", "K7QX2-MHP4A"); err == nil {
+		t.Error("Expected error when invitation codes are not enabled")
+	}
+}
+
+var invitationColumns = []string{"id", "code_hint", "role", "email", "max_uses", "used_count", "note",
+	"expires_at", "revoked_at", "created_by", "created_at"}
+
+func invitationRow(email interface{}, usedCount int64) []driver.Value {
+	return []driver.Value{"inv-1", "MHP4A", "dosen_wali", email, int64(1), usedCount, nil, nil, nil, nil, time.Now()}
+}
+
+func TestRegistrationInvitationForOtherEmailLooksUnknown(t *testing.T) {
+	db, fake := newFakeDB(t)
+	s := &RegisterService{DB: db, InvitationService: NewInvitationService(db)}
+
+	fake.expectQuery("FROM invitation_codes", invitationColumns)
+	unknownErr := s.CreateUser("", "Budi", "budi@unair.ac.id", "123456", "", "K7QX2-MHP4A")
+
+	fake.expectQuery("FROM invitation_codes", invitationColumns, invitationRow("dosen@unair.ac.id", 0))
+	otherEmailErr := s.CreateUser("", "Budi", "budi@unair.ac.id", "123456", "", "K7QX2-MHP4A")
+
+	if !errors.Is(unknownErr, ErrInvalidInvitation) || !errors.Is(otherEmailErr, ErrInvalidInvitation) {
+		t.Errorf("Expected ErrInvalidInvitation for both codes, got %v and %v", unknownErr, otherEmailErr)
+	}
+	var accessErr *RegistrationAccessError
+	if !errors.As(otherEmailErr, &accessErr) {
+		t.Errorf("Expected a RegistrationAccessError, got %T", otherEmailErr)
+	}
+	if len(fake.callsContaining("INSERT INTO users")) != 0 {
+		t.Error("Expected no user to be created")
+	}
+}
+
+func TestRegistrationConcurrentRedeem(t *testing.T) {
+	db, fake := newFakeDB(t)
+	s := &RegisterService{DB: db, InvitationService: NewInvitationService(db)}
+
+	// The code had a use left when read, a concurrent registration took it before the redeem
+	fake.expectQuery("FROM invitation_codes", invitationColumns, invitationRow("dosen@unair.ac.id", 0))
+	fake.expectQuery("SELECT COUNT(*) FROM users", []string{"count"}, []driver.Value{int64(0)})
+	fake.expectExec("INSERT INTO users", 1)
+	fake.expectExec("UPDATE invitation_codes SET used_count", 0)
+
+	err := s.CreateUser("", "Dosen", "dosen@unair.ac.id", "123456", "", "k7qx2mhp4a")
+	if !errors.Is(err, ErrInvitationTaken) {
+		t.Fatalf("Expected ErrInvitationTaken, got %v", err)
+	}
+	if len(fake.callsContaining("COMMIT")) != 0 || len(fake.callsContaining("ROLLBACK")) != 1 {
+		t.Error("Expected the registration to be rolled back")
+	}
+	if len(fake.callsContaining("INSERT INTO invitation_redemptions")) != 0 {
+		t.Error("Expected no redemption to be recorded")
+	}
+}
+
+func TestRegistrationNIMPattern(t *testing.T) {
+	s := &RegisterService{NIMPattern: regexp.MustCompile(`^(?:4342\d{5})$`)}
+
+	if err := s.ValidateUserData("434231027", "Aryo", "aryo@unair.ac.id", "123456", "mahasiswa"); err != nil {
+		t.Errorf("Expected matching NIM to pass, got %v", err)
+	}
+	if err := s.ValidateUserData("12345", "Aryo", "aryo@unair.ac.id", "123456", "mahasiswa"); err == nil || err.Error() != "invalid NIM format" {
+		t.Errorf("Expected invalid NIM format, got %v", err)
+	}
+}
@@ -0,0 +1,544 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"prestasi-mahasiswa/utils"
+
+	"github.com/lib/pq"
+)
+
+// maxRetryDelay caps the exponential backoff between retries of a failed job
+const maxRetryDelay = 6 * time.Hour
+
+// JobFunc is the work of a scheduled job, a returned error or panic fails the run
+type JobFunc func() error
+
+// JobSchedulerService runs registered jobs on their cron schedules. Job state lives in
+// scheduled_jobs so every replica can run the scheduler: a replica takes a lease on a due job
+// before running it and renews it while the job runs, the others skip the job until the lease
+// is released or expires. Each run is recorded in job_runs. A failed scheduled run is retried with exponential backoff up to
+// MaxAttempts, after which the job waits for its next scheduled time.
+type JobSchedulerService struct {
+	DB           *sql.DB
+	Instance     string        // identifies this replica in leases and run history
+	PollInterval time.Duration // how often due jobs are looked for
+	LeaseTime    time.Duration // renewed every third of it while a job runs, jobs not renewed for this long can be started again
+	MaxAttempts  int           // attempts per scheduled run, 1 disables retries
+	RetryBackoff time.Duration // delay before the first retry, doubled for each further one
+
+	mu   sync.Mutex
+	jobs map[string]*registeredJob
+}
+
+type registeredJob struct {
+	Name        string
+	Description string
+	Schedule    string
+	cron        *utils.CronSchedule
+	run         JobFunc
+}
+
+type ScheduledJob struct {
+	Name           string     `json:"name"`
+	Description    string     `json:"description"`
+	Schedule       string     `json:"schedule"`
+	IsPaused       bool       `json:"is_paused"`
+	IsRunning      bool       `json:"is_running"`
+	NextRunAt      *time.Time `json:"next_run_at"`
+	FailedAttempts int        `json:"failed_attempts"` // failures of the current scheduled run, retries pending
+	LastRun        *JobRun    `json:"last_run,omitempty"`
+}
+
+type JobRun struct {
+	ID          string     `json:"id"`
+	JobName     string     `json:"job_name"`
+	Status      string     `json:"status"` // running, succeeded, failed
+	Attempt     int        `json:"attempt"`
+	TriggeredBy *string    `json:"triggered_by,omitempty"` // admin who ran the job manually
+	Instance    string     `json:"instance"`
+	Error       *string    `json:"error,omitempty"`
+	StartedAt   time.Time  `json:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+}
+
+func NewJobSchedulerService(db *sql.DB) *JobSchedulerService {
+	hostname, _ := os.Hostname()
+	return &JobSchedulerService{
+		DB:           db,
+		Instance:     fmt.Sprintf("%s:%d", hostname, os.Getpid()),
+		PollInterval: 30 * time.Second,
+		LeaseTime:    3 * time.Minute,
+		MaxAttempts:  3,
+		RetryBackoff: time.Minute,
+		jobs:         make(map[string]*registeredJob),
+	}
+}
+
+// Register adds a job, to be called before Start. The schedule is a cron expression,
+// see utils.ParseCron.
+func (s *JobSchedulerService) Register(name, description, schedule string, run JobFunc) error {
+	cron, err := utils.ParseCron(schedule)
+	if err != nil {
+		return fmt.Errorf("invalid schedule for job %s: %w", name, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.jobs[name]; exists {
+		return fmt.Errorf("job %s is already registered", name)
+	}
+	s.jobs[name] = &registeredJob{Name: name, Description: description, Schedule: schedule, cron: cron, run: run}
+	return nil
+}
+
+// Start saves the registered jobs and runs due jobs every PollInterval until stop is closed.
+// Rows of jobs this replica doesn't register are left alone: another build may still run them
+// during a rolling deploy, or they are only registered with an optional feature enabled.
+func (s *JobSchedulerService) Start(stop <-chan struct{}) error {
+	for _, job := range s.registeredJobs() {
+		if err := s.saveJob(job); err != nil {
+			return err
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(s.PollInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				s.runDueJobs()
+			case <-stop:
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+// saveJob creates the row of a job, a changed schedule takes effect from now
+func (s *JobSchedulerService) saveJob(job *registeredJob) error {
+	_, err := s.DB.Exec(`
+		INSERT INTO scheduled_jobs (name, description, schedule, next_run_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (name) DO UPDATE SET
+			description = EXCLUDED.description,
+			schedule = EXCLUDED.schedule,
+			next_run_at = CASE WHEN scheduled_jobs.schedule <> EXCLUDED.schedule OR scheduled_jobs.next_run_at IS NULL
+				THEN EXCLUDED.next_run_at ELSE scheduled_jobs.next_run_at END,
+			updated_at = CURRENT_TIMESTAMP
+	`, job.Name, job.Description, job.Schedule, nullTime(job.cron.Next(time.Now())))
+	if err != nil {
+		return fmt.Errorf("failed to save job %s: %w", job.Name, err)
+	}
+	return nil
+}
+
+func (s *JobSchedulerService) runDueJobs() {
+	for _, job := range s.registeredJobs() {
+		var failedAttempts int
+		err := s.DB.QueryRow(`
+			UPDATE scheduled_jobs
+			SET locked_by = $2, locked_until = CURRENT_TIMESTAMP + ($3 * INTERVAL '1 second')
+			WHERE name = $1 AND is_paused = false AND next_run_at <= CURRENT_TIMESTAMP
+			  AND (locked_until IS NULL OR locked_until < CURRENT_TIMESTAMP)
+			RETURNING failed_attempts
+		`, job.Name, s.Instance, int64(s.LeaseTime.Seconds())).Scan(&failedAttempts)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			fmt.Printf("Warning: failed to lock job %s: %v\n", job.Name, err)
+			continue
+		}
+
+		runID, err := s.startRun(job.Name, failedAttempts+1, "")
+		if err != nil {
+			fmt.Printf("Warning: %v\n", err)
+			s.releaseJob(job.Name)
+			continue
+		}
+		s.finishScheduledRun(job, runID, failedAttempts+1, s.runWithLease(job.Name, runID, job.run))
+	}
+}
+
+// TriggerJob runs a job now, in the background, whether it is paused or not. The job's
+// schedule and pending retries are left as they are.
+func (s *JobSchedulerService) TriggerJob(name, userID string) (*JobRun, error) {
+	job := s.registeredJob(name)
+	if job == nil {
+		return nil, errors.New("job not found")
+	}
+
+	result, err := s.DB.Exec(`
+		UPDATE scheduled_jobs
+		SET locked_by = $2, locked_until = CURRENT_TIMESTAMP + ($3 * INTERVAL '1 second')
+		WHERE name = $1 AND (locked_until IS NULL OR locked_until < CURRENT_TIMESTAMP)
+	`, name, s.Instance, int64(s.LeaseTime.Seconds()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock job: %w", err)
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return nil, errors.New("job is already running")
+	}
+
+	runID, err := s.startRun(name, 1, userID)
+	if err != nil {
+		s.releaseJob(name)
+		return nil, err
+	}
+
+	go func() {
+		jobErr := s.runWithLease(name, runID, job.run)
+		s.finishRun(runID, jobErr)
+		s.releaseJob(name)
+	}()
+
+	return s.getRun(runID)
+}
+
+// SetPaused pauses or resumes the schedule of a job, a resumed job next runs at its next scheduled time
+func (s *JobSchedulerService) SetPaused(name string, paused bool) (*ScheduledJob, error) {
+	job := s.registeredJob(name)
+	if job == nil {
+		return nil, errors.New("job not found")
+	}
+
+	_, err := s.DB.Exec(`
+		UPDATE scheduled_jobs
+		SET is_paused = $2, failed_attempts = 0,
+			next_run_at = CASE WHEN $2 THEN next_run_at ELSE $3 END,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE name = $1
+	`, name, paused, nullTime(job.cron.Next(time.Now())))
+	if err != nil {
+		return nil, fmt.Errorf("failed to update job: %w", err)
+	}
+
+	jobs, err := s.getJobs([]string{name})
+	if err != nil {
+		return nil, err
+	}
+	if len(jobs) == 0 {
+		return nil, errors.New("job not found")
+	}
+	return &jobs[0], nil
+}
+
+// GetJobs lists the registered jobs with their state and last run
+func (s *JobSchedulerService) GetJobs() ([]ScheduledJob, error) {
+	var names []string
+	for _, job := range s.registeredJobs() {
+		names = append(names, job.Name)
+	}
+	return s.getJobs(names)
+}
+
+// GetJobRuns lists the latest runs of a job, newest first
+func (s *JobSchedulerService) GetJobRuns(name string, limit int) ([]JobRun, error) {
+	if s.registeredJob(name) == nil {
+		return nil, errors.New("job not found")
+	}
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+
+	rows, err := s.DB.Query(jobRunSelect+` WHERE job_name = $1 ORDER BY started_at DESC LIMIT $2`, name, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job runs: %w", err)
+	}
+	defer rows.Close()
+
+	runs := []JobRun{}
+	for rows.Next() {
+		run, err := scanJobRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, *run)
+	}
+	return runs, rows.Err()
+}
+
+// CleanupJobRuns removes run history older than 30 days
+func (s *JobSchedulerService) CleanupJobRuns() error {
+	result, err := s.DB.Exec(`DELETE FROM job_runs WHERE started_at < CURRENT_TIMESTAMP - INTERVAL '30 days' AND status <> 'running'`)
+	if err != nil {
+		return fmt.Errorf("failed to cleanup job runs: %w", err)
+	}
+
+	rowsDeleted, _ := result.RowsAffected()
+	fmt.Printf("Cleaned up %d old job runs\n", rowsDeleted)
+
+	return nil
+}
+
+func (s *JobSchedulerService) getJobs(names []string) ([]ScheduledJob, error) {
+	rows, err := s.DB.Query(`
+		SELECT j.name, j.description, j.schedule, j.is_paused,
+		       COALESCE(j.locked_until > CURRENT_TIMESTAMP, false), j.next_run_at, j.failed_attempts,
+		       r.id, r.job_name, r.status, r.attempt, r.triggered_by, r.instance, r.error, r.started_at, r.finished_at
+		FROM scheduled_jobs j
+		LEFT JOIN LATERAL (
+			SELECT * FROM job_runs WHERE job_name = j.name ORDER BY started_at DESC LIMIT 1
+		) r ON true
+		WHERE j.name = ANY($1)
+		ORDER BY j.name
+	`, pq.Array(names))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get jobs: %w", err)
+	}
+	defer rows.Close()
+
+	jobs := []ScheduledJob{}
+	for rows.Next() {
+		var job ScheduledJob
+		var runID, runJobName, runStatus, runInstance sql.NullString
+		var runAttempt sql.NullInt64
+		var runStartedAt sql.NullTime
+		var run JobRun
+		err := rows.Scan(&job.Name, &job.Description, &job.Schedule, &job.IsPaused, &job.IsRunning, &job.NextRunAt,
+			&job.FailedAttempts, &runID, &runJobName, &runStatus, &runAttempt, &run.TriggeredBy, &runInstance,
+			&run.Error, &runStartedAt, &run.FinishedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan job: %w", err)
+		}
+		if runID.Valid {
+			run.ID, run.JobName, run.Status = runID.String, runJobName.String, runStatus.String
+			run.Attempt, run.Instance, run.StartedAt = int(runAttempt.Int64), runInstance.String, runStartedAt.Time
+			job.LastRun = &run
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// startRun records a run. Earlier runs still marked running whose replica stopped sending
+// heartbeats for a lease time were interrupted, e.g. by a crash.
+func (s *JobSchedulerService) startRun(name string, attempt int, triggeredBy string) (string, error) {
+	_, err := s.DB.Exec(`
+		UPDATE job_runs SET status = 'failed', error = 'interrupted', finished_at = CURRENT_TIMESTAMP
+		WHERE job_name = $1 AND status = 'running'
+		  AND COALESCE(heartbeat_at, started_at) < CURRENT_TIMESTAMP - ($2 * INTERVAL '1 second')
+	`, name, int64(s.LeaseTime.Seconds()))
+	if err != nil {
+		return "", fmt.Errorf("failed to record run of job %s: %w", name, err)
+	}
+
+	var runID string
+	err = s.DB.QueryRow(`
+		INSERT INTO job_runs (job_name, attempt, triggered_by, instance)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`, name, attempt, nullIfEmpty(triggeredBy), s.Instance).Scan(&runID)
+	if err != nil {
+		return "", fmt.Errorf("failed to record run of job %s: %w", name, err)
+	}
+	return runID, nil
+}
+
+// runWithLease runs a job while renewing the lease on it and the heartbeat of its run
+func (s *JobSchedulerService) runWithLease(name, runID string, run JobFunc) error {
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(s.LeaseTime / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				s.renewLease(name, runID)
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	err := runJob(run)
+	close(stop)
+	<-stopped
+	return err
+}
+
+// renewLease extends the lease on a job held by this replica and records a heartbeat of its run
+func (s *JobSchedulerService) renewLease(name, runID string) {
+	result, err := s.DB.Exec(`
+		WITH lease AS (
+			UPDATE scheduled_jobs SET locked_until = CURRENT_TIMESTAMP + ($3 * INTERVAL '1 second')
+			WHERE name = $1 AND locked_by = $2
+			RETURNING name
+		)
+		UPDATE job_runs SET heartbeat_at = CURRENT_TIMESTAMP
+		WHERE id = $4 AND EXISTS (SELECT 1 FROM lease)
+	`, name, s.Instance, int64(s.LeaseTime.Seconds()), runID)
+	if err != nil {
+		fmt.Printf("Warning: failed to renew lease on job %s: %v\n", name, err)
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		fmt.Printf("Warning: lost lease on job %s while it is running\n", name)
+	}
+}
+
+func (s *JobSchedulerService) finishRun(runID string, jobErr error) {
+	status, errorMessage := "succeeded", ""
+	if jobErr != nil {
+		status, errorMessage = "failed", jobErr.Error()
+	}
+
+	_, err := s.DB.Exec(`
+		UPDATE job_runs SET status = $2, error = $3, finished_at = CURRENT_TIMESTAMP WHERE id = $1
+	`, runID, status, nullIfEmpty(errorMessage))
+	if err != nil {
+		fmt.Printf("Warning: failed to record job run result: %v\n", err)
+	}
+}
+
+// finishScheduledRun records the result of a scheduled run, schedules the retry or next run and releases the job
+func (s *JobSchedulerService) finishScheduledRun(job *registeredJob, runID string, attempt int, jobErr error) {
+	s.finishRun(runID, jobErr)
+	if jobErr != nil {
+		fmt.Printf("Warning: job %s failed (attempt %d of %d): %v\n", job.Name, attempt, s.MaxAttempts, jobErr)
+	}
+
+	nextRunAt, failedAttempts := nextJobRun(job.cron, time.Now(), attempt, s.MaxAttempts, s.RetryBackoff, jobErr != nil)
+	_, err := s.DB.Exec(`
+		UPDATE scheduled_jobs
+		SET next_run_at = $2, failed_attempts = $3, locked_by = NULL, locked_until = NULL, updated_at = CURRENT_TIMESTAMP
+		WHERE name = $1 AND locked_by = $4
+	`, job.Name, nullTime(nextRunAt), failedAttempts, s.Instance)
+	if err != nil {
+		fmt.Printf("Warning: failed to schedule job %s: %v\n", job.Name, err)
+	}
+}
+
+func (s *JobSchedulerService) releaseJob(name string) {
+	_, err := s.DB.Exec(`
+		UPDATE scheduled_jobs SET locked_by = NULL, locked_until = NULL WHERE name = $1 AND locked_by = $2
+	`, name, s.Instance)
+	if err != nil {
+		fmt.Printf("Warning: failed to release job %s: %v\n", name, err)
+	}
+}
+
+const jobRunSelect = `
+	SELECT id, job_name, status, attempt, triggered_by, instance, error, started_at, finished_at
+	FROM job_runs
+`
+
+func (s *JobSchedulerService) getRun(id string) (*JobRun, error) {
+	rows, err := s.DB.Query(jobRunSelect+` WHERE id = $1`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job run: %w", err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, errors.New("job run not found")
+	}
+	return scanJobRun(rows)
+}
+
+func scanJobRun(rows *sql.Rows) (*JobRun, error) {
+	var run JobRun
+	err := rows.Scan(&run.ID, &run.JobName, &run.Status, &run.Attempt, &run.TriggeredBy, &run.Instance,
+		&run.Error, &run.StartedAt, &run.FinishedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan job run: %w", err)
+	}
+	return &run, nil
+}
+
+func (s *JobSchedulerService) registeredJob(name string) *registeredJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.jobs[name]
+}
+
+// registeredJobs returns the jobs sorted by name
+func (s *JobSchedulerService) registeredJobs() []*registeredJob {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	jobs := make([]*registeredJob, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		jobs = append(jobs, job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Name < jobs[j].Name })
+	return jobs
+}
+
+// runJob calls run, turning a panic into an error so one broken job can't stop the scheduler
+func runJob(run JobFunc) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("job panicked: %v", recovered)
+		}
+	}()
+	return run()
+}
+
+// nextJobRun returns when a job runs next after a scheduled attempt and the failures to
+// remember. A failed attempt is retried after backoff doubling per attempt, the last attempt
+// or a success moves on to the next scheduled time.
+func nextJobRun(cron *utils.CronSchedule, now time.Time, attempt, maxAttempts int, backoff time.Duration, failed bool) (time.Time, int) {
+	if !failed || attempt >= maxAttempts {
+		return cron.Next(now), 0
+	}
+
+	delay := backoff
+	for i := 1; i < attempt && delay < maxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxRetryDelay {
+		delay = maxRetryDelay
+	}
+
+	retryAt := now.Add(delay)
+	// No point retrying after the next scheduled run
+	if next := cron.Next(now); !next.IsZero() && next.Before(retryAt) {
+		return next, 0
+	}
+	return retryAt, attempt
+}
+
+// ParseJobSchedules parses schedule overrides written as name=cron pairs separated by
+// semicolons, e.g. "refresh-token-cleanup=0 3 * * *;verification-sla=@hourly"
+func ParseJobSchedules(value string) (map[string]string, error) {
+	schedules := make(map[string]string)
+	for _, pair := range strings.Split(value, ";") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, schedule, ok := strings.Cut(pair, "=")
+		name, schedule = strings.TrimSpace(name), strings.TrimSpace(schedule)
+		if !ok || name == "" || schedule == "" {
+			return nil, fmt.Errorf("invalid job schedule %q, expected name=cron", pair)
+		}
+		if _, err := utils.ParseCron(schedule); err != nil {
+			return nil, fmt.Errorf("invalid schedule for job %s: %w", name, err)
+		}
+		schedules[name] = schedule
+	}
+	return schedules, nil
+}
+
+// nullTime turns the zero time, a schedule that never matches, into NULL
+func nullTime(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t
+}
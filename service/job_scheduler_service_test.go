@@ -0,0 +1,144 @@
+package service
+
+import (
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"prestasi-mahasiswa/utils"
+)
+
+func TestNextJobRun(t *testing.T) {
+	daily, _ := utils.ParseCron("0 3 * * *")
+	now := time.Date(2024, 5, 15, 10, 0, 0, 0, time.UTC)
+	nextDay := time.Date(2024, 5, 16, 3, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name           string
+		attempt        int
+		failed         bool
+		wantRunAt      time.Time
+		wantFailedRuns int
+	}{
+		{"success", 1, false, nextDay, 0},
+		{"first failure", 1, true, now.Add(time.Minute), 1},
+		{"second failure", 2, true, now.Add(2 * time.Minute), 2},
+		{"last attempt", 3, true, nextDay, 0},
+	}
+
+	for _, tt := range tests {
+		runAt, failedAttempts := nextJobRun(daily, now, tt.attempt, 3, time.Minute, tt.failed)
+		if !runAt.Equal(tt.wantRunAt) || failedAttempts != tt.wantFailedRuns {
+			t.Errorf("%s: got %v, %d, want %v, %d", tt.name, runAt, failedAttempts, tt.wantRunAt, tt.wantFailedRuns)
+		}
+	}
+
+	// A retry later than the next scheduled run is replaced by it
+	everyMinute, _ := utils.ParseCron("* * * * *")
+	runAt, failedAttempts := nextJobRun(everyMinute, now, 1, 3, time.Hour, true)
+	if !runAt.Equal(now.Add(time.Minute)) || failedAttempts != 0 {
+		t.Errorf("Expected the next scheduled run instead of a retry, got %v, %d", runAt, failedAttempts)
+	}
+
+	// Backoff is capped
+	yearly, _ := utils.ParseCron("@yearly")
+	runAt, _ = nextJobRun(yearly, now, 20, 30, time.Hour, true)
+	if runAt.Sub(now) != maxRetryDelay {
+		t.Errorf("Expected retry delay to be capped at %v, got %v", maxRetryDelay, runAt.Sub(now))
+	}
+}
+
+func TestRunJobRecoversPanic(t *testing.T) {
+	if err := runJob(func() error { panic("boom") }); err == nil {
+		t.Error("Expected a panicking job to fail")
+	}
+	jobErr := errors.New("database unavailable")
+	if err := runJob(func() error { return jobErr }); err != jobErr {
+		t.Errorf("Expected job error to be returned, got %v", err)
+	}
+}
+
+func TestRegisterJob(t *testing.T) {
+	scheduler := NewJobSchedulerService(nil)
+	noop := func() error { return nil }
+
+	if err := scheduler.Register("cleanup", "", "@daily", noop); err != nil {
+		t.Fatalf("Expected job to register: %v", err)
+	}
+	if err := scheduler.Register("cleanup", "", "@hourly", noop); err == nil {
+		t.Error("Expected duplicate job to be refused")
+	}
+	if err := scheduler.Register("broken", "", "every day", noop); err == nil {
+		t.Error("Expected invalid schedule to be refused")
+	}
+	if scheduler.registeredJob("cleanup") == nil || scheduler.registeredJob("broken") != nil {
+		t.Error("Unexpected registered jobs")
+	}
+}
+
+func TestParseJobSchedules(t *testing.T) {
+	schedules, err := ParseJobSchedules(" refresh-token-cleanup=0 3 * * * ; verification-sla=@hourly;")
+	if err != nil {
+		t.Fatalf("Expected schedules to parse: %v", err)
+	}
+	if len(schedules) != 2 || schedules["refresh-token-cleanup"] != "0 3 * * *" || schedules["verification-sla"] != "@hourly" {
+		t.Errorf("Unexpected schedules: %v", schedules)
+	}
+
+	for _, value := range []string{"refresh-token-cleanup", "=@daily", "verification-sla=sometimes"} {
+		if _, err := ParseJobSchedules(value); err == nil {
+			t.Errorf("Expected %q to be refused", value)
+		}
+	}
+}
+
+func TestRunWithLeaseRenewsLease(t *testing.T) {
+	db, fake := newFakeDB(t)
+	fake.allowExec("WITH lease AS", 1)
+
+	scheduler := NewJobSchedulerService(db)
+	scheduler.LeaseTime = 30 * time.Millisecond
+
+	// The job outlives its lease, the heartbeat keeps other replicas from taking it over
+	err := scheduler.runWithLease("report-export", "run-1", func() error {
+		time.Sleep(100 * time.Millisecond)
+		return errors.New("export failed")
+	})
+	if err == nil || err.Error() != "export failed" {
+		t.Errorf("Expected the job error, got %v", err)
+	}
+
+	renewals := fake.callsContaining("WITH lease AS")
+	if len(renewals) < 2 {
+		t.Fatalf("Expected the lease to be renewed while the job runs, got %d renewals", len(renewals))
+	}
+	args := renewals[0].Args
+	if args[0] != "report-export" || args[1] != scheduler.Instance || args[3] != "run-1" {
+		t.Errorf("Expected the lease of this replica and run to be renewed, got %v", args)
+	}
+
+	// No renewals after the job finished
+	time.Sleep(50 * time.Millisecond)
+	if after := fake.callsContaining("WITH lease AS"); len(after) != len(renewals) {
+		t.Errorf("Expected renewals to stop with the job, got %d more", len(after)-len(renewals))
+	}
+}
+
+func TestStartRunOnlyInterruptsStaleRuns(t *testing.T) {
+	db, fake := newFakeDB(t)
+	fake.expectExec("error = 'interrupted'", 0)
+	fake.expectQuery("INSERT INTO job_runs", []string{"id"}, []driver.Value{"run-2"})
+
+	scheduler := NewJobSchedulerService(db)
+	runID, err := scheduler.startRun("report-export", 1, "")
+	if err != nil || runID != "run-2" {
+		t.Fatalf("startRun() = %q, %v", runID, err)
+	}
+
+	interrupt := fake.callsContaining("error = 'interrupted'")[0]
+	if !strings.Contains(interrupt.Query, "heartbeat_at") || interrupt.Args[1] != int64(scheduler.LeaseTime.Seconds()) {
+		t.Errorf("Expected only runs without a heartbeat for a lease time to be interrupted, got %v", interrupt.Args)
+	}
+}
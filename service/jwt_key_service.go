@@ -0,0 +1,416 @@
+package service
+
+import (
+	"crypto"
+	"crypto/x509"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"prestasi-mahasiswa/utils"
+)
+
+// JWTKeyService stores asymmetric token signing keys and rotates them on schedule.
+// Retired public keys stay published until every token they signed has expired.
+// Private keys are stored encrypted with KeyBox.
+type JWTKeyService struct {
+	DB               *sql.DB
+	KeyBox           *utils.SecretBox
+	Algorithm        string
+	RotationInterval time.Duration
+	RetentionPeriod  time.Duration // longest token lifetime, refresh tokens live 7 days
+	CacheTTL         time.Duration
+
+	mu                sync.Mutex
+	signingKey        *utils.JWTSigningKey
+	signingKeyCreated time.Time
+	verificationKeys  map[string]*utils.JWTVerificationKey
+	loadedAt          time.Time
+}
+
+type JWTKey struct {
+	KeyID     string     `json:"kid"`
+	Algorithm string     `json:"algorithm"`
+	Status    string     `json:"status"` // active, retired
+	CreatedAt time.Time  `json:"created_at"`
+	RetiredAt *time.Time `json:"retired_at,omitempty"`
+}
+
+func NewJWTKeyService(db *sql.DB, keyBox *utils.SecretBox, algorithm string, rotationInterval time.Duration) *JWTKeyService {
+	return &JWTKeyService{
+		DB:               db,
+		KeyBox:           keyBox,
+		Algorithm:        algorithm,
+		RotationInterval: rotationInterval,
+		RetentionPeriod:  8 * 24 * time.Hour,
+		CacheTTL:         time.Minute,
+		verificationKeys: make(map[string]*utils.JWTVerificationKey),
+	}
+}
+
+// Enabled reports whether tokens are signed with asymmetric keys
+func (s *JWTKeyService) Enabled() bool {
+	return utils.IsAsymmetricJWTAlgorithm(s.Algorithm)
+}
+
+// CurrentSigningKey returns the active key, rotating it when older than RotationInterval
+func (s *JWTKeyService) CurrentSigningKey() (*utils.JWTSigningKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if time.Since(s.loadedAt) >= s.CacheTTL {
+		if err := s.loadKeys(); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.signingKey != nil && s.signingKey.Algorithm == s.Algorithm &&
+		(s.RotationInterval <= 0 || time.Since(s.signingKeyCreated) < s.RotationInterval) {
+		return s.signingKey, nil
+	}
+
+	// Scheduled rotation, only the replica that still sees the old key as active rotates it
+	expectedKeyID := ""
+	if s.signingKey != nil {
+		expectedKeyID = s.signingKey.KeyID
+	}
+	if _, err := s.rotateKey(expectedKeyID); err != nil {
+		return nil, err
+	}
+
+	if err := s.loadKeys(); err != nil {
+		return nil, err
+	}
+	if s.signingKey == nil {
+		return nil, errors.New("no active JWT signing key")
+	}
+
+	return s.signingKey, nil
+}
+
+// VerificationKey returns the public key for a kid, reloading once for keys created by other replicas
+func (s *JWTKeyService) VerificationKey(kid string) (*utils.JWTVerificationKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if key, ok := s.verificationKeys[kid]; ok && time.Since(s.loadedAt) < s.CacheTTL {
+		return key, nil
+	}
+
+	// Unknown kids reload at most once per second so random kids can't flood the database
+	if time.Since(s.loadedAt) >= time.Second {
+		if err := s.loadKeys(); err != nil {
+			return nil, err
+		}
+	}
+
+	key, ok := s.verificationKeys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key: %s", kid)
+	}
+
+	return key, nil
+}
+
+// LegacyHS256Switchover returns when the first asymmetric key was created, which is when HS256
+// signing stopped. Before any key exists the switch is now.
+func (s *JWTKeyService) LegacyHS256Switchover() (time.Time, error) {
+	var firstKeyCreated sql.NullTime
+	err := s.DB.QueryRow("SELECT MIN(created_at) FROM jwt_signing_keys").Scan(&firstKeyCreated)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to get first JWT signing key: %w", err)
+	}
+
+	if !firstKeyCreated.Valid {
+		return time.Now(), nil
+	}
+	return firstKeyCreated.Time, nil
+}
+
+// GetJWKS returns active and recently retired verification keys in JWK set format
+func (s *JWTKeyService) GetJWKS() (*utils.JWKSet, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if time.Since(s.loadedAt) >= s.CacheTTL {
+		if err := s.loadKeys(); err != nil {
+			return nil, err
+		}
+	}
+
+	keySet := &utils.JWKSet{Keys: []utils.JWK{}}
+	for _, key := range s.verificationKeys {
+		jwk, err := utils.NewJWK(*key)
+		if err != nil {
+			return nil, err
+		}
+		keySet.Keys = append(keySet.Keys, jwk)
+	}
+
+	sort.Slice(keySet.Keys, func(i, j int) bool {
+		return keySet.Keys[i].Kid < keySet.Keys[j].Kid
+	})
+
+	return keySet, nil
+}
+
+// GetKeys lists token signing keys, newest first
+func (s *JWTKeyService) GetKeys() ([]JWTKey, error) {
+	query := `
+		SELECT kid, algorithm, status, created_at, retired_at
+		FROM jwt_signing_keys
+		ORDER BY created_at DESC
+	`
+
+	rows, err := s.DB.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get JWT signing keys: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []JWTKey
+	for rows.Next() {
+		var key JWTKey
+		if err := rows.Scan(&key.KeyID, &key.Algorithm, &key.Status, &key.CreatedAt, &key.RetiredAt); err != nil {
+			return nil, fmt.Errorf("failed to scan JWT signing key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// RotateKey retires the active signing key immediately and creates a new one
+func (s *JWTKeyService) RotateKey() (*JWTKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key, err := s.rotateKey("")
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nil, errors.New("JWT signing key was rotated concurrently, try again")
+	}
+
+	if err := s.loadKeys(); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// rotateKey must be called with the lock held. When expectedKeyID is set, rotation is skipped
+// if another replica already replaced that key.
+func (s *JWTKeyService) rotateKey(expectedKeyID string) (*JWTKey, error) {
+	if !s.Enabled() {
+		return nil, fmt.Errorf("asymmetric JWT signing is not enabled (algorithm %s)", s.Algorithm)
+	}
+
+	signingKey, err := utils.GenerateJWTSigningKey(s.Algorithm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate JWT signing key: %w", err)
+	}
+
+	publicKey, err := x509.MarshalPKIXPublicKey(signingKey.PrivateKey.Public())
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode public key: %w", err)
+	}
+	privateKey, err := x509.MarshalPKCS8PrivateKey(signingKey.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode private key: %w", err)
+	}
+	sealedPrivateKey, err := s.sealPrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Retired private keys are wiped, they are never needed again
+	retireQuery := `
+		UPDATE jwt_signing_keys
+		SET status = 'retired', retired_at = CURRENT_TIMESTAMP, private_key = NULL
+		WHERE status = 'active'
+	`
+	args := []interface{}{}
+	if expectedKeyID != "" {
+		retireQuery += " AND kid = $1"
+		args = append(args, expectedKeyID)
+	}
+
+	result, err := tx.Exec(retireQuery, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retire JWT signing key: %w", err)
+	}
+	if expectedKeyID != "" {
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			return nil, nil // Already rotated elsewhere
+		}
+	}
+
+	key := &JWTKey{
+		KeyID:     signingKey.KeyID,
+		Algorithm: signingKey.Algorithm,
+		Status:    "active",
+	}
+
+	err = tx.QueryRow(`
+		INSERT INTO jwt_signing_keys (kid, algorithm, public_key, private_key, private_key_encrypted, status)
+		VALUES ($1, $2, $3, $4, TRUE, 'active')
+		RETURNING created_at
+	`, key.KeyID, key.Algorithm, base64.StdEncoding.EncodeToString(publicKey), sealedPrivateKey).Scan(&key.CreatedAt)
+	if err != nil {
+		// A concurrent first key creation is resolved by the unique active index
+		if expectedKeyID == "" && s.signingKey == nil {
+			fmt.Printf("Warning: failed to create JWT signing key: %v\n", err)
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to store JWT signing key: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit key rotation: %w", err)
+	}
+
+	return key, nil
+}
+
+// loadKeys must be called with the lock held
+func (s *JWTKeyService) loadKeys() error {
+	query := `
+		SELECT kid, algorithm, public_key, COALESCE(private_key, ''), private_key_encrypted, status, created_at
+		FROM jwt_signing_keys
+		WHERE status = 'active' OR retired_at > CURRENT_TIMESTAMP - ($1 * INTERVAL '1 second')
+	`
+
+	rows, err := s.DB.Query(query, s.RetentionPeriod.Seconds())
+	if err != nil {
+		return fmt.Errorf("failed to load JWT signing keys: %w", err)
+	}
+	defer rows.Close()
+
+	verificationKeys := make(map[string]*utils.JWTVerificationKey)
+	var signingKey *utils.JWTSigningKey
+	var signingKeyCreated time.Time
+	signingKeyPlaintext := false
+
+	for rows.Next() {
+		var kid, algorithm, encodedPublicKey, encodedPrivateKey, status string
+		var privateKeyEncrypted bool
+		var createdAt time.Time
+		if err := rows.Scan(&kid, &algorithm, &encodedPublicKey, &encodedPrivateKey, &privateKeyEncrypted, &status, &createdAt); err != nil {
+			return fmt.Errorf("failed to scan JWT signing key: %w", err)
+		}
+
+		publicKey, err := decodePublicKey(encodedPublicKey)
+		if err != nil {
+			return fmt.Errorf("invalid public key %s: %w", kid, err)
+		}
+		verificationKeys[kid] = &utils.JWTVerificationKey{KeyID: kid, Algorithm: algorithm, PublicKey: publicKey}
+
+		if status == "active" && encodedPrivateKey != "" {
+			if privateKeyEncrypted {
+				if s.KeyBox == nil {
+					return errors.New("JWT key encryption key is not configured")
+				}
+				if encodedPrivateKey, err = s.KeyBox.Open(encodedPrivateKey); err != nil {
+					return fmt.Errorf("invalid private key %s: %w", kid, err)
+				}
+			}
+			privateKey, err := decodePrivateKey(encodedPrivateKey)
+			if err != nil {
+				return fmt.Errorf("invalid private key %s: %w", kid, err)
+			}
+			signingKey = &utils.JWTSigningKey{KeyID: kid, Algorithm: algorithm, PrivateKey: privateKey}
+			signingKeyCreated = createdAt
+			signingKeyPlaintext = !privateKeyEncrypted
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to load JWT signing keys: %w", err)
+	}
+	rows.Close()
+
+	// A key stored before private keys were encrypted is encrypted on first load
+	if signingKeyPlaintext {
+		if err := s.encryptStoredKey(signingKey); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+	}
+
+	s.verificationKeys = verificationKeys
+	s.signingKey = signingKey
+	s.signingKeyCreated = signingKeyCreated
+	s.loadedAt = time.Now()
+
+	return nil
+}
+
+// sealPrivateKey encrypts a PKCS#8 private key for storage
+func (s *JWTKeyService) sealPrivateKey(der []byte) (string, error) {
+	if s.KeyBox == nil {
+		return "", errors.New("JWT key encryption key is not configured")
+	}
+
+	sealed, err := s.KeyBox.Seal(base64.StdEncoding.EncodeToString(der))
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt private key: %w", err)
+	}
+	return sealed, nil
+}
+
+// encryptStoredKey replaces a plaintext private key in the database with its encrypted form
+func (s *JWTKeyService) encryptStoredKey(key *utils.JWTSigningKey) error {
+	der, err := x509.MarshalPKCS8PrivateKey(key.PrivateKey)
+	if err != nil {
+		return fmt.Errorf("failed to encode private key %s: %w", key.KeyID, err)
+	}
+	sealed, err := s.sealPrivateKey(der)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.DB.Exec(`
+		UPDATE jwt_signing_keys SET private_key = $2, private_key_encrypted = TRUE
+		WHERE kid = $1 AND private_key_encrypted = FALSE
+	`, key.KeyID, sealed)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt private key %s: %w", key.KeyID, err)
+	}
+	return nil
+}
+
+func decodePublicKey(encoded string) (crypto.PublicKey, error) {
+	der, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+	return x509.ParsePKIXPublicKey(der)
+}
+
+func decodePrivateKey(encoded string) (crypto.Signer, error) {
+	der, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	privateKey, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, ok := privateKey.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("private key cannot sign")
+	}
+	return signer, nil
+}
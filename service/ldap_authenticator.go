@@ -0,0 +1,269 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"prestasi-mahasiswa/utils"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// LDAPAttributeMapping names the directory attributes read for a user, empty skips the attribute
+type LDAPAttributeMapping struct {
+	Email string
+	Name  string
+	NIM   string
+	NIP   string
+}
+
+// DefaultLDAPAttributeMapping returns the inetOrgPerson attribute names, NIM and NIP have no standard attribute
+func DefaultLDAPAttributeMapping() LDAPAttributeMapping {
+	return LDAPAttributeMapping{
+		Email: "mail",
+		Name:  "cn",
+	}
+}
+
+// LDAPRoleRule assigns Role to directory users whose Attribute has Value (case-insensitive)
+type LDAPRoleRule struct {
+	Attribute string
+	Value     string
+	Role      string
+}
+
+// ParseLDAPRoleRules reads rules written as attribute=value:role separated by semicolons, e.g.
+// memberOf=cn=dosen,ou=groups,dc=unair,dc=ac,dc=id:dosen_wali;employeeType=student:mahasiswa.
+// Roles must be one of knownRoles, DefaultRoleNames when none are given.
+func ParseLDAPRoleRules(spec string, knownRoles ...string) ([]LDAPRoleRule, error) {
+	if len(knownRoles) == 0 {
+		knownRoles = DefaultRoleNames
+	}
+
+	var rules []LDAPRoleRule
+	for _, part := range strings.Split(spec, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		separator := strings.LastIndex(part, ":")
+		equals := strings.Index(part, "=")
+		if separator < 0 || equals <= 0 || equals > separator {
+			return nil, fmt.Errorf("invalid LDAP role rule %q, expected attribute=value:role", part)
+		}
+
+		rule := LDAPRoleRule{
+			Attribute: strings.TrimSpace(part[:equals]),
+			Value:     strings.TrimSpace(part[equals+1 : separator]),
+			Role:      strings.TrimSpace(part[separator+1:]),
+		}
+		if !slices.Contains(knownRoles, rule.Role) {
+			return nil, fmt.Errorf("invalid role %q in LDAP role rule %q", rule.Role, part)
+		}
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+// LDAPDirectory verifies credentials against a directory, implemented by utils.LDAPClient
+type LDAPDirectory interface {
+	Authenticate(login, password string) (*utils.LDAPEntry, error)
+}
+
+// LDAPAuthenticator signs users in with their directory password. The directory entry is linked to
+// a row in users through user_identities, matched by email/NIM/NIP on first login or, when Provision
+// is set, created just in time with the role from RoleRules.
+type LDAPAuthenticator struct {
+	DB               *sql.DB
+	Directory        LDAPDirectory
+	Issuer           string // identifies the directory in user_identities
+	AttributeMapping LDAPAttributeMapping
+	RoleRules        []LDAPRoleRule // first matching rule wins
+	DefaultRole      string         // role for provisioned users no rule matches, empty refuses them
+	MatchBy          []string       // attributes used to find an existing account: email, nim, nip
+	Provision        bool
+	SyncRoles        bool // update the role of existing accounts when a rule matches
+}
+
+func NewLDAPAuthenticator(db *sql.DB, client *utils.LDAPClient) *LDAPAuthenticator {
+	return &LDAPAuthenticator{
+		DB:               db,
+		Directory:        client,
+		Issuer:           client.URL,
+		AttributeMapping: DefaultLDAPAttributeMapping(),
+		MatchBy:          []string{"email", "nim", "nip"},
+	}
+}
+
+func (a *LDAPAuthenticator) Name() string {
+	return AuthenticatorLDAP
+}
+
+// RequestedAttributes lists the attributes to fetch for a user. Some servers only return
+// memberOf when asked for it explicitly.
+func (a *LDAPAuthenticator) RequestedAttributes() []string {
+	attributes := []string{}
+	for _, name := range []string{a.AttributeMapping.Email, a.AttributeMapping.Name, a.AttributeMapping.NIM, a.AttributeMapping.NIP} {
+		if name != "" {
+			attributes = append(attributes, name)
+		}
+	}
+	for _, rule := range a.RoleRules {
+		attributes = append(attributes, rule.Attribute)
+	}
+	return attributes
+}
+
+func (a *LDAPAuthenticator) Authenticate(login, password string) (string, error) {
+	entry, err := a.Directory.Authenticate(login, password)
+	switch {
+	case errors.Is(err, utils.ErrLDAPUserNotFound):
+		return "", ErrAuthUserNotFound
+	case errors.Is(err, utils.ErrLDAPInvalidCredentials):
+		return "", ErrAuthInvalidPassword
+	case err != nil:
+		return "", err
+	}
+
+	email := strings.TrimSpace(entry.Get(a.AttributeMapping.Email))
+	nim := strings.TrimSpace(entry.Get(a.AttributeMapping.NIM))
+	nip := strings.TrimSpace(entry.Get(a.AttributeMapping.NIP))
+	role := mapLDAPRole(entry, a.RoleRules)
+
+	var userID string
+	err = a.DB.QueryRow(`
+		UPDATE user_identities SET last_login_at = CURRENT_TIMESTAMP, email = $3
+		WHERE issuer = $1 AND subject = $2
+		RETURNING user_id
+	`, a.Issuer, entry.DN, nullIfEmpty(email)).Scan(&userID)
+	if err != nil && err != sql.ErrNoRows {
+		return "", fmt.Errorf("failed to get linked identity: %w", err)
+	}
+
+	if userID == "" {
+		// The directory is authoritative for its email addresses, so they count as verified
+		userID, err = findUserByAttributes(a.DB, a.MatchBy, email, nim, nip)
+		if err != nil {
+			return "", err
+		}
+
+		if userID == "" {
+			if !a.Provision {
+				return "", ErrAuthUserNotFound
+			}
+			return a.provisionUser(entry, email, nim, nip, role)
+		}
+
+		if err := a.linkUser(userID, entry.DN, email); err != nil {
+			return "", err
+		}
+	}
+
+	if a.SyncRoles && role != "" {
+		_, err = a.DB.Exec(`UPDATE users SET role = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1 AND role <> $2`, userID, role)
+		if err != nil {
+			return "", fmt.Errorf("failed to sync role: %w", err)
+		}
+	}
+
+	return userID, nil
+}
+
+func (a *LDAPAuthenticator) linkUser(userID, dn, email string) error {
+	_, err := a.DB.Exec(`
+		INSERT INTO user_identities (user_id, issuer, subject, email, last_login_at)
+		VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP)
+		ON CONFLICT (issuer, subject) DO NOTHING
+	`, userID, a.Issuer, dn, nullIfEmpty(email))
+	if err != nil {
+		return fmt.Errorf("failed to link identity: %w", err)
+	}
+
+	_, err = a.DB.Exec(`
+		UPDATE users SET email_verification_pending = false, email_verified_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND email_verification_pending = true AND LOWER(email) = LOWER($2)
+	`, userID, email)
+	if err != nil {
+		fmt.Printf("Warning: failed to mark email as verified: %v\n", err)
+	}
+
+	return nil
+}
+
+// provisionUser creates the account of a directory user on first login. The random password
+// can't be used, the user keeps signing in with the directory password.
+func (a *LDAPAuthenticator) provisionUser(entry *utils.LDAPEntry, email, nim, nip, role string) (string, error) {
+	if role == "" {
+		role = a.DefaultRole
+	}
+	if role == "" || email == "" {
+		// Nothing to create the account from, treated like a user the directory doesn't know
+		fmt.Printf("Warning: LDAP user %s has no mapped role or email, not provisioned\n", entry.DN)
+		return "", ErrAuthUserNotFound
+	}
+
+	name := strings.TrimSpace(entry.Get(a.AttributeMapping.Name))
+	if name == "" {
+		name = email
+	}
+
+	randomPassword, err := utils.GenerateRandomToken()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate password: %w", err)
+	}
+	hashedPassword, err := utils.HashPassword(randomPassword)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	tx, err := a.DB.Begin()
+	if err != nil {
+		return "", fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	userID := uuid.New().String()
+	_, err = tx.Exec(`
+		INSERT INTO users (id, nim, nip, name, email, password, role, is_active, email_verified_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, true, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+	`, userID, nullIfEmpty(nim), nullIfEmpty(nip), name, email, hashedPassword, role)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return "", errors.New("an account with this email, NIM or NIP already exists, contact the administrator to link it")
+		}
+		return "", fmt.Errorf("failed to create user: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO user_identities (user_id, issuer, subject, email, last_login_at)
+		VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP)
+	`, userID, a.Issuer, entry.DN, email)
+	if err != nil {
+		return "", fmt.Errorf("failed to link identity: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to commit user: %w", err)
+	}
+
+	return userID, nil
+}
+
+// mapLDAPRole returns the role of the first rule the entry matches, or an empty string
+func mapLDAPRole(entry *utils.LDAPEntry, rules []LDAPRoleRule) string {
+	for _, rule := range rules {
+		for _, value := range entry.Values(rule.Attribute) {
+			if strings.EqualFold(strings.TrimSpace(value), rule.Value) {
+				return rule.Role
+			}
+		}
+	}
+	return ""
+}
@@ -3,64 +3,134 @@ package service
 import (
 	"database/sql"
 	"errors"
+	"fmt"
 	"prestasi-mahasiswa/utils"
 
 	_ "github.com/lib/pq"
 )
 
 type LoginService struct {
-	DB      *sql.DB
-	JWTUtil *utils.JWTUtil
+	DB             *sql.DB
+	JWTUtil        *utils.JWTUtil
+	Policy         LoginPolicy
+	Authenticators []Authenticator // tried in order until one knows the user
 }
 
+// dummyPasswordHash is compared when the email is unknown, keeping response times uniform
+var dummyPasswordHash, _ = utils.HashPassword("prestasi-mahasiswa-dummy-password")
+
 func NewLoginService(db *sql.DB, jwtSecret string, jwtExpireHours int) *LoginService {
 	return &LoginService{
-		DB:      db,
-		JWTUtil: utils.NewJWTUtil(jwtSecret, jwtExpireHours),
+		DB:             db,
+		JWTUtil:        utils.NewJWTUtil(jwtSecret, jwtExpireHours),
+		Policy:         DefaultLoginPolicy(),
+		Authenticators: []Authenticator{NewLocalAuthenticator(db)},
 	}
 }
 
-func (s *LoginService) AuthenticateUser(email, password string) (*UserData, error) {
+// AuthenticateUser checks credentials with brute force protection. Every refused attempt returns
+// *LoginError with the same message, whether the email is unknown, the password wrong or the account inactive.
+func (s *LoginService) AuthenticateUser(email, password, ipAddress, userAgent string) (*UserData, error) {
 	if email == "" || password == "" {
 		return nil, errors.New("email and password are required")
 	}
 
-	// Query user from database (handle soft delete with fallback)
-	query := `SELECT id, nim, name, email, password, role, is_active FROM users WHERE email = $1 AND is_active = true`
+	// Refuse early while the account or client is blocked, without checking the password
+	throttled, _, err := s.checkLoginThrottle(email, ipAddress)
+	if err != nil {
+		return nil, err
+	}
+	if throttled != nil {
+		s.recordLoginAttempt(nil, email, ipAddress, userAgent, false, LoginReasonThrottled)
+		return nil, throttled
+	}
+
+	userID, reason, err := s.checkCredentials(email, password)
+	if err != nil {
+		return nil, err
+	}
+
 	var user UserData
-	var hashedPassword string
-	var isActive bool
+	var isActive, verificationPending bool
+	if reason == "" {
+		err = s.DB.QueryRow(`SELECT id, nim, name, email, role, is_active, email_verification_pending FROM users WHERE id = $1`, userID).Scan(
+			&user.ID,
+			&user.NIM,
+			&user.Name,
+			&user.Email,
+			&user.Role,
+			&isActive,
+			&verificationPending,
+		)
+		if err != nil {
+			return nil, errors.New("database error: " + err.Error())
+		}
+		if !isActive {
+			reason = LoginReasonInactive
+		}
+	}
 
-	err := s.DB.QueryRow(query, email).Scan(
-		&user.ID,
-		&user.NIM,
-		&user.Name,
-		&user.Email,
-		&hashedPassword,
-		&user.Role,
-		&isActive,
-	)
+	if reason != "" {
+		var attemptUserID *string
+		if userID != "" {
+			attemptUserID = &userID
+		}
+		s.recordLoginAttempt(attemptUserID, email, ipAddress, userAgent, false, reason)
 
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, errors.New("invalid email or password or account inactive")
+		failedCount := s.registerLoginFailure(email, ipAddress)
+		return nil, &LoginError{
+			Message:         invalidCredentialsMessage,
+			Code:            LoginErrorInvalidCredentials,
+			CaptchaRequired: s.Policy.CaptchaRequired(failedCount),
 		}
-		return nil, errors.New("database error: " + err.Error())
 	}
 
-	// Verify password
-	err = utils.ComparePassword(hashedPassword, password)
-	if err != nil {
-		return nil, errors.New("invalid email or password")
+	// Only revealed after the correct password, so it doesn't disclose which emails are registered
+	if verificationPending {
+		s.recordLoginAttempt(&user.ID, email, ipAddress, userAgent, false, LoginReasonUnverified)
+		return nil, &LoginError{
+			Message: "email address has not been verified, check your inbox for the verification link",
+			Code:    LoginErrorEmailNotVerified,
+		}
 	}
 
+	s.resetAccountThrottle(email)
+	s.recordLoginAttempt(&user.ID, email, ipAddress, userAgent, true, LoginReasonSuccess)
+
 	// Set user status and flags
 	user.IsActive = isActive
-	user.Status = "active" // Only active users can login with current query
+	user.Status = "active" // Only active users can login
 
 	return &user, nil
 }
 
+// checkCredentials asks each authenticator in turn. Unknown users and unavailable backends fall through
+// to the next one, a wrong password ends the search. The reason is empty when the password was accepted.
+func (s *LoginService) checkCredentials(email, password string) (string, string, error) {
+	unavailable := false
+	for _, authenticator := range s.Authenticators {
+		userID, err := authenticator.Authenticate(email, password)
+		switch {
+		case err == nil:
+			return userID, "", nil
+		case errors.Is(err, ErrAuthInvalidPassword):
+			return userID, LoginReasonInvalidPassword, nil
+		case errors.Is(err, ErrAuthUserNotFound):
+			continue
+		default:
+			fmt.Printf("Warning: %s authentication failed: %v\n", authenticator.Name(), err)
+			unavailable = true
+		}
+	}
+
+	// No backend knew the user, but one that couldn't be reached might have, so it isn't reported
+	// as an unknown email. The backend error is logged above and never shown to the client.
+	if unavailable {
+		return "", "", ErrAuthUnavailable
+	}
+	return "", LoginReasonUnknownEmail, nil
+}
+
 func (s *LoginService) GenerateToken(user *UserData) (string, error) {
 	return s.JWTUtil.GenerateToken(user.ID, user.Email, user.Role)
 }
@@ -0,0 +1,325 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Login attempt reasons stored in login_attempts
+const (
+	LoginReasonSuccess         = "success"
+	LoginReasonInvalidPassword = "invalid_password"
+	LoginReasonUnknownEmail    = "unknown_email"
+	LoginReasonInactive        = "inactive"
+	LoginReasonThrottled       = "throttled"
+	LoginReasonUnverified      = "email_not_verified"
+	LoginReasonInvalidMFACode  = "invalid_mfa_code"
+	LoginReasonMFAVerified     = "mfa_verified"
+	LoginReasonOIDC            = "oidc"
+)
+
+// Login error codes returned to clients in the code field
+const (
+	LoginErrorInvalidCredentials = "invalid_credentials"
+	LoginErrorTooManyAttempts    = "too_many_attempts"
+	LoginErrorEmailNotVerified   = "email_not_verified"
+	LoginErrorInvalidMFACode     = "invalid_mfa_code"
+)
+
+// LoginPolicy controls brute force protection of AuthenticateUser
+type LoginPolicy struct {
+	DelayAfterFailures   int           // failures before progressive delays start
+	BaseDelay            time.Duration // first delay, doubled on every further failure
+	MaxDelay             time.Duration
+	MaxFailedAttempts    int // account is locked when reached
+	LockoutDuration      time.Duration
+	IPMaxFailedAttempts  int // client is blocked when reached, across all accounts
+	FailureWindow        time.Duration
+	CaptchaAfterFailures int // 0 disables the captcha_required flag
+}
+
+// DefaultLoginPolicy returns the policy used when nothing is configured
+func DefaultLoginPolicy() LoginPolicy {
+	return LoginPolicy{
+		DelayAfterFailures:   3,
+		BaseDelay:            time.Second,
+		MaxDelay:             time.Minute,
+		MaxFailedAttempts:    10,
+		LockoutDuration:      15 * time.Minute,
+		IPMaxFailedAttempts:  50,
+		FailureWindow:        time.Hour,
+		CaptchaAfterFailures: 3,
+	}
+}
+
+// LoginError is returned for every refused login, it never reveals whether the account exists
+type LoginError struct {
+	Message         string
+	Code            string
+	RetryAfter      time.Duration // set when the attempt was refused without checking the password
+	CaptchaRequired bool
+}
+
+func (e *LoginError) Error() string {
+	return e.Message
+}
+
+// invalidCredentialsMessage is shared by unknown email, wrong password and inactive account
+const invalidCredentialsMessage = "invalid email or password"
+
+type LoginAttempt struct {
+	ID        string    `json:"id"`
+	Email     string    `json:"email"`
+	IPAddress *string   `json:"ip_address"`
+	UserAgent *string   `json:"user_agent"`
+	Success   bool      `json:"success"`
+	Reason    string    `json:"reason"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// BlockDuration returns how long further attempts are refused after failedCount consecutive failures
+// and whether the account counts as locked
+func (p LoginPolicy) BlockDuration(failedCount int) (time.Duration, bool) {
+	if p.MaxFailedAttempts > 0 && failedCount >= p.MaxFailedAttempts {
+		return p.LockoutDuration, true
+	}
+
+	if failedCount < p.DelayAfterFailures {
+		return 0, false
+	}
+
+	delay := p.BaseDelay
+	for i := p.DelayAfterFailures; i < failedCount && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	return delay, false
+}
+
+// CaptchaRequired reports whether the client should solve a captcha before the next attempt
+func (p LoginPolicy) CaptchaRequired(failedCount int) bool {
+	return p.CaptchaAfterFailures > 0 && failedCount >= p.CaptchaAfterFailures
+}
+
+func accountThrottleKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipThrottleKey(ipAddress string) string {
+	return "ip:" + ipAddress
+}
+
+// mfaThrottleKey counts wrong second factor codes. It is separate from the account key,
+// which a correct password resets, so new logins don't restart the count.
+func mfaThrottleKey(userID string) string {
+	return "mfa:" + userID
+}
+
+// checkLoginThrottle refuses the attempt while the account or client is blocked
+func (s *LoginService) checkLoginThrottle(email, ipAddress string) (*LoginError, int, error) {
+	keys := []string{accountThrottleKey(email)}
+	if ipAddress != "" {
+		keys = append(keys, ipThrottleKey(ipAddress))
+	}
+
+	query := `
+		SELECT throttle_key, failed_count, last_failed_at, blocked_until
+		FROM login_throttles
+		WHERE throttle_key = ANY($1)
+	`
+	rows, err := s.DB.Query(query, pq.Array(keys))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to check login throttle: %w", err)
+	}
+	defer rows.Close()
+
+	now := time.Now()
+	accountFailures := 0
+	var blockedUntil time.Time
+
+	for rows.Next() {
+		var key string
+		var failedCount int
+		var lastFailedAt, keyBlockedUntil sql.NullTime
+		if err := rows.Scan(&key, &failedCount, &lastFailedAt, &keyBlockedUntil); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan login throttle: %w", err)
+		}
+
+		// Old failures no longer count
+		if lastFailedAt.Valid && now.Sub(lastFailedAt.Time) > s.Policy.FailureWindow {
+			continue
+		}
+
+		if key == keys[0] {
+			accountFailures = failedCount
+		}
+		if keyBlockedUntil.Valid && keyBlockedUntil.Time.After(blockedUntil) {
+			blockedUntil = keyBlockedUntil.Time
+		}
+	}
+
+	if blockedUntil.After(now) {
+		return &LoginError{
+			Code:            LoginErrorTooManyAttempts,
+			Message:         "too many failed login attempts, please try again later",
+			RetryAfter:      blockedUntil.Sub(now),
+			CaptchaRequired: s.Policy.CaptchaRequired(accountFailures),
+		}, accountFailures, nil
+	}
+
+	return nil, accountFailures, nil
+}
+
+// checkThrottleKey refuses the attempt while a single throttle key is blocked
+func (s *LoginService) checkThrottleKey(key string) (*LoginError, error) {
+	var blockedUntil sql.NullTime
+	err := s.DB.QueryRow(`SELECT blocked_until FROM login_throttles WHERE throttle_key = $1`, key).Scan(&blockedUntil)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to check login throttle: %w", err)
+	}
+
+	if now := time.Now(); blockedUntil.Valid && blockedUntil.Time.After(now) {
+		return &LoginError{
+			Message:    "too many failed attempts, please try again later",
+			Code:       LoginErrorTooManyAttempts,
+			RetryAfter: blockedUntil.Time.Sub(now),
+		}, nil
+	}
+
+	return nil, nil
+}
+
+// resetThrottleKey clears the failures counted under key
+func (s *LoginService) resetThrottleKey(key string) {
+	if _, err := s.DB.Exec(`DELETE FROM login_throttles WHERE throttle_key = $1`, key); err != nil {
+		fmt.Printf("Warning: failed to reset login throttle: %v\n", err)
+	}
+}
+
+// registerLoginFailure increments account and client counters and blocks them per policy,
+// returns the account failure count
+func (s *LoginService) registerLoginFailure(email, ipAddress string) int {
+	accountFailures := s.incrementThrottle(accountThrottleKey(email), s.Policy.BlockDuration)
+
+	if ipAddress != "" {
+		s.incrementThrottle(ipThrottleKey(ipAddress), func(failedCount int) (time.Duration, bool) {
+			if s.Policy.IPMaxFailedAttempts > 0 && failedCount >= s.Policy.IPMaxFailedAttempts {
+				return s.Policy.LockoutDuration, true
+			}
+			return 0, false
+		})
+	}
+
+	return accountFailures
+}
+
+func (s *LoginService) incrementThrottle(key string, blockDuration func(int) (time.Duration, bool)) int {
+	now := time.Now()
+
+	query := `
+		INSERT INTO login_throttles (throttle_key, failed_count, last_failed_at, updated_at)
+		VALUES ($1, 1, $2, $2)
+		ON CONFLICT (throttle_key) DO UPDATE
+		SET failed_count = CASE
+				WHEN login_throttles.last_failed_at IS NULL OR login_throttles.last_failed_at < $3 THEN 1
+				ELSE login_throttles.failed_count + 1
+			END,
+			last_failed_at = $2,
+			updated_at = $2
+		RETURNING failed_count
+	`
+	var failedCount int
+	if err := s.DB.QueryRow(query, key, now, now.Add(-s.Policy.FailureWindow)).Scan(&failedCount); err != nil {
+		fmt.Printf("Warning: failed to update login throttle: %v\n", err)
+		return 0
+	}
+
+	if delay, _ := blockDuration(failedCount); delay > 0 {
+		_, err := s.DB.Exec(`UPDATE login_throttles SET blocked_until = $2 WHERE throttle_key = $1`, key, now.Add(delay))
+		if err != nil {
+			fmt.Printf("Warning: failed to block login: %v\n", err)
+		}
+	}
+
+	return failedCount
+}
+
+// resetAccountThrottle clears failed attempts of an account after a successful login
+func (s *LoginService) resetAccountThrottle(email string) {
+	s.resetThrottleKey(accountThrottleKey(email))
+}
+
+// recordLoginAttempt writes the login audit trail
+func (s *LoginService) recordLoginAttempt(userID *string, email, ipAddress, userAgent string, success bool, reason string) {
+	query := `
+		INSERT INTO login_attempts (user_id, email, ip_address, user_agent, success, reason)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`
+	_, err := s.DB.Exec(query, userID, strings.ToLower(strings.TrimSpace(email)), nullIfEmpty(ipAddress), nullIfEmpty(userAgent), success, reason)
+	if err != nil {
+		fmt.Printf("Warning: failed to record login attempt: %v\n", err)
+	}
+}
+
+// UnlockAccount clears lockout and failed attempts of a user (admin)
+func (s *LoginService) UnlockAccount(userID string) error {
+	var email string
+	err := s.DB.QueryRow(`SELECT email FROM users WHERE id = $1`, userID).Scan(&email)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return errors.New("user not found")
+		}
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	_, err = s.DB.Exec(`DELETE FROM login_throttles WHERE throttle_key = $1`, accountThrottleKey(email))
+	if err != nil {
+		return fmt.Errorf("failed to unlock account: %w", err)
+	}
+
+	return nil
+}
+
+// GetLoginHistory returns the most recent login attempts of a user, newest first
+func (s *LoginService) GetLoginHistory(userID string, limit int) ([]LoginAttempt, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+
+	// Attempts with an unknown email are matched by the user's current email as well
+	query := `
+		SELECT la.id, la.email, la.ip_address, la.user_agent, la.success, COALESCE(la.reason, ''), la.created_at
+		FROM login_attempts la
+		WHERE la.user_id = $1
+		   OR la.email = (SELECT LOWER(email) FROM users WHERE id = $1)
+		ORDER BY la.created_at DESC
+		LIMIT $2
+	`
+	rows, err := s.DB.Query(query, userID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get login history: %w", err)
+	}
+	defer rows.Close()
+
+	attempts := []LoginAttempt{}
+	for rows.Next() {
+		var attempt LoginAttempt
+		if err := rows.Scan(&attempt.ID, &attempt.Email, &attempt.IPAddress, &attempt.UserAgent, &attempt.Success, &attempt.Reason, &attempt.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan login attempt: %w", err)
+		}
+		attempts = append(attempts, attempt)
+	}
+
+	return attempts, nil
+}
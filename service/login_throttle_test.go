@@ -0,0 +1,94 @@
+package service
+
+import (
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLoginPolicyBlockDuration(t *testing.T) {
+	policy := DefaultLoginPolicy()
+
+	tests := []struct {
+		failedCount int
+		wantDelay   time.Duration
+		wantLocked  bool
+	}{
+		{0, 0, false},
+		{2, 0, false},
+		{3, time.Second, false},
+		{4, 2 * time.Second, false},
+		{6, 8 * time.Second, false},
+		{9, time.Minute, false}, // 64s capped at MaxDelay
+		{10, 15 * time.Minute, true},
+		{25, 15 * time.Minute, true},
+	}
+
+	for _, tt := range tests {
+		delay, locked := policy.BlockDuration(tt.failedCount)
+		if delay != tt.wantDelay || locked != tt.wantLocked {
+			t.Errorf("BlockDuration(%d) = %v, %v; want %v, %v", tt.failedCount, delay, locked, tt.wantDelay, tt.wantLocked)
+		}
+	}
+}
+
+func TestLoginPolicyCaptchaRequired(t *testing.T) {
+	policy := DefaultLoginPolicy()
+
+	if policy.CaptchaRequired(2) {
+		t.Error("Expected no captcha before CaptchaAfterFailures")
+	}
+	if !policy.CaptchaRequired(3) {
+		t.Error("Expected captcha after CaptchaAfterFailures")
+	}
+
+	policy.CaptchaAfterFailures = 0
+	if policy.CaptchaRequired(100) {
+		t.Error("Expected captcha disabled when CaptchaAfterFailures is 0")
+	}
+}
+
+func TestLoginThrottleKeyNormalizesEmail(t *testing.T) {
+	if accountThrottleKey(" Aryo@Example.com ") != accountThrottleKey("aryo@example.com") {
+		t.Error("Expected account throttle key to ignore case and surrounding spaces")
+	}
+	if accountThrottleKey("a@example.com") == ipThrottleKey("a@example.com") {
+		t.Error("Expected account and IP throttle keys not to collide")
+	}
+}
+
+func TestLoginErrorIsGeneric(t *testing.T) {
+	var err error = &LoginError{Message: invalidCredentialsMessage, CaptchaRequired: true}
+
+	var loginErr *LoginError
+	if !errors.As(err, &loginErr) {
+		t.Fatal("Expected errors.As to match *LoginError")
+	}
+	if err.Error() != "invalid email or password" {
+		t.Errorf("Expected generic message, got %q", err.Error())
+	}
+}
+
+func TestAuthenticateUserThrottledHasCode(t *testing.T) {
+	db, fake := newFakeDB(t)
+	s := NewLoginService(db, "test-secret-key-that-is-long-enough-for-testing", 24)
+
+	now := time.Now()
+	fake.expectQuery("FROM login_throttles", []string{"throttle_key", "failed_count", "last_failed_at", "blocked_until"},
+		[]driver.Value{accountThrottleKey("student@example.com"), int64(10), now, now.Add(10 * time.Minute)})
+	fake.expectExec("INSERT INTO login_attempts", 1)
+
+	_, err := s.AuthenticateUser("student@example.com", "password123", "203.0.113.7", "test-agent")
+
+	var loginErr *LoginError
+	if !errors.As(err, &loginErr) {
+		t.Fatalf("Expected *LoginError, got %v", err)
+	}
+	if loginErr.Code != LoginErrorTooManyAttempts || loginErr.RetryAfter <= 0 {
+		t.Errorf("Expected code %s with a retry delay, got %q, %v", LoginErrorTooManyAttempts, loginErr.Code, loginErr.RetryAfter)
+	}
+	if attempt := fake.callsContaining("INSERT INTO login_attempts")[0]; attempt.Args[5] != LoginReasonThrottled {
+		t.Errorf("Expected the attempt to be recorded as throttled, got %v", attempt.Args[5])
+	}
+}
@@ -0,0 +1,600 @@
+package service
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"prestasi-mahasiswa/utils"
+
+	"github.com/skip2/go-qrcode"
+)
+
+// MFA challenge purposes, a login either verifies an enrolled factor or has to enroll one first
+const (
+	MFAChallengeVerify = "verify"
+	MFAChallengeEnroll = "enroll"
+)
+
+// MFAService implements TOTP two-factor authentication (RFC 6238) with recovery codes.
+// After the password step a login gets a short-lived challenge token instead of a token pair,
+// the pair is only issued once the code is verified.
+type MFAService struct {
+	DB                   *sql.DB
+	LoginService         *LoginService
+	SecretBox            *utils.SecretBox // encrypts TOTP secrets at rest
+	Issuer               string           // shown in authenticator apps
+	RequiredRoles        []string         // roles that can't login without two-factor authentication
+	ChallengeLifetime    time.Duration
+	MaxChallengeAttempts int // wrong codes before a challenge token stops working
+	RecoveryCodeCount    int
+}
+
+type MFAStatus struct {
+	Enabled                bool       `json:"enabled"`
+	EnabledAt              *time.Time `json:"enabled_at,omitempty"`
+	Required               bool       `json:"required"` // mandatory for the user's role
+	RecoveryCodesRemaining int        `json:"recovery_codes_remaining"`
+}
+
+// MFAEnrollment is shown once when enrollment starts
+type MFAEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+	QRCode          string `json:"qr_code"` // PNG data URI of the provisioning URI
+}
+
+func NewMFAService(db *sql.DB, loginService *LoginService, secretBox *utils.SecretBox, issuer string, challengeLifetime time.Duration) *MFAService {
+	return &MFAService{
+		DB:                   db,
+		LoginService:         loginService,
+		SecretBox:            secretBox,
+		Issuer:               issuer,
+		ChallengeLifetime:    challengeLifetime,
+		MaxChallengeAttempts: 5,
+		RecoveryCodeCount:    10,
+	}
+}
+
+// IsRequired reports whether two-factor authentication is mandatory for role
+func (s *MFAService) IsRequired(role string) bool {
+	for _, required := range s.RequiredRoles {
+		if required == role {
+			return true
+		}
+	}
+	return false
+}
+
+// IsEnabled reports whether the user has a confirmed TOTP factor
+func (s *MFAService) IsEnabled(userID string) (bool, error) {
+	var enabled bool
+	err := s.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM user_mfa WHERE user_id = $1 AND enabled_at IS NOT NULL)`, userID).Scan(&enabled)
+	if err != nil {
+		return false, fmt.Errorf("failed to check two-factor status: %w", err)
+	}
+	return enabled, nil
+}
+
+// LoginChallenge returns the challenge purpose a login of user needs after the password step,
+// an empty purpose means the token pair can be issued right away
+func (s *MFAService) LoginChallenge(user *UserData) (string, error) {
+	enabled, err := s.IsEnabled(user.ID)
+	if err != nil {
+		return "", err
+	}
+
+	switch {
+	case enabled:
+		return MFAChallengeVerify, nil
+	case s.IsRequired(user.Role):
+		return MFAChallengeEnroll, nil
+	default:
+		return "", nil
+	}
+}
+
+// CreateChallenge stores a new challenge token for user and returns it in plain text
+func (s *MFAService) CreateChallenge(userID, purpose string) (string, error) {
+	token, err := utils.GenerateRandomToken()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate MFA token: %w", err)
+	}
+
+	_, err = s.DB.Exec(`
+		INSERT INTO mfa_challenges (user_id, token_hash, purpose, expires_at)
+		VALUES ($1, $2, $3, $4)
+	`, userID, utils.HashToken(token), purpose, time.Now().Add(s.ChallengeLifetime))
+	if err != nil {
+		return "", fmt.Errorf("failed to store MFA token: %w", err)
+	}
+
+	return token, nil
+}
+
+// GetStatus returns the two-factor state of a user
+func (s *MFAService) GetStatus(userID, role string) (*MFAStatus, error) {
+	status := &MFAStatus{Required: s.IsRequired(role)}
+
+	err := s.DB.QueryRow(`
+		SELECT
+			(SELECT enabled_at FROM user_mfa WHERE user_id = $1),
+			(SELECT COUNT(*) FROM mfa_recovery_codes WHERE user_id = $1 AND used_at IS NULL)
+	`, userID).Scan(&status.EnabledAt, &status.RecoveryCodesRemaining)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get two-factor status: %w", err)
+	}
+
+	status.Enabled = status.EnabledAt != nil
+	return status, nil
+}
+
+// StartEnrollment generates a new secret for a user without a confirmed factor. The secret
+// is only used for logins after ConfirmEnrollment, starting again replaces it.
+func (s *MFAService) StartEnrollment(userID string) (*MFAEnrollment, error) {
+	enabled, err := s.IsEnabled(userID)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		return nil, errors.New("two-factor authentication is already enabled")
+	}
+
+	var email string
+	if err := s.DB.QueryRow(`SELECT email FROM users WHERE id = $1`, userID).Scan(&email); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("user not found")
+		}
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate TOTP secret: %w", err)
+	}
+	encrypted, err := s.SecretBox.Seal(secret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt TOTP secret: %w", err)
+	}
+
+	_, err = s.DB.Exec(`
+		INSERT INTO user_mfa (user_id, secret_encrypted)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret_encrypted = EXCLUDED.secret_encrypted, last_used_counter = 0, updated_at = CURRENT_TIMESTAMP
+		WHERE user_mfa.enabled_at IS NULL
+	`, userID, encrypted)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store TOTP secret: %w", err)
+	}
+
+	uri := utils.TOTPProvisioningURI(s.Issuer, email, secret)
+	png, err := qrcode.Encode(uri, qrcode.Medium, 256)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate QR code: %w", err)
+	}
+
+	return &MFAEnrollment{
+		Secret:          secret,
+		ProvisioningURI: uri,
+		QRCode:          "data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+	}, nil
+}
+
+// ConfirmEnrollment enables the pending factor once the first code is correct
+// and returns the recovery codes, they are shown only this once
+func (s *MFAService) ConfirmEnrollment(userID, code string) ([]string, error) {
+	var encrypted string
+	var enabledAt *time.Time
+	err := s.DB.QueryRow(`SELECT secret_encrypted, enabled_at FROM user_mfa WHERE user_id = $1`, userID).Scan(&encrypted, &enabledAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("two-factor enrollment has not been started")
+		}
+		return nil, fmt.Errorf("failed to get TOTP secret: %w", err)
+	}
+	if enabledAt != nil {
+		return nil, errors.New("two-factor authentication is already enabled")
+	}
+
+	secret, err := s.SecretBox.Open(encrypted)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt TOTP secret: %w", err)
+	}
+
+	counter, ok := utils.ValidateTOTPCode(secret, code, time.Now())
+	if !ok {
+		return nil, errors.New("invalid verification code")
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE user_mfa SET enabled_at = CURRENT_TIMESTAMP, last_used_counter = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND enabled_at IS NULL
+	`, userID, counter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to enable two-factor authentication: %w", err)
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return nil, errors.New("two-factor authentication is already enabled")
+	}
+
+	codes, err := s.replaceRecoveryCodes(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit two-factor enrollment: %w", err)
+	}
+	LogSecurityEvent(s.DB, SecurityEvent{UserID: userID, EventType: SecurityEventMFAEnabled})
+
+	return codes, nil
+}
+
+// EnrollWithChallenge confirms enrollment during a login that requires it and consumes the
+// challenge token, the caller issues the token pair for the returned user
+func (s *MFAService) EnrollWithChallenge(token, code, ipAddress, userAgent string) (*UserData, []string, error) {
+	user, err := s.challengeUser(token, MFAChallengeEnroll)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	codes, err := s.ConfirmEnrollment(user.ID, code)
+	if err != nil {
+		if err.Error() == "invalid verification code" {
+			return nil, nil, s.registerCodeFailure(token, user, ipAddress, userAgent)
+		}
+		return nil, nil, err
+	}
+
+	if err := s.consumeChallenge(token); err != nil {
+		return nil, nil, err
+	}
+	s.LoginService.recordLoginAttempt(&user.ID, user.Email, ipAddress, userAgent, true, LoginReasonMFAVerified)
+
+	return user, codes, nil
+}
+
+// StartEnrollmentWithChallenge starts enrollment for a login that requires it, the challenge
+// stays valid for EnrollWithChallenge
+func (s *MFAService) StartEnrollmentWithChallenge(token string) (*MFAEnrollment, error) {
+	user, err := s.challengeUser(token, MFAChallengeEnroll)
+	if err != nil {
+		return nil, err
+	}
+	return s.StartEnrollment(user.ID)
+}
+
+// VerifyChallenge checks the second factor of a login, either a TOTP code or an unused
+// recovery code, and consumes the challenge token
+func (s *MFAService) VerifyChallenge(token, code, recoveryCode, ipAddress, userAgent string) (*UserData, error) {
+	user, err := s.challengeUser(token, MFAChallengeVerify)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkCode(user, code, recoveryCode); err != nil {
+		var loginErr *LoginError
+		if errors.As(err, &loginErr) && loginErr.Code == LoginErrorInvalidMFACode {
+			return nil, s.registerCodeFailure(token, user, ipAddress, userAgent)
+		}
+		return nil, err
+	}
+
+	if err := s.consumeChallenge(token); err != nil {
+		return nil, err
+	}
+	s.LoginService.recordLoginAttempt(&user.ID, user.Email, ipAddress, userAgent, true, LoginReasonMFAVerified)
+
+	return user, nil
+}
+
+// Disable removes the factor and recovery codes after checking password and a current code.
+// Users whose role requires two-factor authentication can't disable it.
+func (s *MFAService) Disable(userID, role, password, code, recoveryCode string) error {
+	if s.IsRequired(role) {
+		return errors.New("two-factor authentication is mandatory for your role")
+	}
+
+	user, err := s.enabledUser(userID)
+	if err != nil {
+		return err
+	}
+
+	var hashedPassword string
+	if err := s.DB.QueryRow(`SELECT password FROM users WHERE id = $1`, userID).Scan(&hashedPassword); err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if password == "" || utils.ComparePassword(hashedPassword, password) != nil {
+		return errors.New("current password is incorrect")
+	}
+
+	if err := s.checkCode(user, code, recoveryCode); err != nil {
+		return err
+	}
+
+	if err := s.removeFactor(userID); err != nil {
+		return err
+	}
+	LogSecurityEvent(s.DB, SecurityEvent{UserID: userID, EventType: SecurityEventMFADisabled})
+
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes after checking a current code
+func (s *MFAService) RegenerateRecoveryCodes(userID, code string) ([]string, error) {
+	user, err := s.enabledUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.checkCode(user, code, ""); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	codes, err := s.replaceRecoveryCodes(tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit recovery codes: %w", err)
+	}
+
+	return codes, nil
+}
+
+// ResetMFA removes the factor of a user who lost their device (admin). Users of a role that
+// requires two-factor authentication enroll again on their next login.
+func (s *MFAService) ResetMFA(userID, resetBy string) error {
+	var exists bool
+	if err := s.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)`, userID).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if !exists {
+		return errors.New("user not found")
+	}
+
+	if err := s.removeFactor(userID); err != nil {
+		return err
+	}
+	LogSecurityEvent(s.DB, SecurityEvent{
+		UserID:    userID,
+		EventType: SecurityEventMFAReset,
+		Details:   map[string]interface{}{"reset_by": resetBy},
+	})
+
+	return nil
+}
+
+// CleanupExpiredChallenges removes used and expired challenge tokens
+func (s *MFAService) CleanupExpiredChallenges() error {
+	result, err := s.DB.Exec(`DELETE FROM mfa_challenges WHERE expires_at < CURRENT_TIMESTAMP - INTERVAL '1 day'`)
+	if err != nil {
+		return fmt.Errorf("failed to cleanup MFA challenges: %w", err)
+	}
+
+	rowsDeleted, _ := result.RowsAffected()
+	fmt.Printf("Cleaned up %d expired MFA challenges\n", rowsDeleted)
+
+	return nil
+}
+
+// checkCode verifies a TOTP code or, when given, a recovery code. Wrong codes count towards
+// the user's MFA throttle and return *LoginError.
+func (s *MFAService) checkCode(user *UserData, code, recoveryCode string) error {
+	key := mfaThrottleKey(user.ID)
+	throttled, err := s.LoginService.checkThrottleKey(key)
+	if err != nil {
+		return err
+	}
+	if throttled != nil {
+		return throttled
+	}
+
+	var ok bool
+	if recoveryCode != "" {
+		ok, err = s.useRecoveryCode(user.ID, recoveryCode)
+	} else {
+		ok, err = s.useTOTPCode(user.ID, code)
+	}
+	if err != nil {
+		return err
+	}
+
+	if !ok {
+		s.LoginService.incrementThrottle(key, s.LoginService.Policy.BlockDuration)
+		return &LoginError{Message: "invalid verification code", Code: LoginErrorInvalidMFACode}
+	}
+
+	s.LoginService.resetThrottleKey(key)
+	return nil
+}
+
+// useTOTPCode accepts a code only for a time step later than the last accepted one,
+// so an observed code can't be replayed
+func (s *MFAService) useTOTPCode(userID, code string) (bool, error) {
+	if code == "" {
+		return false, nil
+	}
+
+	var encrypted string
+	err := s.DB.QueryRow(`SELECT secret_encrypted FROM user_mfa WHERE user_id = $1 AND enabled_at IS NOT NULL`, userID).Scan(&encrypted)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to get TOTP secret: %w", err)
+	}
+
+	secret, err := s.SecretBox.Open(encrypted)
+	if err != nil {
+		return false, fmt.Errorf("failed to decrypt TOTP secret: %w", err)
+	}
+
+	counter, ok := utils.ValidateTOTPCode(secret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+
+	result, err := s.DB.Exec(`
+		UPDATE user_mfa SET last_used_counter = $2, updated_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND last_used_counter < $2
+	`, userID, counter)
+	if err != nil {
+		return false, fmt.Errorf("failed to record TOTP code use: %w", err)
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	return rowsAffected > 0, nil
+}
+
+func (s *MFAService) useRecoveryCode(userID, recoveryCode string) (bool, error) {
+	result, err := s.DB.Exec(`
+		UPDATE mfa_recovery_codes SET used_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL
+	`, userID, utils.HashToken(normalizeInvitationCode(recoveryCode)))
+	if err != nil {
+		return false, fmt.Errorf("failed to use recovery code: %w", err)
+	}
+
+	rowsAffected, _ := result.RowsAffected()
+	return rowsAffected > 0, nil
+}
+
+// replaceRecoveryCodes drops existing recovery codes and stores new ones, returned in plain text
+func (s *MFAService) replaceRecoveryCodes(tx *sql.Tx, userID string) ([]string, error) {
+	if _, err := tx.Exec(`DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return nil, fmt.Errorf("failed to remove recovery codes: %w", err)
+	}
+
+	codes := make([]string, 0, s.RecoveryCodeCount)
+	for i := 0; i < s.RecoveryCodeCount; i++ {
+		// Same unambiguous format as invitation codes, e.g. K7QX2-MHP4A
+		code, err := generateInvitationCode()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate recovery code: %w", err)
+		}
+
+		_, err = tx.Exec(`INSERT INTO mfa_recovery_codes (user_id, code_hash) VALUES ($1, $2)`, userID, utils.HashToken(normalizeInvitationCode(code)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to store recovery code: %w", err)
+		}
+		codes = append(codes, code)
+	}
+
+	return codes, nil
+}
+
+func (s *MFAService) removeFactor(userID string) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to remove recovery codes: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM user_mfa WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to disable two-factor authentication: %w", err)
+	}
+	if _, err := tx.Exec(`UPDATE mfa_challenges SET used_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND used_at IS NULL`, userID); err != nil {
+		return fmt.Errorf("failed to invalidate MFA challenges: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit two-factor removal: %w", err)
+	}
+
+	return nil
+}
+
+// enabledUser returns the user of a confirmed factor
+func (s *MFAService) enabledUser(userID string) (*UserData, error) {
+	enabled, err := s.IsEnabled(userID)
+	if err != nil {
+		return nil, err
+	}
+	if !enabled {
+		return nil, errors.New("two-factor authentication is not enabled")
+	}
+
+	return s.LoginService.GetUserInfo(userID)
+}
+
+// challengeUser resolves an unused, unexpired challenge token of the given purpose to an active user
+func (s *MFAService) challengeUser(token, purpose string) (*UserData, error) {
+	if token == "" {
+		return nil, errors.New("MFA token is required")
+	}
+
+	var userID string
+	err := s.DB.QueryRow(`
+		SELECT user_id FROM mfa_challenges
+		WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+	`, utils.HashToken(token), purpose).Scan(&userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, errors.New("invalid or expired MFA token")
+		}
+		return nil, fmt.Errorf("failed to get MFA challenge: %w", err)
+	}
+
+	user, err := s.LoginService.GetUserInfo(userID)
+	if err != nil {
+		if err.Error() == "user not found" {
+			return nil, errors.New("invalid or expired MFA token")
+		}
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// consumeChallenge marks a challenge as used, it fails when a concurrent request used it first
+func (s *MFAService) consumeChallenge(token string) error {
+	result, err := s.DB.Exec(`
+		UPDATE mfa_challenges SET used_at = CURRENT_TIMESTAMP
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+	`, utils.HashToken(token))
+	if err != nil {
+		return fmt.Errorf("failed to consume MFA challenge: %w", err)
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return errors.New("invalid or expired MFA token")
+	}
+	return nil
+}
+
+// registerCodeFailure audits a wrong code during login and burns the challenge once it
+// reached MaxChallengeAttempts, the returned error is passed on to the client
+func (s *MFAService) registerCodeFailure(token string, user *UserData, ipAddress, userAgent string) error {
+	s.LoginService.recordLoginAttempt(&user.ID, user.Email, ipAddress, userAgent, false, LoginReasonInvalidMFACode)
+
+	_, err := s.DB.Exec(`
+		UPDATE mfa_challenges
+		SET attempts = attempts + 1,
+			used_at = CASE WHEN attempts + 1 >= $2 THEN CURRENT_TIMESTAMP ELSE used_at END
+		WHERE token_hash = $1
+	`, utils.HashToken(token), s.MaxChallengeAttempts)
+	if err != nil {
+		fmt.Printf("Warning: failed to count MFA attempt: %v\n", err)
+	}
+
+	return &LoginError{Message: "invalid verification code", Code: LoginErrorInvalidMFACode}
+}
@@ -0,0 +1,48 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMFAServiceIsRequired(t *testing.T) {
+	s := NewMFAService(nil, nil, nil, "Prestasi Mahasiswa", 5*time.Minute)
+	s.RequiredRoles = []string{"admin", "dosen_wali"}
+
+	tests := []struct {
+		role string
+		want bool
+	}{
+		{"admin", true},
+		{"dosen_wali", true},
+		{"mahasiswa", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := s.IsRequired(tt.role); got != tt.want {
+			t.Errorf("IsRequired(%q) = %v, want %v", tt.role, got, tt.want)
+		}
+	}
+}
+
+func TestMFAServiceDefaults(t *testing.T) {
+	s := NewMFAService(nil, nil, nil, "Prestasi Mahasiswa", 5*time.Minute)
+
+	if s.IsRequired("admin") {
+		t.Error("Expected two-factor authentication to be optional without required roles")
+	}
+	if s.MaxChallengeAttempts != 5 {
+		t.Errorf("Expected 5 attempts per challenge, got %d", s.MaxChallengeAttempts)
+	}
+	if s.RecoveryCodeCount != 10 {
+		t.Errorf("Expected 10 recovery codes, got %d", s.RecoveryCodeCount)
+	}
+}
+
+func TestMFAThrottleKeyIsSeparateFromAccount(t *testing.T) {
+	// A correct password resets the account key, wrong codes must keep counting
+	if mfaThrottleKey("user-1") == accountThrottleKey("user-1") {
+		t.Error("Expected MFA throttle key to differ from the account key")
+	}
+}
@@ -0,0 +1,398 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Notification event types, users can turn each of them off
+const (
+	NotificationVerificationRequested = "verification_requested" // a submission awaits the user's decision
+	NotificationApprovalStepApproved  = "approval_step_approved" // a step of the user's achievement was approved
+	NotificationAchievementVerified   = "achievement_verified"
+	NotificationAchievementRejected   = "achievement_rejected"
+	NotificationAdvisorAssigned       = "advisor_assigned" // the user got a dosen wali or an advisee
+)
+
+// notificationEventTypes describes the event types in the order preferences are listed
+var notificationEventTypes = []struct {
+	Type        string
+	Description string
+}{
+	{NotificationVerificationRequested, "An achievement awaits your verification"},
+	{NotificationApprovalStepApproved, "An approval step of your achievement was approved"},
+	{NotificationAchievementVerified, "Your achievement was verified"},
+	{NotificationAchievementRejected, "Your achievement was rejected"},
+	{NotificationAdvisorAssigned, "You were assigned a dosen wali or an advisee"},
+}
+
+// NotificationService stores in-app notifications. Other services produce them through Notify,
+// which leaves out users who turned the event type off.
+type NotificationService struct {
+	DB *sql.DB
+}
+
+type Notification struct {
+	ID            string     `json:"id"`
+	EventType     string     `json:"event_type"`
+	Title         string     `json:"title"`
+	Message       string     `json:"message"`
+	AchievementID *string    `json:"achievement_id,omitempty"`
+	ActorID       *string    `json:"actor_id,omitempty"`
+	ActorName     *string    `json:"actor_name,omitempty"`
+	ReadAt        *time.Time `json:"read_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// NewNotification is a notification to send, AchievementID and ActorID are optional
+type NewNotification struct {
+	EventType     string
+	Title         string
+	Message       string
+	AchievementID string
+	ActorID       string // never notified of their own action
+}
+
+type NotificationPreference struct {
+	EventType   string `json:"event_type"`
+	Description string `json:"description"`
+	Enabled     bool   `json:"enabled"`
+}
+
+func NewNotificationService(db *sql.DB) *NotificationService {
+	return &NotificationService{DB: db}
+}
+
+// Notify sends a notification to each user who hasn't turned its event type off
+func (s *NotificationService) Notify(userIDs []string, notification NewNotification) error {
+	recipients := notificationRecipients(userIDs, notification.ActorID)
+	if len(recipients) == 0 {
+		return nil
+	}
+	if !isNotificationEventType(notification.EventType) {
+		return fmt.Errorf("unknown notification event type %s", notification.EventType)
+	}
+
+	_, err := s.DB.Exec(`
+		INSERT INTO notifications (user_id, event_type, title, message, achievement_id, actor_id)
+		SELECT r.user_id, $2, $3, $4, $5, $6
+		FROM unnest($1::uuid[]) AS r(user_id)
+		WHERE NOT EXISTS (
+			SELECT 1 FROM notification_preferences p
+			WHERE p.user_id = r.user_id AND p.event_type = $2 AND p.enabled = false
+		)
+	`, pq.Array(recipients), notification.EventType, notification.Title, notification.Message,
+		nullIfEmpty(notification.AchievementID), nullIfEmpty(notification.ActorID))
+	if err != nil {
+		return fmt.Errorf("failed to create notifications: %w", err)
+	}
+	return nil
+}
+
+// GetNotifications lists the notifications of a user, newest first
+func (s *NotificationService) GetNotifications(userID string, unreadOnly bool, limit, offset int) ([]Notification, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	rows, err := s.DB.Query(`
+		SELECT n.id, n.event_type, n.title, n.message, n.achievement_id, n.actor_id, a.name, n.read_at, n.created_at
+		FROM notifications n
+		LEFT JOIN users a ON a.id = n.actor_id
+		WHERE n.user_id = $1 AND (NOT $2 OR n.read_at IS NULL)
+		ORDER BY n.created_at DESC
+		LIMIT $3 OFFSET $4
+	`, userID, unreadOnly, limit, offset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notifications: %w", err)
+	}
+	defer rows.Close()
+
+	notifications := []Notification{}
+	for rows.Next() {
+		var notification Notification
+		err := rows.Scan(&notification.ID, &notification.EventType, &notification.Title, &notification.Message,
+			&notification.AchievementID, &notification.ActorID, &notification.ActorName, &notification.ReadAt, &notification.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan notification: %w", err)
+		}
+		notifications = append(notifications, notification)
+	}
+	return notifications, rows.Err()
+}
+
+// UnreadCount returns how many notifications of a user are unread
+func (s *NotificationService) UnreadCount(userID string) (int, error) {
+	var count int
+	err := s.DB.QueryRow(`SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL`, userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count unread notifications: %w", err)
+	}
+	return count, nil
+}
+
+// MarkRead marks a notification of the user as read, marking it again is not an error
+func (s *NotificationService) MarkRead(userID, id string) error {
+	result, err := s.DB.Exec(`
+		UPDATE notifications SET read_at = COALESCE(read_at, CURRENT_TIMESTAMP)
+		WHERE id::text = $1 AND user_id = $2
+	`, id, userID)
+	if err != nil {
+		return fmt.Errorf("failed to mark notification as read: %w", err)
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return errors.New("notification not found")
+	}
+	return nil
+}
+
+// MarkAllRead marks every unread notification of the user as read and returns how many there were
+func (s *NotificationService) MarkAllRead(userID string) (int64, error) {
+	result, err := s.DB.Exec(`UPDATE notifications SET read_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND read_at IS NULL`, userID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark notifications as read: %w", err)
+	}
+	rowsAffected, _ := result.RowsAffected()
+	return rowsAffected, nil
+}
+
+// GetPreferences lists every event type and whether the user receives it
+func (s *NotificationService) GetPreferences(userID string) ([]NotificationPreference, error) {
+	rows, err := s.DB.Query(`SELECT event_type, enabled FROM notification_preferences WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notification preferences: %w", err)
+	}
+	defer rows.Close()
+
+	enabled := make(map[string]bool)
+	for rows.Next() {
+		var eventType string
+		var isEnabled bool
+		if err := rows.Scan(&eventType, &isEnabled); err != nil {
+			return nil, fmt.Errorf("failed to scan notification preference: %w", err)
+		}
+		enabled[eventType] = isEnabled
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get notification preferences: %w", err)
+	}
+
+	return notificationPreferences(enabled), nil
+}
+
+// UpdatePreferences turns event types on or off for the user, event types left out keep their setting
+func (s *NotificationService) UpdatePreferences(userID string, preferences map[string]bool) ([]NotificationPreference, error) {
+	for eventType := range preferences {
+		if !isNotificationEventType(eventType) {
+			return nil, fmt.Errorf("unknown event type %s", eventType)
+		}
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	for eventType, enabled := range preferences {
+		_, err := tx.Exec(`
+			INSERT INTO notification_preferences (user_id, event_type, enabled)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (user_id, event_type) DO UPDATE SET enabled = EXCLUDED.enabled, updated_at = CURRENT_TIMESTAMP
+		`, userID, eventType, enabled)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update notification preferences: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to update notification preferences: %w", err)
+	}
+	return s.GetPreferences(userID)
+}
+
+// CleanupReadNotifications removes read notifications older than 90 days
+func (s *NotificationService) CleanupReadNotifications() error {
+	result, err := s.DB.Exec(`DELETE FROM notifications WHERE read_at < CURRENT_TIMESTAMP - INTERVAL '90 days'`)
+	if err != nil {
+		return fmt.Errorf("failed to cleanup notifications: %w", err)
+	}
+
+	rowsDeleted, _ := result.RowsAffected()
+	fmt.Printf("Cleaned up %d read notifications\n", rowsDeleted)
+
+	return nil
+}
+
+// achievementSubject is what notifications about an achievement refer to
+type achievementSubject struct {
+	ID          string
+	Title       string
+	StudentID   string
+	StudentName string
+	AdvisorID   *string
+}
+
+func (s *NotificationService) getAchievementSubject(id string) (*achievementSubject, error) {
+	subject := achievementSubject{ID: id}
+	err := s.DB.QueryRow(`
+		SELECT a.title, a.mahasiswa_id, u.name, u.advisor_id
+		FROM achievements a
+		JOIN users u ON u.id = a.mahasiswa_id
+		WHERE a.id = $1
+	`, id).Scan(&subject.Title, &subject.StudentID, &subject.StudentName, &subject.AdvisorID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get achievement: %w", err)
+	}
+	return &subject, nil
+}
+
+// achievementSubmitted tells the assignees of the first approval step about a submission
+func (s *NotificationService) achievementSubmitted(achievementID string) error {
+	subject, err := s.getAchievementSubject(achievementID)
+	if err != nil {
+		return err
+	}
+
+	var step AchievementApproval
+	err = s.DB.QueryRow(`
+		SELECT step_name, assignee_rule, assignee_role FROM achievement_approvals
+		WHERE achievement_id = $1 AND status = 'pending'
+		ORDER BY step_order
+		LIMIT 1
+	`, achievementID).Scan(&step.StepName, &step.AssigneeRule, &step.AssigneeRole)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		return fmt.Errorf("failed to get approval step: %w", err)
+	}
+
+	return s.notifyStepAssignees(subject, &step, subject.StudentID)
+}
+
+// approvalStepApproved tells the student a step was approved and the next step's assignees that it's their turn
+func (s *NotificationService) approvalStepApproved(achievementID, approvedStep string, nextStep *AchievementApproval, actorID string) error {
+	subject, err := s.getAchievementSubject(achievementID)
+	if err != nil {
+		return err
+	}
+
+	err = s.Notify([]string{subject.StudentID}, NewNotification{
+		EventType:     NotificationApprovalStepApproved,
+		Title:         "Tahap " + approvedStep + " disetujui",
+		Message:       fmt.Sprintf("Prestasi \"%s\" disetujui pada tahap %s dan kini menunggu tahap %s.", subject.Title, approvedStep, nextStep.StepName),
+		AchievementID: achievementID,
+		ActorID:       actorID,
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.notifyStepAssignees(subject, nextStep, actorID)
+}
+
+// achievementDecided tells the student their achievement was verified or rejected
+func (s *NotificationService) achievementDecided(achievementID string, verified bool, reason, actorID string) error {
+	subject, err := s.getAchievementSubject(achievementID)
+	if err != nil {
+		return err
+	}
+
+	notification := NewNotification{
+		EventType:     NotificationAchievementVerified,
+		Title:         "Prestasi diverifikasi",
+		Message:       fmt.Sprintf("Prestasi \"%s\" telah diverifikasi.", subject.Title),
+		AchievementID: achievementID,
+		ActorID:       actorID,
+	}
+	if !verified {
+		notification.EventType = NotificationAchievementRejected
+		notification.Title = "Prestasi ditolak"
+		notification.Message = fmt.Sprintf("Prestasi \"%s\" ditolak dengan alasan: %s", subject.Title, reason)
+	}
+	return s.Notify([]string{subject.StudentID}, notification)
+}
+
+// advisorAssigned tells a student about their new dosen wali and the dosen wali about their new advisee
+func (s *NotificationService) advisorAssigned(student, advisor *User, actorID string) error {
+	err := s.Notify([]string{student.ID}, NewNotification{
+		EventType: NotificationAdvisorAssigned,
+		Title:     "Dosen wali ditetapkan",
+		Message:   fmt.Sprintf("%s sekarang menjadi dosen wali Anda.", advisor.Name),
+		ActorID:   actorID,
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.Notify([]string{advisor.ID}, NewNotification{
+		EventType: NotificationAdvisorAssigned,
+		Title:     "Mahasiswa bimbingan baru",
+		Message:   fmt.Sprintf("%s sekarang menjadi mahasiswa bimbingan Anda.", student.Name),
+		ActorID:   actorID,
+	})
+}
+
+func (s *NotificationService) notifyStepAssignees(subject *achievementSubject, step *AchievementApproval, actorID string) error {
+	assignees, err := stepAssignees(s.DB, step.AssigneeRule, step.AssigneeRole, subject.AdvisorID)
+	if err != nil {
+		return err
+	}
+
+	userIDs := make([]string, 0, len(assignees))
+	for _, assignee := range assignees {
+		userIDs = append(userIDs, assignee.ID)
+	}
+	return s.Notify(userIDs, NewNotification{
+		EventType:     NotificationVerificationRequested,
+		Title:         "Prestasi menunggu verifikasi",
+		Message:       fmt.Sprintf("Prestasi \"%s\" dari %s menunggu keputusan Anda pada tahap %s.", subject.Title, subject.StudentName, step.StepName),
+		AchievementID: subject.ID,
+		ActorID:       actorID,
+	})
+}
+
+// notificationRecipients drops empty and duplicate user IDs and the actor
+func notificationRecipients(userIDs []string, actorID string) []string {
+	seen := make(map[string]bool)
+	recipients := []string{}
+	for _, userID := range userIDs {
+		if userID == "" || userID == actorID || seen[userID] {
+			continue
+		}
+		seen[userID] = true
+		recipients = append(recipients, userID)
+	}
+	return recipients
+}
+
+// notificationPreferences lists every event type, enabled unless turned off
+func notificationPreferences(enabled map[string]bool) []NotificationPreference {
+	preferences := make([]NotificationPreference, 0, len(notificationEventTypes))
+	for _, eventType := range notificationEventTypes {
+		isEnabled, ok := enabled[eventType.Type]
+		preferences = append(preferences, NotificationPreference{
+			EventType:   eventType.Type,
+			Description: eventType.Description,
+			Enabled:     !ok || isEnabled,
+		})
+	}
+	return preferences
+}
+
+func isNotificationEventType(eventType string) bool {
+	for _, known := range notificationEventTypes {
+		if known.Type == eventType {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,207 @@
+package service
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestNotificationRecipients(t *testing.T) {
+	got := notificationRecipients([]string{"user-1", "", "actor", "user-2", "user-1"}, "actor")
+	want := []string{"user-1", "user-2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("notificationRecipients() = %v, want %v", got, want)
+	}
+}
+
+func TestNotifyOnlyActor(t *testing.T) {
+	// Nobody to notify, the database isn't touched
+	service := NewNotificationService(nil)
+	err := service.Notify([]string{"dosen-1"}, NewNotification{EventType: NotificationAchievementVerified, ActorID: "dosen-1"})
+	if err != nil {
+		t.Errorf("Expected no error without recipients, got %v", err)
+	}
+}
+
+func TestNotificationPreferences(t *testing.T) {
+	preferences := notificationPreferences(map[string]bool{
+		NotificationAchievementVerified: false,
+		NotificationAdvisorAssigned:     true,
+	})
+	if len(preferences) != len(notificationEventTypes) {
+		t.Fatalf("Expected every event type to be listed, got %d", len(preferences))
+	}
+
+	for _, preference := range preferences {
+		wantEnabled := preference.EventType != NotificationAchievementVerified
+		if preference.Enabled != wantEnabled {
+			t.Errorf("Expected %s enabled=%v", preference.EventType, wantEnabled)
+		}
+		if preference.Description == "" {
+			t.Errorf("Expected %s to have a description", preference.EventType)
+		}
+	}
+}
+
+func TestUpdatePreferencesUnknownEventType(t *testing.T) {
+	service := NewNotificationService(nil)
+	if _, err := service.UpdatePreferences("user-1", map[string]bool{"weekly_digest": false}); err == nil {
+		t.Error("Expected unknown event type to be refused")
+	}
+	if isNotificationEventType("weekly_digest") || !isNotificationEventType(NotificationVerificationRequested) {
+		t.Error("Unexpected event type check result")
+	}
+}
+
+var (
+	subjectColumns = []string{"title", "mahasiswa_id", "name", "advisor_id"}
+	stepColumns    = []string{"step_name", "assignee_rule", "assignee_role"}
+	contactColumns = []string{"id", "name", "email"}
+)
+
+// sentNotification is a notification INSERT run against the fake database
+type sentNotification struct {
+	Recipients    []string
+	EventType     string
+	Title         string
+	Message       string
+	AchievementID driver.Value
+	ActorID       driver.Value
+}
+
+func sentNotifications(t *testing.T, fake *fakeDB) []sentNotification {
+	t.Helper()
+	var sent []sentNotification
+	for _, call := range fake.callsContaining("INSERT INTO notifications") {
+		var recipients pq.StringArray
+		if err := recipients.Scan(call.Args[0]); err != nil {
+			t.Fatalf("Failed to read recipients: %v", err)
+		}
+		sent = append(sent, sentNotification{
+			Recipients:    recipients,
+			EventType:     call.Args[1].(string),
+			Title:         call.Args[2].(string),
+			Message:       call.Args[3].(string),
+			AchievementID: call.Args[4],
+			ActorID:       call.Args[5],
+		})
+	}
+	return sent
+}
+
+func TestAchievementSubmittedNotifiesAdvisorAndDelegates(t *testing.T) {
+	db, fake := newFakeDB(t)
+	fake.expectQuery("FROM achievements a", subjectColumns, []driver.Value{"Juara 1 Gemastik", "mhs-1", "Budi", "dosen-1"})
+	fake.expectQuery("FROM achievement_approvals", stepColumns, []driver.Value{"Dosen Wali", AssigneeRuleAdvisor, nil})
+	fake.expectQuery("FROM verifier_delegations", contactColumns,
+		[]driver.Value{"dosen-1", "Dr. Sari", "sari@example.com"},
+		[]driver.Value{"dosen-2", "Dr. Agus", "agus@example.com"})
+	fake.expectExec("INSERT INTO notifications", 2)
+
+	if err := NewNotificationService(db).achievementSubmitted("ach-1"); err != nil {
+		t.Fatalf("achievementSubmitted() error = %v", err)
+	}
+
+	sent := sentNotifications(t, fake)
+	if len(sent) != 1 {
+		t.Fatalf("Expected one notification, got %d", len(sent))
+	}
+	if !reflect.DeepEqual(sent[0].Recipients, []string{"dosen-1", "dosen-2"}) {
+		t.Errorf("Expected the dosen wali and their delegate, got %v", sent[0].Recipients)
+	}
+	if sent[0].EventType != NotificationVerificationRequested {
+		t.Errorf("Expected %s, got %s", NotificationVerificationRequested, sent[0].EventType)
+	}
+	if sent[0].AchievementID != "ach-1" || sent[0].ActorID != "mhs-1" {
+		t.Errorf("Expected achievement ach-1 by mhs-1, got %v by %v", sent[0].AchievementID, sent[0].ActorID)
+	}
+	if !strings.Contains(sent[0].Message, "Juara 1 Gemastik") || !strings.Contains(sent[0].Message, "Budi") ||
+		!strings.Contains(sent[0].Message, "Dosen Wali") {
+		t.Errorf("Expected the message to name the achievement, student and step, got %q", sent[0].Message)
+	}
+}
+
+func TestAchievementSubmittedWithoutPendingStep(t *testing.T) {
+	db, fake := newFakeDB(t)
+	fake.expectQuery("FROM achievements a", subjectColumns, []driver.Value{"Juara 1 Gemastik", "mhs-1", "Budi", nil})
+	fake.expectQuery("FROM achievement_approvals", stepColumns)
+
+	if err := NewNotificationService(db).achievementSubmitted("ach-1"); err != nil {
+		t.Fatalf("achievementSubmitted() error = %v", err)
+	}
+	if sent := sentNotifications(t, fake); len(sent) != 0 {
+		t.Errorf("Expected no notification without a pending step, got %d", len(sent))
+	}
+}
+
+func TestApprovalStepApprovedNotifiesStudentAndNextStep(t *testing.T) {
+	role := "kaprodi"
+	db, fake := newFakeDB(t)
+	fake.expectQuery("FROM achievements a", subjectColumns, []driver.Value{"Juara 1 Gemastik", "mhs-1", "Budi", "dosen-1"})
+	fake.expectExec("INSERT INTO notifications", 1)
+	fake.expectQuery("role = ANY($1)", contactColumns,
+		[]driver.Value{"kaprodi-1", "Dr. Rina", "rina@example.com"},
+		[]driver.Value{"dosen-1", "Dr. Sari", "sari@example.com"})
+	fake.expectExec("INSERT INTO notifications", 1)
+
+	nextStep := &AchievementApproval{StepName: "Kaprodi", AssigneeRule: AssigneeRuleRole, AssigneeRole: &role}
+	if err := NewNotificationService(db).approvalStepApproved("ach-1", "Dosen Wali", nextStep, "dosen-1"); err != nil {
+		t.Fatalf("approvalStepApproved() error = %v", err)
+	}
+
+	sent := sentNotifications(t, fake)
+	if len(sent) != 2 {
+		t.Fatalf("Expected two notifications, got %d", len(sent))
+	}
+
+	student := sent[0]
+	if !reflect.DeepEqual(student.Recipients, []string{"mhs-1"}) || student.EventType != NotificationApprovalStepApproved {
+		t.Errorf("Expected %s for the student, got %s for %v", NotificationApprovalStepApproved, student.EventType, student.Recipients)
+	}
+	if student.Title != "Tahap Dosen Wali disetujui" || !strings.Contains(student.Message, "Kaprodi") {
+		t.Errorf("Expected the approved and next step to be named, got %q / %q", student.Title, student.Message)
+	}
+	if student.ActorID != "dosen-1" {
+		t.Errorf("Expected actor dosen-1, got %v", student.ActorID)
+	}
+
+	// The approver also has the next step's role but isn't told about their own action
+	next := sent[1]
+	if !reflect.DeepEqual(next.Recipients, []string{"kaprodi-1"}) || next.EventType != NotificationVerificationRequested {
+		t.Errorf("Expected %s for kaprodi-1 only, got %s for %v", NotificationVerificationRequested, next.EventType, next.Recipients)
+	}
+	if role := fake.callsContaining("role = ANY($1)")[0].Args[0]; role != `{"kaprodi"}` {
+		t.Errorf("Expected the next step's role to be looked up, got %v", role)
+	}
+}
+
+func TestAdvisorAssignedNotifiesStudentAndAdvisor(t *testing.T) {
+	db, fake := newFakeDB(t)
+	fake.expectExec("INSERT INTO notifications", 1)
+	fake.expectExec("INSERT INTO notifications", 1)
+
+	student := &User{ID: "mhs-1", Name: "Budi"}
+	advisor := &User{ID: "dosen-1", Name: "Dr. Sari"}
+	if err := NewNotificationService(db).advisorAssigned(student, advisor, "admin-1"); err != nil {
+		t.Fatalf("advisorAssigned() error = %v", err)
+	}
+
+	sent := sentNotifications(t, fake)
+	if len(sent) != 2 {
+		t.Fatalf("Expected two notifications, got %d", len(sent))
+	}
+	if !reflect.DeepEqual(sent[0].Recipients, []string{"mhs-1"}) || !strings.Contains(sent[0].Message, "Dr. Sari") {
+		t.Errorf("Expected the student to be told about Dr. Sari, got %v %q", sent[0].Recipients, sent[0].Message)
+	}
+	if !reflect.DeepEqual(sent[1].Recipients, []string{"dosen-1"}) || !strings.Contains(sent[1].Message, "Budi") {
+		t.Errorf("Expected the advisor to be told about Budi, got %v %q", sent[1].Recipients, sent[1].Message)
+	}
+	for _, notification := range sent {
+		if notification.EventType != NotificationAdvisorAssigned || notification.ActorID != "admin-1" || notification.AchievementID != nil {
+			t.Errorf("Unexpected notification %+v", notification)
+		}
+	}
+}
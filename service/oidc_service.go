@@ -0,0 +1,444 @@
+package service
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"prestasi-mahasiswa/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// OIDC account policies, applied when no account is linked to the IdP subject yet
+const (
+	OIDCAccountPolicyLink   = "link"   // link to an existing account matched by claims, never create one
+	OIDCAccountPolicyCreate = "create" // link, or create a mahasiswa (NIM claim) or dosen_wali (NIP claim) account
+)
+
+// OIDCClaimMapping names the ID token claims read for a user, nested claims use dots (e.g. "attributes.nim")
+type OIDCClaimMapping struct {
+	Email         string
+	EmailVerified string
+	Name          string
+	NIM           string
+	NIP           string
+}
+
+// DefaultOIDCClaimMapping returns the standard claim names plus nim and nip
+func DefaultOIDCClaimMapping() OIDCClaimMapping {
+	return OIDCClaimMapping{
+		Email:         "email",
+		EmailVerified: "email_verified",
+		Name:          "name",
+		NIM:           "nim",
+		NIP:           "nip",
+	}
+}
+
+// OIDCIdentity is the user described by a verified ID token
+type OIDCIdentity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	NIM           string
+	NIP           string
+}
+
+// OIDCService signs users in through the university identity provider (authorization code + PKCE)
+// and maps the IdP identity to a row in users
+type OIDCService struct {
+	DB            *sql.DB
+	Provider      *utils.OIDCProvider // nil when single sign-on is not configured
+	LoginService  *LoginService
+	ClaimMapping  OIDCClaimMapping
+	AccountPolicy string
+	MatchBy       []string // "email" links a new identity to the account with its verified email, NIM and NIP claims are never matched
+	StateLifetime time.Duration
+}
+
+func NewOIDCService(db *sql.DB, provider *utils.OIDCProvider, loginService *LoginService) *OIDCService {
+	return &OIDCService{
+		DB:            db,
+		Provider:      provider,
+		LoginService:  loginService,
+		ClaimMapping:  DefaultOIDCClaimMapping(),
+		AccountPolicy: OIDCAccountPolicyLink,
+		MatchBy:       []string{"email"},
+		StateLifetime: 10 * time.Minute,
+	}
+}
+
+// Enabled reports whether single sign-on is configured
+func (s *OIDCService) Enabled() bool {
+	return s.Provider != nil
+}
+
+// StartLogin stores a new login state and returns the IdP authorization URL along with the state,
+// which the browser must present again on the callback
+func (s *OIDCService) StartLogin() (string, string, error) {
+	return s.startAuthorization("")
+}
+
+// StartLink is StartLogin for a signed-in user linking their account to their IdP identity,
+// the callback links the identity instead of signing in
+func (s *OIDCService) StartLink(userID string) (string, string, error) {
+	return s.startAuthorization(userID)
+}
+
+func (s *OIDCService) startAuthorization(linkUserID string) (string, string, error) {
+	state, err := utils.GenerateRandomToken()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate login state: %w", err)
+	}
+	nonce, err := utils.GenerateRandomToken()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	verifier, err := utils.GeneratePKCEVerifier()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate PKCE verifier: %w", err)
+	}
+
+	authURL, err := s.Provider.AuthCodeURL(state, nonce, utils.PKCEChallenge(verifier))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to build authorization URL: %w", err)
+	}
+
+	_, err = s.DB.Exec(`
+		INSERT INTO oidc_login_states (state_hash, nonce, code_verifier, expires_at, link_user_id)
+		VALUES ($1, $2, $3, $4, $5)
+	`, utils.HashToken(state), nonce, verifier, time.Now().Add(s.StateLifetime), nullIfEmpty(linkUserID))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to store login state: %w", err)
+	}
+
+	return authURL, state, nil
+}
+
+// CompleteLogin handles the IdP callback: it consumes the state, redeems the code, verifies the
+// ID token and returns the linked, created or matched user. For a state started by StartLink the
+// identity is linked to that user instead and linked is true, no user is returned.
+func (s *OIDCService) CompleteLogin(state, code, ipAddress, userAgent string) (user *UserData, linked bool, err error) {
+	if state == "" || code == "" {
+		return nil, false, errors.New("state and code are required")
+	}
+
+	var nonce, verifier string
+	var linkUserID sql.NullString
+	err = s.DB.QueryRow(`
+		UPDATE oidc_login_states SET used_at = CURRENT_TIMESTAMP
+		WHERE state_hash = $1 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+		RETURNING nonce, code_verifier, link_user_id
+	`, utils.HashToken(state)).Scan(&nonce, &verifier, &linkUserID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, false, errors.New("invalid or expired login state")
+		}
+		return nil, false, fmt.Errorf("failed to consume login state: %w", err)
+	}
+
+	rawIDToken, err := s.Provider.Exchange(code, verifier)
+	if err != nil {
+		// Clients only see a generic error, the details help diagnosing IdP configuration
+		fmt.Printf("Warning: single sign-on failed: %v\n", err)
+		return nil, false, fmt.Errorf("single sign-on failed: %w", err)
+	}
+
+	claims, err := s.Provider.VerifyIDToken(rawIDToken, nonce)
+	if err != nil {
+		fmt.Printf("Warning: single sign-on failed: %v\n", err)
+		return nil, false, fmt.Errorf("single sign-on failed: %w", err)
+	}
+
+	identity, err := mapOIDCClaims(claims, s.ClaimMapping)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if linkUserID.Valid {
+		if err := s.linkIdentity(linkUserID.String, identity); err != nil {
+			return nil, false, err
+		}
+		return nil, true, nil
+	}
+
+	userID, err := s.resolveUser(identity)
+	if err != nil {
+		return nil, false, err
+	}
+
+	user, err = s.LoginService.GetUserInfo(userID)
+	if err != nil {
+		if err.Error() == "user not found" {
+			s.LoginService.recordLoginAttempt(&userID, identity.Email, ipAddress, userAgent, false, LoginReasonInactive)
+			return nil, false, errors.New("account is inactive")
+		}
+		return nil, false, err
+	}
+
+	s.LoginService.recordLoginAttempt(&user.ID, user.Email, ipAddress, userAgent, true, LoginReasonOIDC)
+	return user, false, nil
+}
+
+// linkIdentity links an IdP identity to the signed-in user who asked for it, an identity already
+// linked to another account stays with that account
+func (s *OIDCService) linkIdentity(userID string, identity *OIDCIdentity) error {
+	var linkedUserID string
+	err := s.DB.QueryRow(`
+		INSERT INTO user_identities (user_id, issuer, subject, email)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (issuer, subject) DO UPDATE SET email = EXCLUDED.email
+		WHERE user_identities.user_id = EXCLUDED.user_id
+		RETURNING user_id
+	`, userID, s.Provider.Issuer, identity.Subject, nullIfEmpty(identity.Email)).Scan(&linkedUserID)
+	if err == sql.ErrNoRows {
+		return errors.New("this identity is already linked to another account")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to link identity: %w", err)
+	}
+	return nil
+}
+
+// resolveUser finds the account for identity: a linked subject first, then an account matched by
+// claims (linked from then on), then a new account when the policy allows it
+func (s *OIDCService) resolveUser(identity *OIDCIdentity) (string, error) {
+	issuer := s.Provider.Issuer
+
+	var userID string
+	err := s.DB.QueryRow(`
+		UPDATE user_identities SET last_login_at = CURRENT_TIMESTAMP, email = $3
+		WHERE issuer = $1 AND subject = $2
+		RETURNING user_id
+	`, issuer, identity.Subject, nullIfEmpty(identity.Email)).Scan(&userID)
+	if err == nil {
+		return userID, nil
+	}
+	if err != sql.ErrNoRows {
+		return "", fmt.Errorf("failed to get linked identity: %w", err)
+	}
+
+	userID, err = s.matchUser(identity)
+	if err != nil {
+		return "", err
+	}
+
+	if userID == "" {
+		if s.AccountPolicy != OIDCAccountPolicyCreate {
+			return "", errors.New("no account is linked to this identity, contact the administrator")
+		}
+		return s.createUser(identity)
+	}
+
+	_, err = s.DB.Exec(`
+		INSERT INTO user_identities (user_id, issuer, subject, email, last_login_at)
+		VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP)
+		ON CONFLICT (issuer, subject) DO NOTHING
+	`, userID, issuer, identity.Subject, nullIfEmpty(identity.Email))
+	if err != nil {
+		return "", fmt.Errorf("failed to link identity: %w", err)
+	}
+
+	// The IdP vouches for the address, a pending email verification is no longer needed
+	if identity.EmailVerified {
+		_, err = s.DB.Exec(`
+			UPDATE users SET email_verification_pending = false, email_verified_at = CURRENT_TIMESTAMP, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $1 AND email_verification_pending = true AND LOWER(email) = LOWER($2)
+		`, userID, identity.Email)
+		if err != nil {
+			fmt.Printf("Warning: failed to mark email as verified: %v\n", err)
+		}
+	}
+
+	return userID, nil
+}
+
+// matchUser looks up an existing account by the email the IdP verified. NIM and NIP claims are
+// not vouched for by the IdP, accounts are linked by them only through StartLink.
+func (s *OIDCService) matchUser(identity *OIDCIdentity) (string, error) {
+	if !identity.EmailVerified {
+		return "", nil
+	}
+	return findUserByAttributes(s.DB, s.MatchBy, identity.Email, "", "")
+}
+
+// findUserByAttributes returns the first account whose email, nim or nip (in matchBy order) equals
+// the given value, empty values are skipped. An empty id means no account matched.
+func findUserByAttributes(db *sql.DB, matchBy []string, email, nim, nip string) (string, error) {
+	for _, attribute := range matchBy {
+		var column, value string
+		switch attribute {
+		case "email":
+			column, value = "LOWER(email)", strings.ToLower(email)
+		case "nim":
+			column, value = "nim", nim
+		case "nip":
+			column, value = "nip", nip
+		default:
+			continue
+		}
+		if value == "" {
+			continue
+		}
+
+		var userID string
+		err := db.QueryRow(fmt.Sprintf(`SELECT id FROM users WHERE %s = $1`, column), value).Scan(&userID)
+		if err == nil {
+			return userID, nil
+		}
+		if err != sql.ErrNoRows {
+			return "", fmt.Errorf("failed to match user: %w", err)
+		}
+	}
+
+	return "", nil
+}
+
+// createUser provisions an account for an identity unknown to the system. The random password
+// can't be used, the user signs in through the IdP or sets one with the password reset flow.
+func (s *OIDCService) createUser(identity *OIDCIdentity) (string, error) {
+	role, err := oidcRole(identity)
+	if err != nil {
+		return "", err
+	}
+	if identity.Email == "" || !identity.EmailVerified {
+		return "", errors.New("identity provider did not supply a verified email address")
+	}
+
+	name := identity.Name
+	if name == "" {
+		name = identity.Email
+	}
+
+	randomPassword, err := utils.GenerateRandomToken()
+	if err != nil {
+		return "", fmt.Errorf("failed to generate password: %w", err)
+	}
+	hashedPassword, err := utils.HashPassword(randomPassword)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return "", fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	userID := uuid.New().String()
+	_, err = tx.Exec(`
+		INSERT INTO users (id, nim, nip, name, email, password, role, is_active, email_verified_at, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, true, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+	`, userID, nullIfEmpty(identity.NIM), nullIfEmpty(identity.NIP), name, identity.Email, hashedPassword, role)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return "", errors.New("an account with this email, NIM or NIP already exists, contact the administrator to link it")
+		}
+		return "", fmt.Errorf("failed to create user: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO user_identities (user_id, issuer, subject, email, last_login_at)
+		VALUES ($1, $2, $3, $4, CURRENT_TIMESTAMP)
+	`, userID, s.Provider.Issuer, identity.Subject, identity.Email)
+	if err != nil {
+		return "", fmt.Errorf("failed to link identity: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("failed to commit user: %w", err)
+	}
+
+	return userID, nil
+}
+
+// CleanupExpiredLoginStates removes used and expired single sign-on states
+func (s *OIDCService) CleanupExpiredLoginStates() error {
+	result, err := s.DB.Exec(`DELETE FROM oidc_login_states WHERE expires_at < CURRENT_TIMESTAMP - INTERVAL '1 day'`)
+	if err != nil {
+		return fmt.Errorf("failed to cleanup OIDC login states: %w", err)
+	}
+
+	rowsDeleted, _ := result.RowsAffected()
+	fmt.Printf("Cleaned up %d expired OIDC login states\n", rowsDeleted)
+
+	return nil
+}
+
+// oidcRole picks the role of a provisioned account, admins are never created from IdP claims
+func oidcRole(identity *OIDCIdentity) (string, error) {
+	switch {
+	case identity.NIM != "":
+		return "mahasiswa", nil
+	case identity.NIP != "":
+		return "dosen_wali", nil
+	default:
+		return "", errors.New("identity provider did not supply a NIM or NIP, contact the administrator")
+	}
+}
+
+// mapOIDCClaims reads the mapped claims of a verified ID token
+func mapOIDCClaims(claims jwt.MapClaims, mapping OIDCClaimMapping) (*OIDCIdentity, error) {
+	identity := &OIDCIdentity{
+		Subject: oidcClaimString(claims, "sub"),
+		Email:   strings.TrimSpace(oidcClaimString(claims, mapping.Email)),
+		Name:    strings.TrimSpace(oidcClaimString(claims, mapping.Name)),
+		NIM:     strings.TrimSpace(oidcClaimString(claims, mapping.NIM)),
+		NIP:     strings.TrimSpace(oidcClaimString(claims, mapping.NIP)),
+	}
+
+	if identity.Subject == "" {
+		return nil, errors.New("single sign-on failed: ID token has no subject")
+	}
+
+	verified, _ := strconv.ParseBool(oidcClaimString(claims, mapping.EmailVerified))
+	identity.EmailVerified = identity.Email != "" && verified
+
+	return identity, nil
+}
+
+// oidcClaimString returns a claim as string, following dots into nested objects.
+// Some IdPs send NIM/NIP as numbers, ID tokens are decoded with json.Number to keep every digit.
+func oidcClaimString(claims map[string]interface{}, path string) string {
+	if path == "" {
+		return ""
+	}
+
+	var value interface{} = claims
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		value = object[key]
+	}
+
+	switch v := value.(type) {
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case json.Number:
+		return v.String()
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []interface{}:
+		// Multi-valued attributes (e.g. from LDAP backed IdPs) use the first value
+		if len(v) > 0 {
+			if first, ok := v[0].(string); ok {
+				return first
+			}
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,117 @@
+package service
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"testing"
+
+	"prestasi-mahasiswa/utils"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestMapOIDCClaims(t *testing.T) {
+	claims := jwt.MapClaims{
+		"sub":            "user-123",
+		"email":          " Mahasiswa@unair.ac.id ",
+		"email_verified": "true", // some IdPs send booleans as strings
+		"name":           "Budi Santoso",
+		"nim":            []interface{}{"187221001", "187221999"},
+		"employee":       map[string]interface{}{"nip": json.Number("198501012010011001")},
+	}
+
+	mapping := DefaultOIDCClaimMapping()
+	mapping.NIP = "employee.nip"
+
+	identity, err := mapOIDCClaims(claims, mapping)
+	if err != nil {
+		t.Fatalf("Failed to map claims: %v", err)
+	}
+
+	if identity.Subject != "user-123" || identity.Email != "Mahasiswa@unair.ac.id" || !identity.EmailVerified {
+		t.Errorf("Unexpected identity: %+v", identity)
+	}
+	if identity.NIM != "187221001" {
+		t.Errorf("Expected first NIM value, got %q", identity.NIM)
+	}
+	if identity.NIP != "198501012010011001" {
+		t.Errorf("Expected every NIP digit, got %q", identity.NIP)
+	}
+}
+
+func TestMapOIDCClaimsUnverifiedEmail(t *testing.T) {
+	identity, err := mapOIDCClaims(jwt.MapClaims{"sub": "user-123", "email": "dosen@unair.ac.id"}, DefaultOIDCClaimMapping())
+	if err != nil {
+		t.Fatalf("Failed to map claims: %v", err)
+	}
+	if identity.EmailVerified {
+		t.Error("Email without email_verified claim must not count as verified")
+	}
+
+	if _, err := mapOIDCClaims(jwt.MapClaims{"email": "dosen@unair.ac.id"}, DefaultOIDCClaimMapping()); err == nil {
+		t.Error("Expected ID token without subject to be rejected")
+	}
+}
+
+func TestOIDCRole(t *testing.T) {
+	tests := []struct {
+		identity OIDCIdentity
+		role     string
+		wantErr  bool
+	}{
+		{OIDCIdentity{NIM: "187221001"}, "mahasiswa", false},
+		{OIDCIdentity{NIP: "198501012010011001"}, "dosen_wali", false},
+		{OIDCIdentity{Email: "staff@unair.ac.id"}, "", true},
+	}
+
+	for _, tt := range tests {
+		role, err := oidcRole(&tt.identity)
+		if (err != nil) != tt.wantErr || role != tt.role {
+			t.Errorf("oidcRole(%+v) = %q, %v; want %q", tt.identity, role, err, tt.role)
+		}
+	}
+}
+
+func TestMatchUserOnlyByVerifiedEmail(t *testing.T) {
+	db, fake := newFakeDB(t)
+	service := NewOIDCService(db, &utils.OIDCProvider{Issuer: "https://sso.unair.ac.id"}, nil)
+
+	// Unverified claims never pick an account, no query is made
+	userID, err := service.matchUser(&OIDCIdentity{Subject: "sub-1", Email: "budi@unair.ac.id", NIM: "187221001", NIP: "198501012010011001"})
+	if err != nil || userID != "" {
+		t.Errorf("Expected no match on unverified claims, got %q, %v", userID, err)
+	}
+
+	fake.expectQuery("LOWER(email)", []string{"id"}, []driver.Value{"user-1"})
+	userID, err = service.matchUser(&OIDCIdentity{Subject: "sub-1", Email: "Budi@unair.ac.id", EmailVerified: true, NIM: "187221001"})
+	if err != nil || userID != "user-1" {
+		t.Errorf("Expected a match on the verified email, got %q, %v", userID, err)
+	}
+	if email := fake.callsContaining("LOWER(email)")[0].Args[0]; email != "budi@unair.ac.id" {
+		t.Errorf("Expected the email to be matched case-insensitively, got %v", email)
+	}
+	if len(fake.callsContaining("nim")) != 0 {
+		t.Error("Expected the NIM claim not to be matched")
+	}
+}
+
+func TestLinkIdentity(t *testing.T) {
+	db, fake := newFakeDB(t)
+	service := NewOIDCService(db, &utils.OIDCProvider{Issuer: "https://sso.unair.ac.id"}, nil)
+	identity := &OIDCIdentity{Subject: "sub-1", Email: "budi@unair.ac.id"}
+
+	fake.expectQuery("INSERT INTO user_identities", []string{"user_id"}, []driver.Value{"user-1"})
+	if err := service.linkIdentity("user-1", identity); err != nil {
+		t.Fatalf("linkIdentity() error = %v", err)
+	}
+	args := fake.callsContaining("INSERT INTO user_identities")[0].Args
+	if args[0] != "user-1" || args[1] != "https://sso.unair.ac.id" || args[2] != "sub-1" {
+		t.Errorf("Unexpected link %v", args)
+	}
+
+	// The identity belongs to someone else, the conflict update doesn't apply and nothing is returned
+	fake.expectQuery("INSERT INTO user_identities", []string{"user_id"})
+	if err := service.linkIdentity("user-2", identity); err == nil || err.Error() != "this identity is already linked to another account" {
+		t.Errorf("Expected an identity linked elsewhere to be refused, got %v", err)
+	}
+}
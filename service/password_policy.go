@@ -0,0 +1,122 @@
+package service
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// PasswordPolicy is the set of rules every new password must satisfy
+type PasswordPolicy struct {
+	MinLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	HistorySize   int // number of previous passwords that can't be reused, 0 disables the check
+
+	breachedPasswords map[string]struct{}
+}
+
+// DefaultPasswordPolicy returns the policy used when nothing is configured
+func DefaultPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{
+		MinLength:    8,
+		RequireUpper: true,
+		RequireLower: true,
+		RequireDigit: true,
+		HistorySize:  5,
+	}
+}
+
+// LoadBreachedPasswords reads a local list of leaked passwords, one per line, lines starting with # are ignored
+func (p *PasswordPolicy) LoadBreachedPasswords(path string) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open breached password list: %w", err)
+	}
+	defer file.Close()
+
+	breached := make(map[string]struct{})
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		breached[strings.ToLower(line)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read breached password list: %w", err)
+	}
+
+	p.breachedPasswords = breached
+	return len(breached), nil
+}
+
+// PasswordPolicyError refuses a new password that breaks the policy or was used before,
+// handlers report it to the user as a validation error
+type PasswordPolicyError struct {
+	Message string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return e.Message
+}
+
+// IsPasswordPolicyError reports whether err refuses a new password
+func IsPasswordPolicyError(err error) bool {
+	var policyErr *PasswordPolicyError
+	return errors.As(err, &policyErr)
+}
+
+// Validate checks length, character classes and the breached list, refusals are *PasswordPolicyError
+func (p PasswordPolicy) Validate(password string) error {
+	if strings.TrimSpace(password) == "" {
+		return &PasswordPolicyError{Message: "password is required"}
+	}
+
+	if len([]rune(password)) < p.MinLength {
+		return &PasswordPolicyError{Message: fmt.Sprintf("password must be at least %d characters", p.MinLength)}
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			hasSymbol = true
+		}
+	}
+
+	missing := []string{}
+	if p.RequireUpper && !hasUpper {
+		missing = append(missing, "an uppercase letter")
+	}
+	if p.RequireLower && !hasLower {
+		missing = append(missing, "a lowercase letter")
+	}
+	if p.RequireDigit && !hasDigit {
+		missing = append(missing, "a digit")
+	}
+	if p.RequireSymbol && !hasSymbol {
+		missing = append(missing, "a symbol")
+	}
+	if len(missing) > 0 {
+		return &PasswordPolicyError{Message: fmt.Sprintf("password must contain %s", strings.Join(missing, ", "))}
+	}
+
+	if _, breached := p.breachedPasswords[strings.ToLower(password)]; breached {
+		return &PasswordPolicyError{Message: "password appears in a list of leaked passwords, choose a different one"}
+	}
+
+	return nil
+}
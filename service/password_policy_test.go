@@ -0,0 +1,122 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPasswordPolicyValidate(t *testing.T) {
+	policy := DefaultPasswordPolicy()
+
+	tests := []struct {
+		password string
+		wantErr  string
+	}{
+		{"", "password is required"},
+		{"Ab1", "password must be at least 8 characters"},
+		{"alllowercase1", "password must contain an uppercase letter"},
+		{"ALLUPPERCASE1", "password must contain a lowercase letter"},
+		{"NoDigitsHere", "password must contain a digit"},
+		{"Prestasi2024", ""},
+	}
+
+	for _, tt := range tests {
+		err := policy.Validate(tt.password)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("Validate(%q) returned %v, want nil", tt.password, err)
+			}
+			continue
+		}
+		if err == nil || err.Error() != tt.wantErr {
+			t.Errorf("Validate(%q) = %v, want %q", tt.password, err, tt.wantErr)
+		}
+	}
+}
+
+func TestPasswordPolicyRequireSymbol(t *testing.T) {
+	policy := DefaultPasswordPolicy()
+	policy.RequireSymbol = true
+
+	if err := policy.Validate("Prestasi2024"); err == nil || err.Error() != "password must contain a symbol" {
+		t.Errorf("Expected missing symbol error, got %v", err)
+	}
+	if err := policy.Validate("Prestasi-2024"); err != nil {
+		t.Errorf("Expected valid password, got %v", err)
+	}
+}
+
+func TestPasswordPolicyErrorsAreTyped(t *testing.T) {
+	policy := DefaultPasswordPolicy()
+	policy.RequireSymbol = true
+
+	// Handlers rely on the type to answer 400
+	for _, password := range []string{"", "short", "nouppercase1!", "NOLOWERCASE1!", "NoDigits!!", "NoSymbol123"} {
+		err := policy.Validate(password)
+		if err == nil || !IsPasswordPolicyError(err) || !strings.HasPrefix(err.Error(), "password") {
+			t.Errorf("Validate(%q) = %v, want a PasswordPolicyError", password, err)
+		}
+	}
+
+	if !IsPasswordPolicyError(fmt.Errorf("failed to register: %w", validatePassword("abc"))) {
+		t.Error("Expected a wrapped policy error to be recognized")
+	}
+	if IsPasswordPolicyError(errors.New("password_history table is missing")) {
+		t.Error("Expected other errors mentioning password not to count as policy errors")
+	}
+}
+
+func TestPasswordPolicyBreachedList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	content := "# comment\nPassword123\n\n  Qwerty123  \n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write list: %v", err)
+	}
+
+	policy := DefaultPasswordPolicy()
+	count, err := policy.LoadBreachedPasswords(path)
+	if err != nil {
+		t.Fatalf("Failed to load list: %v", err)
+	}
+	if count != 2 {
+		t.Errorf("Expected 2 breached passwords, got %d", count)
+	}
+
+	if err := policy.Validate("pASSWORD123"); err == nil || !strings.Contains(err.Error(), "leaked") {
+		t.Errorf("Expected breached password to be rejected case-insensitively, got %v", err)
+	}
+	if err := policy.Validate("QWERTY123x"); err != nil {
+		t.Errorf("Expected password not in the list to pass, got %v", err)
+	}
+	if err := policy.Validate("Qwerty123"); err == nil || !strings.Contains(err.Error(), "leaked") {
+		t.Errorf("Expected trimmed list entry to match, got %v", err)
+	}
+	if err := policy.Validate("Prestasi2024"); err != nil {
+		t.Errorf("Expected password outside the list to pass, got %v", err)
+	}
+}
+
+func TestBundledBreachedPasswordList(t *testing.T) {
+	policy := DefaultPasswordPolicy()
+	if _, err := policy.LoadBreachedPasswords("../config/breached_passwords.txt"); err != nil {
+		t.Fatalf("Failed to load bundled list: %v", err)
+	}
+
+	if err := policy.Validate("Password123"); err == nil {
+		t.Error("Expected Password123 to be rejected by the bundled list")
+	}
+}
+
+func TestValidateNewPasswordWithoutService(t *testing.T) {
+	// Services created without a PasswordService keep the basic length rule
+	if err := validateNewPassword(nil, "", "123456"); err != nil {
+		t.Errorf("Expected basic rule to accept 6 characters, got %v", err)
+	}
+	if err := validateNewPassword(nil, "", "12345"); err == nil {
+		t.Error("Expected basic rule to reject 5 characters")
+	}
+}
@@ -0,0 +1,236 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"prestasi-mahasiswa/utils"
+)
+
+// PasswordResetService issues single-use reset tokens by email and sets a new password with them.
+// Only the SHA256 hash of a token is stored, like refresh tokens.
+type PasswordResetService struct {
+	DB                     *sql.DB
+	Mailer                 utils.Mailer
+	RefreshTokenService    *RefreshTokenService
+	TokenRevocationService *TokenRevocationService
+	LoginService           *LoginService
+	PasswordService        *PasswordService // password policy and history, optional
+	ResetURL               string           // link sent by email, the token is appended as ?token=
+	TokenLifetime          time.Duration
+	ResendInterval         time.Duration // at most one email per user within this interval
+}
+
+func NewPasswordResetService(db *sql.DB, mailer utils.Mailer, refreshTokenService *RefreshTokenService, tokenRevocationService *TokenRevocationService, loginService *LoginService, resetURL string, tokenLifetime time.Duration) *PasswordResetService {
+	return &PasswordResetService{
+		DB:                     db,
+		Mailer:                 mailer,
+		RefreshTokenService:    refreshTokenService,
+		TokenRevocationService: tokenRevocationService,
+		LoginService:           loginService,
+		ResetURL:               resetURL,
+		TokenLifetime:          tokenLifetime,
+		ResendInterval:         time.Minute,
+	}
+}
+
+// RequestPasswordReset emails a reset link. The account lookup, token and email happen in the
+// background, so the response takes as long and looks the same whether or not the email is
+// registered and the endpoint can't be used to discover accounts.
+func (s *PasswordResetService) RequestPasswordReset(email, ipAddress string) error {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return errors.New("email is required")
+	}
+
+	go func() {
+		if err := s.sendResetLink(email, ipAddress); err != nil {
+			fmt.Printf("Warning: failed to process password reset request: %v\n", err)
+		}
+	}()
+
+	return nil
+}
+
+// sendResetLink issues a reset token for an active account and emails it, unknown or
+// inactive emails are ignored
+func (s *PasswordResetService) sendResetLink(email, ipAddress string) error {
+	var userID, name string
+	err := s.DB.QueryRow(`SELECT id, name FROM users WHERE email = $1 AND is_active = true`, email).Scan(&userID, &name)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	var recentRequest bool
+	err = s.DB.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM password_reset_tokens
+			WHERE user_id = $1 AND created_at > CURRENT_TIMESTAMP - ($2 * INTERVAL '1 second')
+		)
+	`, userID, s.ResendInterval.Seconds()).Scan(&recentRequest)
+	if err != nil {
+		return fmt.Errorf("failed to check password reset requests: %w", err)
+	}
+	if recentRequest {
+		return nil
+	}
+
+	token, err := utils.GenerateRandomToken()
+	if err != nil {
+		return fmt.Errorf("failed to generate reset token: %w", err)
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Only the newest link works
+	_, err = tx.Exec(`UPDATE password_reset_tokens SET used_at = CURRENT_TIMESTAMP WHERE user_id = $1 AND used_at IS NULL`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to invalidate previous reset tokens: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO password_reset_tokens (user_id, token_hash, expires_at, ip_address)
+		VALUES ($1, $2, $3, $4)
+	`, userID, utils.HashToken(token), time.Now().Add(s.TokenLifetime), nullIfEmpty(ipAddress))
+	if err != nil {
+		return fmt.Errorf("failed to store reset token: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit reset token: %w", err)
+	}
+
+	message := utils.EmailMessage{
+		To:      email,
+		Subject: "Reset password Sistem Pelaporan Prestasi Mahasiswa",
+		Body: fmt.Sprintf("Halo %s,\n\nKami menerima permintaan reset password untuk akun Anda. Buka tautan berikut untuk membuat password baru:\n\n%s\n\nTautan berlaku selama %d menit dan hanya dapat digunakan sekali. Abaikan email ini jika Anda tidak meminta reset password.\n",
+			name, s.resetLink(token), int(s.TokenLifetime.Minutes())),
+	}
+	if err := s.Mailer.Send(message); err != nil {
+		return fmt.Errorf("failed to send password reset email: %w", err)
+	}
+
+	return nil
+}
+
+// ResetPassword consumes a reset token, sets the new password and ends all sessions of the user
+func (s *PasswordResetService) ResetPassword(token, newPassword string) error {
+	if token == "" {
+		return errors.New("reset token is required")
+	}
+
+	tokenHash := utils.HashToken(token)
+
+	// Look the user up first so a password rejected by the policy doesn't burn the token
+	var userID string
+	err := s.DB.QueryRow(`
+		SELECT user_id FROM password_reset_tokens
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+	`, tokenHash).Scan(&userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return errors.New("invalid or expired reset token")
+		}
+		return fmt.Errorf("failed to get reset token: %w", err)
+	}
+
+	if err := validateNewPassword(s.PasswordService, userID, newPassword); err != nil {
+		return err
+	}
+
+	hashedPassword, err := utils.HashPassword(newPassword)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Consuming and checking happen in one statement so a token can't be used twice
+	result, err := tx.Exec(`
+		UPDATE password_reset_tokens
+		SET used_at = CURRENT_TIMESTAMP
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > CURRENT_TIMESTAMP
+	`, tokenHash)
+	if err != nil {
+		return fmt.Errorf("failed to consume reset token: %w", err)
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return errors.New("invalid or expired reset token")
+	}
+
+	result, err = tx.Exec(`UPDATE users SET password = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2 AND is_active = true`, hashedPassword, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return errors.New("invalid or expired reset token")
+	}
+	if err := recordPassword(s.PasswordService, tx, userID, hashedPassword); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit password reset: %w", err)
+	}
+	s.endSessions(userID)
+
+	LogSecurityEvent(s.DB, SecurityEvent{UserID: userID, EventType: SecurityEventPasswordReset})
+
+	return nil
+}
+
+// endSessions revokes every session after a reset, the password may have been known to someone else
+func (s *PasswordResetService) endSessions(userID string) {
+	if err := s.RefreshTokenService.RevokeUserRefreshTokens(userID); err != nil {
+		fmt.Printf("Warning: failed to revoke refresh tokens after password reset: %v\n", err)
+	}
+
+	if err := s.TokenRevocationService.InvalidateUserTokens(userID, RevocationReasonPasswordReset); err != nil {
+		fmt.Printf("Warning: failed to revoke access tokens after password reset: %v\n", err)
+	}
+
+	// Proving access to the mailbox also lifts a login lockout
+	if err := s.LoginService.UnlockAccount(userID); err != nil {
+		fmt.Printf("Warning: failed to clear login lockout after password reset: %v\n", err)
+	}
+}
+
+func (s *PasswordResetService) resetLink(token string) string {
+	separator := "?"
+	if strings.Contains(s.ResetURL, "?") {
+		separator = "&"
+	}
+	return s.ResetURL + separator + "token=" + url.QueryEscape(token)
+}
+
+// CleanupExpiredResetTokens removes used and expired reset tokens
+func (s *PasswordResetService) CleanupExpiredResetTokens() error {
+	query := `
+		DELETE FROM password_reset_tokens
+		WHERE expires_at < CURRENT_TIMESTAMP OR used_at IS NOT NULL
+	`
+	result, err := s.DB.Exec(query)
+	if err != nil {
+		return fmt.Errorf("failed to cleanup reset tokens: %w", err)
+	}
+
+	rowsDeleted, _ := result.RowsAffected()
+	fmt.Printf("Cleaned up %d expired password reset tokens\n", rowsDeleted)
+
+	return nil
+}
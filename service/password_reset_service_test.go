@@ -0,0 +1,47 @@
+package service
+
+import (
+	"net/url"
+	"testing"
+)
+
+func TestPasswordResetLink(t *testing.T) {
+	tests := []struct {
+		resetURL string
+		want     string
+	}{
+		{"http://localhost:3000/reset-password", "http://localhost:3000/reset-password?token=abc123"},
+		{"http://localhost:3000/#/reset?lang=id", "http://localhost:3000/#/reset?lang=id&token=abc123"},
+	}
+
+	for _, tt := range tests {
+		s := &PasswordResetService{ResetURL: tt.resetURL}
+		if got := s.resetLink("abc123"); got != tt.want {
+			t.Errorf("resetLink with %s = %s; want %s", tt.resetURL, got, tt.want)
+		}
+	}
+}
+
+func TestPasswordResetLinkEscapesToken(t *testing.T) {
+	s := &PasswordResetService{ResetURL: "http://localhost:3000/reset-password"}
+
+	link, err := url.Parse(s.resetLink("a+b&c"))
+	if err != nil {
+		t.Fatalf("Failed to parse reset link: %v", err)
+	}
+	if link.Query().Get("token") != "a+b&c" {
+		t.Errorf("Expected token to survive URL encoding, got %q", link.Query().Get("token"))
+	}
+}
+
+func TestValidatePassword(t *testing.T) {
+	if err := validatePassword(""); err == nil || err.Error() != "password is required" {
+		t.Errorf("Expected password is required, got %v", err)
+	}
+	if err := validatePassword("12345"); err == nil {
+		t.Error("Expected error for short password")
+	}
+	if err := validatePassword("123456"); err != nil {
+		t.Errorf("Expected valid password, got %v", err)
+	}
+}
@@ -0,0 +1,152 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"prestasi-mahasiswa/utils"
+)
+
+// PasswordService applies the password policy wherever a password is set
+// and keeps the hashes of previous passwords to prevent reuse
+type PasswordService struct {
+	DB     *sql.DB
+	Policy PasswordPolicy
+}
+
+func NewPasswordService(db *sql.DB, policy PasswordPolicy) *PasswordService {
+	return &PasswordService{
+		DB:     db,
+		Policy: policy,
+	}
+}
+
+// ValidateNewPassword checks the policy and, for an existing user, that the password
+// is not the current one or one of the last HistorySize passwords
+func (s *PasswordService) ValidateNewPassword(userID, password string) error {
+	if err := s.Policy.Validate(password); err != nil {
+		return err
+	}
+
+	if userID == "" || s.Policy.HistorySize <= 0 {
+		return nil
+	}
+
+	// The current hash is checked too, accounts created before password history have no entries
+	query := `
+		SELECT password FROM users WHERE id = $1
+		UNION ALL
+		(SELECT password_hash FROM password_history WHERE user_id = $1 ORDER BY created_at DESC LIMIT $2)
+	`
+	rows, err := s.DB.Query(query, userID, s.Policy.HistorySize)
+	if err != nil {
+		return fmt.Errorf("failed to check password history: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var hashedPassword string
+		if err := rows.Scan(&hashedPassword); err != nil {
+			return fmt.Errorf("failed to scan password history: %w", err)
+		}
+		if utils.ComparePassword(hashedPassword, password) == nil {
+			return &PasswordPolicyError{Message: fmt.Sprintf("password must not match any of your last %d passwords", s.Policy.HistorySize)}
+		}
+	}
+
+	return nil
+}
+
+// execer is implemented by *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// RecordPassword stores a newly set password hash and drops entries beyond HistorySize. It runs in
+// the transaction that sets the password, so a password is never set without its history entry.
+func (s *PasswordService) RecordPassword(tx execer, userID, hashedPassword string) error {
+	if s.Policy.HistorySize <= 0 {
+		return nil
+	}
+
+	_, err := tx.Exec(`INSERT INTO password_history (user_id, password_hash) VALUES ($1, $2)`, userID, hashedPassword)
+	if err != nil {
+		return fmt.Errorf("failed to record password history: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		DELETE FROM password_history
+		WHERE user_id = $1 AND id NOT IN (
+			SELECT id FROM password_history WHERE user_id = $1 ORDER BY created_at DESC LIMIT $2
+		)
+	`, userID, s.Policy.HistorySize)
+	if err != nil {
+		return fmt.Errorf("failed to prune password history: %w", err)
+	}
+	return nil
+}
+
+// validateNewPassword uses the configured password service, services created without one
+// fall back to the basic length rule
+func validateNewPassword(passwordService *PasswordService, userID, password string) error {
+	if passwordService == nil {
+		return validatePassword(password)
+	}
+	return passwordService.ValidateNewPassword(userID, password)
+}
+
+func recordPassword(passwordService *PasswordService, tx execer, userID, hashedPassword string) error {
+	if passwordService == nil {
+		return nil
+	}
+	return passwordService.RecordPassword(tx, userID, hashedPassword)
+}
+
+// ChangePassword sets a new password after verifying the current one
+func (s *PasswordService) ChangePassword(userID, currentPassword, newPassword string) error {
+	if currentPassword == "" {
+		return errors.New("current password is required")
+	}
+
+	var hashedPassword string
+	err := s.DB.QueryRow(`SELECT password FROM users WHERE id = $1 AND is_active = true`, userID).Scan(&hashedPassword)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return errors.New("user not found")
+		}
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	if utils.ComparePassword(hashedPassword, currentPassword) != nil {
+		return errors.New("current password is incorrect")
+	}
+
+	if err := s.ValidateNewPassword(userID, newPassword); err != nil {
+		return err
+	}
+
+	newHash, err := utils.HashPassword(newPassword)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`UPDATE users SET password = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2`, newHash, userID)
+	if err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+	if err := s.RecordPassword(tx, userID, newHash); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to update password: %w", err)
+	}
+	return nil
+}
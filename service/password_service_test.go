@@ -0,0 +1,68 @@
+package service
+
+import (
+	"database/sql/driver"
+	"errors"
+	"testing"
+
+	"prestasi-mahasiswa/utils"
+)
+
+func TestChangePasswordRecordsHistoryInTransaction(t *testing.T) {
+	currentHash, err := utils.HashPassword("OldPassword1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		historyErr error
+		wantCommit bool
+	}{
+		{"history recorded", nil, true},
+		{"history insert fails", errors.New("connection reset"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, fake := newFakeDB(t)
+			fake.expectQuery("SELECT password FROM users", []string{"password"}, []driver.Value{currentHash})
+			fake.expectQuery("UNION ALL", []string{"password"}, []driver.Value{currentHash})
+			fake.expectExec("UPDATE users SET password", 1)
+			if tt.historyErr != nil {
+				fake.expectError("INSERT INTO password_history", tt.historyErr)
+			} else {
+				fake.expectExec("INSERT INTO password_history", 1)
+				fake.expectExec("DELETE FROM password_history", 0)
+			}
+
+			service := NewPasswordService(db, DefaultPasswordPolicy())
+			err := service.ChangePassword("user-1", "OldPassword1", "NewPassword2")
+			if (err == nil) != tt.wantCommit {
+				t.Fatalf("ChangePassword() error = %v", err)
+			}
+
+			// Without its history entry the new password isn't kept either
+			committed := len(fake.callsContaining("COMMIT")) == 1
+			if committed != tt.wantCommit {
+				t.Errorf("Expected committed=%v, got %v", tt.wantCommit, committed)
+			}
+		})
+	}
+}
+
+func TestChangePasswordReusedPassword(t *testing.T) {
+	currentHash, err := utils.HashPassword("OldPassword1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, fake := newFakeDB(t)
+	fake.expectQuery("SELECT password FROM users", []string{"password"}, []driver.Value{currentHash})
+	fake.expectQuery("UNION ALL", []string{"password"}, []driver.Value{currentHash})
+
+	err = NewPasswordService(db, DefaultPasswordPolicy()).ChangePassword("user-1", "OldPassword1", "OldPassword1")
+	if !IsPasswordPolicyError(err) {
+		t.Errorf("Expected reusing the current password to be a policy error, got %v", err)
+	}
+}
@@ -0,0 +1,399 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Permissions checked by routes and helpers, catalog in PermissionCatalog
+const (
+	PermissionAchievementRead      = "achievement:read"
+	PermissionAchievementReadAll   = "achievement:read_all"
+	PermissionAchievementManageOwn = "achievement:manage_own"
+	PermissionAchievementVerify    = "achievement:verify"
+	PermissionReportRead           = "report:read"
+	PermissionUserRead             = "user:read"
+	PermissionUserManage           = "user:manage"
+	PermissionRBACManage           = "rbac:manage"
+	PermissionApprovalManage       = "approval:manage"
+	PermissionSystemManage         = "system:manage"
+)
+
+// RoleAdmin always has every permission, so admins can't lock themselves out
+const RoleAdmin = "admin"
+
+type PermissionInfo struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// PermissionCatalog lists every permission, the same rows are seeded by migration 019
+var PermissionCatalog = []PermissionInfo{
+	{PermissionAchievementRead, "View achievements, only their own without achievement:read_all"},
+	{PermissionAchievementReadAll, "View achievements and evidence files of every student"},
+	{PermissionAchievementManageOwn, "Create, edit, submit and delete their own achievements"},
+	{PermissionAchievementVerify, "Verify or reject submitted achievements and re-issue attestations"},
+	{PermissionReportRead, "View statistics and student reports"},
+	{PermissionUserRead, "View the user list"},
+	{PermissionUserManage, "Create, invite, edit and deactivate users, assign advisors"},
+	{PermissionRBACManage, "Manage roles and their permissions"},
+	{PermissionApprovalManage, "Manage approval chains for achievement verification"},
+	{PermissionSystemManage, "Manage signing keys, API keys and impersonation"},
+}
+
+// DefaultRoleNames are the roles created by migration 019
+var DefaultRoleNames = []string{"mahasiswa", "dosen_wali", "admin", "kaprodi", "wakil_dekan", "staff_kemahasiswaan"}
+
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{1,49}$`)
+
+type Role struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	IsSystem    bool      `json:"is_system"`
+	Permissions []string  `json:"permissions"`
+	UserCount   int       `json:"user_count"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type RoleRequest struct {
+	Name        string   `json:"name"` // only used when creating
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+// PermissionService manages roles and answers permission checks from an in-memory copy of
+// role_permissions. Changes made by this process apply immediately, changes made by other
+// replicas within CacheTTL.
+type PermissionService struct {
+	DB       *sql.DB
+	CacheTTL time.Duration
+
+	mu       sync.RWMutex
+	cache    map[string][]string // role -> permissions
+	loadedAt time.Time
+}
+
+func NewPermissionService(db *sql.DB) *PermissionService {
+	return &PermissionService{
+		DB:       db,
+		CacheTTL: 30 * time.Second,
+	}
+}
+
+// PermissionsForRole returns the permissions of a role, none for unknown roles
+func (s *PermissionService) PermissionsForRole(role string) []string {
+	if role == RoleAdmin {
+		return allPermissions()
+	}
+
+	s.mu.RLock()
+	permissions, fresh := s.cache[role], s.cache != nil && time.Since(s.loadedAt) < s.CacheTTL
+	s.mu.RUnlock()
+	if fresh {
+		return permissions
+	}
+
+	if err := s.reload(); err != nil {
+		// Keep answering from the stale copy, an empty one denies everything
+		fmt.Printf("Warning: failed to load role permissions: %v\n", err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.cache[role]
+}
+
+// HasPermission reports whether role has permission
+func (s *PermissionService) HasPermission(role, permission string) bool {
+	for _, granted := range s.PermissionsForRole(role) {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *PermissionService) reload() error {
+	rows, err := s.DB.Query(`SELECT role_name, permission_name FROM role_permissions`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	cache := make(map[string][]string)
+	for rows.Next() {
+		var role, permission string
+		if err := rows.Scan(&role, &permission); err != nil {
+			return err
+		}
+		cache[role] = append(cache[role], permission)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.cache = cache
+	s.loadedAt = time.Now()
+	s.mu.Unlock()
+	return nil
+}
+
+// invalidate makes the next check reload role_permissions
+func (s *PermissionService) invalidate() {
+	s.mu.Lock()
+	s.loadedAt = time.Time{}
+	s.mu.Unlock()
+}
+
+// GetPermissions returns the permission catalog
+func (s *PermissionService) GetPermissions() []PermissionInfo {
+	return PermissionCatalog
+}
+
+// GetRoles lists roles with their permissions and number of users
+func (s *PermissionService) GetRoles() ([]Role, error) {
+	query := `
+		SELECT r.name, r.description, r.is_system, r.created_at, r.updated_at,
+		       COALESCE(ARRAY(SELECT rp.permission_name FROM role_permissions rp WHERE rp.role_name = r.name ORDER BY rp.permission_name), '{}'),
+		       (SELECT COUNT(*) FROM users u WHERE u.role = r.name AND u.deleted_at IS NULL)
+		FROM roles r
+		ORDER BY r.is_system DESC, r.name
+	`
+	rows, err := s.DB.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get roles: %w", err)
+	}
+	defer rows.Close()
+
+	roles := []Role{}
+	for rows.Next() {
+		var role Role
+		err := rows.Scan(&role.Name, &role.Description, &role.IsSystem, &role.CreatedAt, &role.UpdatedAt,
+			pq.Array(&role.Permissions), &role.UserCount)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan role: %w", err)
+		}
+		if role.Name == RoleAdmin {
+			role.Permissions = allPermissions()
+		}
+		roles = append(roles, role)
+	}
+
+	return roles, nil
+}
+
+// RoleNames returns the names of every role
+func (s *PermissionService) RoleNames() ([]string, error) {
+	rows, err := s.DB.Query(`SELECT name FROM roles ORDER BY name`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get roles: %w", err)
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to scan role: %w", err)
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// CreateRole adds a role with the given permissions
+func (s *PermissionService) CreateRole(req RoleRequest) (*Role, error) {
+	req.Name = strings.TrimSpace(req.Name)
+	if !roleNamePattern.MatchString(req.Name) {
+		return nil, errors.New("role name must be 2-50 lowercase letters, digits or underscores, starting with a letter")
+	}
+	// api_client is the role middleware gives API key requests
+	if req.Name == "api_client" {
+		return nil, errors.New("role name is reserved")
+	}
+	permissions, err := normalizePermissions(req.Permissions)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		INSERT INTO roles (name, description) VALUES ($1, $2)
+		ON CONFLICT (name) DO NOTHING
+	`, req.Name, strings.TrimSpace(req.Description))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create role: %w", err)
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return nil, errors.New("role already exists")
+	}
+
+	if err := setRolePermissions(tx, req.Name, permissions); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit role: %w", err)
+	}
+	s.invalidate()
+
+	return s.getRole(req.Name)
+}
+
+// UpdateRole replaces the description and permissions of a role
+func (s *PermissionService) UpdateRole(name string, req RoleRequest) (*Role, error) {
+	if name == RoleAdmin {
+		return nil, errors.New("the admin role always has every permission and can't be changed")
+	}
+	permissions, err := normalizePermissions(req.Permissions)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE roles SET description = $2, updated_at = CURRENT_TIMESTAMP WHERE name = $1
+	`, name, strings.TrimSpace(req.Description))
+	if err != nil {
+		return nil, fmt.Errorf("failed to update role: %w", err)
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return nil, errors.New("role not found")
+	}
+
+	if _, err := tx.Exec(`DELETE FROM role_permissions WHERE role_name = $1`, name); err != nil {
+		return nil, fmt.Errorf("failed to update role permissions: %w", err)
+	}
+	if err := setRolePermissions(tx, name, permissions); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit role: %w", err)
+	}
+	s.invalidate()
+
+	return s.getRole(name)
+}
+
+// DeleteRole removes a role no user or approval step refers to, system roles can't be deleted
+func (s *PermissionService) DeleteRole(name string) error {
+	var isSystem bool
+	var userCount, stepCount int
+	err := s.DB.QueryRow(`
+		SELECT is_system, (SELECT COUNT(*) FROM users WHERE role = $1),
+		       (SELECT COUNT(*) FROM approval_chain_steps WHERE assignee_role = $1)
+		FROM roles WHERE name = $1
+	`, name).Scan(&isSystem, &userCount, &stepCount)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return errors.New("role not found")
+		}
+		return fmt.Errorf("failed to get role: %w", err)
+	}
+	if isSystem {
+		return errors.New("system roles can't be deleted")
+	}
+	if userCount > 0 {
+		return fmt.Errorf("role is assigned to %d users, change their role first", userCount)
+	}
+	if stepCount > 0 {
+		return fmt.Errorf("role approves %d approval chain steps, change those steps first", stepCount)
+	}
+
+	if _, err := s.DB.Exec(`DELETE FROM roles WHERE name = $1`, name); err != nil {
+		return fmt.Errorf("failed to delete role: %w", err)
+	}
+	s.invalidate()
+
+	return nil
+}
+
+func (s *PermissionService) getRole(name string) (*Role, error) {
+	roles, err := s.GetRoles()
+	if err != nil {
+		return nil, err
+	}
+	for i := range roles {
+		if roles[i].Name == name {
+			return &roles[i], nil
+		}
+	}
+	return nil, errors.New("role not found")
+}
+
+func setRolePermissions(tx *sql.Tx, role string, permissions []string) error {
+	for _, permission := range permissions {
+		_, err := tx.Exec(`
+			INSERT INTO role_permissions (role_name, permission_name) VALUES ($1, $2)
+			ON CONFLICT DO NOTHING
+		`, role, permission)
+		if err != nil {
+			return fmt.Errorf("failed to grant permission: %w", err)
+		}
+	}
+	return nil
+}
+
+// normalizePermissions checks permissions against PermissionCatalog, removes duplicates and sorts them
+func normalizePermissions(permissions []string) ([]string, error) {
+	seen := make(map[string]bool)
+	normalized := []string{}
+	for _, permission := range permissions {
+		permission = strings.ToLower(strings.TrimSpace(permission))
+		if !isKnownPermission(permission) {
+			return nil, fmt.Errorf("unknown permission %q", permission)
+		}
+		if !seen[permission] {
+			seen[permission] = true
+			normalized = append(normalized, permission)
+		}
+	}
+	sort.Strings(normalized)
+	return normalized, nil
+}
+
+func isKnownPermission(permission string) bool {
+	for _, known := range PermissionCatalog {
+		if known.Name == permission {
+			return true
+		}
+	}
+	return false
+}
+
+func allPermissions() []string {
+	permissions := make([]string, len(PermissionCatalog))
+	for i, permission := range PermissionCatalog {
+		permissions[i] = permission.Name
+	}
+	return permissions
+}
+
+// roleExists reports whether role is a row of roles, used to validate role assignments
+func roleExists(db *sql.DB, role string) (bool, error) {
+	var exists bool
+	err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM roles WHERE name = $1)`, role).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check role: %w", err)
+	}
+	return exists, nil
+}
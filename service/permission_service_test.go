@@ -0,0 +1,65 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNormalizePermissions(t *testing.T) {
+	permissions, err := normalizePermissions([]string{" Report:Read ", "achievement:read", "report:read"})
+	if err != nil {
+		t.Fatalf("Failed to normalize permissions: %v", err)
+	}
+	if len(permissions) != 2 || permissions[0] != PermissionAchievementRead || permissions[1] != PermissionReportRead {
+		t.Errorf("Unexpected permissions: %v", permissions)
+	}
+
+	if permissions, err := normalizePermissions(nil); err != nil || len(permissions) != 0 {
+		t.Errorf("Expected a role without permissions to be allowed, got %v, %v", permissions, err)
+	}
+
+	for _, invalid := range [][]string{{"achievement:write"}, {"report:read", "*"}} {
+		if _, err := normalizePermissions(invalid); err == nil {
+			t.Errorf("Expected permissions %v to be rejected", invalid)
+		}
+	}
+}
+
+func TestPermissionsForRole(t *testing.T) {
+	// A fresh cache answers without touching the database
+	s := &PermissionService{
+		CacheTTL: time.Minute,
+		cache:    map[string][]string{"kaprodi": {PermissionAchievementRead, PermissionReportRead}},
+		loadedAt: time.Now(),
+	}
+
+	if !s.HasPermission("kaprodi", PermissionReportRead) {
+		t.Error("Expected kaprodi to have report:read")
+	}
+	if s.HasPermission("kaprodi", PermissionAchievementVerify) {
+		t.Error("Expected kaprodi not to have achievement:verify")
+	}
+	if permissions := s.PermissionsForRole("unknown"); len(permissions) != 0 {
+		t.Errorf("Expected no permissions for unknown role, got %v", permissions)
+	}
+	if len(s.PermissionsForRole(RoleAdmin)) != len(PermissionCatalog) {
+		t.Error("Expected admin to have every permission")
+	}
+}
+
+func TestCreateRoleValidation(t *testing.T) {
+	s := &PermissionService{}
+	tests := []RoleRequest{
+		{Name: "Kaprodi"},
+		{Name: "k"},
+		{Name: "kaprodi-ti"},
+		{Name: "api_client"},
+		{Name: "kaprodi", Permissions: []string{"everything"}},
+	}
+
+	for _, req := range tests {
+		if _, err := s.CreateRole(req); err == nil {
+			t.Errorf("Expected role %+v to be rejected", req)
+		}
+	}
+}
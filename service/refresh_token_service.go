@@ -2,18 +2,43 @@ package service
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"time"
 
 	"prestasi-mahasiswa/utils"
+
+	"github.com/google/uuid"
 )
 
 type RefreshTokenService struct {
 	db      *sql.DB
 	jwtUtil *utils.JWTUtil
+
+	// ReuseGracePeriod tolerates concurrent refreshes of the same token by the same client, they
+	// all get the tokens issued by the first one. RotationBox encrypts those tokens while they are
+	// kept for the grace period, without it every second refresh counts as reuse.
+	ReuseGracePeriod time.Duration
+	RotationBox      *utils.SecretBox
 }
 
+// ErrRefreshInProgress is returned to a concurrent refresh that arrived before the first one
+// finished issuing its tokens
+var ErrRefreshInProgress = errors.New("refresh token is being rotated, retry shortly")
+
+// rotationResponseWait bounds how long a concurrent refresh waits for the first one's tokens
+const rotationResponseWait = 2 * time.Second
+
+// consumedTokenAction is what a refresh with an already rotated token gets
+type consumedTokenAction int
+
+const (
+	consumedTokenReuse      consumedTokenAction = iota // replay, the token family is revoked
+	consumedTokenServeChild                            // the tokens issued by the first refresh
+	consumedTokenRetry                                 // the first refresh hasn't stored its tokens yet
+)
+
 type RefreshToken struct {
 	ID         string     `json:"id"`
 	UserID     string     `json:"user_id"`
@@ -25,6 +50,9 @@ type RefreshToken struct {
 	LastUsedAt *time.Time `json:"last_used_at"`
 	IPAddress  *string    `json:"ip_address"`
 	UserAgent  *string    `json:"user_agent"`
+	FamilyID   *string    `json:"family_id"`
+	ParentID   *string    `json:"parent_id"`
+	ConsumedAt *time.Time `json:"consumed_at"`
 }
 
 type RefreshTokenRequest struct {
@@ -40,41 +68,101 @@ type TokenRefreshResponse struct {
 
 func NewRefreshTokenService(db *sql.DB, jwtUtil *utils.JWTUtil) *RefreshTokenService {
 	return &RefreshTokenService{
-		db:      db,
-		jwtUtil: jwtUtil,
+		db:               db,
+		jwtUtil:          jwtUtil,
+		ReuseGracePeriod: 30 * time.Second,
 	}
 }
 
-// StoreRefreshToken stores refresh token in database
+// StoreRefreshToken stores refresh token in database as the start of a new token family
 func (rts *RefreshTokenService) StoreRefreshToken(userID, tokenHash string, expiresAt time.Time, ipAddress, userAgent *string) error {
+	_, err := rts.storeRefreshToken(userID, tokenHash, expiresAt, ipAddress, userAgent, nil, nil, nil)
+	return err
+}
+
+// StartSession issues a token pair for a new login. The refresh token starts a token family whose
+// id is the session id, carried in the sid claim of every access token of the session.
+func (rts *RefreshTokenService) StartSession(userID, email, role string, ipAddress, userAgent *string) (*utils.TokenPair, string, error) {
+	sessionID := uuid.New().String()
+
+	tokenPair, err := rts.jwtUtil.GenerateSessionTokenPair(userID, email, role, sessionID)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to generate tokens: %w", err)
+	}
+
+	expiresAt := time.Now().Add(7 * 24 * time.Hour) // 7 days
+	_, err = rts.storeRefreshToken(userID, utils.HashToken(tokenPair.RefreshToken), expiresAt, ipAddress, userAgent, &sessionID, nil, tokenPair)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return tokenPair, sessionID, nil
+}
+
+// storeRefreshToken inserts refresh token, linking it to its family and parent when rotated.
+// The access token of tokenPair is recorded so ending the session can revoke it.
+func (rts *RefreshTokenService) storeRefreshToken(userID, tokenHash string, expiresAt time.Time, ipAddress, userAgent, familyID, parentID *string, tokenPair *utils.TokenPair) (string, error) {
+	tokenID := uuid.New().String()
+	if familyID == nil {
+		familyID = &tokenID
+	}
+
+	var accessTokenID, accessTokenExpiresAt interface{}
+	if tokenPair != nil && tokenPair.AccessTokenID != "" {
+		accessTokenID = tokenPair.AccessTokenID
+		accessTokenExpiresAt = tokenPair.AccessTokenExpiresAt
+	}
+
 	query := `
-		INSERT INTO refresh_tokens (user_id, token_hash, expires_at, ip_address, user_agent)
-		VALUES ($1, $2, $3, $4, $5)
+		INSERT INTO refresh_tokens (id, user_id, token_hash, expires_at, ip_address, user_agent, family_id, parent_id,
+		                            access_token_jti, access_token_expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
 	`
-	_, err := rts.db.Exec(query, userID, tokenHash, expiresAt, ipAddress, userAgent)
+	_, err := rts.db.Exec(query, tokenID, userID, tokenHash, expiresAt, ipAddress, userAgent, familyID, parentID,
+		accessTokenID, accessTokenExpiresAt)
 	if err != nil {
-		return fmt.Errorf("failed to store refresh token: %w", err)
+		return "", fmt.Errorf("failed to store refresh token: %w", err)
 	}
 
-	return nil
+	return tokenID, nil
 }
 
 // ValidateRefreshToken validates and retrieves refresh token from database
 func (rts *RefreshTokenService) ValidateRefreshToken(tokenString string) (*RefreshToken, error) {
+	refreshToken, _, err := rts.findRefreshToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check if token is revoked
+	if refreshToken.IsRevoked {
+		return nil, errors.New("refresh token has been revoked")
+	}
+
+	// Check if token is expired
+	if time.Now().After(refreshToken.ExpiresAt) {
+		return nil, errors.New("refresh token has expired")
+	}
+
+	return refreshToken, nil
+}
+
+// findRefreshToken validates JWT structure and loads stored token regardless of its state
+func (rts *RefreshTokenService) findRefreshToken(tokenString string) (*RefreshToken, *utils.Claims, error) {
 	// First validate JWT structure and signature
 	claims, err := rts.jwtUtil.ValidateRefreshToken(tokenString)
 	if err != nil {
-		return nil, fmt.Errorf("invalid refresh token: %w", err)
+		return nil, nil, fmt.Errorf("invalid refresh token: %w", err)
 	}
 
 	// Generate hash to look up in database
 	tokenHash := utils.HashToken(tokenString)
 
-	// Check if token exists and is not revoked
 	var refreshToken RefreshToken
 	query := `
 		SELECT id, user_id, token_hash, expires_at, is_revoked, revoked_at, 
-		       created_at, last_used_at, ip_address, user_agent
+		       created_at, last_used_at, ip_address, user_agent,
+		       family_id, parent_id, consumed_at
 		FROM refresh_tokens
 		WHERE token_hash = $1 AND user_id = $2
 	`
@@ -90,40 +178,66 @@ func (rts *RefreshTokenService) ValidateRefreshToken(tokenString string) (*Refre
 		&refreshToken.LastUsedAt,
 		&refreshToken.IPAddress,
 		&refreshToken.UserAgent,
+		&refreshToken.FamilyID,
+		&refreshToken.ParentID,
+		&refreshToken.ConsumedAt,
 	)
 
 	if err != nil {
 		if err == sql.ErrNoRows {
-			return nil, errors.New("refresh token not found")
+			return nil, nil, errors.New("refresh token not found")
 		}
-		return nil, fmt.Errorf("database error: %w", err)
+		return nil, nil, fmt.Errorf("database error: %w", err)
+	}
+
+	// Tokens stored before families existed form their own family
+	if refreshToken.FamilyID == nil {
+		refreshToken.FamilyID = &refreshToken.ID
+	}
+
+	return &refreshToken, claims, nil
+}
+
+// RefreshTokens rotates refresh token and returns new token pair.
+// Presenting an already rotated token revokes its whole family (reuse detection).
+func (rts *RefreshTokenService) RefreshTokens(tokenString string, ipAddress, userAgent *string) (*TokenRefreshResponse, error) {
+	refreshToken, claims, err := rts.findRefreshToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+
+	// Token was already rotated, either a concurrent refresh or a replay
+	if refreshToken.ConsumedAt != nil {
+		return rts.handleConsumedToken(refreshToken, claims, ipAddress, userAgent)
 	}
 
-	// Check if token is revoked
 	if refreshToken.IsRevoked {
 		return nil, errors.New("refresh token has been revoked")
 	}
 
-	// Check if token is expired
 	if time.Now().After(refreshToken.ExpiresAt) {
 		return nil, errors.New("refresh token has expired")
 	}
 
-	return &refreshToken, nil
-}
-
-// RefreshTokens validates refresh token and returns new token pair
-func (rts *RefreshTokenService) RefreshTokens(tokenString string, ipAddress, userAgent *string) (*TokenRefreshResponse, error) {
-	// Validate refresh token
-	refreshToken, err := rts.ValidateRefreshToken(tokenString)
+	// Mark token as consumed, only one concurrent request can win
+	consumed, err := rts.consumeRefreshToken(refreshToken.ID)
 	if err != nil {
 		return nil, err
 	}
+	if !consumed {
+		refreshToken, claims, err = rts.findRefreshToken(tokenString)
+		if err != nil {
+			return nil, err
+		}
+		if refreshToken.ConsumedAt == nil {
+			return nil, errors.New("refresh token has been revoked")
+		}
+		return rts.handleConsumedToken(refreshToken, claims, ipAddress, userAgent)
+	}
 
-	// Get user details from claims
-	claims, err := rts.jwtUtil.ValidateRefreshToken(tokenString)
-	if err != nil {
-		return nil, err
+	// The parent's grace period ends once its child is used, its tokens aren't served again
+	if refreshToken.ParentID != nil {
+		rts.clearRotationResponse(*refreshToken.ParentID)
 	}
 
 	// Update last used timestamp
@@ -133,28 +247,211 @@ func (rts *RefreshTokenService) RefreshTokens(tokenString string, ipAddress, use
 		fmt.Printf("Warning: failed to update last used timestamp: %v\n", err)
 	}
 
-	// Generate new token pair
-	tokenPair, err := rts.jwtUtil.GenerateTokenPair(claims.UserID, claims.Email, claims.Role)
+	response, err := rts.issueRotatedTokens(claims, refreshToken, ipAddress, userAgent)
+	if err != nil {
+		return nil, err
+	}
+
+	rts.storeRotationResponse(refreshToken.ID, response)
+	return response, nil
+}
+
+// handleConsumedToken answers a concurrent refresh from the same client within the grace period
+// with the tokens the first refresh issued, never with a new pair. Anything else is treated as
+// token replay and revokes the whole family.
+func (rts *RefreshTokenService) handleConsumedToken(refreshToken *RefreshToken, claims *utils.Claims, ipAddress, userAgent *string) (*TokenRefreshResponse, error) {
+	withinGrace, err := rts.isWithinReuseGrace(refreshToken)
+	if err != nil {
+		return nil, err
+	}
+
+	fromSameClient := sameClient(refreshToken, ipAddress, userAgent)
+	var child *TokenRefreshResponse
+	if withinGrace && fromSameClient {
+		if child, err = rts.waitForRotationResponse(refreshToken.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	switch decideConsumedToken(withinGrace, fromSameClient, child != nil) {
+	case consumedTokenServeChild:
+		return child, nil
+	case consumedTokenRetry:
+		return nil, ErrRefreshInProgress
+	}
+
+	if err := rts.RevokeTokenFamily(*refreshToken.FamilyID); err != nil {
+		fmt.Printf("Warning: failed to revoke token family: %v\n", err)
+	}
+
+	LogSecurityEvent(rts.db, SecurityEvent{
+		UserID:    refreshToken.UserID,
+		EventType: SecurityEventRefreshTokenReuse,
+		IPAddress: ipAddress,
+		UserAgent: userAgent,
+		Details: map[string]interface{}{
+			"token_id":          refreshToken.ID,
+			"family_id":         *refreshToken.FamilyID,
+			"consumed_at":       refreshToken.ConsumedAt,
+			"original_ip":       refreshToken.IPAddress,
+			"original_agent":    refreshToken.UserAgent,
+			"grace_period_secs": int(rts.ReuseGracePeriod.Seconds()),
+		},
+	})
+
+	return nil, errors.New("refresh token reuse detected, all sessions from this login have been revoked")
+}
+
+// decideConsumedToken picks the answer to a refresh with an already rotated token
+func decideConsumedToken(withinGrace, fromSameClient, childAvailable bool) consumedTokenAction {
+	switch {
+	case !withinGrace || !fromSameClient:
+		return consumedTokenReuse
+	case childAvailable:
+		return consumedTokenServeChild
+	default:
+		return consumedTokenRetry
+	}
+}
+
+// storeRotationResponse keeps the tokens issued for a rotation, encrypted, so concurrent refreshes
+// of the same token within the grace period get the same tokens
+func (rts *RefreshTokenService) storeRotationResponse(tokenID string, response *TokenRefreshResponse) {
+	if rts.RotationBox == nil || rts.ReuseGracePeriod <= 0 {
+		return
+	}
+
+	sealed, err := sealRotationResponse(rts.RotationBox, response)
+	if err == nil {
+		_, err = rts.db.Exec(`UPDATE refresh_tokens SET rotation_response = $2 WHERE id = $1`, tokenID, sealed)
+	}
+	if err != nil {
+		fmt.Printf("Warning: failed to store rotation response: %v\n", err)
+	}
+}
+
+// clearRotationResponse drops the tokens kept for concurrent refreshes of tokenID
+func (rts *RefreshTokenService) clearRotationResponse(tokenID string) {
+	_, err := rts.db.Exec(`UPDATE refresh_tokens SET rotation_response = NULL WHERE id = $1 AND rotation_response IS NOT NULL`, tokenID)
+	if err != nil {
+		fmt.Printf("Warning: failed to clear rotation response: %v\n", err)
+	}
+}
+
+// waitForRotationResponse returns the tokens issued when tokenID was rotated, waiting briefly for a
+// rotation still in progress. It returns nil when there are none, or the new refresh token was used already.
+func (rts *RefreshTokenService) waitForRotationResponse(tokenID string) (*TokenRefreshResponse, error) {
+	if rts.RotationBox == nil {
+		return nil, nil
+	}
+
+	query := `
+		SELECT p.rotation_response FROM refresh_tokens p
+		WHERE p.id = $1 AND p.rotation_response IS NOT NULL
+		  AND EXISTS (
+			SELECT 1 FROM refresh_tokens c
+			WHERE c.parent_id = p.id AND c.consumed_at IS NULL AND c.is_revoked = false
+		  )
+	`
+
+	deadline := time.Now().Add(rotationResponseWait)
+	for {
+		var sealed string
+		err := rts.db.QueryRow(query, tokenID).Scan(&sealed)
+		if err == nil {
+			return openRotationResponse(rts.RotationBox, sealed)
+		}
+		if err != sql.ErrNoRows {
+			return nil, fmt.Errorf("database error: %w", err)
+		}
+		if time.Now().After(deadline) {
+			return nil, nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func sealRotationResponse(box *utils.SecretBox, response *TokenRefreshResponse) (string, error) {
+	plaintext, err := json.Marshal(response)
+	if err != nil {
+		return "", err
+	}
+	return box.Seal(string(plaintext))
+}
+
+func openRotationResponse(box *utils.SecretBox, sealed string) (*TokenRefreshResponse, error) {
+	plaintext, err := box.Open(sealed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rotation response: %w", err)
+	}
+
+	var response TokenRefreshResponse
+	if err := json.Unmarshal([]byte(plaintext), &response); err != nil {
+		return nil, fmt.Errorf("failed to read rotation response: %w", err)
+	}
+	return &response, nil
+}
+
+// isWithinReuseGrace checks, using database clock, that token was consumed recently
+// and its family has not been revoked
+func (rts *RefreshTokenService) isWithinReuseGrace(refreshToken *RefreshToken) (bool, error) {
+	query := `
+		SELECT
+			COALESCE(consumed_at >= CURRENT_TIMESTAMP - ($2 * INTERVAL '1 second'), false),
+			EXISTS (
+				SELECT 1 FROM refresh_tokens
+				WHERE family_id = $3 AND is_revoked = false AND expires_at > CURRENT_TIMESTAMP
+			)
+		FROM refresh_tokens
+		WHERE id = $1
+	`
+
+	var recentlyConsumed, familyActive bool
+	err := rts.db.QueryRow(query, refreshToken.ID, rts.ReuseGracePeriod.Seconds(), *refreshToken.FamilyID).Scan(&recentlyConsumed, &familyActive)
+	if err != nil {
+		return false, fmt.Errorf("database error: %w", err)
+	}
+
+	return recentlyConsumed && familyActive, nil
+}
+
+// consumeRefreshToken marks token as rotated, returns false if it was already consumed or revoked
+func (rts *RefreshTokenService) consumeRefreshToken(tokenID string) (bool, error) {
+	query := `
+		UPDATE refresh_tokens
+		SET consumed_at = CURRENT_TIMESTAMP, is_revoked = true, revoked_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND consumed_at IS NULL AND is_revoked = false
+	`
+	result, err := rts.db.Exec(query, tokenID)
+	if err != nil {
+		return false, fmt.Errorf("failed to consume refresh token: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to check consume result: %w", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// issueRotatedTokens generates new token pair whose refresh token is a child of parent
+func (rts *RefreshTokenService) issueRotatedTokens(claims *utils.Claims, parent *RefreshToken, ipAddress, userAgent *string) (*TokenRefreshResponse, error) {
+	// Generate new token pair, still part of the session of the parent
+	tokenPair, err := rts.jwtUtil.GenerateSessionTokenPair(claims.UserID, claims.Email, claims.Role, *parent.FamilyID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate new tokens: %w", err)
 	}
 
-	// Store new refresh token
+	// Store new refresh token in the same family
 	newTokenHash := utils.HashToken(tokenPair.RefreshToken)
 	expiresAt := time.Now().Add(7 * 24 * time.Hour) // 7 days
 
-	err = rts.StoreRefreshToken(claims.UserID, newTokenHash, expiresAt, ipAddress, userAgent)
+	_, err = rts.storeRefreshToken(claims.UserID, newTokenHash, expiresAt, ipAddress, userAgent, parent.FamilyID, &parent.ID, tokenPair)
 	if err != nil {
 		return nil, fmt.Errorf("failed to store new refresh token: %w", err)
 	}
 
-	// Revoke old refresh token for security
-	err = rts.RevokeRefreshToken(refreshToken.ID)
-	if err != nil {
-		// Log error but don't fail the refresh
-		fmt.Printf("Warning: failed to revoke old refresh token: %v\n", err)
-	}
-
 	return &TokenRefreshResponse{
 		AccessToken:  tokenPair.AccessToken,
 		RefreshToken: tokenPair.RefreshToken,
@@ -163,6 +460,17 @@ func (rts *RefreshTokenService) RefreshTokens(tokenString string, ipAddress, use
 	}, nil
 }
 
+func sameClient(refreshToken *RefreshToken, ipAddress, userAgent *string) bool {
+	return equalStringPtr(refreshToken.IPAddress, ipAddress) && equalStringPtr(refreshToken.UserAgent, userAgent)
+}
+
+func equalStringPtr(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
 // RevokeRefreshToken marks refresh token as revoked
 func (rts *RefreshTokenService) RevokeRefreshToken(tokenID string) error {
 	query := `
@@ -178,12 +486,27 @@ func (rts *RefreshTokenService) RevokeRefreshToken(tokenID string) error {
 	return nil
 }
 
+// RevokeTokenFamily revokes every refresh token rotated from the same login
+func (rts *RefreshTokenService) RevokeTokenFamily(familyID string) error {
+	query := `
+		UPDATE refresh_tokens
+		SET is_revoked = true, revoked_at = CURRENT_TIMESTAMP, rotation_response = NULL
+		WHERE (family_id = $1 OR id = $1) AND (is_revoked = false OR rotation_response IS NOT NULL)
+	`
+	_, err := rts.db.Exec(query, familyID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke token family: %w", err)
+	}
+
+	return nil
+}
+
 // RevokeUserRefreshTokens revokes all refresh tokens for a user (logout all devices)
 func (rts *RefreshTokenService) RevokeUserRefreshTokens(userID string) error {
 	query := `
 		UPDATE refresh_tokens
-		SET is_revoked = true, revoked_at = CURRENT_TIMESTAMP
-		WHERE user_id = $1 AND is_revoked = false
+		SET is_revoked = true, revoked_at = CURRENT_TIMESTAMP, rotation_response = NULL
+		WHERE user_id = $1 AND (is_revoked = false OR rotation_response IS NOT NULL)
 	`
 	result, err := rts.db.Exec(query, userID)
 	if err != nil {
@@ -215,7 +538,8 @@ func (rts *RefreshTokenService) UpdateLastUsed(tokenID string, ipAddress, userAg
 func (rts *RefreshTokenService) GetUserRefreshTokens(userID string) ([]RefreshToken, error) {
 	query := `
 		SELECT id, user_id, token_hash, expires_at, is_revoked, revoked_at,
-		       created_at, last_used_at, ip_address, user_agent
+		       created_at, last_used_at, ip_address, user_agent,
+		       family_id, parent_id, consumed_at
 		FROM refresh_tokens
 		WHERE user_id = $1 AND is_revoked = false
 		ORDER BY created_at DESC
@@ -241,6 +565,9 @@ func (rts *RefreshTokenService) GetUserRefreshTokens(userID string) ([]RefreshTo
 			&token.LastUsedAt,
 			&token.IPAddress,
 			&token.UserAgent,
+			&token.FamilyID,
+			&token.ParentID,
+			&token.ConsumedAt,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan refresh token: %w", err)
@@ -265,5 +592,14 @@ func (rts *RefreshTokenService) CleanupExpiredTokens() error {
 	rowsDeleted, _ := result.RowsAffected()
 	fmt.Printf("Cleaned up %d expired refresh tokens\n", rowsDeleted)
 
+	// Tokens kept for concurrent refreshes whose child was never used outlive the grace period until here
+	_, err = rts.db.Exec(`
+		UPDATE refresh_tokens SET rotation_response = NULL
+		WHERE rotation_response IS NOT NULL AND consumed_at < CURRENT_TIMESTAMP - ($1 * INTERVAL '1 second')
+	`, rts.ReuseGracePeriod.Seconds())
+	if err != nil {
+		return fmt.Errorf("failed to cleanup rotation responses: %w", err)
+	}
+
 	return nil
 }
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"prestasi-mahasiswa/utils"
+)
+
+func TestDecideConsumedToken(t *testing.T) {
+	tests := []struct {
+		name           string
+		withinGrace    bool
+		fromSameClient bool
+		childAvailable bool
+		want           consumedTokenAction
+	}{
+		{"concurrent refresh gets the same child", true, true, true, consumedTokenServeChild},
+		{"concurrent refresh before the child is stored", true, true, false, consumedTokenRetry},
+		{"other client within grace revokes the family", true, false, true, consumedTokenReuse},
+		{"same client after grace revokes the family", false, true, true, consumedTokenReuse},
+		{"replay after grace revokes the family", false, false, false, consumedTokenReuse},
+	}
+
+	for _, tt := range tests {
+		if got := decideConsumedToken(tt.withinGrace, tt.fromSameClient, tt.childAvailable); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSameClient(t *testing.T) {
+	ip, otherIP := "10.0.0.1", "10.0.0.2"
+	agent := "Mozilla/5.0"
+	token := &RefreshToken{IPAddress: &ip, UserAgent: &agent}
+
+	if !sameClient(token, &ip, &agent) {
+		t.Error("Expected the same IP and user agent to match")
+	}
+	if sameClient(token, &otherIP, &agent) {
+		t.Error("Expected another IP not to match")
+	}
+	if sameClient(token, &ip, nil) {
+		t.Error("Expected a missing user agent not to match")
+	}
+}
+
+func TestRotationResponseRoundTrip(t *testing.T) {
+	box, err := utils.NewSecretBox("refresh-token-rotation:test-secret")
+	if err != nil {
+		t.Fatalf("Failed to create secret box: %v", err)
+	}
+
+	response := &TokenRefreshResponse{AccessToken: "access", RefreshToken: "refresh", TokenType: "Bearer", ExpiresIn: 900}
+	sealed, err := sealRotationResponse(box, response)
+	if err != nil {
+		t.Fatalf("Failed to seal response: %v", err)
+	}
+	if sealed == "" || sealed == response.RefreshToken {
+		t.Fatalf("Expected an encrypted response, got %q", sealed)
+	}
+
+	opened, err := openRotationResponse(box, sealed)
+	if err != nil {
+		t.Fatalf("Failed to open response: %v", err)
+	}
+	if *opened != *response {
+		t.Errorf("Expected %+v, got %+v", response, opened)
+	}
+
+	otherBox, _ := utils.NewSecretBox("refresh-token-rotation:other-secret")
+	if _, err := openRotationResponse(otherBox, sealed); err == nil {
+		t.Error("Expected a response sealed with another key to be rejected")
+	}
+}
+
+func TestRefreshTokensClearsParentRotationResponse(t *testing.T) {
+	db, fake := newFakeDB(t)
+	jwtUtil := utils.NewJWTUtil("test-secret-key-that-is-long-enough-for-testing", 24)
+	rts := NewRefreshTokenService(db, jwtUtil)
+
+	refreshToken, err := jwtUtil.GenerateRefreshToken("user-1", "user@example.com", "mahasiswa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	fake.expectQuery("WHERE token_hash = $1", []string{"id", "user_id", "token_hash", "expires_at", "is_revoked", "revoked_at",
+		"created_at", "last_used_at", "ip_address", "user_agent", "family_id", "parent_id", "consumed_at"},
+		[]driver.Value{"child-1", "user-1", utils.HashToken(refreshToken), now.Add(time.Hour), false, nil,
+			now, nil, nil, nil, "family-1", "parent-1", nil})
+	fake.expectExec("SET consumed_at = CURRENT_TIMESTAMP", 1)
+	fake.expectExec("SET rotation_response = NULL WHERE id = $1", 1)
+	fake.expectExec("last_used_at", 1)
+	fake.expectExec("INSERT INTO refresh_tokens", 1)
+
+	if _, err := rts.RefreshTokens(refreshToken, nil, nil); err != nil {
+		t.Fatalf("RefreshTokens failed: %v", err)
+	}
+	if cleared := fake.callsContaining("SET rotation_response = NULL WHERE id = $1")[0].Args[0]; cleared != "parent-1" {
+		t.Errorf("Expected the parent's rotation response to be cleared, got %v", cleared)
+	}
+}
@@ -3,36 +3,74 @@ package service
 import (
 	"database/sql"
 	"errors"
+	"fmt"
 	"prestasi-mahasiswa/utils"
 	"regexp"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
 type RegisterService struct {
-	DB *sql.DB
+	DB              *sql.DB
+	PasswordService *PasswordService // password policy and history, optional
+
+	// EmailVerificationService keeps new accounts pending until the email is verified, optional
+	EmailVerificationService *EmailVerificationService
+
+	// Public registration is for mahasiswa only, other roles need an invitation code
+	InvitationService   *InvitationService
+	AllowedEmailDomains []string       // empty allows any domain, invited users are not restricted
+	NIMPattern          *regexp.Regexp // nil accepts any NIM
+}
+
+// ErrEmailRegistered refuses a registration with an email that already has an account
+var ErrEmailRegistered = errors.New("email already registered")
+
+// RegistrationAccessError refuses a registration the public endpoint doesn't allow: a role that
+// needs an invitation, an email domain that isn't allowed or an invalid invitation code
+type RegistrationAccessError struct {
+	Message string
+}
+
+func (e *RegistrationAccessError) Error() string {
+	return e.Message
 }
 
 func NewRegisterService(db *sql.DB) *RegisterService {
 	return &RegisterService{DB: db}
 }
 
-func (s *RegisterService) CreateUser(nim, name, email, password, role string) error {
+// CreateUser registers a user from the public endpoint. Without invitationCode only mahasiswa can register,
+// with it the role of the invitation is used. Refusals are *RegistrationAccessError, ErrEmailRegistered
+// or, when a concurrent registration took the last use of the invitation, ErrInvitationTaken.
+func (s *RegisterService) CreateUser(nim, name, email, password, role, invitationCode string) error {
+	// The invitation is read and redeemed in one transaction
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return errors.New("database error: " + err.Error())
+	}
+	defer tx.Rollback()
+
+	invitation, role, err := s.resolveRegistration(tx, email, role, invitationCode)
+	if err != nil {
+		return err
+	}
+
 	// Validate required fields
 	if err := s.ValidateUserData(nim, name, email, password, role); err != nil {
 		return err
 	}
 
 	// Check if email already exists
-	exists, err := s.checkEmailExists(email)
+	exists, err := s.checkEmailExists(tx, email)
 	if err != nil {
 		return errors.New("database error: " + err.Error())
 	}
 	if exists {
-		return errors.New("email already registered")
+		return ErrEmailRegistered
 	}
 
 	// Hash password
@@ -46,30 +84,115 @@ func (s *RegisterService) CreateUser(nim, name, email, password, role string) er
 
 	// Insert user into database
 	query := `
-		INSERT INTO users (id, nim, name, email, password, role, is_active, created_at, updated_at) 
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		INSERT INTO users (id, nim, name, email, password, role, is_active, email_verification_pending, created_at, updated_at) 
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
 	`
 
 	now := time.Now()
-	_, err = s.DB.Exec(query,
+	_, err = tx.Exec(query,
 		userID,
 		s.parseNIM(nim, role),
 		name,
 		email,
 		hashedPassword,
 		role,
-		true, // is_active
-		now,  // created_at
-		now,  // updated_at
+		true,                              // is_active
+		s.EmailVerificationService != nil, // email_verification_pending
+		now,                               // created_at
+		now,                               // updated_at
 	)
 
 	if err != nil {
+		// Registered concurrently with the same email
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+			return ErrEmailRegistered
+		}
 		return errors.New("failed to create user: " + err.Error())
 	}
 
+	// The use is counted in the same transaction, a code can't be used more often than allowed
+	if invitation != nil {
+		if err := s.InvitationService.redeemInvitation(tx, invitation.ID, userID); err != nil {
+			return err
+		}
+	}
+
+	if err := recordPassword(s.PasswordService, tx, userID, hashedPassword); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return errors.New("failed to create user: " + err.Error())
+	}
+
+	if s.EmailVerificationService != nil {
+		// The account exists either way, the user can ask for a new link via resend
+		if err := s.EmailVerificationService.SendVerification(userID, email, name); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+	}
+
 	return nil
 }
 
+// resolveRegistration returns the role the account gets and, with a code, its invitation read in tx
+func (s *RegisterService) resolveRegistration(tx queryer, email, role, invitationCode string) (*Invitation, string, error) {
+	var invitation *Invitation
+
+	if strings.TrimSpace(invitationCode) == "" {
+		if role != "" && role != "mahasiswa" {
+			return nil, "", &RegistrationAccessError{Message: "public registration is only available for mahasiswa, an invitation code is required for other roles"}
+		}
+		role = "mahasiswa"
+
+		if !emailDomainAllowed(email, s.AllowedEmailDomains) {
+			return nil, "", &RegistrationAccessError{Message: "email domain is not allowed for registration"}
+		}
+	} else {
+		if s.InvitationService == nil {
+			return nil, "", &RegistrationAccessError{Message: "invitation codes are not enabled"}
+		}
+
+		var err error
+		invitation, err = s.InvitationService.findValidInvitation(tx, invitationCode, email)
+		if err != nil {
+			return nil, "", err
+		}
+		if role != "" && role != invitation.Role {
+			return nil, "", &RegistrationAccessError{Message: fmt.Sprintf("invitation code is for role %s", invitation.Role)}
+		}
+		role = invitation.Role
+	}
+
+	return invitation, role, nil
+}
+
+// emailDomainAllowed matches the email domain exactly or as a subdomain of an allowed domain
+func emailDomainAllowed(email string, allowedDomains []string) bool {
+	if len(allowedDomains) == 0 {
+		return true
+	}
+
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return false
+	}
+	domain := strings.ToLower(strings.TrimSpace(email[at+1:]))
+
+	for _, allowed := range allowedDomains {
+		allowed = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(allowed), "@"))
+		if allowed == "" {
+			continue
+		}
+		if domain == allowed || strings.HasSuffix(domain, "."+allowed) {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (s *RegisterService) ValidateUserData(nim, name, email, password, role string) error {
 	// Validate required fields
 	if strings.TrimSpace(name) == "" {
@@ -78,13 +201,8 @@ func (s *RegisterService) ValidateUserData(nim, name, email, password, role stri
 	if strings.TrimSpace(email) == "" {
 		return errors.New("email is required")
 	}
-	if strings.TrimSpace(password) == "" {
-		return errors.New("password is required")
-	}
-
-	// Validate password length
-	if len(password) < 6 {
-		return errors.New("password must be at least 6 characters")
+	if err := validateNewPassword(s.PasswordService, "", password); err != nil {
+		return err
 	}
 
 	// Validate email format
@@ -93,31 +211,40 @@ func (s *RegisterService) ValidateUserData(nim, name, email, password, role stri
 		return errors.New("invalid email format")
 	}
 
-	// Validate role
-	validRoles := []string{"mahasiswa", "dosen_wali", "admin"}
-	validRole := false
-	for _, validRoleItem := range validRoles {
-		if role == validRoleItem {
-			validRole = true
-			break
-		}
-	}
-	if !validRole {
-		return errors.New("invalid role. Must be mahasiswa, dosen_wali, or admin")
+	// Validate role, roles other than mahasiswa come from an invitation checked against the roles table
+	if !roleNamePattern.MatchString(role) {
+		return errors.New("invalid role")
 	}
 
 	// Validate NIM for mahasiswa
 	if role == "mahasiswa" && strings.TrimSpace(nim) == "" {
 		return errors.New("NIM is required for mahasiswa")
 	}
+	if role == "mahasiswa" && s.NIMPattern != nil && !s.NIMPattern.MatchString(strings.TrimSpace(nim)) {
+		return errors.New("invalid NIM format")
+	}
+
+	return nil
+}
+
+// validatePassword is the basic rule used when no password policy is configured
+func validatePassword(password string) error {
+	if strings.TrimSpace(password) == "" {
+		return &PasswordPolicyError{Message: "password is required"}
+	}
+
+	// Validate password length
+	if len(password) < 6 {
+		return &PasswordPolicyError{Message: "password must be at least 6 characters"}
+	}
 
 	return nil
 }
 
-func (s *RegisterService) checkEmailExists(email string) (bool, error) {
+func (s *RegisterService) checkEmailExists(tx queryer, email string) (bool, error) {
 	query := `SELECT COUNT(*) FROM users WHERE email = $1`
 	var count int
-	err := s.DB.QueryRow(query, email).Scan(&count)
+	err := tx.QueryRow(query, email).Scan(&count)
 	if err != nil {
 		return false, err
 	}
@@ -7,11 +7,12 @@ import (
 )
 
 type ReportService struct {
-	DB *sql.DB
+	DB          *sql.DB
+	DecisionSLA time.Duration // time a verifier has to decide an approval step
 }
 
 func NewReportService(db *sql.DB) *ReportService {
-	return &ReportService{DB: db}
+	return &ReportService{DB: db, DecisionSLA: 3 * 24 * time.Hour}
 }
 
 type AchievementStatistics struct {
@@ -115,6 +116,23 @@ func (rs *ReportService) GetSystemStatistics() (*SystemStatistics, error) {
 		stats.Achievements.VerificationRate = "0%"
 	}
 
+	// Average time from submission to verification or rejection
+	var avgSeconds sql.NullFloat64
+	err = rs.DB.QueryRow(`
+		SELECT AVG(EXTRACT(EPOCH FROM (verified_at - submitted_at)))
+		FROM achievements
+		WHERE is_deleted = false AND status IN ('verified', 'rejected')
+		  AND submitted_at IS NOT NULL AND verified_at >= submitted_at
+	`).Scan(&avgSeconds)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to get verification time: %w", err)
+	}
+	if avgSeconds.Valid {
+		stats.Achievements.AvgVerificationTime = FormatDuration(time.Duration(avgSeconds.Float64 * float64(time.Second)))
+	} else {
+		stats.Achievements.AvgVerificationTime = "-"
+	}
+
 	// Get top categories
 	categoryQuery := `
 		SELECT category, COUNT(*) as count
@@ -302,3 +320,68 @@ func (rs *ReportService) GetAchievementHistory(achievementID string) ([]Achievem
 
 	return history, nil
 }
+
+// VerifierSLA is how quickly a dosen wali decides the advisor steps of their advisees
+type VerifierSLA struct {
+	AdvisorID          string   `json:"advisor_id"`
+	AdvisorName        string   `json:"advisor_name"`
+	PendingSteps       int64    `json:"pending_steps"`
+	OverdueSteps       int64    `json:"overdue_steps"`
+	DecidedSteps       int64    `json:"decided_steps"`
+	AvgDecisionHours   *float64 `json:"avg_decision_hours"`
+	WithinSLARate      string   `json:"within_sla_rate"`
+	OldestPendingHours *float64 `json:"oldest_pending_hours"`
+}
+
+// GetVerifierSLA reports per dosen wali the steps waiting for them and the steps they decided in
+// the last days, against DecisionSLA. Steps count for the dosen wali responsible for them while
+// they waited, decided steps without one for the dosen wali a delegate decided for, never for
+// whoever decided them. Steps stay with that dosen wali when the student later gets another one.
+func (rs *ReportService) GetVerifierSLA(days int) ([]VerifierSLA, error) {
+	if days <= 0 {
+		days = 90
+	}
+
+	rows, err := rs.DB.Query(`
+		SELECT adv.id, adv.name,
+			COUNT(*) FILTER (WHERE ap.status = 'pending'),
+			COUNT(*) FILTER (WHERE ap.status = 'pending' AND ap.activated_at <= CURRENT_TIMESTAMP - ($2 * INTERVAL '1 second')),
+			COUNT(*) FILTER (WHERE ap.decided_at IS NOT NULL),
+			COUNT(*) FILTER (WHERE ap.decided_at IS NOT NULL AND ap.decided_at - ap.activated_at <= ($2 * INTERVAL '1 second')),
+			ROUND((AVG(EXTRACT(EPOCH FROM (ap.decided_at - ap.activated_at))) FILTER (WHERE ap.decided_at IS NOT NULL) / 3600)::numeric, 1),
+			ROUND((MAX(EXTRACT(EPOCH FROM (CURRENT_TIMESTAMP - ap.activated_at))) FILTER (WHERE ap.status = 'pending') / 3600)::numeric, 1)
+		FROM achievement_approvals ap
+		JOIN achievements a ON a.id = ap.achievement_id AND a.is_deleted = false
+		JOIN users adv ON adv.id = CASE WHEN ap.status = 'pending' THEN ap.assigned_advisor_id ELSE COALESCE(ap.assigned_advisor_id, ap.on_behalf_of) END
+		WHERE ap.assignee_rule = 'advisor' AND ap.activated_at IS NOT NULL
+		  AND (ap.status = 'pending' OR ap.decided_at >= CURRENT_TIMESTAMP - ($1 * INTERVAL '1 day'))
+		GROUP BY adv.id, adv.name
+		ORDER BY adv.name
+	`, days, int64(rs.DecisionSLA.Seconds()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get verifier SLA: %w", err)
+	}
+	defer rows.Close()
+
+	report := []VerifierSLA{}
+	for rows.Next() {
+		var sla VerifierSLA
+		var withinSLA int64
+		err := rows.Scan(&sla.AdvisorID, &sla.AdvisorName, &sla.PendingSteps, &sla.OverdueSteps, &sla.DecidedSteps,
+			&withinSLA, &sla.AvgDecisionHours, &sla.OldestPendingHours)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan verifier SLA: %w", err)
+		}
+		sla.WithinSLARate = percentage(withinSLA, sla.DecidedSteps)
+		report = append(report, sla)
+	}
+	return report, rows.Err()
+}
+
+// percentage formats part of total like the other rates in reports, "0%" when total is zero
+func percentage(part, total int64) string {
+	if total == 0 {
+		return "0%"
+	}
+	return fmt.Sprintf("%.2f%%", float64(part)/float64(total)*100)
+}
@@ -0,0 +1,45 @@
+package service
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+// Security event types
+const (
+	SecurityEventRefreshTokenReuse = "refresh_token_reuse"
+	SecurityEventPasswordReset     = "password_reset"
+	SecurityEventMFAEnabled        = "mfa_enabled"
+	SecurityEventMFADisabled       = "mfa_disabled"
+	SecurityEventMFAReset          = "mfa_reset"
+	SecurityEventAPIKeyCreated     = "api_key_created"
+	SecurityEventAPIKeyRevoked     = "api_key_revoked"
+	SecurityEventImpersonation     = "impersonation_started"
+)
+
+type SecurityEvent struct {
+	UserID    string
+	EventType string
+	IPAddress *string
+	UserAgent *string
+	Details   map[string]interface{}
+}
+
+// LogSecurityEvent writes security event to log output and security_events table
+func LogSecurityEvent(db *sql.DB, event SecurityEvent) {
+	detailsJSON, _ := json.Marshal(event.Details)
+	fmt.Printf("SECURITY [%s] user=%s details=%s\n", event.EventType, event.UserID, detailsJSON)
+
+	query := `
+		INSERT INTO security_events (user_id, event_type, ip_address, user_agent, details)
+		VALUES ($1, $2, $3, $4, $5)
+	`
+	var userID interface{}
+	if event.UserID != "" {
+		userID = event.UserID
+	}
+	if _, err := db.Exec(query, userID, event.EventType, event.IPAddress, event.UserAgent, detailsJSON); err != nil {
+		fmt.Printf("Warning: failed to store security event: %v\n", err)
+	}
+}
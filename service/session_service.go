@@ -0,0 +1,181 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"prestasi-mahasiswa/utils"
+)
+
+// Session is one login of a user on a device, the chain of refresh tokens rotated from it
+type Session struct {
+	ID         string    `json:"id"`
+	Device     string    `json:"device"`
+	UserAgent  *string   `json:"user_agent"`
+	IPAddress  *string   `json:"ip_address"`
+	Location   string    `json:"location,omitempty"` // approximate, from the GeoIP database
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+// SessionService lists and ends the login sessions of a user and tells users about logins from
+// devices they haven't used before
+type SessionService struct {
+	DB                     *sql.DB
+	Mailer                 utils.Mailer
+	GeoIP                  *utils.GeoIPDatabase // nil leaves locations empty
+	TokenRevocationService *TokenRevocationService
+	NotifyNewDevices       bool
+}
+
+func NewSessionService(db *sql.DB, mailer utils.Mailer, tokenRevocationService *TokenRevocationService) *SessionService {
+	return &SessionService{
+		DB:                     db,
+		Mailer:                 mailer,
+		TokenRevocationService: tokenRevocationService,
+		NotifyNewDevices:       true,
+	}
+}
+
+// GetSessions returns the active sessions of a user, newest first. currentSessionID is the sid
+// of the access token making the request.
+func (s *SessionService) GetSessions(userID, currentSessionID string) ([]Session, error) {
+	query := `
+		SELECT r.family_id, r.user_agent, r.ip_address, r.expires_at,
+		       COALESCE(r.last_used_at, r.created_at),
+		       (SELECT MIN(f.created_at) FROM refresh_tokens f WHERE f.family_id = r.family_id)
+		FROM refresh_tokens r
+		WHERE r.user_id = $1 AND r.is_revoked = false AND r.expires_at > CURRENT_TIMESTAMP
+		ORDER BY COALESCE(r.last_used_at, r.created_at) DESC
+	`
+	rows, err := s.DB.Query(query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get sessions: %w", err)
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		var session Session
+		err := rows.Scan(&session.ID, &session.UserAgent, &session.IPAddress, &session.ExpiresAt,
+			&session.LastUsedAt, &session.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+
+		userAgent := ""
+		if session.UserAgent != nil {
+			userAgent = *session.UserAgent
+		}
+		session.Device = utils.DeviceLabel(userAgent)
+		if session.IPAddress != nil {
+			if location, ok := s.GeoIP.Lookup(*session.IPAddress); ok {
+				session.Location = location.String()
+			}
+		}
+		session.Current = currentSessionID != "" && session.ID == currentSessionID
+		sessions = append(sessions, session)
+	}
+
+	return sessions, nil
+}
+
+// RevokeSession ends one session of the user: its refresh tokens stop working right away and
+// access tokens still valid from the session are denied
+func (s *SessionService) RevokeSession(userID, sessionID string) error {
+	result, err := s.DB.Exec(`
+		UPDATE refresh_tokens SET is_revoked = true, revoked_at = CURRENT_TIMESTAMP
+		WHERE user_id = $1 AND family_id::text = $2 AND is_revoked = false AND expires_at > CURRENT_TIMESTAMP
+	`, userID, sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		return errors.New("session not found")
+	}
+
+	rows, err := s.DB.Query(`
+		SELECT access_token_jti, access_token_expires_at FROM refresh_tokens
+		WHERE user_id = $1 AND family_id::text = $2 AND access_token_jti IS NOT NULL AND access_token_expires_at > CURRENT_TIMESTAMP
+	`, userID, sessionID)
+	if err != nil {
+		return fmt.Errorf("failed to get session access tokens: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var jti string
+		var expiresAt time.Time
+		if err := rows.Scan(&jti, &expiresAt); err != nil {
+			return fmt.Errorf("failed to scan session access token: %w", err)
+		}
+		if err := s.TokenRevocationService.RevokeAccessToken(jti, userID, expiresAt, RevocationReasonSessionRevoked); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// RecordLogin remembers the device of a login and emails the user when the device is new.
+// Devices are told apart by deviceID, a random id kept by the device; the label derived from
+// the user agent is only shown to the user. The first device of an account is not reported.
+func (s *SessionService) RecordLogin(userID, deviceID, ipAddress, userAgent string) {
+	if deviceID == "" {
+		fmt.Printf("Warning: login of user %s has no device id, device not recorded\n", userID)
+		return
+	}
+	device := utils.DeviceLabel(userAgent)
+
+	var isNew bool
+	var knownDevices int
+	err := s.DB.QueryRow(`
+		WITH known AS (SELECT COUNT(*) AS total FROM user_devices WHERE user_id = $1)
+		INSERT INTO user_devices (user_id, device_hash, label, last_ip)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id, device_hash) DO UPDATE
+		SET last_seen_at = CURRENT_TIMESTAMP, last_ip = EXCLUDED.last_ip, label = EXCLUDED.label
+		RETURNING (xmax = 0), (SELECT total FROM known)
+	`, userID, utils.HashToken(deviceID), device, nullIfEmpty(ipAddress)).Scan(&isNew, &knownDevices)
+	if err != nil {
+		fmt.Printf("Warning: failed to record login device: %v\n", err)
+		return
+	}
+
+	if !isNew || knownDevices == 0 || !s.NotifyNewDevices {
+		return
+	}
+
+	location := ""
+	if geo, ok := s.GeoIP.Lookup(ipAddress); ok {
+		location = geo.String()
+	}
+	go s.sendNewDeviceEmail(userID, device, ipAddress, location, time.Now())
+}
+
+func (s *SessionService) sendNewDeviceEmail(userID, device, ipAddress, location string, loginAt time.Time) {
+	var name, email string
+	if err := s.DB.QueryRow(`SELECT name, email FROM users WHERE id = $1`, userID).Scan(&name, &email); err != nil {
+		fmt.Printf("Warning: failed to get user for new device email: %v\n", err)
+		return
+	}
+
+	where := ipAddress
+	if location != "" {
+		where = fmt.Sprintf("%s (%s)", ipAddress, location)
+	}
+
+	message := utils.EmailMessage{
+		To:      email,
+		Subject: "Login dari perangkat baru - Sistem Pelaporan Prestasi Mahasiswa",
+		Body: fmt.Sprintf("Halo %s,\n\nAkun Anda baru saja digunakan untuk login dari perangkat yang belum pernah dipakai sebelumnya:\n\nPerangkat: %s\nAlamat IP: %s\nWaktu: %s\n\nJika ini bukan Anda, segera ganti password dan akhiri sesi tersebut dari daftar sesi aktif.\n",
+			name, device, where, loginAt.Format("02 Jan 2006 15:04 MST")),
+	}
+	if err := s.Mailer.Send(message); err != nil {
+		fmt.Printf("Warning: failed to send new device email: %v\n", err)
+	}
+}
@@ -0,0 +1,259 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"prestasi-mahasiswa/utils"
+)
+
+// Token revocation reasons
+const (
+	RevocationReasonLogout          = "logout"
+	RevocationReasonLogoutAll       = "logout_all"
+	RevocationReasonDeactivated     = "deactivated"
+	RevocationReasonRoleChanged     = "role_changed"
+	RevocationReasonDeleted         = "deleted"
+	RevocationReasonPasswordReset   = "password_reset"
+	RevocationReasonPasswordChanged = "password_changed"
+	RevocationReasonSessionRevoked  = "session_revoked"
+)
+
+// TokenRevocationService keeps the access token denylist and the per-user token generations in
+// Postgres and mirrors them in memory. Revocations made by this process apply immediately,
+// revocations made by other replicas are picked up within SyncInterval.
+type TokenRevocationService struct {
+	DB           *sql.DB
+	SyncInterval time.Duration
+	// Invalidations older than the access token lifetime plus the clock skew tolerated when
+	// validating tokens no longer match any valid token
+	AccessTokenLifetime time.Duration
+	ClockSkew           time.Duration
+
+	mu            sync.RWMutex
+	revokedTokens map[string]time.Time       // jti -> token expiry
+	generations   map[string]tokenGeneration // user ID -> tokens of an older generation are invalid
+	lastSync      time.Time                  // database clock of the last successful sync
+	lastSyncCheck time.Time
+}
+
+func NewTokenRevocationService(db *sql.DB) *TokenRevocationService {
+	return &TokenRevocationService{
+		DB:                  db,
+		SyncInterval:        10 * time.Second,
+		AccessTokenLifetime: utils.AccessTokenLifetime,
+		ClockSkew:           utils.DefaultJWTClockSkew,
+		revokedTokens:       make(map[string]time.Time),
+		generations:         make(map[string]tokenGeneration),
+	}
+}
+
+type tokenGeneration struct {
+	generation int
+	updatedAt  time.Time // when the generation was bumped, tokens of older ones expire one lifetime later
+}
+
+// RevokeAccessToken adds a single access token to the denylist until it expires
+func (s *TokenRevocationService) RevokeAccessToken(jti, userID string, expiresAt time.Time, reason string) error {
+	if jti == "" {
+		return errors.New("token has no jti")
+	}
+
+	query := `
+		INSERT INTO revoked_access_tokens (jti, user_id, reason, expires_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (jti) DO NOTHING
+	`
+	_, err := s.DB.Exec(query, jti, userID, reason, expiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to revoke access token: %w", err)
+	}
+
+	s.mu.Lock()
+	s.revokedTokens[jti] = expiresAt
+	s.mu.Unlock()
+
+	return nil
+}
+
+// InvalidateUserTokens rejects every access token of the user issued up to now by bumping the
+// user's token generation. Tokens issued afterwards carry the new generation, so a token pair
+// issued right after the call (password change) stays valid whatever its issue time.
+func (s *TokenRevocationService) InvalidateUserTokens(userID, reason string) error {
+	query := `
+		INSERT INTO user_token_invalidations (user_id, invalid_before, generation, reason, updated_at)
+		VALUES ($1, CURRENT_TIMESTAMP, 1, $2, CURRENT_TIMESTAMP)
+		ON CONFLICT (user_id) DO UPDATE
+		SET invalid_before = CURRENT_TIMESTAMP,
+		    generation = user_token_invalidations.generation + 1,
+		    reason = EXCLUDED.reason,
+		    updated_at = CURRENT_TIMESTAMP
+		RETURNING generation
+	`
+	var generation int
+	err := s.DB.QueryRow(query, userID, reason).Scan(&generation)
+	if err != nil {
+		return fmt.Errorf("failed to invalidate user tokens: %w", err)
+	}
+
+	s.mu.Lock()
+	s.setGeneration(userID, generation, time.Now())
+	s.mu.Unlock()
+
+	return nil
+}
+
+// TokenGeneration returns the user's current token generation, stamped into new access tokens.
+// It reads the database so a token issued right after an invalidation on another replica
+// isn't stamped with the old generation.
+func (s *TokenRevocationService) TokenGeneration(userID string) (int, error) {
+	var generation int
+	err := s.DB.QueryRow(`SELECT generation FROM user_token_invalidations WHERE user_id = $1`, userID).Scan(&generation)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get token generation: %w", err)
+	}
+	return generation, nil
+}
+
+// IsAccessTokenRevoked reports whether token was denylisted or carries an older generation than the user's current one
+func (s *TokenRevocationService) IsAccessTokenRevoked(jti, userID string, generation int) bool {
+	s.syncIfStale()
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if jti != "" {
+		if _, revoked := s.revokedTokens[jti]; revoked {
+			return true
+		}
+	}
+
+	if current, ok := s.generations[userID]; ok && generation < current.generation {
+		return true
+	}
+
+	return false
+}
+
+// CleanupExpiredRevocations removes denylist entries of tokens that have expired anyway
+func (s *TokenRevocationService) CleanupExpiredRevocations() error {
+	_, err := s.DB.Exec(`DELETE FROM revoked_access_tokens WHERE expires_at < CURRENT_TIMESTAMP`)
+	if err != nil {
+		return fmt.Errorf("failed to cleanup revoked access tokens: %w", err)
+	}
+
+	s.mu.Lock()
+	s.pruneExpired(time.Now())
+	s.mu.Unlock()
+
+	return nil
+}
+
+// syncIfStale loads revocations made since the last sync, on failure the cached data keeps being used
+func (s *TokenRevocationService) syncIfStale() {
+	s.mu.RLock()
+	stale := time.Since(s.lastSyncCheck) >= s.SyncInterval
+	s.mu.RUnlock()
+	if !stale {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Another request may have synced while waiting for the lock
+	if time.Since(s.lastSyncCheck) < s.SyncInterval {
+		return
+	}
+	s.lastSyncCheck = time.Now()
+
+	if err := s.sync(); err != nil {
+		fmt.Printf("Warning: failed to sync token revocations: %v\n", err)
+	}
+}
+
+// sync must be called with the write lock held
+func (s *TokenRevocationService) sync() error {
+	var now time.Time
+	if err := s.DB.QueryRow(`SELECT CURRENT_TIMESTAMP`).Scan(&now); err != nil {
+		return err
+	}
+
+	// Overlap with the previous window so rows committed late are not missed
+	since := s.lastSync.Add(-5 * time.Second)
+
+	rows, err := s.DB.Query(`
+		SELECT jti, expires_at FROM revoked_access_tokens
+		WHERE revoked_at >= $1 AND expires_at > CURRENT_TIMESTAMP
+	`, since)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var jti string
+		var expiresAt time.Time
+		if err := rows.Scan(&jti, &expiresAt); err != nil {
+			return err
+		}
+		s.revokedTokens[jti] = expiresAt
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	invalidationRows, err := s.DB.Query(`
+		SELECT user_id, generation, updated_at FROM user_token_invalidations
+		WHERE updated_at >= $1
+	`, since)
+	if err != nil {
+		return err
+	}
+	defer invalidationRows.Close()
+
+	for invalidationRows.Next() {
+		var userID string
+		var generation int
+		var updatedAt time.Time
+		if err := invalidationRows.Scan(&userID, &generation, &updatedAt); err != nil {
+			return err
+		}
+		s.setGeneration(userID, generation, updatedAt)
+	}
+	if err := invalidationRows.Err(); err != nil {
+		return err
+	}
+
+	s.pruneExpired(time.Now())
+	s.lastSync = now
+
+	return nil
+}
+
+func (s *TokenRevocationService) setGeneration(userID string, generation int, updatedAt time.Time) {
+	if current, ok := s.generations[userID]; !ok || generation > current.generation {
+		s.generations[userID] = tokenGeneration{generation: generation, updatedAt: updatedAt}
+	}
+}
+
+func (s *TokenRevocationService) pruneExpired(now time.Time) {
+	for jti, expiresAt := range s.revokedTokens {
+		if now.After(expiresAt) {
+			delete(s.revokedTokens, jti)
+		}
+	}
+
+	// Tokens of an older generation were issued before the bump and have expired one lifetime later
+	for userID, current := range s.generations {
+		if now.Sub(current.updatedAt) > s.AccessTokenLifetime+s.ClockSkew {
+			delete(s.generations, userID)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"database/sql/driver"
+	"testing"
+	"time"
+)
+
+// newCachedRevocationService returns a service whose cache is considered fresh, so no database is needed
+func newCachedRevocationService() *TokenRevocationService {
+	s := NewTokenRevocationService(nil)
+	s.SyncInterval = time.Hour
+	s.lastSyncCheck = time.Now()
+	return s
+}
+
+func TestIsAccessTokenRevokedByJTI(t *testing.T) {
+	s := newCachedRevocationService()
+	s.revokedTokens["revoked-jti"] = time.Now().Add(10 * time.Minute)
+
+	if !s.IsAccessTokenRevoked("revoked-jti", "user-1", 0) {
+		t.Error("Expected denylisted jti to be revoked")
+	}
+
+	if s.IsAccessTokenRevoked("other-jti", "user-1", 0) {
+		t.Error("Expected other jti to be accepted")
+	}
+}
+
+func TestIsAccessTokenRevokedByGeneration(t *testing.T) {
+	s := newCachedRevocationService()
+	s.setGeneration("user-1", 2, time.Now())
+
+	if !s.IsAccessTokenRevoked("", "user-1", 1) {
+		t.Error("Expected token of an older generation to be revoked")
+	}
+
+	if s.IsAccessTokenRevoked("", "user-1", 2) {
+		t.Error("Expected token of the current generation to be accepted")
+	}
+
+	if s.IsAccessTokenRevoked("", "user-2", 0) {
+		t.Error("Expected tokens of other users to be accepted")
+	}
+}
+
+func TestSetGenerationKeepsLatest(t *testing.T) {
+	s := newCachedRevocationService()
+	now := time.Now()
+	s.setGeneration("user-1", 3, now)
+	s.setGeneration("user-1", 2, now.Add(time.Minute))
+
+	if s.generations["user-1"].generation != 3 {
+		t.Errorf("Expected generation 3, got %d", s.generations["user-1"].generation)
+	}
+}
+
+func TestInvalidateUserTokensKeepsTokensIssuedRightAfter(t *testing.T) {
+	db, fake := newFakeDB(t)
+	s := NewTokenRevocationService(db)
+	s.SyncInterval = time.Hour
+	s.lastSyncCheck = time.Now()
+
+	fake.expectQuery("RETURNING generation", []string{"generation"}, []driver.Value{int64(4)})
+	fake.expectQuery("SELECT generation FROM user_token_invalidations", []string{"generation"}, []driver.Value{int64(4)})
+
+	if err := s.InvalidateUserTokens("user-1", RevocationReasonPasswordChanged); err != nil {
+		t.Fatalf("InvalidateUserTokens failed: %v", err)
+	}
+	generation, err := s.TokenGeneration("user-1")
+	if err != nil {
+		t.Fatalf("TokenGeneration failed: %v", err)
+	}
+
+	// The pair ChangePassword returns is issued in the same instant but with the new generation
+	if s.IsAccessTokenRevoked("", "user-1", generation) {
+		t.Error("Expected a token issued after the invalidation to be accepted")
+	}
+	if !s.IsAccessTokenRevoked("", "user-1", generation-1) {
+		t.Error("Expected tokens issued before the invalidation to be revoked")
+	}
+}
+
+func TestTokenGenerationOfUserNeverInvalidated(t *testing.T) {
+	db, fake := newFakeDB(t)
+	s := NewTokenRevocationService(db)
+
+	fake.expectQuery("SELECT generation FROM user_token_invalidations", []string{"generation"})
+
+	generation, err := s.TokenGeneration("user-1")
+	if err != nil || generation != 0 {
+		t.Errorf("Expected generation 0, got %d, %v", generation, err)
+	}
+}
+
+func TestPruneExpiredRevocations(t *testing.T) {
+	s := newCachedRevocationService()
+	now := time.Now()
+	s.revokedTokens["expired"] = now.Add(-time.Minute)
+	s.revokedTokens["active"] = now.Add(time.Minute)
+	s.generations["old"] = tokenGeneration{generation: 1, updatedAt: now.Add(-s.AccessTokenLifetime - time.Minute)}
+	s.generations["recent"] = tokenGeneration{generation: 1, updatedAt: now.Add(-time.Minute)}
+
+	s.pruneExpired(now)
+
+	if _, ok := s.revokedTokens["expired"]; ok {
+		t.Error("Expected expired jti to be pruned")
+	}
+	if _, ok := s.revokedTokens["active"]; !ok {
+		t.Error("Expected active jti to be kept")
+	}
+	if _, ok := s.generations["old"]; ok {
+		t.Error("Expected old invalidation to be pruned")
+	}
+	if _, ok := s.generations["recent"]; !ok {
+		t.Error("Expected recent invalidation to be kept")
+	}
+}
+
+func TestPruneExpiredKeepsInvalidationsWithinClockSkew(t *testing.T) {
+	s := newCachedRevocationService()
+	now := time.Now()
+	s.generations["within-skew"] = tokenGeneration{generation: 1, updatedAt: now.Add(-s.AccessTokenLifetime - s.ClockSkew/2)}
+
+	s.pruneExpired(now)
+
+	// A token issued just before the invalidation is still accepted by the validator's leeway
+	if _, ok := s.generations["within-skew"]; !ok {
+		t.Error("Expected invalidation within the clock skew to be kept")
+	}
+}
@@ -13,7 +13,14 @@ import (
 )
 
 type UserService struct {
-	DB *sql.DB
+	DB              *sql.DB
+	PasswordService *PasswordService // password policy and history, optional
+
+	// EmailVerificationService sends the verification link when an admin requests it, optional
+	EmailVerificationService *EmailVerificationService
+
+	// NotificationService tells students and dosen wali about advisor assignments, optional
+	NotificationService *NotificationService
 }
 
 type User struct {
@@ -41,6 +48,11 @@ type CreateUserRequest struct {
 	Role        string                 `json:"role"`
 	AdvisorID   *string                `json:"advisor_id,omitempty"`
 	ProfileData map[string]interface{} `json:"profile_data,omitempty"`
+
+	// Admin-created accounts are verified unless the admin asks for the email verification flow
+	RequireEmailVerification bool `json:"require_email_verification,omitempty"`
+
+	CanManageAdmins bool `json:"-"` // set by the handler, whether the caller may create admins
 }
 
 type UpdateUserRequest struct {
@@ -53,11 +65,22 @@ type UpdateUserRequest struct {
 	AdvisorID   *string                `json:"advisor_id,omitempty"`
 	ProfileData map[string]interface{} `json:"profile_data,omitempty"`
 	IsActive    *bool                  `json:"is_active,omitempty"`
+
+	// Set by the handler: who makes the change and whether they may grant or remove the admin role
+	UpdatedBy       string `json:"-"`
+	CanManageAdmins bool   `json:"-"`
 }
 
+// Role changes refused by checkRoleChange
+var (
+	ErrOwnRoleChange     = errors.New("you can't change your own role")
+	ErrAdminRoleRequired = errors.New("only administrators can grant or remove the admin role")
+)
+
 type AssignAdvisorRequest struct {
 	MahasiswaID string `json:"mahasiswa_id"`
 	AdvisorID   string `json:"advisor_id"`
+	AssignedBy  string `json:"-"` // user making the assignment, not notified
 }
 
 func NewUserService(db *sql.DB) *UserService {
@@ -258,16 +281,27 @@ func (s *UserService) CreateUser(req CreateUserRequest) (*User, error) {
 	}
 
 	// Validate role
-	if req.Role != "mahasiswa" && req.Role != "dosen_wali" && req.Role != "admin" {
-		return nil, errors.New("invalid role. Must be: mahasiswa, dosen_wali, or admin")
+	exists, err := roleExists(s.DB, req.Role)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, errors.New("invalid role. Must be one of the roles at /admin/roles")
+	}
+	if req.Role == RoleAdmin && !req.CanManageAdmins {
+		return nil, ErrAdminRoleRequired
 	}
 
-	// Validate role-specific fields
+	// Validate role-specific fields, every role other than mahasiswa is staff with a NIP
 	if req.Role == "mahasiswa" && req.NIM == nil {
 		return nil, errors.New("NIM is required for mahasiswa")
 	}
-	if (req.Role == "dosen_wali" || req.Role == "admin") && req.NIP == nil {
-		return nil, errors.New("NIP is required for dosen_wali and admin")
+	if req.Role != "mahasiswa" && req.NIP == nil {
+		return nil, errors.New("NIP is required for staff roles")
+	}
+
+	if err := validateNewPassword(s.PasswordService, "", req.Password); err != nil {
+		return nil, err
 	}
 
 	// Hash password
@@ -325,19 +359,47 @@ func (s *UserService) CreateUser(req CreateUserRequest) (*User, error) {
 		values += ", FALSE"
 	}
 
+	requireVerification := req.RequireEmailVerification && s.EmailVerificationService != nil
+	if requireVerification {
+		columns += ", email_verification_pending"
+		values += ", TRUE"
+	} else {
+		columns += ", email_verified_at"
+		values += ", CURRENT_TIMESTAMP"
+	}
+
 	query := fmt.Sprintf(`
 		INSERT INTO users (%s)
 		VALUES (%s)
 		RETURNING created_at, updated_at
 	`, columns, values)
 
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
 	var createdAt, updatedAt time.Time
-	err = s.DB.QueryRow(query, args...).Scan(&createdAt, &updatedAt)
+	err = tx.QueryRow(query, args...).Scan(&createdAt, &updatedAt)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to create user: %v", err)
 	}
 
+	if err := recordPassword(s.PasswordService, tx, userID, string(hashedPassword)); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to create user: %v", err)
+	}
+
+	if requireVerification {
+		if err := s.EmailVerificationService.SendVerification(userID, req.Email, req.Name); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+	}
+
 	// Return created user
 	return s.GetUserByID(userID)
 }
@@ -379,19 +441,31 @@ func (s *UserService) UpdateUser(userID string, req UpdateUserRequest) (*User, e
 		args = append(args, *req.Email)
 	}
 
+	var newPasswordHash string
 	if req.Password != nil {
+		if err := validateNewPassword(s.PasswordService, userID, *req.Password); err != nil {
+			return nil, err
+		}
 		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(*req.Password), bcrypt.DefaultCost)
 		if err != nil {
 			return nil, fmt.Errorf("failed to hash password: %v", err)
 		}
+		newPasswordHash = string(hashedPassword)
 		argCount++
 		setParts = append(setParts, fmt.Sprintf("password = $%d", argCount))
 		args = append(args, string(hashedPassword))
 	}
 
 	if req.Role != nil {
-		if *req.Role != "mahasiswa" && *req.Role != "dosen_wali" && *req.Role != "admin" {
-			return nil, errors.New("invalid role. Must be: mahasiswa, dosen_wali, or admin")
+		if err := checkRoleChange(userID, existingUser.Role, *req.Role, req.UpdatedBy, req.CanManageAdmins); err != nil {
+			return nil, err
+		}
+		exists, err := roleExists(s.DB, *req.Role)
+		if err != nil {
+			return nil, err
+		}
+		if !exists {
+			return nil, errors.New("invalid role. Must be one of the roles at /admin/roles")
 		}
 		argCount++
 		setParts = append(setParts, fmt.Sprintf("role = $%d", argCount))
@@ -433,14 +507,44 @@ func (s *UserService) UpdateUser(userID string, req UpdateUserRequest) (*User, e
 	query := fmt.Sprintf("UPDATE users SET %s WHERE id = $%d",
 		strings.Join(setParts, ", "), argCount)
 
-	_, err = s.DB.Exec(query, args...)
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to update user: %v", err)
 	}
 
+	if newPasswordHash != "" {
+		if err := recordPassword(s.PasswordService, tx, userID, newPasswordHash); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to update user: %v", err)
+	}
+
 	return s.GetUserByID(userID)
 }
 
+// checkRoleChange refuses changing your own role, and granting or removing the admin role
+// unless the caller is allowed to manage admins
+func checkRoleChange(userID, currentRole, newRole, updatedBy string, canManageAdmins bool) error {
+	if newRole == currentRole {
+		return nil
+	}
+	if updatedBy != "" && updatedBy == userID {
+		return ErrOwnRoleChange
+	}
+	if (newRole == RoleAdmin || currentRole == RoleAdmin) && !canManageAdmins {
+		return ErrAdminRoleRequired
+	}
+	return nil
+}
+
 // Soft delete user
 func (s *UserService) DeleteUser(userID string) error {
 	// Check if is_deleted column exists
@@ -495,12 +599,31 @@ func (s *UserService) AssignAdvisor(req AssignAdvisorRequest) error {
 		return errors.New("advisor must be a dosen_wali")
 	}
 
-	// Update mahasiswa with advisor
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	// Update mahasiswa with advisor, steps waiting for the previous advisor move to the new one
 	query := "UPDATE users SET advisor_id = $1, updated_at = CURRENT_TIMESTAMP WHERE id = $2"
-	_, err = s.DB.Exec(query, req.AdvisorID, req.MahasiswaID)
+	_, err = tx.Exec(query, req.AdvisorID, req.MahasiswaID)
 	if err != nil {
 		return fmt.Errorf("failed to assign advisor: %v", err)
 	}
+	if err := handOverAdvisorSteps(tx, req.MahasiswaID, req.AdvisorID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to assign advisor: %v", err)
+	}
+
+	// Notifications are best effort, the assignment stands
+	if s.NotificationService != nil {
+		if err := s.NotificationService.advisorAssigned(mahasiswa, advisor, req.AssignedBy); err != nil {
+			fmt.Printf("Warning: failed to send advisor assignment notifications: %v\n", err)
+		}
+	}
 
 	return nil
 }
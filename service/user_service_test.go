@@ -0,0 +1,32 @@
+package service
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckRoleChange(t *testing.T) {
+	tests := []struct {
+		name            string
+		currentRole     string
+		newRole         string
+		updatedBy       string
+		canManageAdmins bool
+		wantErr         error
+	}{
+		{"same role", "dosen_wali", "dosen_wali", "u1", false, nil},
+		{"staff role by user manager", "mahasiswa", "dosen_wali", "u2", false, nil},
+		{"own role", "dosen_wali", "kaprodi", "u1", true, ErrOwnRoleChange},
+		{"own role to admin", "kaprodi", RoleAdmin, "u1", false, ErrOwnRoleChange},
+		{"grant admin by user manager", "kaprodi", RoleAdmin, "u2", false, ErrAdminRoleRequired},
+		{"remove admin by user manager", RoleAdmin, "kaprodi", "u2", false, ErrAdminRoleRequired},
+		{"grant admin by admin manager", "kaprodi", RoleAdmin, "u2", true, nil},
+	}
+
+	for _, tt := range tests {
+		err := checkRoleChange("u1", tt.currentRole, tt.newRole, tt.updatedBy, tt.canManageAdmins)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package service
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"prestasi-mahasiswa/utils"
+
+	"github.com/lib/pq"
+)
+
+// VerificationSLAService watches approval steps waiting for a decision. After ReminderAfter the
+// step's verifiers are reminded by email, after EscalateAfter users with EscalationRoles are told.
+// Each step is reminded and escalated once.
+type VerificationSLAService struct {
+	DB              *sql.DB
+	Mailer          utils.Mailer
+	ReminderAfter   time.Duration
+	EscalateAfter   time.Duration
+	EscalationRoles []string
+}
+
+// overdueStep is an approval step past a deadline, with the people to email about it
+type overdueStep struct {
+	StepName         string
+	AchievementTitle string
+	StudentName      string
+	ActivatedAt      time.Time
+	Recipients       []userContact
+}
+
+func NewVerificationSLAService(db *sql.DB, mailer utils.Mailer) *VerificationSLAService {
+	return &VerificationSLAService{
+		DB:              db,
+		Mailer:          mailer,
+		ReminderAfter:   3 * 24 * time.Hour,
+		EscalateAfter:   7 * 24 * time.Hour,
+		EscalationRoles: []string{"kaprodi", RoleAdmin},
+	}
+}
+
+// CheckOverdue sends the reminders and escalations that are due, returning how many steps got each.
+// Recipients of every claimed step are resolved before any email goes out; when that fails the
+// claims are released, so the steps are picked up again on the next run.
+func (s *VerificationSLAService) CheckOverdue() (int, int, error) {
+	reminded, err := s.claimOverdue("reminded_at", s.ReminderAfter)
+	if err != nil {
+		return 0, 0, err
+	}
+	for i := range reminded {
+		step := &reminded[i]
+		step.overdue.Recipients, err = stepAssignees(s.DB, step.assigneeRule, step.assigneeRole, step.advisorID)
+		if err != nil {
+			s.releaseClaims("reminded_at", reminded)
+			return 0, 0, err
+		}
+	}
+	for _, step := range reminded {
+		s.sendReminder(step.overdue)
+	}
+
+	escalated, err := s.claimOverdue("escalated_at", s.EscalateAfter)
+	if err != nil {
+		return len(reminded), 0, err
+	}
+	if len(escalated) > 0 {
+		recipients, err := activeUsersWithRoles(s.DB, s.EscalationRoles)
+		if err != nil {
+			s.releaseClaims("escalated_at", escalated)
+			return len(reminded), 0, err
+		}
+		for _, step := range escalated {
+			step.overdue.Recipients = recipients
+			s.sendEscalation(step.overdue)
+		}
+	}
+
+	return len(reminded), len(escalated), nil
+}
+
+// claimedStep is a step whose reminder or escalation this instance sends
+type claimedStep struct {
+	id           string
+	overdue      overdueStep
+	assigneeRule string
+	assigneeRole *string
+	advisorID    *string
+}
+
+// claimOverdue marks pending steps waiting longer than after as handled in column and returns
+// them. Marking and reading in one statement keeps replicas from emailing the same step twice.
+func (s *VerificationSLAService) claimOverdue(column string, after time.Duration) ([]claimedStep, error) {
+	if after <= 0 {
+		return nil, nil
+	}
+
+	query := fmt.Sprintf(`
+		WITH due AS (
+			SELECT id FROM achievement_approvals
+			WHERE status = 'pending' AND activated_at IS NOT NULL AND %[1]s IS NULL
+			  AND activated_at <= CURRENT_TIMESTAMP - ($1 * INTERVAL '1 second')
+			ORDER BY activated_at
+			LIMIT 100
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE achievement_approvals ap SET %[1]s = CURRENT_TIMESTAMP
+		FROM due, achievements a, users u
+		WHERE ap.id = due.id AND a.id = ap.achievement_id AND u.id = a.mahasiswa_id
+		RETURNING ap.id, ap.step_name, ap.assignee_rule, ap.assignee_role, ap.activated_at, a.title, u.name, u.advisor_id
+	`, column)
+
+	rows, err := s.DB.Query(query, int64(after.Seconds()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get overdue approval steps: %w", err)
+	}
+	defer rows.Close()
+
+	var steps []claimedStep
+	for rows.Next() {
+		var step claimedStep
+		err := rows.Scan(&step.id, &step.overdue.StepName, &step.assigneeRule, &step.assigneeRole, &step.overdue.ActivatedAt,
+			&step.overdue.AchievementTitle, &step.overdue.StudentName, &step.advisorID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan overdue approval step: %w", err)
+		}
+		steps = append(steps, step)
+	}
+	return steps, rows.Err()
+}
+
+// releaseClaims clears column of steps claimed but not emailed
+func (s *VerificationSLAService) releaseClaims(column string, steps []claimedStep) {
+	ids := make([]string, len(steps))
+	for i, step := range steps {
+		ids[i] = step.id
+	}
+
+	query := fmt.Sprintf(`UPDATE achievement_approvals SET %s = NULL WHERE id = ANY($1)`, column)
+	if _, err := s.DB.Exec(query, pq.Array(ids)); err != nil {
+		fmt.Printf("Warning: failed to release overdue approval steps: %v\n", err)
+	}
+}
+
+func (s *VerificationSLAService) sendReminder(step overdueStep) {
+	waiting := FormatDuration(time.Since(step.ActivatedAt))
+	for _, recipient := range step.Recipients {
+		s.send(utils.EmailMessage{
+			To:      recipient.Email,
+			Subject: "Pengingat verifikasi prestasi - Sistem Pelaporan Prestasi Mahasiswa",
+			Body: fmt.Sprintf("Halo %s,\n\nPrestasi berikut menunggu keputusan Anda pada tahap %s selama %s:\n\nJudul: %s\nMahasiswa: %s\n\nSilakan verifikasi atau tolak prestasi tersebut.\n",
+				recipient.Name, step.StepName, waiting, step.AchievementTitle, step.StudentName),
+		})
+	}
+}
+
+func (s *VerificationSLAService) sendEscalation(step overdueStep) {
+	waiting := FormatDuration(time.Since(step.ActivatedAt))
+	for _, recipient := range step.Recipients {
+		s.send(utils.EmailMessage{
+			To:      recipient.Email,
+			Subject: "Eskalasi verifikasi prestasi - Sistem Pelaporan Prestasi Mahasiswa",
+			Body: fmt.Sprintf("Halo %s,\n\nPrestasi berikut belum diputuskan pada tahap %s selama %s, melewati batas waktu verifikasi:\n\nJudul: %s\nMahasiswa: %s\n\nMohon tindak lanjuti dengan pemeriksa tahap tersebut.\n",
+				recipient.Name, step.StepName, waiting, step.AchievementTitle, step.StudentName),
+		})
+	}
+}
+
+func (s *VerificationSLAService) send(message utils.EmailMessage) {
+	if err := s.Mailer.Send(message); err != nil {
+		fmt.Printf("Warning: failed to send verification SLA email: %v\n", err)
+	}
+}
+
+// FormatDuration renders a duration in days, hours or minutes, e.g. "2 hari 5 jam"
+func FormatDuration(d time.Duration) string {
+	if d < time.Minute {
+		return "0 menit"
+	}
+
+	days := int(d / (24 * time.Hour))
+	hours := int(d % (24 * time.Hour) / time.Hour)
+	minutes := int(d % time.Hour / time.Minute)
+
+	switch {
+	case days > 0 && hours > 0:
+		return fmt.Sprintf("%d hari %d jam", days, hours)
+	case days > 0:
+		return fmt.Sprintf("%d hari", days)
+	case hours > 0 && minutes > 0:
+		return fmt.Sprintf("%d jam %d menit", hours, minutes)
+	case hours > 0:
+		return fmt.Sprintf("%d jam", hours)
+	default:
+		return fmt.Sprintf("%d menit", minutes)
+	}
+}
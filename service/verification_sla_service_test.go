@@ -0,0 +1,95 @@
+package service
+
+import (
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestFormatDuration(t *testing.T) {
+	tests := []struct {
+		duration time.Duration
+		expected string
+	}{
+		{30 * time.Second, "0 menit"},
+		{45 * time.Minute, "45 menit"},
+		{2 * time.Hour, "2 jam"},
+		{2*time.Hour + 15*time.Minute, "2 jam 15 menit"},
+		{3 * 24 * time.Hour, "3 hari"},
+		{3*24*time.Hour + 5*time.Hour + 20*time.Minute, "3 hari 5 jam"},
+	}
+
+	for _, test := range tests {
+		if got := FormatDuration(test.duration); got != test.expected {
+			t.Errorf("FormatDuration(%v) = %q, expected %q", test.duration, got, test.expected)
+		}
+	}
+}
+
+func TestPercentage(t *testing.T) {
+	if got := percentage(0, 0); got != "0%" {
+		t.Errorf("Expected 0%% without decisions, got %q", got)
+	}
+	if got := percentage(2, 3); got != "66.67%" {
+		t.Errorf("Expected 66.67%%, got %q", got)
+	}
+}
+
+func TestClaimOverdueDisabled(t *testing.T) {
+	// A zero deadline turns the reminder or escalation off without touching the database
+	service := NewVerificationSLAService(nil, nil)
+	steps, err := service.claimOverdue("reminded_at", 0)
+	if err != nil || steps != nil {
+		t.Errorf("Expected no steps for a disabled deadline, got %v, %v", steps, err)
+	}
+}
+
+var overdueStepColumns = []string{"id", "step_name", "assignee_rule", "assignee_role", "activated_at", "title", "name", "advisor_id"}
+
+func TestCheckOverdueReleasesClaimsWhenRecipientsFail(t *testing.T) {
+	db, fake := newFakeDB(t)
+	mailer := &recordingMailer{}
+	service := NewVerificationSLAService(db, mailer)
+
+	activatedAt := time.Now().Add(-4 * 24 * time.Hour)
+	fake.expectQuery("SET reminded_at = CURRENT_TIMESTAMP", overdueStepColumns,
+		[]driver.Value{"step-1", "Dosen Wali", AssigneeRuleAdvisor, nil, activatedAt, "Juara 1 Hackathon", "Budi", "advisor-1"},
+		[]driver.Value{"step-2", "Dosen Wali", AssigneeRuleAdvisor, nil, activatedAt, "Finalis Gemastik", "Sari", "advisor-2"})
+	fake.expectQuery("verifier_delegations", []string{"id", "name", "email"}, []driver.Value{"advisor-1", "Dr. Andi", "andi@example.com"})
+	fake.expectError("verifier_delegations", errors.New("connection reset"))
+	fake.expectExec("SET reminded_at = NULL", 2)
+
+	if _, _, err := service.CheckOverdue(); err == nil {
+		t.Fatal("Expected the recipient lookup error")
+	}
+	if len(mailer.messages) != 0 {
+		t.Errorf("Expected no reminder before every recipient is known, got %d", len(mailer.messages))
+	}
+	if released := fake.callsContaining("SET reminded_at = NULL")[0].Args[0]; released != `{"step-1","step-2"}` {
+		t.Errorf("Expected both claimed steps to be released, got %v", released)
+	}
+}
+
+func TestCheckOverdueSendsReminders(t *testing.T) {
+	db, fake := newFakeDB(t)
+	mailer := &recordingMailer{}
+	service := NewVerificationSLAService(db, mailer)
+
+	activatedAt := time.Now().Add(-4 * 24 * time.Hour)
+	fake.expectQuery("SET reminded_at = CURRENT_TIMESTAMP", overdueStepColumns,
+		[]driver.Value{"step-1", "Dosen Wali", AssigneeRuleAdvisor, nil, activatedAt, "Juara 1 Hackathon", "Budi", "advisor-1"})
+	fake.expectQuery("verifier_delegations", []string{"id", "name", "email"}, []driver.Value{"advisor-1", "Dr. Andi", "andi@example.com"})
+	fake.expectQuery("SET escalated_at = CURRENT_TIMESTAMP", overdueStepColumns)
+
+	reminded, escalated, err := service.CheckOverdue()
+	if err != nil {
+		t.Fatalf("CheckOverdue failed: %v", err)
+	}
+	if reminded != 1 || escalated != 0 {
+		t.Errorf("Expected 1 reminder and no escalation, got %d and %d", reminded, escalated)
+	}
+	if len(mailer.messages) != 1 || mailer.messages[0].To != "andi@example.com" {
+		t.Errorf("Expected a reminder to the dosen wali, got %+v", mailer.messages)
+	}
+}
@@ -0,0 +1,169 @@
+package utils
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// AttestationJWK is an Ed25519 public key in JWK format (RFC 8037)
+type AttestationJWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+}
+
+// AttestationKeySet is the published set of attestation verification keys
+type AttestationKeySet struct {
+	Keys []AttestationJWK `json:"keys"`
+}
+
+type attestationHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Typ string `json:"typ"`
+}
+
+// NewAttestationJWK converts an Ed25519 public key to JWK format
+func NewAttestationJWK(kid string, publicKey ed25519.PublicKey) AttestationJWK {
+	return AttestationJWK{
+		Kty: "OKP",
+		Crv: "Ed25519",
+		X:   base64.RawURLEncoding.EncodeToString(publicKey),
+		Kid: kid,
+		Use: "sig",
+		Alg: "EdDSA",
+	}
+}
+
+// AttestationKeyID computes the RFC 7638 JWK thumbprint used as key ID
+func AttestationKeyID(publicKey ed25519.PublicKey) string {
+	thumbprintInput := fmt.Sprintf(`{"crv":"Ed25519","kty":"OKP","x":"%s"}`, base64.RawURLEncoding.EncodeToString(publicKey))
+	hash := sha256.Sum256([]byte(thumbprintInput))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+// CanonicalJSON encodes value with object keys sorted at every level, without HTML escaping,
+// insignificant whitespace or trailing newline. The order fields are declared in doesn't matter.
+func CanonicalJSON(value interface{}) ([]byte, error) {
+	encoded, err := encodeJSON(value)
+	if err != nil {
+		return nil, err
+	}
+
+	// Decoding into maps and encoding again sorts the keys, numbers keep their exact text
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+	var generic interface{}
+	if err := decoder.Decode(&generic); err != nil {
+		return nil, err
+	}
+
+	return encodeJSON(generic)
+}
+
+func encodeJSON(value interface{}) ([]byte, error) {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buffer.Bytes(), "\n"), nil
+}
+
+// SignAttestation creates a compact JWS (EdDSA) over the payload
+func SignAttestation(payload []byte, kid string, privateKey ed25519.PrivateKey) (string, error) {
+	if len(privateKey) != ed25519.PrivateKeySize {
+		return "", errors.New("invalid Ed25519 private key")
+	}
+
+	header, err := json.Marshal(attestationHeader{Alg: "EdDSA", Kid: kid, Typ: "JOSE"})
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	signature := ed25519.Sign(privateKey, []byte(signingInput))
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// VerifyAttestation verifies compact JWS against known keys and returns payload and key ID
+func VerifyAttestation(token string, keys map[string]ed25519.PublicKey) ([]byte, string, error) {
+	parts := strings.Split(strings.TrimSpace(token), ".")
+	if len(parts) != 3 {
+		return nil, "", errors.New("invalid attestation format")
+	}
+
+	headerJSON, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, "", errors.New("invalid attestation header encoding")
+	}
+
+	var header attestationHeader
+	if err := json.Unmarshal(headerJSON, &header); err != nil {
+		return nil, "", errors.New("invalid attestation header")
+	}
+
+	// Only EdDSA is accepted, never trust other algorithms from the header
+	if header.Alg != "EdDSA" {
+		return nil, "", fmt.Errorf("unsupported attestation algorithm: %s", header.Alg)
+	}
+
+	publicKey, ok := keys[header.Kid]
+	if !ok {
+		return nil, "", fmt.Errorf("unknown attestation key: %s", header.Kid)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, "", errors.New("invalid attestation signature encoding")
+	}
+
+	if !ed25519.Verify(publicKey, []byte(parts[0]+"."+parts[1]), signature) {
+		return nil, "", errors.New("attestation signature is invalid")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, "", errors.New("invalid attestation payload encoding")
+	}
+
+	return payload, header.Kid, nil
+}
+
+// ParseAttestationKeySet decodes published key set into verification keys by key ID
+func ParseAttestationKeySet(data []byte) (map[string]ed25519.PublicKey, error) {
+	var keySet AttestationKeySet
+	if err := json.Unmarshal(data, &keySet); err != nil {
+		return nil, fmt.Errorf("invalid key set: %w", err)
+	}
+
+	keys := make(map[string]ed25519.PublicKey)
+	for _, jwk := range keySet.Keys {
+		if jwk.Kty != "OKP" || jwk.Crv != "Ed25519" {
+			continue
+		}
+
+		publicKey, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil || len(publicKey) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid public key for kid %s", jwk.Kid)
+		}
+		keys[jwk.Kid] = ed25519.PublicKey(publicKey)
+	}
+
+	if len(keys) == 0 {
+		return nil, errors.New("key set contains no Ed25519 keys")
+	}
+
+	return keys, nil
+}
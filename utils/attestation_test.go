@@ -0,0 +1,130 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func newTestAttestationKey(t *testing.T) (string, ed25519.PublicKey, ed25519.PrivateKey) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	return AttestationKeyID(publicKey), publicKey, privateKey
+}
+
+func TestSignAndVerifyAttestation(t *testing.T) {
+	kid, publicKey, privateKey := newTestAttestationKey(t)
+	payload := []byte(`{"achievement":{"id":"a-1"},"issuer":"Test"}`)
+
+	token, err := SignAttestation(payload, kid, privateKey)
+	if err != nil {
+		t.Fatalf("Failed to sign attestation: %v", err)
+	}
+
+	verified, verifiedKid, err := VerifyAttestation(token, map[string]ed25519.PublicKey{kid: publicKey})
+	if err != nil {
+		t.Fatalf("Failed to verify attestation: %v", err)
+	}
+
+	if string(verified) != string(payload) {
+		t.Errorf("Expected payload %s, got %s", payload, verified)
+	}
+	if verifiedKid != kid {
+		t.Errorf("Expected kid %s, got %s", kid, verifiedKid)
+	}
+}
+
+func TestVerifyAttestationRejectsTamperedPayload(t *testing.T) {
+	kid, publicKey, privateKey := newTestAttestationKey(t)
+	token, _ := SignAttestation([]byte(`{"title":"Juara 1"}`), kid, privateKey)
+
+	parts := strings.Split(token, ".")
+	parts[1] = base64.RawURLEncoding.EncodeToString([]byte(`{"title":"Juara 2"}`))
+
+	_, _, err := VerifyAttestation(strings.Join(parts, "."), map[string]ed25519.PublicKey{kid: publicKey})
+	if err == nil {
+		t.Error("Expected error for tampered payload, got nil")
+	}
+}
+
+func TestVerifyAttestationWithRotatedKeys(t *testing.T) {
+	oldKid, oldPublic, oldPrivate := newTestAttestationKey(t)
+	newKid, newPublic, _ := newTestAttestationKey(t)
+
+	// Signature made with a retired key stays valid while its public key is published
+	token, _ := SignAttestation([]byte(`{}`), oldKid, oldPrivate)
+	keySet := AttestationKeySet{Keys: []AttestationJWK{
+		NewAttestationJWK(newKid, newPublic),
+		NewAttestationJWK(oldKid, oldPublic),
+	}}
+	keySetJSON, _ := json.Marshal(keySet)
+
+	keys, err := ParseAttestationKeySet(keySetJSON)
+	if err != nil {
+		t.Fatalf("Failed to parse key set: %v", err)
+	}
+
+	if _, _, err := VerifyAttestation(token, keys); err != nil {
+		t.Errorf("Expected attestation signed with retired key to verify, got %v", err)
+	}
+
+	delete(keys, oldKid)
+	if _, _, err := VerifyAttestation(token, keys); err == nil {
+		t.Error("Expected error for unknown key, got nil")
+	}
+}
+
+func TestVerifyAttestationRejectsOtherAlgorithms(t *testing.T) {
+	kid, publicKey, _ := newTestAttestationKey(t)
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","kid":"` + kid + `"}`))
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{}`))
+
+	_, _, err := VerifyAttestation(header+"."+payload+".", map[string]ed25519.PublicKey{kid: publicKey})
+	if err == nil {
+		t.Error("Expected error for alg none, got nil")
+	}
+}
+
+func TestCanonicalJSONDoesNotEscapeHTML(t *testing.T) {
+	encoded, err := CanonicalJSON(map[string]string{"title": "R&D <Lomba>"})
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+
+	if string(encoded) != `{"title":"R&D <Lomba>"}` {
+		t.Errorf("Unexpected canonical JSON: %s", encoded)
+	}
+}
+
+func TestCanonicalJSONSortsKeys(t *testing.T) {
+	type file struct {
+		Size int64  `json:"size"`
+		Name string `json:"name"`
+	}
+	type payload struct {
+		Version int               `json:"version"`
+		Files   []file            `json:"files"`
+		Extra   map[string]string `json:"extra"`
+		Issuer  string            `json:"issuer,omitempty"`
+	}
+
+	encoded, err := CanonicalJSON(payload{
+		Version: 1,
+		Files:   []file{{Size: 9007199254740993, Name: "b.pdf"}, {Size: 2, Name: "a.png"}},
+		Extra:   map[string]string{"z": "1", "a": "2"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to encode: %v", err)
+	}
+
+	// Keys are sorted at every level, array order and exact numbers are kept
+	expected := `{"extra":{"a":"2","z":"1"},"files":[{"name":"b.pdf","size":9007199254740993},{"name":"a.png","size":2}],"version":1}`
+	if string(encoded) != expected {
+		t.Errorf("Unexpected canonical JSON:\n%s\nexpected\n%s", encoded, expected)
+	}
+}
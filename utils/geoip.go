@@ -0,0 +1,115 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+)
+
+// GeoLocation is the approximate location of an IP address
+type GeoLocation struct {
+	Country string `json:"country,omitempty"` // ISO 3166 alpha-2 code
+	Region  string `json:"region,omitempty"`
+	City    string `json:"city,omitempty"`
+}
+
+// String returns the location as "City, Region, Country", skipping unknown parts
+func (l GeoLocation) String() string {
+	parts := []string{}
+	for _, part := range []string{l.City, l.Region, l.Country} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+type geoIPRange struct {
+	start, end net.IP // 16 byte form
+	location   GeoLocation
+}
+
+// GeoIPDatabase looks up IP addresses in a local range file, so no address leaves the server.
+// It reads the free DB-IP Lite CSV files: country (ip_start,ip_end,country) and city
+// (ip_start,ip_end,continent,country,region,city,latitude,longitude).
+type GeoIPDatabase struct {
+	ranges []geoIPRange // sorted by start, not overlapping
+}
+
+// LoadGeoIPDatabase reads a DB-IP Lite CSV file
+func LoadGeoIPDatabase(path string) (*GeoIPDatabase, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open GeoIP database: %w", err)
+	}
+	defer file.Close()
+
+	return ParseGeoIPDatabase(file)
+}
+
+// ParseGeoIPDatabase reads DB-IP Lite CSV rows from r
+func ParseGeoIPDatabase(r io.Reader) (*GeoIPDatabase, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	db := &GeoIPDatabase{}
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read GeoIP database line %d: %w", line, err)
+		}
+
+		if len(record) < 3 {
+			return nil, fmt.Errorf("invalid GeoIP database line %d", line)
+		}
+		start, end := net.ParseIP(strings.TrimSpace(record[0])), net.ParseIP(strings.TrimSpace(record[1]))
+		if start == nil || end == nil {
+			return nil, fmt.Errorf("invalid GeoIP database line %d", line)
+		}
+
+		var location GeoLocation
+		if len(record) >= 6 {
+			location = GeoLocation{Country: record[3], Region: record[4], City: record[5]}
+		} else {
+			location = GeoLocation{Country: record[2]}
+		}
+		db.ranges = append(db.ranges, geoIPRange{start: start.To16(), end: end.To16(), location: location})
+	}
+
+	sort.Slice(db.ranges, func(i, j int) bool {
+		return bytes.Compare(db.ranges[i].start, db.ranges[j].start) < 0
+	})
+
+	return db, nil
+}
+
+// Lookup returns the location of ip, false when the address is unknown or private
+func (db *GeoIPDatabase) Lookup(ip string) (GeoLocation, bool) {
+	parsed := net.ParseIP(ip)
+	if db == nil || parsed == nil || parsed.IsPrivate() || parsed.IsLoopback() {
+		return GeoLocation{}, false
+	}
+	parsed = parsed.To16()
+
+	// First range starting after ip, the candidate is the one before it
+	i := sort.Search(len(db.ranges), func(i int) bool {
+		return bytes.Compare(db.ranges[i].start, parsed) > 0
+	})
+	if i == 0 {
+		return GeoLocation{}, false
+	}
+
+	candidate := db.ranges[i-1]
+	if bytes.Compare(parsed, candidate.end) > 0 || candidate.location.Country == "ZZ" {
+		return GeoLocation{}, false
+	}
+	return candidate.location, true
+}
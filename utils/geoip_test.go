@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGeoIPDatabaseLookup(t *testing.T) {
+	csv := strings.Join([]string{
+		`36.64.0.0,36.95.255.255,AS,ID,"East Java",Surabaya,-7.2575,112.752`,
+		`1.0.0.0,1.0.0.255,OC,AU,Queensland,"South Brisbane",-27.4767,153.017`,
+		`2001:df0::,2001:df0:ffff:ffff:ffff:ffff:ffff:ffff,AS,ID,Jakarta,Jakarta,-6.2,106.8`,
+		`36.96.0.0,36.96.255.255,ZZ,ZZ,,,,`,
+	}, "\n")
+
+	db, err := ParseGeoIPDatabase(strings.NewReader(csv))
+	if err != nil {
+		t.Fatalf("Failed to parse GeoIP database: %v", err)
+	}
+
+	tests := []struct {
+		ip     string
+		want   string
+		wantOK bool
+	}{
+		{ip: "36.80.12.1", want: "Surabaya, East Java, ID", wantOK: true},
+		{ip: "1.0.0.1", want: "South Brisbane, Queensland, AU", wantOK: true},
+		{ip: "2001:df0::1", want: "Jakarta, Jakarta, ID", wantOK: true},
+		{ip: "36.96.1.1", wantOK: false},   // reserved range
+		{ip: "8.8.8.8", wantOK: false},     // not in the file
+		{ip: "192.168.1.5", wantOK: false}, // private
+		{ip: "not-an-ip", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		location, ok := db.Lookup(tt.ip)
+		if ok != tt.wantOK || location.String() != tt.want {
+			t.Errorf("Lookup(%s) = %q, %v, want %q, %v", tt.ip, location.String(), ok, tt.want, tt.wantOK)
+		}
+	}
+
+	// Country files have three columns
+	db, err = ParseGeoIPDatabase(strings.NewReader("36.64.0.0,36.95.255.255,ID\n"))
+	if err != nil {
+		t.Fatalf("Failed to parse country database: %v", err)
+	}
+	if location, ok := db.Lookup("36.70.0.1"); !ok || location.String() != "ID" {
+		t.Errorf("Expected country ID, got %q", location.String())
+	}
+
+	// A nil database knows no location
+	var missing *GeoIPDatabase
+	if _, ok := missing.Lookup("36.80.12.1"); ok {
+		t.Error("Expected nil database lookup to fail")
+	}
+}
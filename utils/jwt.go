@@ -5,23 +5,72 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"errors"
+	"fmt"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
 type Claims struct {
-	UserID    string `json:"user_id"`
-	Email     string `json:"email"`
-	Role      string `json:"role"`
-	TokenType string `json:"token_type"` // "access" or "refresh"
+	UserID     string       `json:"user_id"`
+	Email      string       `json:"email"`
+	Role       string       `json:"role"`
+	TokenType  string       `json:"token_type"`    // "access" or "refresh"
+	Actor      *ActorClaims `json:"act,omitempty"` // set when an admin acts as UserID (impersonation)
+	SessionID  string       `json:"sid,omitempty"` // login session (refresh token family) the token belongs to
+	Generation int          `json:"gen,omitempty"` // user's token generation at issue time, older generations are revoked
 	jwt.RegisteredClaims
 }
 
+// ActorClaims identifies who is acting on behalf of the subject (RFC 8693 act claim)
+type ActorClaims struct {
+	Subject    string `json:"sub"`
+	Email      string `json:"email,omitempty"`
+	Generation int    `json:"gen,omitempty"` // actor's token generation at issue time
+}
+
+// IsImpersonated reports whether the token was issued to an admin acting as the user
+func (c *Claims) IsImpersonated() bool {
+	return c.Actor != nil && c.Actor.Subject != ""
+}
+
+// Token validation defaults, overridable with SetValidation
+const (
+	DefaultJWTIssuer    = "prestasi-mahasiswa-api"
+	DefaultJWTAudience  = "prestasi-mahasiswa-api"
+	DefaultJWTClockSkew = 30 * time.Second
+)
+
+// AccessTokenLifetime is how long access tokens are valid
+const AccessTokenLifetime = 15 * time.Minute
+
+// Token types carried in the token_type claim
+const (
+	TokenTypeAccess  = "access"
+	TokenTypeRefresh = "refresh"
+)
+
 type JWTUtil struct {
 	secretKey         []byte
 	expireHours       int
 	refreshExpireDays int
+	issuer            string
+	audience          string
+	clockSkew         time.Duration
+
+	// keyProvider enables asymmetric signing, HS256 with secretKey is used when it is nil
+	keyProvider JWTKeyProvider
+	// legacyHMACSwitchover is when asymmetric signing started, zero rejects all HS256 tokens
+	legacyHMACSwitchover time.Time
+	// generations stamps the gen claim of access tokens, tokens carry generation 0 when it is nil
+	generations TokenGenerationSource
+}
+
+// TokenGenerationSource returns the current token generation of a user, implemented by
+// service.TokenRevocationService. Invalidating a user's tokens bumps the generation.
+type TokenGenerationSource interface {
+	TokenGeneration(userID string) (int, error)
 }
 
 type TokenPair struct {
@@ -29,6 +78,10 @@ type TokenPair struct {
 	RefreshToken string `json:"refresh_token"`
 	TokenType    string `json:"token_type"`
 	ExpiresIn    int    `json:"expires_in"` // seconds
+
+	// Access token jti and expiry, so a session can revoke its current access token
+	AccessTokenID        string    `json:"-"`
+	AccessTokenExpiresAt time.Time `json:"-"`
 }
 
 func NewJWTUtil(secret string, expireHours int) *JWTUtil {
@@ -36,9 +89,40 @@ func NewJWTUtil(secret string, expireHours int) *JWTUtil {
 		secretKey:         []byte(secret),
 		expireHours:       expireHours,
 		refreshExpireDays: 7, // 7 days for refresh token
+		issuer:            DefaultJWTIssuer,
+		audience:          DefaultJWTAudience,
+		clockSkew:         DefaultJWTClockSkew,
 	}
 }
 
+// SetValidation sets the issuer and audience put into and required from tokens,
+// and the clock skew tolerated when checking exp, nbf and iat
+func (j *JWTUtil) SetValidation(issuer, audience string, clockSkew time.Duration) {
+	j.issuer = issuer
+	j.audience = audience
+	j.clockSkew = clockSkew
+}
+
+// SetKeyProvider switches token signing to asymmetric keys with kid headers. When legacyHS256Switchover
+// is set, HS256 tokens issued before it are accepted for one access token lifetime after it.
+func (j *JWTUtil) SetKeyProvider(provider JWTKeyProvider, legacyHS256Switchover time.Time) {
+	j.keyProvider = provider
+	j.legacyHMACSwitchover = legacyHS256Switchover
+}
+
+// SetTokenGenerations makes access tokens carry the user's current token generation
+func (j *JWTUtil) SetTokenGenerations(source TokenGenerationSource) {
+	j.generations = source
+}
+
+// tokenGeneration returns 0 when no generation source is set
+func (j *JWTUtil) tokenGeneration(userID string) (int, error) {
+	if j.generations == nil {
+		return 0, nil
+	}
+	return j.generations.TokenGeneration(userID)
+}
+
 // GenerateToken creates access token (backward compatibility)
 func (j *JWTUtil) GenerateToken(userID, email, role string) (string, error) {
 	return j.GenerateAccessToken(userID, email, role)
@@ -46,23 +130,73 @@ func (j *JWTUtil) GenerateToken(userID, email, role string) (string, error) {
 
 // GenerateAccessToken creates short-lived access token (15 minutes)
 func (j *JWTUtil) GenerateAccessToken(userID, email, role string) (string, error) {
-	expirationTime := time.Now().Add(15 * time.Minute) // Short-lived for security
+	token, _, err := j.generateAccessToken(userID, email, role, "")
+	return token, err
+}
+
+func (j *JWTUtil) generateAccessToken(userID, email, role, sessionID string) (string, *Claims, error) {
+	generation, err := j.tokenGeneration(userID)
+	if err != nil {
+		return "", nil, err
+	}
+
+	expirationTime := time.Now().Add(AccessTokenLifetime) // Short-lived for security
 
 	claims := &Claims{
-		UserID:    userID,
-		Email:     email,
-		Role:      role,
-		TokenType: "access",
+		UserID:     userID,
+		Email:      email,
+		Role:       role,
+		TokenType:  TokenTypeAccess,
+		SessionID:  sessionID,
+		Generation: generation,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(), // jti, allows revoking a single access token
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			Issuer:    "prestasi-mahasiswa-api",
+			Issuer:    j.issuer,
+			Audience:  jwt.ClaimStrings{j.audience},
+			Subject:   userID,
+		},
+	}
+
+	token, err := j.signClaims(claims)
+	return token, claims, err
+}
+
+// GenerateImpersonationToken creates an access token for userID with actor as act claim.
+// There is no matching refresh token, the session ends when the token expires.
+func (j *JWTUtil) GenerateImpersonationToken(userID, email, role string, actor ActorClaims, lifetime time.Duration) (string, error) {
+	if actor.Subject == "" {
+		return "", errors.New("impersonation token requires an actor")
+	}
+
+	generation, err := j.tokenGeneration(userID)
+	if err != nil {
+		return "", err
+	}
+	actor.Generation, err = j.tokenGeneration(actor.Subject)
+	if err != nil {
+		return "", err
+	}
+
+	claims := &Claims{
+		UserID:     userID,
+		Email:      email,
+		Role:       role,
+		TokenType:  TokenTypeAccess,
+		Actor:      &actor,
+		Generation: generation,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(lifetime)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			Issuer:    j.issuer,
+			Audience:  jwt.ClaimStrings{j.audience},
 			Subject:   userID,
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(j.secretKey)
+	return j.signClaims(claims)
 }
 
 // GenerateRefreshToken creates long-lived refresh token (7 days)
@@ -73,22 +207,28 @@ func (j *JWTUtil) GenerateRefreshToken(userID, email, role string) (string, erro
 		UserID:    userID,
 		Email:     email,
 		Role:      role,
-		TokenType: "refresh",
+		TokenType: TokenTypeRefresh,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.New().String(), // Unique per token, rotated tokens never collide
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
-			Issuer:    "prestasi-mahasiswa-api",
+			Issuer:    j.issuer,
+			Audience:  jwt.ClaimStrings{j.audience},
 			Subject:   userID,
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(j.secretKey)
+	return j.signClaims(claims)
 }
 
 // GenerateTokenPair creates both access and refresh tokens
 func (j *JWTUtil) GenerateTokenPair(userID, email, role string) (*TokenPair, error) {
-	accessToken, err := j.GenerateAccessToken(userID, email, role)
+	return j.GenerateSessionTokenPair(userID, email, role, "")
+}
+
+// GenerateSessionTokenPair creates both tokens with the session id in the access token sid claim
+func (j *JWTUtil) GenerateSessionTokenPair(userID, email, role, sessionID string) (*TokenPair, error) {
+	accessToken, accessClaims, err := j.generateAccessToken(userID, email, role, sessionID)
 	if err != nil {
 		return nil, err
 	}
@@ -102,51 +242,129 @@ func (j *JWTUtil) GenerateTokenPair(userID, email, role string) (*TokenPair, err
 		AccessToken:  accessToken,
 		RefreshToken: refreshToken,
 		TokenType:    "Bearer",
-		ExpiresIn:    15 * 60, // 15 minutes in seconds
+		ExpiresIn:    int(AccessTokenLifetime.Seconds()),
+
+		AccessTokenID:        accessClaims.ID,
+		AccessTokenExpiresAt: accessClaims.ExpiresAt.Time,
 	}, nil
 }
 
-func (j *JWTUtil) ValidateToken(tokenString string) (*Claims, error) {
-	claims := &Claims{}
+// signClaims signs with the current provider key, or with the shared secret when no provider is set
+func (j *JWTUtil) signClaims(claims *Claims) (string, error) {
+	if j.keyProvider == nil {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		return token.SignedString(j.secretKey)
+	}
+
+	signingKey, err := j.keyProvider.CurrentSigningKey()
+	if err != nil {
+		return "", err
+	}
 
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+	method, err := jwtSigningMethod(signingKey.Algorithm)
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = signingKey.KeyID
+	return token.SignedString(signingKey.PrivateKey)
+}
+
+// keyFunc resolves the verification key of a token. Asymmetric tokens are matched by kid and
+// must use the algorithm registered for that key, the secret is only ever used for HS256.
+func (j *JWTUtil) keyFunc(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); ok {
+		if token.Method.Alg() != JWTAlgorithmHS256 {
+			return nil, fmt.Errorf("unexpected signing method: %s", token.Method.Alg())
+		}
+		if j.keyProvider != nil {
+			if err := j.checkLegacyHMAC(token); err != nil {
+				return nil, err
+			}
+		}
 		return j.secretKey, nil
-	})
+	}
 
+	if j.keyProvider == nil {
+		return nil, fmt.Errorf("unexpected signing method: %s", token.Method.Alg())
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, errors.New("token has no kid header")
+	}
+
+	verificationKey, err := j.keyProvider.VerificationKey(kid)
 	if err != nil {
 		return nil, err
 	}
 
-	if !token.Valid {
-		return nil, errors.New("invalid token")
+	if token.Method.Alg() != verificationKey.Algorithm {
+		return nil, fmt.Errorf("unexpected signing method for key %s: %s", kid, token.Method.Alg())
 	}
 
-	return claims, nil
+	return verificationKey.PublicKey, nil
 }
 
-// ValidateAccessToken validates access token specifically
-func (j *JWTUtil) ValidateAccessToken(tokenString string) (*Claims, error) {
-	claims, err := j.ValidateToken(tokenString)
+// checkLegacyHMAC allows an HS256 token after the switch to asymmetric keys only when it was issued
+// before the switch, and only until one access token lifetime has passed since
+func (j *JWTUtil) checkLegacyHMAC(token *jwt.Token) error {
+	if j.legacyHMACSwitchover.IsZero() || time.Now().After(j.legacyHMACSwitchover.Add(AccessTokenLifetime+j.clockSkew)) {
+		return errors.New("HS256 tokens are no longer accepted")
+	}
+
+	claims, ok := token.Claims.(*Claims)
+	if !ok || claims.IssuedAt == nil || claims.IssuedAt.After(j.legacyHMACSwitchover) {
+		return errors.New("HS256 token was not issued before the switch to asymmetric signing")
+	}
+
+	return nil
+}
+
+// ValidateToken is the single token verifier: it checks signature against the algorithm whitelist,
+// issuer, audience, expiry (required) and issue time, with the configured clock skew
+func (j *JWTUtil) ValidateToken(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+
+	token, err := jwt.ParseWithClaims(tokenString, claims, j.keyFunc,
+		jwt.WithValidMethods([]string{JWTAlgorithmHS256, JWTAlgorithmRS256, JWTAlgorithmEdDSA}),
+		jwt.WithIssuer(j.issuer),
+		jwt.WithAudience(j.audience),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(j.clockSkew),
+	)
+
 	if err != nil {
 		return nil, err
 	}
 
-	if claims.TokenType != "access" {
-		return nil, errors.New("invalid token type: expected access token")
+	if !token.Valid {
+		return nil, errors.New("invalid token")
 	}
 
 	return claims, nil
 }
 
+// ValidateAccessToken validates access token specifically
+func (j *JWTUtil) ValidateAccessToken(tokenString string) (*Claims, error) {
+	return j.validateTokenType(tokenString, TokenTypeAccess)
+}
+
 // ValidateRefreshToken validates refresh token specifically
 func (j *JWTUtil) ValidateRefreshToken(tokenString string) (*Claims, error) {
+	return j.validateTokenType(tokenString, TokenTypeRefresh)
+}
+
+func (j *JWTUtil) validateTokenType(tokenString, tokenType string) (*Claims, error) {
 	claims, err := j.ValidateToken(tokenString)
 	if err != nil {
 		return nil, err
 	}
 
-	if claims.TokenType != "refresh" {
-		return nil, errors.New("invalid token type: expected refresh token")
+	if claims.TokenType != tokenType {
+		return nil, fmt.Errorf("invalid token type: expected %s token", tokenType)
 	}
 
 	return claims, nil
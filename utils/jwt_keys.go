@@ -0,0 +1,148 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Supported JWT signing algorithms
+const (
+	JWTAlgorithmHS256 = "HS256"
+	JWTAlgorithmRS256 = "RS256"
+	JWTAlgorithmEdDSA = "EdDSA"
+)
+
+// JWTSigningKey is a private key used to sign new tokens
+type JWTSigningKey struct {
+	KeyID      string
+	Algorithm  string
+	PrivateKey crypto.Signer
+}
+
+// JWTVerificationKey is a public key accepted for tokens carrying its key ID
+type JWTVerificationKey struct {
+	KeyID     string
+	Algorithm string
+	PublicKey crypto.PublicKey
+}
+
+// JWTKeyProvider supplies asymmetric keys to JWTUtil, keys are looked up by the kid header
+type JWTKeyProvider interface {
+	CurrentSigningKey() (*JWTSigningKey, error)
+	VerificationKey(kid string) (*JWTVerificationKey, error)
+}
+
+// JWK is a public key in JWK format (RFC 7517), RSA and Ed25519 keys are published, EC keys are read from IdPs
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+// JWKSet is the published set of token verification keys
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// IsAsymmetricJWTAlgorithm reports whether algorithm is signed with a key pair
+func IsAsymmetricJWTAlgorithm(algorithm string) bool {
+	return algorithm == JWTAlgorithmRS256 || algorithm == JWTAlgorithmEdDSA
+}
+
+// GenerateJWTSigningKey creates a new RS256 (2048 bit) or EdDSA (Ed25519) signing key
+func GenerateJWTSigningKey(algorithm string) (*JWTSigningKey, error) {
+	var privateKey crypto.Signer
+	var err error
+
+	switch algorithm {
+	case JWTAlgorithmRS256:
+		privateKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	case JWTAlgorithmEdDSA:
+		_, privateKey, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm: %s", algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	kid, err := JWTKeyID(privateKey.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	return &JWTSigningKey{KeyID: kid, Algorithm: algorithm, PrivateKey: privateKey}, nil
+}
+
+// JWTKeyID computes the RFC 7638 JWK thumbprint used as key ID
+func JWTKeyID(publicKey crypto.PublicKey) (string, error) {
+	switch key := publicKey.(type) {
+	case ed25519.PublicKey:
+		return AttestationKeyID(key), nil
+	case *rsa.PublicKey:
+		thumbprintInput := fmt.Sprintf(`{"e":"%s","kty":"RSA","n":"%s"}`, rsaExponent(key), base64.RawURLEncoding.EncodeToString(key.N.Bytes()))
+		hash := sha256.Sum256([]byte(thumbprintInput))
+		return base64.RawURLEncoding.EncodeToString(hash[:]), nil
+	default:
+		return "", errors.New("unsupported public key type")
+	}
+}
+
+// NewJWK converts a verification key to JWK format
+func NewJWK(key JWTVerificationKey) (JWK, error) {
+	switch publicKey := key.PublicKey.(type) {
+	case ed25519.PublicKey:
+		return JWK{
+			Kty: "OKP",
+			Kid: key.KeyID,
+			Use: "sig",
+			Alg: key.Algorithm,
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(publicKey),
+		}, nil
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: "RSA",
+			Kid: key.KeyID,
+			Use: "sig",
+			Alg: key.Algorithm,
+			N:   base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes()),
+			E:   rsaExponent(publicKey),
+		}, nil
+	default:
+		return JWK{}, fmt.Errorf("unsupported public key type for kid %s", key.KeyID)
+	}
+}
+
+func rsaExponent(key *rsa.PublicKey) string {
+	return base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes())
+}
+
+// jwtSigningMethod maps algorithm name to the jwt library signing method
+func jwtSigningMethod(algorithm string) (jwt.SigningMethod, error) {
+	switch algorithm {
+	case JWTAlgorithmHS256:
+		return jwt.SigningMethodHS256, nil
+	case JWTAlgorithmRS256:
+		return jwt.SigningMethodRS256, nil
+	case JWTAlgorithmEdDSA:
+		return jwt.SigningMethodEdDSA, nil
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm: %s", algorithm)
+	}
+}
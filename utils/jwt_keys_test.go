@@ -0,0 +1,153 @@
+package utils
+
+import (
+	"crypto/rsa"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// staticKeyProvider serves fixed keys, the database-backed provider lives in the service package
+type staticKeyProvider struct {
+	signing *JWTSigningKey
+	keys    map[string]*JWTVerificationKey
+}
+
+func newStaticKeyProvider(t *testing.T, algorithm string) *staticKeyProvider {
+	signingKey, err := GenerateJWTSigningKey(algorithm)
+	if err != nil {
+		t.Fatalf("Failed to generate %s key: %v", algorithm, err)
+	}
+
+	return &staticKeyProvider{
+		signing: signingKey,
+		keys: map[string]*JWTVerificationKey{
+			signingKey.KeyID: {KeyID: signingKey.KeyID, Algorithm: algorithm, PublicKey: signingKey.PrivateKey.Public()},
+		},
+	}
+}
+
+func (p *staticKeyProvider) CurrentSigningKey() (*JWTSigningKey, error) {
+	return p.signing, nil
+}
+
+func (p *staticKeyProvider) VerificationKey(kid string) (*JWTVerificationKey, error) {
+	key, ok := p.keys[kid]
+	if !ok {
+		return nil, errors.New("unknown signing key: " + kid)
+	}
+	return key, nil
+}
+
+func TestAsymmetricTokenRoundTrip(t *testing.T) {
+	for _, algorithm := range []string{JWTAlgorithmRS256, JWTAlgorithmEdDSA} {
+		t.Run(algorithm, func(t *testing.T) {
+			provider := newStaticKeyProvider(t, algorithm)
+			jwtUtil := NewJWTUtil("test-secret-key-that-is-long-enough-for-testing", 24)
+			jwtUtil.SetKeyProvider(provider, time.Time{})
+
+			token, err := jwtUtil.GenerateAccessToken("test-user-123", "test@example.com", "mahasiswa")
+			if err != nil {
+				t.Fatalf("Failed to generate token: %v", err)
+			}
+
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, &Claims{})
+			if err != nil {
+				t.Fatalf("Failed to parse token: %v", err)
+			}
+			if parsed.Header["alg"] != algorithm || parsed.Header["kid"] != provider.signing.KeyID {
+				t.Errorf("Expected alg %s and kid %s, got %v and %v", algorithm, provider.signing.KeyID, parsed.Header["alg"], parsed.Header["kid"])
+			}
+
+			claims, err := jwtUtil.ValidateAccessToken(token)
+			if err != nil {
+				t.Fatalf("Failed to validate token: %v", err)
+			}
+			if claims.UserID != "test-user-123" {
+				t.Errorf("Expected userID test-user-123, got %s", claims.UserID)
+			}
+		})
+	}
+}
+
+func TestAsymmetricTokenRejections(t *testing.T) {
+	const secret = "test-secret-key-that-is-long-enough-for-testing"
+
+	rsaProvider := newStaticKeyProvider(t, JWTAlgorithmRS256)
+	edProvider := newStaticKeyProvider(t, JWTAlgorithmEdDSA)
+
+	legacyUtil := NewJWTUtil(secret, 24)
+	legacyToken, _ := legacyUtil.GenerateAccessToken("test-user-123", "test@example.com", "mahasiswa")
+
+	edUtil := NewJWTUtil(secret, 24)
+	edUtil.SetKeyProvider(edProvider, time.Time{})
+	edToken, _ := edUtil.GenerateAccessToken("test-user-123", "test@example.com", "mahasiswa")
+
+	// EdDSA token whose kid points to an RS256 key, must not be verified with the RSA key
+	mismatched := jwt.NewWithClaims(jwt.SigningMethodEdDSA, &Claims{UserID: "test-user-123", TokenType: "access"})
+	mismatched.Header["kid"] = rsaProvider.signing.KeyID
+	mismatchedToken, _ := mismatched.SignedString(edProvider.signing.PrivateKey)
+
+	// HS256 token signed with the RSA public key as secret (alg confusion)
+	rsaPublicKey := rsaProvider.signing.PrivateKey.Public().(*rsa.PublicKey)
+	confused := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{UserID: "test-user-123", TokenType: "access"})
+	confused.Header["kid"] = rsaProvider.signing.KeyID
+	confusedToken, _ := confused.SignedString(rsaPublicKey.N.Bytes())
+
+	switchover := time.Now()
+
+	tests := []struct {
+		name       string
+		token      string
+		switchover time.Time
+		wantErr    bool
+	}{
+		{name: "legacy HS256 accepted during transition", token: legacyToken, switchover: switchover, wantErr: false},
+		{name: "legacy HS256 rejected when not accepted", token: legacyToken, wantErr: true},
+		{name: "legacy HS256 rejected one access token lifetime after switch", token: legacyToken, switchover: switchover.Add(-AccessTokenLifetime - time.Minute), wantErr: true},
+		{name: "HS256 issued after switch", token: legacyToken, switchover: switchover.Add(-time.Minute), wantErr: true},
+		{name: "unknown kid", token: edToken, wantErr: true},
+		{name: "algorithm does not match key", token: mismatchedToken, wantErr: true},
+		{name: "public key used as HMAC secret", token: confusedToken, switchover: switchover, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jwtUtil := NewJWTUtil(secret, 24)
+			jwtUtil.SetKeyProvider(rsaProvider, tt.switchover)
+
+			_, err := jwtUtil.ValidateAccessToken(tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestNewJWK(t *testing.T) {
+	for _, algorithm := range []string{JWTAlgorithmRS256, JWTAlgorithmEdDSA} {
+		provider := newStaticKeyProvider(t, algorithm)
+
+		jwk, err := NewJWK(*provider.keys[provider.signing.KeyID])
+		if err != nil {
+			t.Fatalf("Failed to convert %s key: %v", algorithm, err)
+		}
+
+		if jwk.Kid != provider.signing.KeyID || jwk.Alg != algorithm || jwk.Use != "sig" {
+			t.Errorf("Unexpected JWK metadata: %+v", jwk)
+		}
+
+		switch algorithm {
+		case JWTAlgorithmRS256:
+			if jwk.Kty != "RSA" || jwk.N == "" || jwk.E != "AQAB" {
+				t.Errorf("Unexpected RSA JWK: %+v", jwk)
+			}
+		case JWTAlgorithmEdDSA:
+			if jwk.Kty != "OKP" || jwk.Crv != "Ed25519" || jwk.X == "" {
+				t.Errorf("Unexpected Ed25519 JWK: %+v", jwk)
+			}
+		}
+	}
+}
@@ -1,7 +1,11 @@
 package utils
 
 import (
+	"errors"
 	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
 )
 
 func TestGenerateToken(t *testing.T) {
@@ -48,3 +52,221 @@ func TestValidateToken(t *testing.T) {
 		t.Errorf("Expected role %s, got %s", role, claims.Role)
 	}
 }
+
+func TestGenerateRefreshTokenIsUnique(t *testing.T) {
+	jwtUtil := NewJWTUtil("test-secret-key-that-is-long-enough-for-testing", 24)
+
+	// Tokens issued within the same second must still differ, otherwise rotation reuses hashes
+	first, err := jwtUtil.GenerateRefreshToken("test-user-123", "test@example.com", "mahasiswa")
+	if err != nil {
+		t.Fatalf("Failed to generate refresh token: %v", err)
+	}
+	second, err := jwtUtil.GenerateRefreshToken("test-user-123", "test@example.com", "mahasiswa")
+	if err != nil {
+		t.Fatalf("Failed to generate refresh token: %v", err)
+	}
+
+	if first == second {
+		t.Error("Expected refresh tokens to be unique")
+	}
+	if HashToken(first) == HashToken(second) {
+		t.Error("Expected refresh token hashes to be unique")
+	}
+}
+
+func TestValidateTokenRejections(t *testing.T) {
+	const secret = "test-secret-key-that-is-long-enough-for-testing"
+	jwtUtil := NewJWTUtil(secret, 24)
+
+	now := time.Now()
+	baseClaims := func() *Claims {
+		return &Claims{
+			UserID:    "test-user-123",
+			Email:     "test@example.com",
+			Role:      "mahasiswa",
+			TokenType: TokenTypeAccess,
+			RegisteredClaims: jwt.RegisteredClaims{
+				ExpiresAt: jwt.NewNumericDate(now.Add(15 * time.Minute)),
+				IssuedAt:  jwt.NewNumericDate(now),
+				Issuer:    DefaultJWTIssuer,
+				Audience:  jwt.ClaimStrings{DefaultJWTAudience},
+				Subject:   "test-user-123",
+			},
+		}
+	}
+	sign := func(method jwt.SigningMethod, key interface{}, modify func(*Claims)) string {
+		claims := baseClaims()
+		if modify != nil {
+			modify(claims)
+		}
+		token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+		if err != nil {
+			t.Fatalf("Failed to sign test token: %v", err)
+		}
+		return token
+	}
+
+	refreshToken, _ := jwtUtil.GenerateRefreshToken("test-user-123", "test@example.com", "mahasiswa")
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{name: "valid token", token: sign(jwt.SigningMethodHS256, []byte(secret), nil), wantErr: false},
+		{name: "malformed token", token: "not-a-jwt", wantErr: true},
+		{name: "wrong signature", token: sign(jwt.SigningMethodHS256, []byte("another-secret"), nil), wantErr: true},
+		{name: "alg none", token: sign(jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, nil), wantErr: true},
+		{name: "alg not whitelisted", token: sign(jwt.SigningMethodHS512, []byte(secret), nil), wantErr: true},
+		{name: "refresh token used as access token", token: refreshToken, wantErr: true},
+		{name: "missing token type", token: sign(jwt.SigningMethodHS256, []byte(secret), func(c *Claims) { c.TokenType = "" }), wantErr: true},
+		{name: "wrong issuer", token: sign(jwt.SigningMethodHS256, []byte(secret), func(c *Claims) { c.Issuer = "other-service" }), wantErr: true},
+		{name: "wrong audience", token: sign(jwt.SigningMethodHS256, []byte(secret), func(c *Claims) { c.Audience = jwt.ClaimStrings{"other-service"} }), wantErr: true},
+		{name: "missing audience", token: sign(jwt.SigningMethodHS256, []byte(secret), func(c *Claims) { c.Audience = nil }), wantErr: true},
+		{name: "missing expiry", token: sign(jwt.SigningMethodHS256, []byte(secret), func(c *Claims) { c.ExpiresAt = nil }), wantErr: true},
+		{name: "expired beyond clock skew", token: sign(jwt.SigningMethodHS256, []byte(secret), func(c *Claims) {
+			c.ExpiresAt = jwt.NewNumericDate(now.Add(-DefaultJWTClockSkew - time.Minute))
+		}), wantErr: true},
+		{name: "expired within clock skew", token: sign(jwt.SigningMethodHS256, []byte(secret), func(c *Claims) {
+			c.ExpiresAt = jwt.NewNumericDate(now.Add(-DefaultJWTClockSkew / 2))
+		}), wantErr: false},
+		{name: "issued in the future beyond clock skew", token: sign(jwt.SigningMethodHS256, []byte(secret), func(c *Claims) {
+			c.IssuedAt = jwt.NewNumericDate(now.Add(DefaultJWTClockSkew + time.Minute))
+		}), wantErr: true},
+		{name: "not valid yet beyond clock skew", token: sign(jwt.SigningMethodHS256, []byte(secret), func(c *Claims) {
+			c.NotBefore = jwt.NewNumericDate(now.Add(DefaultJWTClockSkew + time.Minute))
+		}), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := jwtUtil.ValidateAccessToken(tt.token)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestValidateRefreshTokenRejectsAccessToken(t *testing.T) {
+	jwtUtil := NewJWTUtil("test-secret-key-that-is-long-enough-for-testing", 24)
+
+	accessToken, _ := jwtUtil.GenerateAccessToken("test-user-123", "test@example.com", "mahasiswa")
+	if _, err := jwtUtil.ValidateRefreshToken(accessToken); err == nil {
+		t.Error("Expected access token to be rejected as refresh token")
+	}
+}
+
+func TestSetValidationIssuerAudience(t *testing.T) {
+	issuer := NewJWTUtil("test-secret-key-that-is-long-enough-for-testing", 24)
+	issuer.SetValidation("campus-sso", "prestasi-api", DefaultJWTClockSkew)
+
+	token, _ := issuer.GenerateAccessToken("test-user-123", "test@example.com", "mahasiswa")
+	if _, err := issuer.ValidateAccessToken(token); err != nil {
+		t.Fatalf("Expected token to be valid with configured issuer/audience: %v", err)
+	}
+
+	// Default verifier expects a different issuer and audience
+	verifier := NewJWTUtil("test-secret-key-that-is-long-enough-for-testing", 24)
+	if _, err := verifier.ValidateAccessToken(token); err == nil {
+		t.Error("Expected token from another issuer/audience to be rejected")
+	}
+}
+
+func TestGenerateImpersonationToken(t *testing.T) {
+	jwtUtil := NewJWTUtil("test-secret-key-that-is-long-enough-for-testing", 24)
+
+	token, err := jwtUtil.GenerateImpersonationToken("test-user-123", "test@example.com", "mahasiswa",
+		ActorClaims{Subject: "admin-1", Email: "admin@example.com"}, 10*time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to generate impersonation token: %v", err)
+	}
+
+	claims, err := jwtUtil.ValidateAccessToken(token)
+	if err != nil {
+		t.Fatalf("Expected impersonation token to be a valid access token: %v", err)
+	}
+	if !claims.IsImpersonated() || claims.Actor.Subject != "admin-1" || claims.Actor.Email != "admin@example.com" {
+		t.Errorf("Expected act claim of admin-1, got %+v", claims.Actor)
+	}
+	if claims.UserID != "test-user-123" {
+		t.Errorf("Expected subject user test-user-123, got %s", claims.UserID)
+	}
+	if lifetime := claims.ExpiresAt.Sub(claims.IssuedAt.Time); lifetime != 10*time.Minute {
+		t.Errorf("Expected 10 minute lifetime, got %v", lifetime)
+	}
+
+	// Regular access tokens carry no actor
+	accessToken, _ := jwtUtil.GenerateAccessToken("test-user-123", "test@example.com", "mahasiswa")
+	claims, _ = jwtUtil.ValidateAccessToken(accessToken)
+	if claims.IsImpersonated() {
+		t.Error("Expected regular access token not to be impersonated")
+	}
+
+	if _, err := jwtUtil.GenerateImpersonationToken("test-user-123", "test@example.com", "mahasiswa", ActorClaims{}, time.Minute); err == nil {
+		t.Error("Expected impersonation token without actor to be rejected")
+	}
+}
+
+func TestGenerateSessionTokenPair(t *testing.T) {
+	jwtUtil := NewJWTUtil("test-secret-key-that-is-long-enough-for-testing", 24)
+
+	tokenPair, err := jwtUtil.GenerateSessionTokenPair("test-user-123", "test@example.com", "mahasiswa", "session-1")
+	if err != nil {
+		t.Fatalf("Failed to generate token pair: %v", err)
+	}
+
+	claims, err := jwtUtil.ValidateAccessToken(tokenPair.AccessToken)
+	if err != nil {
+		t.Fatalf("Expected access token to be valid: %v", err)
+	}
+	if claims.SessionID != "session-1" {
+		t.Errorf("Expected sid session-1, got %q", claims.SessionID)
+	}
+	if claims.ID != tokenPair.AccessTokenID || !claims.ExpiresAt.Time.Equal(tokenPair.AccessTokenExpiresAt) {
+		t.Error("Expected token pair to report the access token jti and expiry")
+	}
+}
+
+type stubGenerations map[string]int
+
+func (s stubGenerations) TokenGeneration(userID string) (int, error) {
+	if userID == "broken-user" {
+		return 0, errors.New("database unavailable")
+	}
+	return s[userID], nil
+}
+
+func TestAccessTokenCarriesTokenGeneration(t *testing.T) {
+	jwtUtil := NewJWTUtil("test-secret-key-that-is-long-enough-for-testing", 24)
+	jwtUtil.SetTokenGenerations(stubGenerations{"test-user-123": 3, "admin-1": 5})
+
+	tokenPair, err := jwtUtil.GenerateSessionTokenPair("test-user-123", "test@example.com", "mahasiswa", "session-1")
+	if err != nil {
+		t.Fatalf("Failed to generate token pair: %v", err)
+	}
+	claims, err := jwtUtil.ValidateAccessToken(tokenPair.AccessToken)
+	if err != nil {
+		t.Fatalf("Failed to validate token: %v", err)
+	}
+	if claims.Generation != 3 {
+		t.Errorf("Expected gen 3, got %d", claims.Generation)
+	}
+
+	token, err := jwtUtil.GenerateImpersonationToken("test-user-123", "test@example.com", "mahasiswa",
+		ActorClaims{Subject: "admin-1", Email: "admin@example.com"}, time.Minute)
+	if err != nil {
+		t.Fatalf("Failed to generate impersonation token: %v", err)
+	}
+	claims, err = jwtUtil.ValidateAccessToken(token)
+	if err != nil {
+		t.Fatalf("Failed to validate impersonation token: %v", err)
+	}
+	if claims.Generation != 3 || claims.Actor.Generation != 5 {
+		t.Errorf("Expected gen 3 and actor gen 5, got %d and %d", claims.Generation, claims.Actor.Generation)
+	}
+
+	if _, err := jwtUtil.GenerateAccessToken("broken-user", "broken@example.com", "mahasiswa"); err == nil {
+		t.Error("Expected no token when the generation can't be read")
+	}
+}
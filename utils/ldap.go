@@ -0,0 +1,148 @@
+package utils
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+var (
+	ErrLDAPUserNotFound       = errors.New("user not found in directory")
+	ErrLDAPInvalidCredentials = errors.New("invalid directory credentials")
+)
+
+// LDAPEntry is a directory user found by LDAPClient.Authenticate
+type LDAPEntry struct {
+	DN         string
+	Attributes map[string][]string // keys are lower case, attribute names are case-insensitive in LDAP
+}
+
+// Values returns all values of an attribute
+func (e *LDAPEntry) Values(name string) []string {
+	return e.Attributes[strings.ToLower(name)]
+}
+
+// Get returns the first value of an attribute or an empty string
+func (e *LDAPEntry) Get(name string) string {
+	if values := e.Values(name); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// LDAPClient authenticates users against an LDAP or Active Directory server with search then bind:
+// the service account searches the user by login, then the user's DN is bound with the given password
+type LDAPClient struct {
+	URL          string // ldap://host:389 or ldaps://host:636
+	BindDN       string // service account, empty searches anonymously
+	BindPassword string
+	BaseDN       string
+	UserFilter   string   // {login} is replaced by the escaped login, e.g. (&(objectClass=person)(mail={login}))
+	Attributes   []string // attributes returned for the user, empty returns all user attributes
+	StartTLS     bool
+	TLSConfig    *tls.Config
+	Timeout      time.Duration
+}
+
+func NewLDAPClient(url, bindDN, bindPassword, baseDN, userFilter string) *LDAPClient {
+	if userFilter == "" {
+		userFilter = "(mail={login})"
+	}
+
+	return &LDAPClient{
+		URL:          url,
+		BindDN:       bindDN,
+		BindPassword: bindPassword,
+		BaseDN:       baseDN,
+		UserFilter:   userFilter,
+		Timeout:      5 * time.Second,
+	}
+}
+
+// Authenticate looks up login and verifies password with a bind as that user
+func (c *LDAPClient) Authenticate(login, password string) (*LDAPEntry, error) {
+	// An empty password would be an unauthenticated bind, which most servers accept
+	if login == "" || password == "" {
+		return nil, ErrLDAPInvalidCredentials
+	}
+
+	conn, err := c.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if c.BindDN != "" {
+		if err := conn.Bind(c.BindDN, c.BindPassword); err != nil {
+			return nil, fmt.Errorf("LDAP service bind failed: %w", err)
+		}
+	}
+
+	filter := strings.ReplaceAll(c.UserFilter, "{login}", ldap.EscapeFilter(login))
+	result, err := conn.Search(ldap.NewSearchRequest(
+		c.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		2, int(c.Timeout.Seconds()), false,
+		filter, c.Attributes, nil,
+	))
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return nil, fmt.Errorf("LDAP search failed: %w", err)
+	}
+
+	if result == nil || len(result.Entries) == 0 {
+		return nil, ErrLDAPUserNotFound
+	}
+	// A login matching several entries is a filter misconfiguration, never guess which one is meant
+	if len(result.Entries) > 1 {
+		return nil, fmt.Errorf("LDAP search for %q returned more than one entry", login)
+	}
+
+	found := result.Entries[0]
+	if err := conn.Bind(found.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrLDAPInvalidCredentials
+		}
+		return nil, fmt.Errorf("LDAP user bind failed: %w", err)
+	}
+
+	entry := &LDAPEntry{DN: found.DN, Attributes: make(map[string][]string)}
+	for _, attribute := range found.Attributes {
+		name := strings.ToLower(attribute.Name)
+		entry.Attributes[name] = append(entry.Attributes[name], attribute.Values...)
+	}
+
+	return entry, nil
+}
+
+func (c *LDAPClient) dial() (*ldap.Conn, error) {
+	tlsConfig := c.TLSConfig
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+		if parsed, err := url.Parse(c.URL); err == nil {
+			tlsConfig.ServerName = parsed.Hostname()
+		}
+	}
+
+	conn, err := ldap.DialURL(c.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: c.Timeout}),
+		ldap.DialWithTLSConfig(tlsConfig),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to LDAP server: %w", err)
+	}
+	conn.SetTimeout(c.Timeout)
+
+	if c.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("LDAP StartTLS failed: %w", err)
+		}
+	}
+
+	return conn, nil
+}
@@ -0,0 +1,231 @@
+package utils
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// ldapStandIn is a minimal in-process LDAP server: simple bind, subtree search with
+// and/or/not/equality/present filters, and unbind. Enough for search-then-bind logins.
+type ldapStandIn struct {
+	listener  net.Listener
+	entries   map[string]map[string][]string // DN -> lower case attribute name -> values
+	passwords map[string]string              // DN -> password
+}
+
+func newLDAPStandIn(t *testing.T) *ldapStandIn {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	s := &ldapStandIn{
+		listener: listener,
+		entries: map[string]map[string][]string{
+			"cn=service,dc=unair,dc=ac,dc=id": {"objectclass": {"person"}, "uid": {"service"}},
+			"uid=budi,ou=people,dc=unair,dc=ac,dc=id": {
+				"objectclass": {"person"},
+				"uid":         {"budi"},
+				"mail":        {"budi@unair.ac.id"},
+				"cn":          {"Budi Santoso"},
+				"memberof":    {"cn=students,ou=groups,dc=unair,dc=ac,dc=id", "cn=bem,ou=groups,dc=unair,dc=ac,dc=id"},
+			},
+			"uid=dup1,ou=people,dc=unair,dc=ac,dc=id": {"objectclass": {"person"}, "mail": {"shared@unair.ac.id"}},
+			"uid=dup2,ou=people,dc=unair,dc=ac,dc=id": {"objectclass": {"person"}, "mail": {"shared@unair.ac.id"}},
+		},
+		passwords: map[string]string{
+			"cn=service,dc=unair,dc=ac,dc=id":         "service-secret",
+			"uid=budi,ou=people,dc=unair,dc=ac,dc=id": "budi-secret",
+		},
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { listener.Close() })
+
+	return s
+}
+
+func (s *ldapStandIn) URL() string {
+	return "ldap://" + s.listener.Addr().String()
+}
+
+func (s *ldapStandIn) serve(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		messageID := packet.Children[0].Value
+		op := packet.Children[1]
+
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			name := op.Children[1].Data.String()
+			password := op.Children[2].Data.String()
+			code := ldap.LDAPResultInvalidCredentials
+			if expected, ok := s.passwords[name]; ok && password != "" && password == expected {
+				code = ldap.LDAPResultSuccess
+			}
+			conn.Write(ldapResult(messageID, ldap.ApplicationBindResponse, code).Bytes())
+		case ldap.ApplicationSearchRequest:
+			baseDN := strings.ToLower(op.Children[0].Data.String())
+			filter := op.Children[6]
+			for dn, attributes := range s.entries {
+				if strings.HasSuffix(strings.ToLower(dn), baseDN) && matchLDAPFilter(filter, attributes) {
+					conn.Write(ldapSearchEntry(messageID, dn, attributes).Bytes())
+				}
+			}
+			conn.Write(ldapResult(messageID, ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess).Bytes())
+		default:
+			return
+		}
+	}
+}
+
+func ldapEnvelope(messageID interface{}, op *ber.Packet) *ber.Packet {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "Message ID"))
+	packet.AppendChild(op)
+	return packet
+}
+
+func ldapResult(messageID interface{}, tag ber.Tag, code int) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Result")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "Result Code"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Diagnostic Message"))
+	return ldapEnvelope(messageID, op)
+}
+
+func ldapSearchEntry(messageID interface{}, dn string, attributes map[string][]string) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, dn, "Object Name"))
+
+	list := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+	for name, values := range attributes {
+		attribute := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+		attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		for _, value := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "Value"))
+		}
+		attribute.AppendChild(set)
+		list.AppendChild(attribute)
+	}
+	op.AppendChild(list)
+
+	return ldapEnvelope(messageID, op)
+}
+
+func matchLDAPFilter(filter *ber.Packet, attributes map[string][]string) bool {
+	switch filter.Tag {
+	case ldap.FilterAnd:
+		for _, child := range filter.Children {
+			if !matchLDAPFilter(child, attributes) {
+				return false
+			}
+		}
+		return true
+	case ldap.FilterOr:
+		for _, child := range filter.Children {
+			if matchLDAPFilter(child, attributes) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterNot:
+		return !matchLDAPFilter(filter.Children[0], attributes)
+	case ldap.FilterPresent:
+		return len(attributes[strings.ToLower(filter.Data.String())]) > 0
+	case ldap.FilterEqualityMatch:
+		name := strings.ToLower(filter.Children[0].Data.String())
+		for _, value := range attributes[name] {
+			if strings.EqualFold(value, filter.Children[1].Data.String()) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func newStandInClient(s *ldapStandIn) *LDAPClient {
+	return NewLDAPClient(s.URL(), "cn=service,dc=unair,dc=ac,dc=id", "service-secret",
+		"ou=people,dc=unair,dc=ac,dc=id", "(&(objectClass=person)(|(uid={login})(mail={login})))")
+}
+
+func TestLDAPAuthenticate(t *testing.T) {
+	client := newStandInClient(newLDAPStandIn(t))
+
+	entry, err := client.Authenticate("budi@unair.ac.id", "budi-secret")
+	if err != nil {
+		t.Fatalf("Failed to authenticate: %v", err)
+	}
+	if entry.DN != "uid=budi,ou=people,dc=unair,dc=ac,dc=id" || entry.Get("CN") != "Budi Santoso" {
+		t.Errorf("Unexpected entry: %+v", entry)
+	}
+	if len(entry.Values("memberOf")) != 2 {
+		t.Errorf("Expected both group memberships, got %v", entry.Values("memberOf"))
+	}
+
+	// The uid works as login too
+	if _, err := client.Authenticate("budi", "budi-secret"); err != nil {
+		t.Errorf("Failed to authenticate by uid: %v", err)
+	}
+}
+
+func TestLDAPAuthenticateRejectsInvalidLogins(t *testing.T) {
+	client := newStandInClient(newLDAPStandIn(t))
+
+	tests := []struct {
+		name     string
+		login    string
+		password string
+		want     error
+	}{
+		{"wrong password", "budi", "wrong", ErrLDAPInvalidCredentials},
+		{"empty password", "budi", "", ErrLDAPInvalidCredentials},
+		{"unknown user", "siti", "budi-secret", ErrLDAPUserNotFound},
+		{"filter injection", "*", "budi-secret", ErrLDAPUserNotFound},
+		{"outside base DN", "service", "service-secret", ErrLDAPUserNotFound},
+	}
+
+	for _, tt := range tests {
+		if _, err := client.Authenticate(tt.login, tt.password); !errors.Is(err, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, err)
+		}
+	}
+
+	// Several matching entries are a configuration error, not a login failure
+	_, err := client.Authenticate("shared@unair.ac.id", "anything")
+	if err == nil || errors.Is(err, ErrLDAPUserNotFound) || errors.Is(err, ErrLDAPInvalidCredentials) {
+		t.Errorf("Expected ambiguous search error, got %v", err)
+	}
+}
+
+func TestLDAPAuthenticateServiceBindFailure(t *testing.T) {
+	server := newLDAPStandIn(t)
+	client := newStandInClient(server)
+	client.BindPassword = "wrong"
+
+	_, err := client.Authenticate("budi", "budi-secret")
+	if err == nil || errors.Is(err, ErrLDAPInvalidCredentials) {
+		t.Errorf("Expected service bind error, got %v", err)
+	}
+}
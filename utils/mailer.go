@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/smtp"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Supported mail drivers
+const (
+	MailDriverLog  = "log"
+	MailDriverSMTP = "smtp"
+)
+
+// EmailMessage is a plain text email
+type EmailMessage struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers emails, services depend on this interface so the driver can be swapped
+type Mailer interface {
+	Send(message EmailMessage) error
+}
+
+// LogMailer prints emails instead of sending them, for development. Link tokens are redacted,
+// stdout usually ends up in log storage where anyone reading it could use them.
+type LogMailer struct{}
+
+// linkTokenPattern matches token query parameters of links in email bodies
+var linkTokenPattern = regexp.MustCompile(`([?&]token=)[^\s&#]+`)
+
+func (LogMailer) Send(message EmailMessage) error {
+	fmt.Printf("MAIL to=%s subject=%q\n%s\n", message.To, message.Subject, RedactLinkTokens(message.Body))
+	return nil
+}
+
+// RedactLinkTokens replaces the value of token query parameters in text
+func RedactLinkTokens(text string) string {
+	return linkTokenPattern.ReplaceAllString(text, "${1}[REDACTED]")
+}
+
+// SMTPMailer sends emails through an SMTP server, using STARTTLS when the server offers it
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string // empty disables authentication
+	Password string
+	From     string
+}
+
+func NewSMTPMailer(host, port, username, password, from string) *SMTPMailer {
+	return &SMTPMailer{
+		Host:     host,
+		Port:     port,
+		Username: username,
+		Password: password,
+		From:     from,
+	}
+}
+
+// NewMailer returns the mailer for a driver name
+func NewMailer(driver, host, port, username, password, from string) (Mailer, error) {
+	switch driver {
+	case MailDriverLog, "":
+		return LogMailer{}, nil
+	case MailDriverSMTP:
+		return NewSMTPMailer(host, port, username, password, from), nil
+	default:
+		return nil, fmt.Errorf("unsupported mail driver: %s", driver)
+	}
+}
+
+func (m *SMTPMailer) Send(message EmailMessage) error {
+	if strings.ContainsAny(message.To, "\r\n") || strings.ContainsAny(message.Subject, "\r\n") {
+		return errors.New("invalid email header")
+	}
+
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	return smtp.SendMail(net.JoinHostPort(m.Host, m.Port), auth, m.From, []string{message.To}, m.buildMessage(message))
+}
+
+func (m *SMTPMailer) buildMessage(message EmailMessage) []byte {
+	var builder strings.Builder
+	builder.WriteString("From: " + m.From + "\r\n")
+	builder.WriteString("To: " + message.To + "\r\n")
+	builder.WriteString("Subject: " + message.Subject + "\r\n")
+	builder.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	builder.WriteString("MIME-Version: 1.0\r\n")
+	builder.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	builder.WriteString("\r\n")
+	builder.WriteString(strings.ReplaceAll(strings.ReplaceAll(message.Body, "\r\n", "\n"), "\n", "\r\n"))
+	return []byte(builder.String())
+}
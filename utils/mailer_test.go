@@ -0,0 +1,151 @@
+package utils
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+)
+
+// fakeSMTPServer accepts a single SMTP session and records the envelope and data
+type fakeSMTPServer struct {
+	listener   net.Listener
+	from       string
+	recipients []string
+	data       string
+	done       chan struct{}
+}
+
+func startFakeSMTPServer(t *testing.T) *fakeSMTPServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to start fake SMTP server: %v", err)
+	}
+
+	server := &fakeSMTPServer{listener: listener, done: make(chan struct{})}
+	go server.serve()
+	t.Cleanup(func() { listener.Close() })
+
+	return server
+}
+
+func (s *fakeSMTPServer) serve() {
+	defer close(s.done)
+
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+	reply("220 localhost fake SMTP")
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command := strings.TrimRight(line, "\r\n")
+		upper := strings.ToUpper(command)
+
+		switch {
+		case strings.HasPrefix(upper, "EHLO"), strings.HasPrefix(upper, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(upper, "MAIL FROM:"):
+			s.from = strings.Trim(command[len("MAIL FROM:"):], "<> ")
+			reply("250 OK")
+		case strings.HasPrefix(upper, "RCPT TO:"):
+			s.recipients = append(s.recipients, strings.Trim(command[len("RCPT TO:"):], "<> "))
+			reply("250 OK")
+		case upper == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				dataLine, err := reader.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if dataLine == ".\r\n" {
+					break
+				}
+				data.WriteString(dataLine)
+			}
+			s.data = data.String()
+			reply("250 OK")
+		case upper == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func TestSMTPMailerSend(t *testing.T) {
+	server := startFakeSMTPServer(t)
+	host, port, _ := net.SplitHostPort(server.listener.Addr().String())
+
+	mailer := NewSMTPMailer(host, port, "", "", "noreply@prestasi.test")
+	err := mailer.Send(EmailMessage{
+		To:      "student@prestasi.test",
+		Subject: "Reset password",
+		Body:    "Line one\nLine two",
+	})
+	if err != nil {
+		t.Fatalf("Failed to send email: %v", err)
+	}
+	<-server.done
+
+	if server.from != "noreply@prestasi.test" {
+		t.Errorf("Expected sender noreply@prestasi.test, got %s", server.from)
+	}
+	if len(server.recipients) != 1 || server.recipients[0] != "student@prestasi.test" {
+		t.Errorf("Expected single recipient student@prestasi.test, got %v", server.recipients)
+	}
+	if !strings.Contains(server.data, "Subject: Reset password\r\n") {
+		t.Errorf("Expected subject header in message, got %q", server.data)
+	}
+	if !strings.Contains(server.data, "Line one\r\nLine two") {
+		t.Errorf("Expected body with CRLF line endings, got %q", server.data)
+	}
+}
+
+func TestSMTPMailerRejectsHeaderInjection(t *testing.T) {
+	mailer := NewSMTPMailer("127.0.0.1", "25", "", "", "noreply@prestasi.test")
+
+	err := mailer.Send(EmailMessage{To: "a@prestasi.test\r\nBcc: b@prestasi.test", Subject: "x", Body: "x"})
+	if err == nil {
+		t.Error("Expected error for recipient containing line breaks")
+	}
+}
+
+func TestNewMailerDrivers(t *testing.T) {
+	if mailer, err := NewMailer(MailDriverLog, "", "", "", "", ""); err != nil || mailer == nil {
+		t.Errorf("Expected log mailer, got %v, %v", mailer, err)
+	}
+	if _, err := NewMailer(MailDriverSMTP, "localhost", "25", "", "", "a@b.c"); err != nil {
+		t.Errorf("Expected smtp mailer, got error %v", err)
+	}
+	if _, err := NewMailer("carrier-pigeon", "", "", "", "", ""); err == nil {
+		t.Error("Expected error for unsupported driver")
+	}
+}
+
+func TestRedactLinkTokens(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Buka http://localhost:3000/reset-password?token=abc123 sekarang", "Buka http://localhost:3000/reset-password?token=[REDACTED] sekarang"},
+		{"http://localhost:3000/#/verify?lang=id&token=a%2Bb#top", "http://localhost:3000/#/verify?lang=id&token=[REDACTED]#top"},
+		{"Halo Budi,\n\nTidak ada tautan.", "Halo Budi,\n\nTidak ada tautan."},
+	}
+
+	for _, tt := range tests {
+		if got := RedactLinkTokens(tt.text); got != tt.want {
+			t.Errorf("RedactLinkTokens(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// mockIdP is a minimal OpenID provider: discovery, JWKS and a token endpoint that
+// checks the PKCE verifier of the single code it issued
+type mockIdP struct {
+	server        *httptest.Server
+	key           *rsa.PrivateKey
+	kid           string
+	code          string
+	codeChallenge string
+	claims        jwt.MapClaims
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	idp := &mockIdP{key: key, kid: "mock-key-1", code: "mock-code"}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		jwk, _ := NewJWK(JWTVerificationKey{KeyID: idp.kid, Algorithm: JWTAlgorithmRS256, PublicKey: &key.PublicKey})
+		json.NewEncoder(w).Encode(JWKSet{Keys: []JWK{jwk}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("code") != idp.code || PKCEChallenge(r.Form.Get("code_verifier")) != idp.codeChallenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": idp.sign(t, idp.claims), "token_type": "Bearer"})
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+
+	return idp
+}
+
+func (idp *mockIdP) sign(t *testing.T, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = idp.kid
+	signed, err := token.SignedString(idp.key)
+	if err != nil {
+		t.Fatalf("Failed to sign ID token: %v", err)
+	}
+	return signed
+}
+
+func (idp *mockIdP) validClaims(nonce string) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":            idp.server.URL,
+		"aud":            "prestasi",
+		"sub":            "user-123",
+		"email":          "mahasiswa@unair.ac.id",
+		"email_verified": true,
+		"nim":            "187221001",
+		"nonce":          nonce,
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(5 * time.Minute).Unix(),
+	}
+}
+
+func TestOIDCAuthorizationCodeFlowWithPKCE(t *testing.T) {
+	idp := newMockIdP(t)
+	provider := NewOIDCProvider(idp.server.URL, "prestasi", "secret", "http://localhost:8080/api/v1/auth/oidc/callback", nil)
+
+	verifier, err := GeneratePKCEVerifier()
+	if err != nil {
+		t.Fatalf("Failed to generate verifier: %v", err)
+	}
+
+	authURL, err := provider.AuthCodeURL("state-1", "nonce-1", PKCEChallenge(verifier))
+	if err != nil {
+		t.Fatalf("Failed to build authorization URL: %v", err)
+	}
+
+	parsed, _ := url.Parse(authURL)
+	query := parsed.Query()
+	if !strings.HasPrefix(authURL, idp.server.URL+"/authorize?") {
+		t.Errorf("Unexpected authorization endpoint: %s", authURL)
+	}
+	if query.Get("code_challenge_method") != "S256" || query.Get("state") != "state-1" || query.Get("nonce") != "nonce-1" {
+		t.Errorf("Unexpected authorization parameters: %s", parsed.RawQuery)
+	}
+
+	// The IdP remembers the challenge of the authorization request
+	idp.codeChallenge = query.Get("code_challenge")
+	idp.claims = idp.validClaims("nonce-1")
+
+	if _, err := provider.Exchange(idp.code, "wrong-verifier"); err == nil {
+		t.Error("Expected exchange with the wrong PKCE verifier to fail")
+	}
+
+	rawIDToken, err := provider.Exchange(idp.code, verifier)
+	if err != nil {
+		t.Fatalf("Failed to exchange code: %v", err)
+	}
+
+	claims, err := provider.VerifyIDToken(rawIDToken, "nonce-1")
+	if err != nil {
+		t.Fatalf("Failed to verify ID token: %v", err)
+	}
+	if claims["email"] != "mahasiswa@unair.ac.id" || claims["nim"] != "187221001" {
+		t.Errorf("Unexpected claims: %v", claims)
+	}
+
+	if _, err := provider.VerifyIDToken(rawIDToken, "other-nonce"); err == nil {
+		t.Error("Expected ID token with a different nonce to be rejected")
+	}
+}
+
+func TestOIDCVerifyIDTokenRejectsInvalidTokens(t *testing.T) {
+	idp := newMockIdP(t)
+	provider := NewOIDCProvider(idp.server.URL, "prestasi", "", "http://localhost/callback", nil)
+
+	tests := []struct {
+		name   string
+		modify func(jwt.MapClaims)
+	}{
+		{"wrong audience", func(c jwt.MapClaims) { c["aud"] = "other-client" }},
+		{"wrong issuer", func(c jwt.MapClaims) { c["iss"] = "https://evil.example" }},
+		{"expired", func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }},
+		{"missing nonce", func(c jwt.MapClaims) { delete(c, "nonce") }},
+		{"other authorized party", func(c jwt.MapClaims) { c["azp"] = "other-client" }},
+	}
+
+	for _, tt := range tests {
+		claims := idp.validClaims("nonce-1")
+		tt.modify(claims)
+		if _, err := provider.VerifyIDToken(idp.sign(t, claims), "nonce-1"); err == nil {
+			t.Errorf("%s: expected ID token to be rejected", tt.name)
+		}
+	}
+
+	// A token signed by another key with the same kid must fail the signature check
+	otherKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	forged := jwt.NewWithClaims(jwt.SigningMethodRS256, idp.validClaims("nonce-1"))
+	forged.Header["kid"] = idp.kid
+	signed, _ := forged.SignedString(otherKey)
+	if _, err := provider.VerifyIDToken(signed, "nonce-1"); err == nil {
+		t.Error("Expected forged ID token to be rejected")
+	}
+
+	// Symmetric algorithms are refused outright, which rules out algorithm confusion
+	confused := jwt.NewWithClaims(jwt.SigningMethodHS256, idp.validClaims("nonce-1"))
+	confused.Header["kid"] = idp.kid
+	signed, _ = confused.SignedString([]byte("secret"))
+	if _, err := provider.VerifyIDToken(signed, "nonce-1"); err == nil {
+		t.Error("Expected HS256 ID token to be rejected")
+	}
+}
+
+func TestOIDCDiscoveryIssuerMismatch(t *testing.T) {
+	idp := newMockIdP(t)
+	provider := NewOIDCProvider(idp.server.URL+"/realms/other", "prestasi", "", "http://localhost/callback", nil)
+
+	// Discovery is only read from the configured issuer, which this IdP does not serve
+	if _, err := provider.AuthCodeURL("state", "nonce", "challenge"); err == nil {
+		t.Error("Expected discovery for a different issuer to fail")
+	}
+}
+
+func TestPKCEVerifierAndChallenge(t *testing.T) {
+	verifier, err := GeneratePKCEVerifier()
+	if err != nil {
+		t.Fatalf("Failed to generate verifier: %v", err)
+	}
+
+	// RFC 7636 requires 43 to 128 unreserved characters
+	if len(verifier) < 43 || strings.ContainsAny(verifier, "+/=") {
+		t.Errorf("Unexpected verifier format: %q", verifier)
+	}
+
+	challenge := PKCEChallenge(verifier)
+	if len(challenge) != 43 || challenge == verifier || challenge != PKCEChallenge(verifier) {
+		t.Errorf("Unexpected S256 challenge: %q", challenge)
+	}
+}
@@ -0,0 +1,128 @@
+package utils
+
+import (
+	"encoding/base32"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 appendix B, SHA1 secret "12345678901234567890"
+func TestTOTPRFC6238Vectors(t *testing.T) {
+	key := []byte("12345678901234567890")
+
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+
+	for _, tt := range tests {
+		counter := uint64(tt.unix / 30)
+		if got := hotp(key, counter, 8); got != tt.want {
+			t.Errorf("hotp at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestGenerateAndValidateTOTPCode(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+	at := time.Unix(59, 0)
+
+	code, err := GenerateTOTPCode(secret, at)
+	if err != nil {
+		t.Fatalf("Failed to generate code: %v", err)
+	}
+	if code != "287082" {
+		t.Errorf("Expected 6 digit RFC vector 287082, got %s", code)
+	}
+
+	counter, ok := ValidateTOTPCode(secret, code, at)
+	if !ok || counter != 1 {
+		t.Errorf("Expected code to validate at counter 1, got %d, %v", counter, ok)
+	}
+
+	// One step of clock drift is tolerated, two are not
+	if _, ok := ValidateTOTPCode(secret, code, at.Add(TOTPPeriod)); !ok {
+		t.Error("Expected code from previous step to validate")
+	}
+	if _, ok := ValidateTOTPCode(secret, code, at.Add(2*TOTPPeriod)); ok {
+		t.Error("Expected code from two steps ago to be rejected")
+	}
+
+	if _, ok := ValidateTOTPCode(secret, "000000", at); ok {
+		t.Error("Expected wrong code to be rejected")
+	}
+	if _, ok := ValidateTOTPCode(secret, "28708", at); ok {
+		t.Error("Expected short code to be rejected")
+	}
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("Failed to generate secret: %v", err)
+	}
+	if len(secret) != 32 || strings.Contains(secret, "=") {
+		t.Errorf("Expected 32 base32 characters without padding, got %q", secret)
+	}
+
+	now := time.Now()
+	code, err := GenerateTOTPCode(secret, now)
+	if err != nil {
+		t.Fatalf("Failed to generate code: %v", err)
+	}
+	if _, ok := ValidateTOTPCode(secret, code, now); !ok {
+		t.Error("Expected generated code to validate")
+	}
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	uri := TOTPProvisioningURI("Prestasi Mahasiswa", "dosen@unair.ac.id", "JBSWY3DPEHPK3PXP")
+
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		t.Fatalf("Failed to parse URI: %v", err)
+	}
+	if parsed.Scheme != "otpauth" || parsed.Host != "totp" {
+		t.Errorf("Unexpected scheme or type: %s", uri)
+	}
+	if parsed.Path != "/Prestasi Mahasiswa:dosen@unair.ac.id" {
+		t.Errorf("Unexpected label: %s", parsed.Path)
+	}
+	if parsed.Query().Get("secret") != "JBSWY3DPEHPK3PXP" || parsed.Query().Get("issuer") != "Prestasi Mahasiswa" {
+		t.Errorf("Unexpected query: %s", parsed.RawQuery)
+	}
+}
+
+func TestSecretBoxRoundTrip(t *testing.T) {
+	box, err := NewSecretBox("test-key")
+	if err != nil {
+		t.Fatalf("Failed to create secret box: %v", err)
+	}
+
+	sealed, err := box.Seal("JBSWY3DPEHPK3PXP")
+	if err != nil {
+		t.Fatalf("Failed to seal: %v", err)
+	}
+	if strings.Contains(sealed, "JBSWY3DPEHPK3PXP") {
+		t.Error("Expected sealed value not to contain the plaintext")
+	}
+
+	opened, err := box.Open(sealed)
+	if err != nil || opened != "JBSWY3DPEHPK3PXP" {
+		t.Errorf("Expected round trip, got %q, %v", opened, err)
+	}
+
+	otherBox, _ := NewSecretBox("other-key")
+	if _, err := otherBox.Open(sealed); err == nil {
+		t.Error("Expected decryption with another key to fail")
+	}
+}
@@ -0,0 +1,75 @@
+package utils
+
+import "strings"
+
+// DeviceLabel describes a user agent as "Browser on OS", e.g. "Chrome on Windows", for session lists.
+// Versions are left out so a browser update doesn't look like a new device.
+func DeviceLabel(userAgent string) string {
+	userAgent = strings.TrimSpace(userAgent)
+	if userAgent == "" {
+		return "Unknown device"
+	}
+
+	browser := userAgentBrowser(userAgent)
+	os := userAgentOS(userAgent)
+	switch {
+	case browser != "" && os != "":
+		return browser + " on " + os
+	case browser != "":
+		return browser
+	case os != "":
+		return "Browser on " + os
+	}
+
+	// API clients such as curl/8.4.0 or PostmanRuntime/7.36.0, keep the product name
+	product := strings.Fields(userAgent)[0]
+	if slash := strings.Index(product, "/"); slash > 0 {
+		product = product[:slash]
+	}
+	if len(product) > 50 {
+		product = product[:50]
+	}
+	return product
+}
+
+// userAgentBrowser checks the most specific tokens first, Chrome user agents also contain
+// "Safari" and Edge/Opera ones also contain "Chrome"
+func userAgentBrowser(userAgent string) string {
+	browsers := []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"EdgA/", "Edge"},
+		{"OPR/", "Opera"},
+		{"SamsungBrowser/", "Samsung Internet"},
+		{"Firefox/", "Firefox"},
+		{"FxiOS/", "Firefox"},
+		{"CriOS/", "Chrome"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"PostmanRuntime/", "Postman"},
+	}
+	for _, browser := range browsers {
+		if strings.Contains(userAgent, browser.token) {
+			return browser.name
+		}
+	}
+	return ""
+}
+
+func userAgentOS(userAgent string) string {
+	systems := []struct{ token, name string }{
+		{"iPhone", "iPhone"},
+		{"iPad", "iPad"},
+		{"Android", "Android"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"Macintosh", "macOS"},
+		{"CrOS", "ChromeOS"},
+		{"Linux", "Linux"},
+	}
+	for _, system := range systems {
+		if strings.Contains(userAgent, system.token) {
+			return system.name
+		}
+	}
+	return ""
+}
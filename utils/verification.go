@@ -0,0 +1,24 @@
+package utils
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"strings"
+)
+
+// GenerateVerificationCode creates an unguessable, human-readable code (XXXX-XXXX-XXXX-XXXX)
+func GenerateVerificationCode() (string, error) {
+	bytes := make([]byte, 10) // 80 bits of entropy
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+
+	encoded := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(bytes)
+
+	var groups []string
+	for i := 0; i < len(encoded); i += 4 {
+		groups = append(groups, encoded[i:i+4])
+	}
+
+	return strings.Join(groups, "-"), nil
+}
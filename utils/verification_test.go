@@ -0,0 +1,27 @@
+package utils
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestGenerateVerificationCodeFormat(t *testing.T) {
+	code, err := GenerateVerificationCode()
+	if err != nil {
+		t.Fatalf("Failed to generate verification code: %v", err)
+	}
+
+	pattern := regexp.MustCompile(`^[A-Z2-7]{4}-[A-Z2-7]{4}-[A-Z2-7]{4}-[A-Z2-7]{4}$`)
+	if !pattern.MatchString(code) {
+		t.Errorf("Unexpected verification code format: %s", code)
+	}
+}
+
+func TestGenerateVerificationCodeUnique(t *testing.T) {
+	code1, _ := GenerateVerificationCode()
+	code2, _ := GenerateVerificationCode()
+
+	if code1 == code2 {
+		t.Error("Two verification codes should be different")
+	}
+}